@@ -0,0 +1,382 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+)
+
+// ErrAtlasFull is returned when an image does not fit into the free space of an atlas.
+var ErrAtlasFull = errors.New("atlas is full")
+
+// AtlasHeuristic selects the free rectangle that an image is placed in.
+type AtlasHeuristic uint8
+
+const (
+	// AtlasHeuristicBestShortSideFit places images where the shorter leftover side is smallest.
+	AtlasHeuristicBestShortSideFit AtlasHeuristic = 0
+
+	// AtlasHeuristicBestAreaFit places images in the smallest free rectangle they fit in.
+	AtlasHeuristicBestAreaFit AtlasHeuristic = 1
+
+	// AtlasHeuristicBottomLeft places images as close to the top left corner as possible,
+	// which keeps the used area compact for atlases that grow.
+	AtlasHeuristicBottomLeft AtlasHeuristic = 2
+)
+
+// AtlasOptions configures NewAtlas and PackAtlas.
+type AtlasOptions struct {
+	// Padding is the number of transparent pixels between neighboring images.
+	Padding int
+
+	// Extrude is the number of times the edge pixels of every image are repeated
+	// around it, so that filtering at the edges does not sample its neighbors.
+	Extrude int
+
+	// Heuristic selects where images are placed.
+	Heuristic AtlasHeuristic
+
+	// MaxSize is the largest width and height PackAtlas tries. The default is 4096.
+	MaxSize int
+}
+
+// UVRect is a rectangle in normalized texture coordinates, where (0, 0) is the
+// top left and (1, 1) the bottom right corner of the texture.
+type UVRect struct {
+	U0, V0, U1, V1 float32
+}
+
+// AtlasEntry describes where an image was placed in an atlas.
+type AtlasEntry struct {
+	// Bounds is the rectangle of the image in atlas pixels.
+	Bounds image.Rectangle
+
+	// Frame is Bounds grown by the extruded edge pixels. It is the rectangle
+	// written to the atlas.
+	Frame image.Rectangle
+
+	// UV is Bounds in normalized texture coordinates.
+	UV UVRect
+}
+
+// Region returns the region of the entry's frame, for use with Texture.ReplaceRegion
+// after an incremental insertion.
+func (e AtlasEntry) Region() Region {
+	return RegionMake2D(uint(e.Frame.Min.X), uint(e.Frame.Min.Y), uint(e.Frame.Dx()), uint(e.Frame.Dy()))
+}
+
+// Atlas packs images into a single texture image with the MaxRects algorithm.
+// Images can be added incrementally, which suits dynamic atlases such as glyph caches.
+//
+// Reference: https://github.com/juj/RectangleBinPack/blob/master/RectangleBinPack.pdf
+type Atlas struct {
+	// Image holds the pixels of the atlas.
+	Image *TextureImage
+
+	opts AtlasOptions
+	free []image.Rectangle
+}
+
+// NewAtlas returns an empty atlas of the given size in the uncompressed pixel format pf.
+func NewAtlas(pf PixelFormat, width, height int, optFns ...func(*AtlasOptions)) (*Atlas, error) {
+	opts := newAtlasOptions(optFns)
+
+	if opts.Padding < 0 || opts.Extrude < 0 {
+		return nil, fmt.Errorf("invalid padding %d or extrusion %d", opts.Padding, opts.Extrude)
+	}
+
+	if opts.Heuristic > AtlasHeuristicBottomLeft {
+		return nil, fmt.Errorf("unknown atlas heuristic %d", opts.Heuristic)
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid atlas size %dx%d", width, height)
+	}
+
+	img, err := NewTextureImage(pf, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	// The free space extends by the padding past the right and bottom edges, so that
+	// images at these edges do not need padding inside the atlas.
+	return &Atlas{
+		Image: img,
+		opts:  opts,
+		free:  []image.Rectangle{image.Rect(0, 0, width+opts.Padding, height+opts.Padding)},
+	}, nil
+}
+
+// PackAtlas packs all images into the smallest power of two sized atlas of at most
+// MaxSize pixels in each dimension, and returns the entries in the order of the images.
+// Larger images are placed first, which packs tighter than incremental insertion.
+func PackAtlas(images []image.Image, pf PixelFormat, optFns ...func(*AtlasOptions)) (*Atlas, []AtlasEntry, error) {
+	opts := newAtlasOptions(optFns)
+
+	order := make([]int, len(images))
+	area := 0
+
+	for i, img := range images {
+		order[i] = i
+
+		w, h := atlasCellSize(img.Bounds(), opts)
+		area += w * h
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := images[order[i]].Bounds(), images[order[j]].Bounds()
+		if a.Dy() != b.Dy() {
+			return a.Dy() > b.Dy()
+		}
+
+		return a.Dx() > b.Dx()
+	})
+
+	width, height := 1, 1
+	for width*height < area {
+		if width <= height {
+			width *= 2
+		} else {
+			height *= 2
+		}
+	}
+
+	for width <= opts.MaxSize && height <= opts.MaxSize {
+		a, err := NewAtlas(pf, width, height, optFns...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entries, err := a.addAll(images, order)
+		if err == nil {
+			return a, entries, nil
+		}
+
+		if !errors.Is(err, ErrAtlasFull) {
+			return nil, nil, err
+		}
+
+		if width <= height {
+			width *= 2
+		} else {
+			height *= 2
+		}
+	}
+
+	return nil, nil, fmt.Errorf("images do not fit into %dx%d pixels: %w", opts.MaxSize, opts.MaxSize, ErrAtlasFull)
+}
+
+// Add places img into the atlas, draws it and returns its entry. It returns
+// ErrAtlasFull if there is no free space for the image. Empty images are not
+// placed and return an empty entry.
+func (a *Atlas) Add(img image.Image) (AtlasEntry, error) {
+	b := img.Bounds()
+	if b.Empty() {
+		return AtlasEntry{}, nil
+	}
+
+	w, h := atlasCellSize(b, a.opts)
+
+	cell, ok := a.place(w, h)
+	if !ok {
+		return AtlasEntry{}, fmt.Errorf("cannot add %dx%d image: %w", b.Dx(), b.Dy(), ErrAtlasFull)
+	}
+
+	a.split(cell)
+
+	e := a.entry(cell.Min, b.Size())
+	a.draw(e, img)
+
+	return e, nil
+}
+
+// Upload copies the frame of the entry from the atlas to the texture at level 0,
+// which must have the size and pixel format of the atlas.
+func (a *Atlas) Upload(t Texture, e AtlasEntry) {
+	if e.Frame.Empty() {
+		return
+	}
+
+	t.ReplaceRegion(e.Region(), 0, &a.Image.Pix[a.Image.PixOffset(e.Frame.Min.X, e.Frame.Min.Y)], uintptr(a.Image.BytesPerRow))
+}
+
+// addAll adds the images in the given order and returns their entries in the
+// order of the images.
+func (a *Atlas) addAll(images []image.Image, order []int) ([]AtlasEntry, error) {
+	entries := make([]AtlasEntry, len(images))
+
+	for _, i := range order {
+		e, err := a.Add(images[i])
+		if err != nil {
+			return nil, err
+		}
+
+		entries[i] = e
+	}
+
+	return entries, nil
+}
+
+// place returns the rectangle of w*h pixels in the free space chosen by the
+// heuristic, at the top left corner of a free rectangle.
+func (a *Atlas) place(w, h int) (image.Rectangle, bool) {
+	var best image.Rectangle
+
+	bestScore, bestTie, found := 0, 0, false
+
+	for _, f := range a.free {
+		if f.Dx() < w || f.Dy() < h {
+			continue
+		}
+
+		dx, dy := f.Dx()-w, f.Dy()-h
+		short, long := dx, dy
+
+		if short > long {
+			short, long = long, short
+		}
+
+		var score, tie int
+
+		switch a.opts.Heuristic {
+		case AtlasHeuristicBestAreaFit:
+			score, tie = f.Dx()*f.Dy()-w*h, short
+		case AtlasHeuristicBottomLeft:
+			score, tie = f.Min.Y+h, f.Min.X
+		default:
+			score, tie = short, long
+		}
+
+		if !found || score < bestScore || score == bestScore && tie < bestTie {
+			best = image.Rectangle{Min: f.Min, Max: f.Min.Add(image.Pt(w, h))}
+			bestScore, bestTie, found = score, tie, true
+		}
+	}
+
+	return best, found
+}
+
+// split removes the used rectangle from the free space. Every free rectangle
+// that overlaps it is replaced by the up to 4 maximal rectangles around it, and
+// free rectangles contained in others are pruned.
+func (a *Atlas) split(used image.Rectangle) {
+	free := make([]image.Rectangle, 0, len(a.free)+4)
+
+	for _, f := range a.free {
+		if !f.Overlaps(used) {
+			free = append(free, f)
+			continue
+		}
+
+		if used.Min.X > f.Min.X {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, used.Min.X, f.Max.Y))
+		}
+
+		if used.Max.X < f.Max.X {
+			free = append(free, image.Rect(used.Max.X, f.Min.Y, f.Max.X, f.Max.Y))
+		}
+
+		if used.Min.Y > f.Min.Y {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, f.Max.X, used.Min.Y))
+		}
+
+		if used.Max.Y < f.Max.Y {
+			free = append(free, image.Rect(f.Min.X, used.Max.Y, f.Max.X, f.Max.Y))
+		}
+	}
+
+	a.free = a.free[:0]
+
+	for i, f := range free {
+		contained := false
+
+		for j, g := range free {
+			// Of two equal rectangles, only the first is kept.
+			if i != j && f.In(g) && (f != g || j < i) {
+				contained = true
+				break
+			}
+		}
+
+		if !contained {
+			a.free = append(a.free, f)
+		}
+	}
+}
+
+// entry returns the entry of an image of the given size in the cell at p.
+func (a *Atlas) entry(p, size image.Point) AtlasEntry {
+	e := a.opts.Extrude
+	frame := image.Rectangle{Min: p, Max: p.Add(size).Add(image.Pt(2*e, 2*e))}
+	bounds := frame.Inset(e)
+	w, h := float32(a.Image.Width), float32(a.Image.Height)
+
+	return AtlasEntry{
+		Bounds: bounds,
+		Frame:  frame,
+		UV: UVRect{
+			U0: float32(bounds.Min.X) / w,
+			V0: float32(bounds.Min.Y) / h,
+			U1: float32(bounds.Max.X) / w,
+			V1: float32(bounds.Max.Y) / h,
+		},
+	}
+}
+
+// draw copies img to the frame of the entry, repeating its edge pixels in the
+// extruded border.
+func (a *Atlas) draw(e AtlasEntry, img image.Image) {
+	b := img.Bounds()
+	offset := b.Min.Sub(e.Bounds.Min)
+
+	for y := e.Frame.Min.Y; y < e.Frame.Max.Y; y++ {
+		sy := clampInt(y+offset.Y, b.Min.Y, b.Max.Y-1)
+
+		for x := e.Frame.Min.X; x < e.Frame.Max.X; x++ {
+			a.Image.Set(x, y, img.At(clampInt(x+offset.X, b.Min.X, b.Max.X-1), sy))
+		}
+	}
+}
+
+// newAtlasOptions returns the atlas options with the functions applied.
+func newAtlasOptions(optFns []func(*AtlasOptions)) AtlasOptions {
+	opts := AtlasOptions{
+		Padding:   0,
+		Extrude:   0,
+		Heuristic: AtlasHeuristicBestShortSideFit,
+		MaxSize:   4096,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	return opts
+}
+
+// atlasCellSize returns the space an image of the given bounds occupies in an
+// atlas, including its extruded border and the padding to its neighbors.
+func atlasCellSize(b image.Rectangle, opts AtlasOptions) (int, int) {
+	if b.Empty() {
+		return 0, 0
+	}
+
+	return b.Dx() + 2*opts.Extrude + opts.Padding, b.Dy() + 2*opts.Extrude + opts.Padding
+}
+
+// clampInt returns v clamped to [lo, hi].
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+
+	if v > hi {
+		return hi
+	}
+
+	return v
+}
@@ -0,0 +1,130 @@
+package mtl
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSprite(w, h int, c uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []byte{c, c, c, 255})
+	}
+
+	return img
+}
+
+func requireDisjoint(t *testing.T, entries []AtlasEntry, padding int) {
+	t.Helper()
+
+	grow := func(r image.Rectangle) image.Rectangle {
+		return image.Rectangle{Min: r.Min, Max: r.Max.Add(image.Pt(padding, padding))}
+	}
+
+	for i, a := range entries {
+		for _, b := range entries[i+1:] {
+			require.False(t, grow(a.Frame).Overlaps(grow(b.Frame)), "%v %v", a.Frame, b.Frame)
+		}
+	}
+}
+
+func TestAtlas(t *testing.T) {
+	a, err := NewAtlas(PixelFormatRGBA8Unorm, 16, 8, func(o *AtlasOptions) { o.Extrude = 1 })
+	require.NoError(t, err)
+
+	sprite := newTestSprite(2, 2, 0)
+	sprite.Set(1, 1, color.NRGBA{R: 255, A: 255})
+
+	e, err := a.Add(sprite)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(1, 1, 3, 3), e.Bounds)
+	require.Equal(t, image.Rect(0, 0, 4, 4), e.Frame)
+	require.Equal(t, UVRect{U0: 1.0 / 16, V0: 1.0 / 8, U1: 3.0 / 16, V1: 3.0 / 8}, e.UV)
+	require.Equal(t, RegionMake2D(0, 0, 4, 4), e.Region())
+
+	// The edge pixels are repeated around the image.
+	require.Equal(t, color.NRGBA{R: 255, A: 255}, a.Image.At(2, 2))
+	require.Equal(t, color.NRGBA{R: 255, A: 255}, a.Image.At(3, 3))
+	require.Equal(t, color.NRGBA{A: 255}, a.Image.At(0, 0))
+	require.Equal(t, color.NRGBA{}, a.Image.At(4, 0))
+
+	e, err = a.Add(newTestSprite(10, 6, 1))
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(4, 0, 16, 8), e.Frame)
+
+	_, err = a.Add(newTestSprite(1, 3, 1))
+	require.ErrorIs(t, err, ErrAtlasFull)
+
+	e, err = a.Add(newTestSprite(2, 2, 1))
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 4, 4, 8), e.Frame)
+
+	e, err = a.Add(image.NewNRGBA(image.Rectangle{}))
+	require.NoError(t, err)
+	require.Equal(t, AtlasEntry{}, e)
+
+	_, err = NewAtlas(PixelFormatBC1RGBA, 16, 16)
+	require.Error(t, err)
+
+	_, err = NewAtlas(PixelFormatR8Unorm, 16, 16, func(o *AtlasOptions) { o.Padding = -1 })
+	require.Error(t, err)
+}
+
+func TestAtlasPadding(t *testing.T) {
+	a, err := NewAtlas(PixelFormatR8Unorm, 8, 4, func(o *AtlasOptions) { o.Padding = 2 })
+	require.NoError(t, err)
+
+	// Images at the right and bottom edges need no padding inside the atlas.
+	var entries []AtlasEntry
+
+	for i := 0; i < 2; i++ {
+		e, err := a.Add(newTestSprite(3, 4, 255))
+		require.NoError(t, err)
+
+		entries = append(entries, e)
+	}
+
+	require.Equal(t, image.Rect(0, 0, 3, 4), entries[0].Bounds)
+	require.Equal(t, image.Rect(5, 0, 8, 4), entries[1].Bounds)
+	require.Equal(t, []byte{255, 255, 255, 0, 0, 255, 255, 255}, a.Image.Pix[:8])
+
+	_, err = a.Add(newTestSprite(1, 1, 255))
+	require.True(t, errors.Is(err, ErrAtlasFull))
+}
+
+func TestPackAtlas(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	images := make([]image.Image, 100)
+	for i := range images {
+		images[i] = newTestSprite(1+rnd.Intn(24), 1+rnd.Intn(24), uint8(i))
+	}
+
+	for _, h := range []AtlasHeuristic{AtlasHeuristicBestShortSideFit, AtlasHeuristicBestAreaFit, AtlasHeuristicBottomLeft} {
+		a, entries, err := PackAtlas(images, PixelFormatR8Unorm, func(o *AtlasOptions) {
+			o.Padding = 1
+			o.Extrude = 1
+			o.Heuristic = h
+		})
+		require.NoError(t, err)
+		require.Len(t, entries, len(images))
+		require.LessOrEqual(t, a.Image.Width*a.Image.Height, 256*256)
+
+		requireDisjoint(t, entries, 1)
+
+		for i, e := range entries {
+			require.Equal(t, images[i].Bounds().Size(), e.Bounds.Size())
+			require.True(t, e.Frame.In(a.Image.Bounds()))
+			require.Equal(t, uint8(i), a.Image.Pix[a.Image.PixOffset(e.Bounds.Min.X, e.Bounds.Min.Y)])
+			require.Equal(t, float32(e.Bounds.Max.X)/float32(a.Image.Width), e.UV.U1)
+		}
+	}
+
+	_, _, err := PackAtlas([]image.Image{newTestSprite(40, 1, 0)}, PixelFormatR8Unorm, func(o *AtlasOptions) { o.MaxSize = 32 })
+	require.ErrorIs(t, err, ErrAtlasFull)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hupe1980/go-mtl/metallib"
+)
+
+// dump writes the header and the functions of the library l read from the file
+// name to w, with tags the hash and the tags of each function.
+func dump(w io.Writer, name string, l *metallib.Library, tags bool) error {
+	h := l.Header
+
+	fmt.Fprintf(w, "%s: %s library for %s %s, file format %s, %d bytes\n", name, h.FileType, h.OS, h.OSVersion, h.FileVersion, h.FileSize)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tAIR\tMSL\tBITCODE")
+
+	for _, f := range l.Functions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", f.Name, f.Type, f.AIRVersion, f.LanguageVersion, len(f.Bitcode))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if !tags {
+		return nil
+	}
+
+	for _, f := range l.Functions {
+		fmt.Fprintf(w, "\n%s:\n", f.Name)
+		fmt.Fprintf(w, "\thash: %x\n", f.Hash)
+		fmt.Fprintf(w, "\ttags: %s\n", tagList(f.Tags))
+		fmt.Fprintf(w, "\tpublic metadata: %s\n", tagList(f.PublicMetadata))
+		fmt.Fprintf(w, "\tprivate metadata: %s\n", tagList(f.PrivateMetadata))
+	}
+
+	return nil
+}
+
+// tagList returns the names of the tags with their sizes in bytes, or "none".
+func tagList(tags []metallib.Tag) string {
+	if len(tags) == 0 {
+		return "none"
+	}
+
+	list := make([]string, len(tags))
+	for i, t := range tags {
+		list[i] = fmt.Sprintf("%s(%d)", t.Name, len(t.Data))
+	}
+
+	return strings.Join(list, " ")
+}
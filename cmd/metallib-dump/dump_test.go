@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hupe1980/go-mtl/metallib"
+)
+
+func TestDump(t *testing.T) {
+	l := &metallib.Library{
+		Header: metallib.Header{
+			FileVersion: metallib.Version{Major: 1, Minor: 2},
+			FileType:    metallib.FileTypeExecutable,
+			OS:          metallib.OSMacOS,
+			OSVersion:   metallib.Version{Major: 14},
+			FileSize:    4096,
+		},
+		Functions: []metallib.Function{
+			{
+				Name:            "add_arrays",
+				Type:            metallib.FunctionTypeKernel,
+				Hash:            [32]byte{0xab},
+				AIRVersion:      metallib.Version{Major: 2, Minor: 6},
+				LanguageVersion: metallib.Version{Major: 3, Minor: 1},
+				Bitcode:         make([]byte, 1234),
+				Tags:            []metallib.Tag{{Name: "NAME", Data: []byte("add_arrays\x00")}, {Name: "TYPE", Data: []byte{2}}},
+			},
+			{
+				Name:            "vertex_shader",
+				Type:            metallib.FunctionTypeVertex,
+				AIRVersion:      metallib.Version{Major: 2, Minor: 6},
+				LanguageVersion: metallib.Version{Major: 3, Minor: 0},
+				Bitcode:         make([]byte, 56),
+				PublicMetadata:  []metallib.Tag{{Name: "VATT", Data: make([]byte, 12)}},
+			},
+		},
+	}
+
+	var sb strings.Builder
+	require.NoError(t, dump(&sb, "shaders.metallib", l, false))
+	require.Equal(t, `shaders.metallib: executable library for macOS 14.0, file format 1.2, 4096 bytes
+NAME           TYPE    AIR  MSL  BITCODE
+add_arrays     kernel  2.6  3.1  1234
+vertex_shader  vertex  2.6  3.0  56
+`, sb.String())
+
+	sb.Reset()
+	require.NoError(t, dump(&sb, "shaders.metallib", l, true))
+	require.Contains(t, sb.String(), `
+add_arrays:
+	hash: ab00000000000000000000000000000000000000000000000000000000000000
+	tags: NAME(11) TYPE(1)
+	public metadata: none
+	private metadata: none
+
+vertex_shader:
+`)
+	require.Contains(t, sb.String(), "\tpublic metadata: VATT(12)\n")
+}
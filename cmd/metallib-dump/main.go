@@ -0,0 +1,68 @@
+// Command metallib-dump prints the contents of Metal library files (.metallib).
+//
+// For each file, metallib-dump prints the header and a table of the functions with
+// their types, the versions of the Apple intermediate representation (AIR) and of
+// the Metal Shading Language, and the sizes of their bitcode. Files that are not
+// valid libraries are reported with the reason.
+//
+// Usage:
+//
+//	metallib-dump [-tags] file.metallib...
+//
+// Flags:
+//
+//	-tags  print the hash and the tags of each function
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hupe1980/go-mtl/metallib"
+)
+
+func main() {
+	tags := flag.Bool("tags", false, "print the hash and the tags of each function")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: metallib-dump [flags] file.metallib...\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+
+	for _, name := range flag.Args() {
+		if err := run(name, *tags); err != nil {
+			fmt.Fprintln(os.Stderr, "metallib-dump:", err)
+
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// run parses the file name and prints its contents to standard output.
+func run(name string, tags bool) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	l, err := metallib.Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return dump(os.Stdout, name, l, tags)
+}
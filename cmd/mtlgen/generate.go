@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/hupe1980/go-mtl/msl"
+)
+
+// kernel is the data of the generated code of a kernel.
+type kernel struct {
+	Name    string
+	GoName  string
+	Buffers []buffer
+}
+
+// buffer is a buffer argument of a kernel.
+type buffer struct {
+	Name   string
+	GoName string
+	Type   string
+	Index  int
+}
+
+// file is the data of a generated file.
+type file struct {
+	Source    string
+	Package   string
+	SourceVar string
+	Library   string
+	Kernels   []kernel
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by mtlgen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	_ "embed"
+	"errors"
+
+	"github.com/hupe1980/go-mtl"
+)
+
+//go:embed {{.Source}}
+var {{.SourceVar}} string
+
+// {{.Library}} compiles the source of {{.Source}}.
+func {{.Library}}(device mtl.Device, optFns ...func(*mtl.CompileOptions)) (mtl.Library, error) {
+	return device.NewLibraryWithSource({{.SourceVar}}, optFns...)
+}
+{{range .Kernels}}
+// {{.GoName}} holds the buffers of the kernel {{.Name}}.
+type {{.GoName}} struct {
+{{- range .Buffers}}
+	// {{.GoName}} is the {{.Type}} {{.Name}} at buffer index {{.Index}}.
+	{{.GoName}} *mtl.Buffer
+{{end -}}
+}
+
+// New{{.GoName}}PipelineState creates the compute pipeline state of the kernel {{.Name}}
+// of the library.
+func New{{.GoName}}PipelineState(device mtl.Device, lib mtl.Library) (mtl.ComputePipelineState, error) {
+	f, err := lib.NewFunctionWithName("{{.Name}}")
+	if err != nil {
+		return mtl.ComputePipelineState{}, err
+	}
+
+	return device.NewComputePipelineStateWithFunction(f)
+}
+
+// Encode sets the compute pipeline state and the buffers of the kernel {{.Name}}
+// and dispatches the threads of the grid. It returns an error if a buffer is nil.
+func (k *{{.GoName}}) Encode(cce mtl.ComputeCommandEncoder, cps mtl.ComputePipelineState, gridSize, threadgroupSize mtl.Size) error {
+{{- $kernel := .Name}}
+{{- range .Buffers}}
+	if k.{{.GoName}} == nil {
+		return errors.New("{{$kernel}}: buffer {{.GoName}} is nil")
+	}
+{{end}}
+	cce.SetComputePipelineState(cps)
+{{- range .Buffers}}
+	cce.SetBuffer(*k.{{.GoName}}, 0, {{.Index}})
+{{- end}}
+	cce.DispatchThreads(gridSize, threadgroupSize)
+
+	return nil
+}
+{{end}}`))
+
+// generate returns the Go source of the wrappers of the kernels of the MSL source
+// read from the file name.
+func generate(name, source, pkg string) ([]byte, error) {
+	m, err := msl.Reflect(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", name, err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+
+	f := file{
+		Source:    filepath.Base(name),
+		Package:   pkg,
+		SourceVar: goName(base, false) + "Source",
+		Library:   "New" + goName(base, true) + "Library",
+	}
+
+	names := map[string]string{f.SourceVar: base, f.Library: base}
+
+	for _, fn := range m.Functions {
+		if fn.Kind != msl.FunctionKindKernel {
+			continue
+		}
+
+		k, err := newKernel(fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", name, err)
+		}
+
+		for _, n := range []string{k.GoName, "New" + k.GoName + "PipelineState"} {
+			if other, ok := names[n]; ok {
+				return nil, fmt.Errorf("%s:%s: name %s of kernel %s is used by %s", name, fn.Pos, n, fn.Name, other)
+			}
+
+			names[n] = fn.Name
+		}
+
+		f.Kernels = append(f.Kernels, k)
+	}
+
+	if len(f.Kernels) == 0 {
+		return nil, fmt.Errorf("%s: no kernels", name)
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, f); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// newKernel returns the generated code data of the kernel fn. Buffers without a
+// [[buffer(n)]] attribute get the lowest free index in parameter order.
+func newKernel(fn msl.Function) (kernel, error) {
+	k := kernel{Name: fn.Name, GoName: goName(fn.Name, true)}
+
+	used := map[int]bool{}
+
+	for _, p := range fn.Bindings(msl.BindingBuffer) {
+		used[p.Binding.Index] = true
+	}
+
+	fields := map[string]string{}
+	next := 0
+
+	for _, p := range fn.Parameters {
+		b := buffer{Name: p.Name, GoName: goName(p.Name, true), Type: p.Type.String()}
+
+		switch p.Binding.Kind {
+		case msl.BindingBuffer:
+			if p.Binding.Index < 0 {
+				return kernel{}, fmt.Errorf("%s: buffer index of parameter %s of kernel %s is not an integer constant", p.Pos, p.Name, fn.Name)
+			}
+
+			b.Index = p.Binding.Index
+		case msl.BindingNone:
+			if p.Type.AddressSpace != msl.AddressSpaceDevice && p.Type.AddressSpace != msl.AddressSpaceConstant {
+				return kernel{}, fmt.Errorf("%s: parameter %s of kernel %s has no binding", p.Pos, p.Name, fn.Name)
+			}
+
+			for used[next] {
+				next++
+			}
+
+			b.Index = next
+			used[next] = true
+		case msl.BindingBuiltin, msl.BindingStageIn:
+			continue
+		default:
+			return kernel{}, fmt.Errorf("%s: parameter %s of kernel %s: only buffer arguments are supported", p.Pos, p.Name, fn.Name)
+		}
+
+		if other, ok := fields[b.GoName]; ok {
+			return kernel{}, fmt.Errorf("%s: parameters %s and %s of kernel %s have the same name %s", p.Pos, other, p.Name, fn.Name, b.GoName)
+		}
+
+		fields[b.GoName] = p.Name
+		k.Buffers = append(k.Buffers, b)
+	}
+
+	return k, nil
+}
+
+// goName returns the Go identifier of an MSL or file name, such as AddArrays for
+// add_arrays. The first letter is upper case if exported.
+func goName(s string, exported bool) string {
+	var sb strings.Builder
+
+	upper := exported
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = sb.Len() > 0 || exported
+
+			continue
+		}
+
+		switch {
+		case upper:
+			r = unicode.ToUpper(r)
+		case sb.Len() == 0:
+			r = unicode.ToLower(r)
+		}
+
+		sb.WriteRune(r)
+
+		upper = false
+	}
+
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		if exported {
+			return "Metal" + name
+		}
+
+		return "metal" + name
+	}
+
+	return name
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	source, err := os.ReadFile("testdata/kernels.metal")
+	require.NoError(t, err)
+
+	code, err := generate("testdata/kernels.metal", string(source), "kernels")
+	require.NoError(t, err)
+
+	if *update {
+		require.NoError(t, os.WriteFile("testdata/kernels_metal.go.golden", code, 0o600))
+	}
+
+	golden, err := os.ReadFile("testdata/kernels_metal.go.golden")
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(code))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for source, msg := range map[string]string{
+		"vertex float4 v() { return 0; }":                                 "a.metal: no kernels",
+		"kernel void k(texture2d<float> t [[texture(0)]]) {}":             "a.metal:1:32: parameter t of kernel k: only buffer arguments are supported",
+		"kernel void k(float x) {}":                                       "a.metal:1:21: parameter x of kernel k has no binding",
+		"kernel void k(device float* a [[buffer(N)]]) {}":                 "a.metal:1:29: buffer index of parameter a of kernel k is not an integer constant",
+		"kernel void k(device float* a_b, device float* aB) {}":           "a.metal:1:48: parameters a_b and aB of kernel k have the same name AB",
+		"kernel void a() {}\nkernel void A() {}":                          "a.metal:2:13: name A of kernel A is used by a",
+		"kernel void k(device float* a [[buffer(0)]], device float* b {}": "a.metal:1:",
+	} {
+		_, err := generate("a.metal", source, "main")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for s, want := range map[string][2]string{
+		"add_arrays":  {"AddArrays", "addArrays"},
+		"inA":         {"InA", "inA"},
+		"Result":      {"Result", "result"},
+		"my-shaders":  {"MyShaders", "myShaders"},
+		"_x__y":       {"XY", "xY"},
+		"2d":          {"Metal2d", "metal2d"},
+		"blur_3x3_h":  {"Blur3x3H", "blur3x3H"},
+		"__internal":  {"Internal", "internal"},
+		"kernel_main": {"KernelMain", "kernelMain"},
+	} {
+		require.Equal(t, want[0], goName(s, true), s)
+		require.Equal(t, want[1], goName(s, false), s)
+	}
+}
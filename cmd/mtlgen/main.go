@@ -0,0 +1,75 @@
+// Command mtlgen generates typed Go wrappers for the kernels of Metal shader files.
+//
+// For each .metal file, mtlgen writes a Go file that embeds the source and declares
+// a function that compiles it. For each kernel, it declares a struct with a
+// *mtl.Buffer field per buffer argument, a function that creates the compute
+// pipeline state and an Encode method that sets the pipeline state and the buffers
+// at their indices and dispatches the threads. Renaming, reordering or removing a
+// buffer argument changes the struct, so stale callers fail to compile.
+//
+// Usage:
+//
+//	//go:generate go run github.com/hupe1980/go-mtl/cmd/mtlgen add.metal
+//
+// Flags:
+//
+//	-package name  package of the generated files (default $GOPACKAGE or main)
+//	-o file        output file of a single input (default <name>_metal.go)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated files")
+	out := flag.String("o", "", "output file of a single input")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: mtlgen [flags] file.metal...\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*out != "" && flag.NArg() > 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *pkg == "" {
+		*pkg = "main"
+	}
+
+	for _, name := range flag.Args() {
+		output := *out
+		if output == "" {
+			output = strings.TrimSuffix(name, filepath.Ext(name)) + "_metal.go"
+		}
+
+		if err := run(name, output, *pkg); err != nil {
+			fmt.Fprintln(os.Stderr, "mtlgen:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// run generates the wrappers of the file name and writes them to output.
+func run(name, output, pkg string) error {
+	source, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(name, string(source), pkg)
+	if err != nil {
+		return err
+	}
+
+	// Generated sources are committed, so they get the permissions of other sources.
+	return os.WriteFile(output, code, 0o644) //nolint:gosec // G306: the file is not secret
+}
@@ -0,0 +1,28 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+#define DATA_INDEX 1
+
+struct Params {
+	float scale;
+};
+
+kernel void add_arrays(device const float* inA,
+	device const float* inB,
+	device float* result,
+	uint index [[thread_position_in_grid]])
+{
+	result[index] = inA[index] + inB[index];
+}
+
+[[kernel]] void scale(device float* data [[buffer(DATA_INDEX)]],
+	constant Params& params,
+	uint index [[thread_position_in_grid]])
+{
+	data[index] *= params.scale;
+}
+
+vertex float4 vertex_main(uint vid [[vertex_id]]) {
+	return float4(0);
+}
@@ -0,0 +1,284 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SRGBToLinear converts an sRGB-encoded component to linear light using the exact sRGB transfer function.
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB converts a linear-light component to sRGB encoding using the exact sRGB transfer function.
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+var (
+	// srgb8ToLinearTable holds the linear value of every 8-bit sRGB code.
+	srgb8ToLinearTable = func() (t [256]float32) {
+		for i := range t {
+			t[i] = float32(SRGBToLinear(float64(i) / 255))
+		}
+
+		return t
+	}()
+
+	// linearToSRGB8Table holds the linear value at which each 8-bit sRGB code
+	// starts, i.e. the midpoint between it and the previous code.
+	linearToSRGB8Table = func() (t [256]float32) {
+		for i := 1; i < len(t); i++ {
+			t[i] = float32(SRGBToLinear((float64(i) - 0.5) / 255))
+		}
+
+		return t
+	}()
+)
+
+// SRGB8ToLinear converts an 8-bit sRGB code to a linear-light value in [0, 1] using a lookup table.
+func SRGB8ToLinear(v uint8) float32 {
+	return srgb8ToLinearTable[v]
+}
+
+// LinearToSRGB8 converts a linear-light value to the nearest 8-bit sRGB code using a lookup table.
+// The result matches rounding the output of LinearToSRGB; values outside [0, 1] are clamped.
+func LinearToSRGB8(v float32) uint8 {
+	// Binary search for the last code whose starting value is <= v.
+	i := 0
+	for step := 128; step > 0; step >>= 1 {
+		if v >= linearToSRGB8Table[i+step] {
+			i += step
+		}
+	}
+
+	return uint8(i)
+}
+
+// ColorMatrix is a 3x3 matrix, in row-major order, that converts linear RGB or XYZ
+// color values between color spaces.
+type ColorMatrix [3][3]float64
+
+// Apply multiplies the column vector (r, g, b) by the matrix.
+func (m ColorMatrix) Apply(r, g, b float64) (float64, float64, float64) {
+	return m[0][0]*r + m[0][1]*g + m[0][2]*b,
+		m[1][0]*r + m[1][1]*g + m[1][2]*b,
+		m[2][0]*r + m[2][1]*g + m[2][2]*b
+}
+
+// Mul returns the matrix product m*n, which applies n first and then m.
+func (m ColorMatrix) Mul(n ColorMatrix) ColorMatrix {
+	var p ColorMatrix
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			p[i][j] = m[i][0]*n[0][j] + m[i][1]*n[1][j] + m[i][2]*n[2][j]
+		}
+	}
+
+	return p
+}
+
+// Inverse returns the inverse of the matrix.
+func (m ColorMatrix) Inverse() ColorMatrix {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+
+	return ColorMatrix{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
+
+// Gamut conversion matrices between linear RGB color spaces and CIE XYZ. All
+// color spaces use the D65 white point, so no chromatic adaptation is required.
+var (
+	// LinearSRGBToXYZ converts linear sRGB (BT.709 primaries) to CIE XYZ.
+	LinearSRGBToXYZ = ColorMatrix{
+		{0.4123907992659595, 0.35758433938387796, 0.1804807884018343},
+		{0.21263900587151036, 0.7151686787677559, 0.07219231536073371},
+		{0.01933081871559185, 0.11919477979462599, 0.9505321522496606},
+	}
+
+	// LinearDisplayP3ToXYZ converts linear Display P3 to CIE XYZ.
+	LinearDisplayP3ToXYZ = ColorMatrix{
+		{0.4865709486482162, 0.26566769316909306, 0.1982172852343625},
+		{0.2289745640697488, 0.6917385218365064, 0.079286914093745},
+		{0, 0.04511338185890264, 1.043944368900976},
+	}
+
+	// LinearRec2020ToXYZ converts linear Rec. 2020 to CIE XYZ.
+	LinearRec2020ToXYZ = ColorMatrix{
+		{0.6369580483012914, 0.14461690358620832, 0.1688809751641721},
+		{0.2627002120112671, 0.6779980715188708, 0.05930171646986196},
+		{0, 0.028072693049087428, 1.060985057710791},
+	}
+
+	// XYZToLinearSRGB converts CIE XYZ to linear sRGB.
+	XYZToLinearSRGB = LinearSRGBToXYZ.Inverse()
+
+	// XYZToLinearDisplayP3 converts CIE XYZ to linear Display P3.
+	XYZToLinearDisplayP3 = LinearDisplayP3ToXYZ.Inverse()
+
+	// XYZToLinearRec2020 converts CIE XYZ to linear Rec. 2020.
+	XYZToLinearRec2020 = LinearRec2020ToXYZ.Inverse()
+
+	// LinearSRGBToLinearDisplayP3 converts linear sRGB to linear Display P3.
+	LinearSRGBToLinearDisplayP3 = XYZToLinearDisplayP3.Mul(LinearSRGBToXYZ)
+
+	// LinearDisplayP3ToLinearSRGB converts linear Display P3 to linear sRGB.
+	// Colors outside the sRGB gamut produce components outside [0, 1].
+	LinearDisplayP3ToLinearSRGB = XYZToLinearSRGB.Mul(LinearDisplayP3ToXYZ)
+
+	// LinearSRGBToLinearRec2020 converts linear sRGB to linear Rec. 2020.
+	LinearSRGBToLinearRec2020 = XYZToLinearRec2020.Mul(LinearSRGBToXYZ)
+
+	// LinearRec2020ToLinearSRGB converts linear Rec. 2020 to linear sRGB.
+	// Colors outside the sRGB gamut produce components outside [0, 1].
+	LinearRec2020ToLinearSRGB = XYZToLinearSRGB.Mul(LinearRec2020ToXYZ)
+)
+
+// Constants of the SMPTE ST 2084 perceptual quantizer.
+const (
+	pqM1 = 2610.0 / 16384
+	pqM2 = 2523.0 / 4096 * 128
+	pqC1 = 3424.0 / 4096
+	pqC2 = 2413.0 / 4096 * 32
+	pqC3 = 2392.0 / 4096 * 32
+)
+
+// LinearToPQ encodes a linear display luminance with the SMPTE ST 2084 (PQ) inverse EOTF.
+// A linear value of 1 corresponds to 10000 cd/m².
+func LinearToPQ(v float64) float64 {
+	if v <= 0 {
+		return 0
+	}
+
+	p := math.Pow(v, pqM1)
+
+	return math.Pow((pqC1+pqC2*p)/(1+pqC3*p), pqM2)
+}
+
+// PQToLinear decodes a SMPTE ST 2084 (PQ) signal to linear display luminance,
+// where 1 corresponds to 10000 cd/m².
+func PQToLinear(v float64) float64 {
+	if v <= 0 {
+		return 0
+	}
+
+	p := math.Pow(v, 1/pqM2)
+
+	return math.Pow(math.Max(p-pqC1, 0)/(pqC2-pqC3*p), 1/pqM1)
+}
+
+// Constants of the ITU-R BT.2100 hybrid log-gamma OETF.
+const (
+	hlgA = 0.17883277
+	hlgB = 1 - 4*hlgA
+)
+
+// hlgC is 0.5 - a*ln(4a).
+var hlgC = 0.5 - hlgA*math.Log(4*hlgA)
+
+// LinearToHLG encodes a normalized scene-linear value in [0, 1] with the BT.2100 hybrid log-gamma OETF.
+func LinearToHLG(v float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v <= 1.0/12:
+		return math.Sqrt(3 * v)
+	}
+
+	return hlgA*math.Log(12*v-hlgB) + hlgC
+}
+
+// HLGToLinear decodes a hybrid log-gamma signal to a normalized scene-linear value
+// with the BT.2100 inverse OETF.
+func HLGToLinear(v float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v <= 0.5:
+		return v * v / 3
+	}
+
+	return (math.Exp((v-hlgC)/hlgA) + hlgB) / 12
+}
+
+// ClearColorFromSRGB returns the clear color for sRGB-encoded red, green and blue
+// components in [0, 1]. The color components are converted to linear values, while
+// alpha is used as is. When clearing a render target with an sRGB pixel format,
+// Metal encodes the linear values back, so the stored pixels match the sRGB input.
+func ClearColorFromSRGB(red, green, blue, alpha float64) ClearColor {
+	return ClearColor{
+		Red:   SRGBToLinear(red),
+		Green: SRGBToLinear(green),
+		Blue:  SRGBToLinear(blue),
+		Alpha: alpha,
+	}
+}
+
+// ClearColorFromHex returns the clear color for an sRGB hex color in one of
+// the forms RGB, RGBA, RRGGBB or RRGGBBAA, with an optional leading '#'.
+// Alpha defaults to opaque.
+func ClearColorFromHex(hex string) (ClearColor, error) {
+	s := strings.TrimPrefix(hex, "#")
+
+	switch len(s) {
+	case 3, 4:
+		// Expand the short forms by repeating every digit.
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+
+		s = b.String()
+	case 6, 8:
+	default:
+		return ClearColor{}, fmt.Errorf("invalid hex color %q", hex)
+	}
+
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return ClearColor{}, fmt.Errorf("invalid hex color %q: %w", hex, err)
+	}
+
+	return ClearColorFromSRGB(
+		float64(v>>24&0xff)/255,
+		float64(v>>16&0xff)/255,
+		float64(v>>8&0xff)/255,
+		float64(v&0xff)/255,
+	), nil
+}
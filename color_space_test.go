@@ -0,0 +1,109 @@
+package mtl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRGBTransferFunction(t *testing.T) {
+	require.InDelta(t, 0.21404114048223255, SRGBToLinear(0.5), 1e-12)
+	require.InDelta(t, 0.0030959752321981426, SRGBToLinear(0.04), 1e-12)
+	require.InDelta(t, 0.4613561295004529, LinearToSRGB(0.18), 1e-12)
+	require.InDelta(t, 0.01292, LinearToSRGB(0.001), 1e-12)
+
+	for i := 0; i <= 100; i++ {
+		v := float64(i) / 100
+		require.InDelta(t, v, LinearToSRGB(SRGBToLinear(v)), 1e-12)
+	}
+}
+
+func TestSRGBLookupTables(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		require.InDelta(t, SRGBToLinear(float64(i)/255), float64(SRGB8ToLinear(uint8(i))), 1e-7)
+		require.Equal(t, uint8(i), LinearToSRGB8(SRGB8ToLinear(uint8(i))))
+	}
+
+	for i := 0; i <= 10000; i++ {
+		v := float32(i) / 10000
+		want := uint8(math.Round(LinearToSRGB(float64(v)) * 255))
+		require.Equal(t, want, LinearToSRGB8(v), "linear value %v", v)
+	}
+
+	require.Equal(t, uint8(0), LinearToSRGB8(-1))
+	require.Equal(t, uint8(255), LinearToSRGB8(2))
+}
+
+func TestGamutMatrices(t *testing.T) {
+	requireMatrix := func(t *testing.T, want, got ColorMatrix) {
+		t.Helper()
+
+		for i := range want {
+			for j := range want[i] {
+				require.InDelta(t, want[i][j], got[i][j], 1e-6, "element [%d][%d]", i, j)
+			}
+		}
+	}
+
+	requireMatrix(t, ColorMatrix{
+		{0.8224621, 0.1775379, 0},
+		{0.0331942, 0.9668058, 0},
+		{0.0170826, 0.0723974, 0.9105199},
+	}, LinearSRGBToLinearDisplayP3)
+
+	requireMatrix(t, ColorMatrix{
+		{0.6274039, 0.3292830, 0.0433131},
+		{0.0690973, 0.9195404, 0.0113623},
+		{0.0163914, 0.0880133, 0.8955953},
+	}, LinearSRGBToLinearRec2020)
+
+	identity := ColorMatrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	requireMatrix(t, identity, LinearDisplayP3ToLinearSRGB.Mul(LinearSRGBToLinearDisplayP3))
+	requireMatrix(t, identity, LinearRec2020ToLinearSRGB.Mul(LinearSRGBToLinearRec2020))
+
+	// White maps to white in every color space.
+	r, g, b := LinearSRGBToLinearRec2020.Apply(1, 1, 1)
+	require.InDelta(t, 1, r, 1e-6)
+	require.InDelta(t, 1, g, 1e-6)
+	require.InDelta(t, 1, b, 1e-6)
+}
+
+func TestPQ(t *testing.T) {
+	require.InDelta(t, 0.508078, LinearToPQ(100.0/10000), 1e-6)
+	require.InDelta(t, 0.751827, LinearToPQ(1000.0/10000), 1e-6)
+	require.InDelta(t, 1, LinearToPQ(1), 1e-12)
+	require.Equal(t, 0.0, LinearToPQ(0))
+
+	for _, v := range []float64{0.0001, 0.01, 0.2, 0.5, 1} {
+		require.InDelta(t, v, PQToLinear(LinearToPQ(v)), 1e-9)
+	}
+}
+
+func TestHLG(t *testing.T) {
+	require.InDelta(t, 0.5, LinearToHLG(1.0/12), 1e-12)
+	require.InDelta(t, 1, LinearToHLG(1), 1e-6)
+	require.InDelta(t, 0.871643, LinearToHLG(0.5), 1e-6)
+
+	for _, v := range []float64{0.01, 1.0 / 12, 0.3, 1} {
+		require.InDelta(t, v, HLGToLinear(LinearToHLG(v)), 1e-12)
+	}
+}
+
+func TestClearColorFromHex(t *testing.T) {
+	c, err := ClearColorFromHex("#ff8000")
+	require.NoError(t, err)
+	require.InDelta(t, 1, c.Red, 1e-12)
+	require.InDelta(t, SRGBToLinear(128.0/255), c.Green, 1e-12)
+	require.InDelta(t, 0, c.Blue, 1e-12)
+	require.InDelta(t, 1, c.Alpha, 1e-12)
+
+	c, err = ClearColorFromHex("0f08")
+	require.NoError(t, err)
+	require.Equal(t, ClearColorFromSRGB(0, 1, 0, 136.0/255), c)
+
+	for _, s := range []string{"", "#12", "#12345", "#gggggg", "#+12345"} {
+		_, err = ClearColorFromHex(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"strings"
+
+	"github.com/hupe1980/go-mtl/msl"
+)
+
+// CompileError is the error of NewLibraryWithSource if the source does not compile.
+// It carries the compiler output both as text and as structured diagnostics.
+type CompileError struct {
+	// Source is the source that failed to compile.
+	Source string
+
+	// Output is the compiler output.
+	Output string
+
+	// Diagnostics holds the errors and warnings parsed from the output.
+	Diagnostics []msl.Diagnostic
+}
+
+// newCompileError returns the compile error of source with the compiler output.
+func newCompileError(source, output string) *CompileError {
+	return &CompileError{
+		Source:      source,
+		Output:      output,
+		Diagnostics: msl.ParseDiagnostics(output),
+	}
+}
+
+// Error implements the error interface. It returns the compiler output.
+func (e *CompileError) Error() string {
+	return strings.TrimSpace(e.Output)
+}
+
+// Errors returns the diagnostics with error severity.
+func (e *CompileError) Errors() []msl.Diagnostic {
+	var errs []msl.Diagnostic
+
+	for _, d := range e.Diagnostics {
+		if d.Severity == msl.SeverityError {
+			errs = append(errs, d)
+		}
+	}
+
+	return errs
+}
+
+// Format returns the diagnostics with the offending source lines and carets. It
+// returns the compiler output if it contains no diagnostics.
+func (e *CompileError) Format() string {
+	if len(e.Diagnostics) == 0 {
+		return e.Error()
+	}
+
+	return msl.FormatDiagnostics(e.Diagnostics, e.Source)
+}
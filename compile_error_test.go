@@ -0,0 +1,27 @@
+package mtl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hupe1980/go-mtl/msl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileError(t *testing.T) {
+	source := "kernel void k() {\n  foo = 1;\n}\n"
+	output := "program_source:2:3: error: use of undeclared identifier 'foo'\n  foo = 1;\n  ^\n1 error generated.\n"
+
+	var err error = newCompileError(source, output)
+
+	var ce *CompileError
+	require.True(t, errors.As(err, &ce))
+	require.Equal(t, "program_source:2:3: error: use of undeclared identifier 'foo'\n  foo = 1;\n  ^\n1 error generated.", err.Error())
+	require.Len(t, ce.Errors(), 1)
+	require.Equal(t, msl.Pos{Line: 2, Column: 3}, ce.Errors()[0].Pos)
+	require.Equal(t, "program_source:2:3: error: use of undeclared identifier 'foo'\n2 |   foo = 1;\n  |   ^\n", ce.Format())
+
+	ce = newCompileError(source, "Compilation failed")
+	require.Empty(t, ce.Diagnostics)
+	require.Equal(t, "Compilation failed", ce.Format())
+}
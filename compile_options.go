@@ -0,0 +1,252 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MathMode represents the floating-point optimizations the compiler can apply.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtlmathmode
+type MathMode uint8
+
+const (
+	// MathModeSafe disables unsafe floating-point optimizations.
+	MathModeSafe MathMode = 0
+
+	// MathModeRelaxed allows floating-point optimizations that may violate IEEE 754,
+	// but keeps the handling of infinities and NaNs.
+	MathModeRelaxed MathMode = 1
+
+	// MathModeFast allows all floating-point optimizations that may violate IEEE 754.
+	MathModeFast MathMode = 2
+)
+
+// MathFloatingPointFunctions represents the precision of the math functions of
+// the Metal standard library, such as sin and exp.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtlmathfloatingpointfunctions
+type MathFloatingPointFunctions uint8
+
+const (
+	// MathFloatingPointFunctionsFast selects the fast variants of the math functions.
+	MathFloatingPointFunctionsFast MathFloatingPointFunctions = 0
+
+	// MathFloatingPointFunctionsPrecise selects the precise variants of the math functions.
+	MathFloatingPointFunctionsPrecise MathFloatingPointFunctions = 1
+)
+
+// LibraryType represents the type of a library.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtllibrarytype
+type LibraryType uint8
+
+const (
+	// LibraryTypeExecutable is a library whose functions can be used to create pipeline states.
+	LibraryTypeExecutable LibraryType = 0
+
+	// LibraryTypeDynamic is a library that other libraries can link against.
+	LibraryTypeDynamic LibraryType = 1
+)
+
+// LibraryOptimizationLevel represents the optimization goal of the compiler.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtllibraryoptimizationlevel
+type LibraryOptimizationLevel uint8
+
+const (
+	// LibraryOptimizationLevelDefault optimizes for performance.
+	LibraryOptimizationLevelDefault LibraryOptimizationLevel = 0
+
+	// LibraryOptimizationLevelSize optimizes for the size of the compiled code.
+	LibraryOptimizationLevelSize LibraryOptimizationLevel = 1
+)
+
+// CompileOptions specifies optional compilation settings for
+// the graphics or compute functions within a library.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtlcompileoptions
+type CompileOptions struct {
+	// Indicates whether the compiler can perform optimizations for floating-point arithmetic that may violate the IEEE 754 standard.
+	//
+	// Deprecated: Use MathMode. If FastMathEnabled is false, MathModeFast is treated as MathModeSafe.
+	FastMathEnabled bool
+
+	// Indicates whether the compiler should compile vertex shaders conservatively to generate consistent position calculations.
+	PreserveInvariance bool
+
+	// The language version used to interpret the library source code.
+	LanguageVersion LanguageVersion
+
+	// PreprocessorMacros holds the macros defined before the source is compiled. The values
+	// are strings, which are inserted verbatim, or booleans, integers and floating-point numbers.
+	PreprocessorMacros map[string]any
+
+	// MathMode is the floating-point optimizations the compiler can apply. It requires
+	// macOS 15 or iOS 18, older systems only distinguish MathModeFast from the others.
+	MathMode MathMode
+
+	// MathFloatingPointFunctions is the precision of the math functions. It requires
+	// macOS 15 or iOS 18.
+	MathFloatingPointFunctions MathFloatingPointFunctions
+
+	// LibraryType is the type of the library to create.
+	LibraryType LibraryType
+
+	// InstallName is the name other libraries use to link against a dynamic library.
+	// It is required for LibraryTypeDynamic.
+	InstallName string
+
+	// OptimizationLevel is the optimization goal of the compiler. It requires macOS 13
+	// or iOS 16.
+	OptimizationLevel LibraryOptimizationLevel
+}
+
+// newCompileOptions returns the default compile options modified by optFns.
+func newCompileOptions(optFns []func(*CompileOptions)) CompileOptions {
+	opts := CompileOptions{
+		FastMathEnabled:            true,
+		PreserveInvariance:         false,
+		LanguageVersion:            LanguageVersion3_0,
+		PreprocessorMacros:         nil,
+		MathMode:                   MathModeFast,
+		MathFloatingPointFunctions: MathFloatingPointFunctionsFast,
+		LibraryType:                LibraryTypeExecutable,
+		InstallName:                "",
+		OptimizationLevel:          LibraryOptimizationLevelDefault,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	return opts
+}
+
+// mathMode returns the math mode with FastMathEnabled applied.
+func (o *CompileOptions) mathMode() MathMode {
+	if !o.FastMathEnabled && o.MathMode == MathModeFast {
+		return MathModeSafe
+	}
+
+	return o.MathMode
+}
+
+// macroKind is the type of the value of a macro.
+type macroKind uint8
+
+const (
+	macroKindString macroKind = iota
+	macroKindInt
+	macroKindUint
+	macroKindFloat
+)
+
+// macro is a preprocessor macro with its value formatted as source text.
+type macro struct {
+	Name  string
+	Value string
+	Kind  macroKind
+}
+
+var macroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// macros returns the preprocessor macros sorted by name.
+func (o *CompileOptions) macros() ([]macro, error) {
+	macros := make([]macro, 0, len(o.PreprocessorMacros))
+
+	for name, v := range o.PreprocessorMacros {
+		if !macroName.MatchString(name) {
+			return nil, fmt.Errorf("invalid macro name %q", name)
+		}
+
+		m := macro{Name: name}
+
+		switch v := v.(type) {
+		case string:
+			m.Value, m.Kind = v, macroKindString
+		case bool:
+			m.Value, m.Kind = "0", macroKindInt
+			if v {
+				m.Value = "1"
+			}
+		case int:
+			m.Value, m.Kind = strconv.FormatInt(int64(v), 10), macroKindInt
+		case int8:
+			m.Value, m.Kind = strconv.FormatInt(int64(v), 10), macroKindInt
+		case int16:
+			m.Value, m.Kind = strconv.FormatInt(int64(v), 10), macroKindInt
+		case int32:
+			m.Value, m.Kind = strconv.FormatInt(int64(v), 10), macroKindInt
+		case int64:
+			m.Value, m.Kind = strconv.FormatInt(v, 10), macroKindInt
+		case uint:
+			m.Value, m.Kind = strconv.FormatUint(uint64(v), 10), macroKindUint
+		case uint8:
+			m.Value, m.Kind = strconv.FormatUint(uint64(v), 10), macroKindUint
+		case uint16:
+			m.Value, m.Kind = strconv.FormatUint(uint64(v), 10), macroKindUint
+		case uint32:
+			m.Value, m.Kind = strconv.FormatUint(uint64(v), 10), macroKindUint
+		case uint64:
+			m.Value, m.Kind = strconv.FormatUint(v, 10), macroKindUint
+		case float32:
+			m.Value, m.Kind = strconv.FormatFloat(float64(v), 'g', -1, 32), macroKindFloat
+		case float64:
+			m.Value, m.Kind = strconv.FormatFloat(v, 'g', -1, 64), macroKindFloat
+		default:
+			return nil, fmt.Errorf("unsupported value %T of macro %q", v, name)
+		}
+
+		if strings.ContainsAny(m.Value, "\r\n") {
+			return nil, fmt.Errorf("value of macro %q contains a line break", name)
+		}
+
+		macros = append(macros, m)
+	}
+
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+
+	return macros, nil
+}
+
+// DefineMacros returns the source with the preprocessor macros of the compile options
+// defined by #define lines, followed by a #line directive that keeps the line numbers
+// of compiler diagnostics. It applies the same options as NewLibraryWithSource and
+// can be used where the compiler does not set the macros, such as for generated
+// source and tests. The source is returned unchanged if there are no macros.
+func DefineMacros(source string, optFns ...func(*CompileOptions)) (string, error) {
+	opts := newCompileOptions(optFns)
+
+	macros, err := opts.macros()
+	if err != nil {
+		return "", err
+	}
+
+	if len(macros) == 0 {
+		return source, nil
+	}
+
+	var sb strings.Builder
+
+	for _, m := range macros {
+		sb.WriteString("#define " + m.Name)
+
+		if m.Value != "" {
+			sb.WriteString(" " + m.Value)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("#line 1\n")
+	sb.WriteString(source)
+
+	return sb.String(), nil
+}
@@ -0,0 +1,67 @@
+package mtl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefineMacros(t *testing.T) {
+	source := "kernel void k() {}\n"
+
+	out, err := DefineMacros(source)
+	require.NoError(t, err)
+	require.Equal(t, source, out)
+
+	out, err = DefineMacros(source, func(o *CompileOptions) {
+		o.PreprocessorMacros = map[string]any{
+			"SCALE":    float32(0.5),
+			"COUNT":    uint8(4),
+			"OFFSET":   -3,
+			"ENABLED":  true,
+			"TYPE":     "half",
+			"DEFINED":  "",
+			"EPSILON":  1e-6,
+			"DISABLED": false,
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, `#define COUNT 4
+#define DEFINED
+#define DISABLED 0
+#define ENABLED 1
+#define EPSILON 1e-06
+#define OFFSET -3
+#define SCALE 0.5
+#define TYPE half
+#line 1
+kernel void k() {}
+`, out)
+
+	for _, macros := range []map[string]any{
+		{"1X": 1},
+		{"X": []int{1}},
+		{"X": "a\nb"},
+	} {
+		_, err := DefineMacros(source, func(o *CompileOptions) {
+			o.PreprocessorMacros = macros
+		})
+		require.Error(t, err)
+	}
+}
+
+func TestCompileOptionsMathMode(t *testing.T) {
+	opts := newCompileOptions(nil)
+	require.Equal(t, MathModeFast, opts.mathMode())
+
+	opts = newCompileOptions([]func(*CompileOptions){func(o *CompileOptions) {
+		o.FastMathEnabled = false
+	}})
+	require.Equal(t, MathModeSafe, opts.mathMode())
+
+	opts = newCompileOptions([]func(*CompileOptions){func(o *CompileOptions) {
+		o.FastMathEnabled = false
+		o.MathMode = MathModeRelaxed
+	}})
+	require.Equal(t, MathModeRelaxed, opts.mathMode())
+}
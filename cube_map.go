@@ -0,0 +1,606 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// CubeFace identifies a face of a cube texture by its slice index.
+type CubeFace int
+
+const (
+	// CubeFacePositiveX is the face in the +X direction.
+	CubeFacePositiveX CubeFace = 0
+	// CubeFaceNegativeX is the face in the -X direction.
+	CubeFaceNegativeX CubeFace = 1
+	// CubeFacePositiveY is the face in the +Y direction.
+	CubeFacePositiveY CubeFace = 2
+	// CubeFaceNegativeY is the face in the -Y direction.
+	CubeFaceNegativeY CubeFace = 3
+	// CubeFacePositiveZ is the face in the +Z direction.
+	CubeFacePositiveZ CubeFace = 4
+	// CubeFaceNegativeZ is the face in the -Z direction.
+	CubeFaceNegativeZ CubeFace = 5
+)
+
+// Direction returns the normalized direction through the point (u, v) of the face,
+// where u runs from -1 at the left to 1 at the right edge and v from -1 at the top
+// to 1 at the bottom edge, as seen from the center of the cube.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtltexturetype/cube
+func (f CubeFace) Direction(u, v float64) [3]float64 {
+	var d [3]float64
+
+	switch f {
+	case CubeFacePositiveX:
+		d = [3]float64{1, -v, -u}
+	case CubeFaceNegativeX:
+		d = [3]float64{-1, -v, u}
+	case CubeFacePositiveY:
+		d = [3]float64{u, 1, v}
+	case CubeFaceNegativeY:
+		d = [3]float64{u, -1, -v}
+	case CubeFacePositiveZ:
+		d = [3]float64{u, -v, 1}
+	default:
+		d = [3]float64{-u, -v, -1}
+	}
+
+	return normalize3(d)
+}
+
+// cubeFaceUV returns the face hit by a direction and the face coordinates of the
+// hit point as defined by CubeFace.Direction.
+func cubeFaceUV(d [3]float64) (CubeFace, float64, float64) {
+	ax, ay, az := math.Abs(d[0]), math.Abs(d[1]), math.Abs(d[2])
+
+	switch {
+	case ax >= ay && ax >= az && d[0] >= 0:
+		return CubeFacePositiveX, -d[2] / ax, -d[1] / ax
+	case ax >= ay && ax >= az:
+		return CubeFaceNegativeX, d[2] / ax, -d[1] / ax
+	case ay >= az && d[1] >= 0:
+		return CubeFacePositiveY, d[0] / ay, d[2] / ay
+	case ay >= az:
+		return CubeFaceNegativeY, d[0] / ay, -d[2] / ay
+	case d[2] >= 0:
+		return CubeFacePositiveZ, d[0] / az, -d[1] / az
+	}
+
+	return CubeFaceNegativeZ, -d[0] / az, -d[1] / az
+}
+
+// CubeMap holds the six square faces of a cube texture in Metal's slice order
+// +X, -X, +Y, -Y, +Z, -Z.
+type CubeMap struct {
+	// Size is the width and height of every face in pixels.
+	Size int
+
+	// Faces holds the faces, indexed by CubeFace.
+	Faces [6]*FloatImage
+}
+
+// NewCubeMap returns a cube map of transparent black faces.
+func NewCubeMap(size int) *CubeMap {
+	c := &CubeMap{Size: size}
+
+	for i := range c.Faces {
+		c.Faces[i] = NewFloatImage(size, size)
+	}
+
+	return c
+}
+
+// NewCubeMapFromFaces returns a cube map of six square faces of equal size, ordered
+// by CubeFace.
+func NewCubeMapFromFaces(faces [6]*FloatImage) (*CubeMap, error) {
+	for i, f := range faces {
+		if f == nil {
+			return nil, fmt.Errorf("face %d is nil", i)
+		}
+	}
+
+	c := &CubeMap{Size: faces[0].Width, Faces: faces}
+
+	for i, f := range faces {
+		if f.Width != c.Size || f.Height != c.Size {
+			return nil, fmt.Errorf("face %d is %dx%d, want %dx%d", i, f.Width, f.Height, c.Size, c.Size)
+		}
+	}
+
+	return c, nil
+}
+
+// NewCubeMapFromCross returns a cube map cut from a horizontal cross with a
+// width:height ratio of 4:3. The middle row holds -X, +Z, +X and -Z, with +Y above
+// and -Y below +Z.
+func NewCubeMapFromCross(img *FloatImage) (*CubeMap, error) {
+	size := img.Width / 4
+	if size == 0 || img.Width != 4*size || img.Height != 3*size {
+		return nil, fmt.Errorf("invalid cross dimensions %dx%d", img.Width, img.Height)
+	}
+
+	c := NewCubeMap(size)
+
+	for face, pos := range cubeCrossPositions {
+		for y := 0; y < size; y++ {
+			copy(c.Faces[face].Pix[y*size:(y+1)*size], img.Pix[(pos[1]*size+y)*img.Width+pos[0]*size:])
+		}
+	}
+
+	return c, nil
+}
+
+// NewCubeMapFromTextureLevel returns the cube map stored in the six slices of a
+// texture level in the uncompressed pixel format pf.
+func NewCubeMapFromTextureLevel(l TextureLevel, pf PixelFormat) (*CubeMap, error) {
+	if len(l.Slices) != 6 || l.Width != l.Height {
+		return nil, fmt.Errorf("invalid cube level of %d slices of %dx%d pixels", len(l.Slices), l.Width, l.Height)
+	}
+
+	var faces [6]*FloatImage
+
+	for i, s := range l.Slices {
+		f, err := NewFloatImageFromTexture(s, pf, l.Width, l.Height, l.BytesPerRow)
+		if err != nil {
+			return nil, err
+		}
+
+		faces[i] = f
+	}
+
+	return NewCubeMapFromFaces(faces)
+}
+
+// cubeCrossPositions holds the column and row of every face in a horizontal cross.
+var cubeCrossPositions = [6][2]int{{2, 1}, {0, 1}, {1, 0}, {1, 2}, {1, 1}, {3, 1}}
+
+// Cross returns the faces laid out as a horizontal cross for inspection. The
+// unused areas are transparent black.
+func (c *CubeMap) Cross() *FloatImage {
+	img := NewFloatImage(4*c.Size, 3*c.Size)
+
+	for face, pos := range cubeCrossPositions {
+		for y := 0; y < c.Size; y++ {
+			copy(img.Pix[(pos[1]*c.Size+y)*img.Width+pos[0]*c.Size:], c.Faces[face].Pix[y*c.Size:(y+1)*c.Size])
+		}
+	}
+
+	return img
+}
+
+// TextureLevel returns the faces as a level of a cube texture in the uncompressed
+// pixel format pf, for Texture.ReplaceLevels or the texture container writers.
+func (c *CubeMap) TextureLevel(pf PixelFormat) (TextureLevel, error) {
+	l := newTextureLevel(pf, c.Size, c.Size, 1, 0)
+
+	for _, f := range c.Faces {
+		data, err := f.TextureBytes(pf)
+		if err != nil {
+			return TextureLevel{}, err
+		}
+
+		l.Slices = append(l.Slices, data)
+	}
+
+	return l, nil
+}
+
+// CubeMapOptions configures the conversions between cube maps and panoramas.
+type CubeMapOptions struct {
+	// Filter selects how the source is sampled.
+	Filter ResampleFilter
+
+	// Supersampling is the number of samples per destination pixel along each axis.
+	// Values above 1 reduce aliasing when the source has a higher resolution.
+	Supersampling int
+}
+
+// EquirectToCubeMap converts an equirectangular panorama to a cube map with faces
+// of size*size pixels. The panorama spans 360° horizontally and 180° vertically
+// with +Y at the top. Its center looks toward +Z and its right half toward +X.
+func EquirectToCubeMap(pano *FloatImage, size int, optFns ...func(*CubeMapOptions)) *CubeMap {
+	opts := newCubeMapOptions(optFns)
+	c := NewCubeMap(size)
+
+	forEachCubeFace(func(face CubeFace) {
+		c.Faces[face].supersample(opts.Supersampling, func(x, y float64) FloatColor {
+			u, v := equirectUV(face.Direction(2*x/float64(size)-1, 2*y/float64(size)-1))
+
+			return pano.sample(opts.Filter, u*float64(pano.Width), v*float64(pano.Height), true)
+		})
+	})
+
+	return c
+}
+
+// Equirect converts the cube map to an equirectangular panorama of width*height
+// pixels, as described by EquirectToCubeMap.
+func (c *CubeMap) Equirect(width, height int, optFns ...func(*CubeMapOptions)) *FloatImage {
+	opts := newCubeMapOptions(optFns)
+	img := NewFloatImage(width, height)
+
+	img.supersample(opts.Supersampling, func(x, y float64) FloatColor {
+		return c.Sample(equirectDirection(x/float64(width), y/float64(height)), opts.Filter)
+	})
+
+	return img
+}
+
+// Sample returns the color of the cube map in a direction.
+func (c *CubeMap) Sample(d [3]float64, f ResampleFilter) FloatColor {
+	face, u, v := cubeFaceUV(d)
+	size := float64(c.Size)
+
+	return c.Faces[face].sample(f, (u+1)/2*size, (v+1)/2*size, false)
+}
+
+// newCubeMapOptions returns the options of the cube map conversions.
+func newCubeMapOptions(optFns []func(*CubeMapOptions)) CubeMapOptions {
+	opts := CubeMapOptions{
+		Filter:        ResampleFilterBilinear,
+		Supersampling: 1,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if opts.Supersampling < 1 {
+		opts.Supersampling = 1
+	}
+
+	return opts
+}
+
+// supersample sets every pixel to the average of n*n colors returned by fn for
+// continuous coordinates within the pixel.
+func (img *FloatImage) supersample(n int, fn func(x, y float64) FloatColor) {
+	w := 1 / float64(n*n)
+
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			var sum [4]float64
+
+			for j := 0; j < n; j++ {
+				for i := 0; i < n; i++ {
+					sum = addScaled(sum, fn(float64(x)+(float64(i)+0.5)/float64(n), float64(y)+(float64(j)+0.5)/float64(n)), w)
+				}
+			}
+
+			img.Pix[y*img.Width+x] = FloatColor{float32(sum[0]), float32(sum[1]), float32(sum[2]), float32(sum[3])}
+		}
+	}
+}
+
+// equirectUV returns the panorama coordinates in [0, 1] of a direction.
+func equirectUV(d [3]float64) (u, v float64) {
+	return 0.5 + math.Atan2(d[0], d[2])/(2*math.Pi), math.Acos(clamp(d[1], -1, 1)) / math.Pi
+}
+
+// equirectDirection returns the direction of panorama coordinates in [0, 1].
+func equirectDirection(u, v float64) [3]float64 {
+	phi, theta := (u-0.5)*2*math.Pi, v*math.Pi
+
+	return [3]float64{math.Sin(theta) * math.Sin(phi), math.Cos(theta), math.Sin(theta) * math.Cos(phi)}
+}
+
+// SphericalHarmonics holds the RGB coefficients of the first three bands of real
+// spherical harmonics, in the order L00, L1-1, L10, L11, L2-2, L2-1, L20, L21, L22.
+type SphericalHarmonics [9][3]float64
+
+// shBasis returns the spherical harmonics basis functions for a normalized direction.
+func shBasis(d [3]float64) [9]float64 {
+	x, y, z := d[0], d[1], d[2]
+
+	return [9]float64{
+		0.282095,
+		0.488603 * y,
+		0.488603 * z,
+		0.488603 * x,
+		1.092548 * x * y,
+		1.092548 * y * z,
+		0.315392 * (3*z*z - 1),
+		1.092548 * x * z,
+		0.546274 * (x*x - y*y),
+	}
+}
+
+// SphericalHarmonics projects the radiance of the cube map onto spherical harmonics,
+// weighting every texel by its solid angle.
+//
+// Reference: https://graphics.stanford.edu/papers/envmap/envmap.pdf
+func (c *CubeMap) SphericalHarmonics() SphericalHarmonics {
+	var sh SphericalHarmonics
+
+	size := float64(c.Size)
+
+	for face, img := range c.Faces {
+		for y := 0; y < c.Size; y++ {
+			for x := 0; x < c.Size; x++ {
+				u, v := (2*float64(x)+1)/size-1, (2*float64(y)+1)/size-1
+				w := texelSolidAngle(u, v, 1/size)
+				basis := shBasis(CubeFace(face).Direction(u, v))
+				p := img.Pix[y*c.Size+x]
+
+				for i, b := range basis {
+					sh[i][0] += float64(p.R) * b * w
+					sh[i][1] += float64(p.G) * b * w
+					sh[i][2] += float64(p.B) * b * w
+				}
+			}
+		}
+	}
+
+	return sh
+}
+
+// Irradiance returns the irradiance from the spherical harmonics radiance for a
+// surface facing a direction, divided by π. This is the light reflected by a white
+// Lambertian surface, so a constant environment yields its own radiance.
+func (sh SphericalHarmonics) Irradiance(d [3]float64) FloatColor {
+	// Convolution with the clamped cosine lobe scales the bands by π, 2π/3 and π/4.
+	bands := [9]float64{1, 2.0 / 3, 2.0 / 3, 2.0 / 3, 0.25, 0.25, 0.25, 0.25, 0.25}
+	basis := shBasis(normalize3(d))
+
+	var rgb [3]float64
+
+	for i, b := range basis {
+		for ch := range rgb {
+			rgb[ch] += sh[i][ch] * b * bands[i]
+		}
+	}
+
+	return FloatColor{
+		float32(math.Max(0, rgb[0])),
+		float32(math.Max(0, rgb[1])),
+		float32(math.Max(0, rgb[2])),
+		1,
+	}
+}
+
+// Irradiance returns a diffuse irradiance cube map with faces of size*size pixels,
+// as described by SphericalHarmonics.Irradiance.
+func (c *CubeMap) Irradiance(size int) *CubeMap {
+	sh := c.SphericalHarmonics()
+	out := NewCubeMap(size)
+
+	forEachCubeFace(func(face CubeFace) {
+		out.Faces[face].supersample(1, func(x, y float64) FloatColor {
+			return sh.Irradiance(face.Direction(2*x/float64(size)-1, 2*y/float64(size)-1))
+		})
+	})
+
+	return out
+}
+
+// PrefilterOptions configures CubeMap.PrefilterSpecular.
+type PrefilterOptions struct {
+	// LevelCount is the number of levels, including the unfiltered base level.
+	// A value of 0 generates levels down to 1x1.
+	LevelCount int
+
+	// SampleCount is the number of GGX importance samples per texel.
+	SampleCount int
+}
+
+// PrefilterSpecular returns the levels of a specular environment map for split-sum
+// image-based lighting. Level i halves the size of the previous one and is
+// convolved with the GGX distribution for a perceptual roughness of i/(LevelCount-1),
+// assuming that the view and reflection directions equal the normal. Samples are
+// read from a box-filtered mip chain of the cube map to reduce noise.
+//
+// Reference: https://cdn2.unrealengine.com/Resources/files/2013SiggraphPresentationsNotes-26915738.pdf
+func (c *CubeMap) PrefilterSpecular(optFns ...func(*PrefilterOptions)) ([]*CubeMap, error) {
+	opts := PrefilterOptions{
+		LevelCount:  0,
+		SampleCount: 256,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if c.Size <= 0 {
+		return nil, errors.New("cube map has no pixels")
+	}
+
+	if opts.SampleCount <= 0 {
+		return nil, fmt.Errorf("invalid sample count %d", opts.SampleCount)
+	}
+
+	chain := []*CubeMap{c}
+	for chain[len(chain)-1].Size > 1 {
+		chain = append(chain, chain[len(chain)-1].downsample())
+	}
+
+	levelCount := opts.LevelCount
+	if levelCount <= 0 || levelCount > len(chain) {
+		levelCount = len(chain)
+	}
+
+	levels := []*CubeMap{c}
+
+	for i := 1; i < levelCount; i++ {
+		roughness := float64(i) / float64(levelCount-1)
+		a := roughness * roughness
+		size := chain[i].Size
+		out := NewCubeMap(size)
+
+		// The solid angle of a texel of the base level, for selecting source levels.
+		baseSolidAngle := 4 * math.Pi / (6 * float64(c.Size*c.Size))
+
+		forEachCubeFace(func(face CubeFace) {
+			out.Faces[face].supersample(1, func(x, y float64) FloatColor {
+				n := face.Direction(2*x/float64(size)-1, 2*y/float64(size)-1)
+				t, b := tangentBasis(n)
+
+				var (
+					sum    [4]float64
+					weight float64
+				)
+
+				for s := 0; s < opts.SampleCount; s++ {
+					h, nDotH := importanceSampleGGX(s, opts.SampleCount, a, n, t, b)
+					l := [3]float64{2*nDotH*h[0] - n[0], 2*nDotH*h[1] - n[1], 2*nDotH*h[2] - n[2]}
+
+					nDotL := dot3(n, l)
+					if nDotL <= 0 {
+						continue
+					}
+
+					// With the view direction equal to the normal, the pdf is D/4.
+					pdf := ggx(nDotH, a) / 4
+					sampleSolidAngle := 1 / (float64(opts.SampleCount) * pdf)
+					lod := math.Max(0, 0.5*math.Log2(sampleSolidAngle/baseSolidAngle)+1)
+
+					sum = addScaled(sum, sampleChain(chain, l, lod), nDotL)
+					weight += nDotL
+				}
+
+				if weight == 0 {
+					return chain[0].Sample(n, ResampleFilterBilinear)
+				}
+
+				return FloatColor{float32(sum[0] / weight), float32(sum[1] / weight), float32(sum[2] / weight), float32(sum[3] / weight)}
+			})
+		})
+
+		levels = append(levels, out)
+	}
+
+	return levels, nil
+}
+
+// downsample returns the cube map with faces of half the size, averaging 2x2 pixels.
+func (c *CubeMap) downsample() *CubeMap {
+	size := mipmapSize(c.Size, 1)
+	out := NewCubeMap(size)
+
+	for face, src := range c.Faces {
+		dst := out.Faces[face]
+
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				var sum [4]float64
+
+				for j := 0; j < 2; j++ {
+					for i := 0; i < 2; i++ {
+						sum = addScaled(sum, src.texel(2*x+i, 2*y+j, false), 0.25)
+					}
+				}
+
+				dst.Pix[y*size+x] = FloatColor{float32(sum[0]), float32(sum[1]), float32(sum[2]), float32(sum[3])}
+			}
+		}
+	}
+
+	return out
+}
+
+// sampleChain samples a mip chain of cube maps trilinearly at a fractional level.
+func sampleChain(chain []*CubeMap, d [3]float64, lod float64) FloatColor {
+	if lod >= float64(len(chain)-1) {
+		return chain[len(chain)-1].Sample(d, ResampleFilterBilinear)
+	}
+
+	i := int(lod)
+	f := lod - float64(i)
+	a := chain[i].Sample(d, ResampleFilterBilinear)
+
+	if f == 0 {
+		return a
+	}
+
+	sum := addScaled(addScaled([4]float64{}, a, 1-f), chain[i+1].Sample(d, ResampleFilterBilinear), f)
+
+	return FloatColor{float32(sum[0]), float32(sum[1]), float32(sum[2]), float32(sum[3])}
+}
+
+// importanceSampleGGX returns the half vector of sample i of n from a Hammersley
+// sequence distributed according to GGX with alpha a around the normal, and the
+// cosine between it and the normal.
+func importanceSampleGGX(i, n int, a float64, normal, tangent, bitangent [3]float64) ([3]float64, float64) {
+	xi1 := float64(i) / float64(n)
+	xi2 := float64(bits.Reverse32(uint32(i))) / (1 << 32)
+
+	phi := 2 * math.Pi * xi1
+	cosTheta := math.Sqrt((1 - xi2) / (1 + (a*a-1)*xi2))
+	sinTheta := math.Sqrt(1 - cosTheta*cosTheta)
+
+	hx, hy := sinTheta*math.Cos(phi), sinTheta*math.Sin(phi)
+
+	return normalize3([3]float64{
+		tangent[0]*hx + bitangent[0]*hy + normal[0]*cosTheta,
+		tangent[1]*hx + bitangent[1]*hy + normal[1]*cosTheta,
+		tangent[2]*hx + bitangent[2]*hy + normal[2]*cosTheta,
+	}), cosTheta
+}
+
+// ggx returns the GGX normal distribution for the cosine between the normal and
+// the half vector.
+func ggx(nDotH, a float64) float64 {
+	a2 := a * a
+	d := nDotH*nDotH*(a2-1) + 1
+
+	return a2 / (math.Pi * d * d)
+}
+
+// texelSolidAngle returns the solid angle of a cube face texel centered at (u, v)
+// with a half size of h in face coordinates.
+func texelSolidAngle(u, v, h float64) float64 {
+	area := func(x, y float64) float64 { return math.Atan2(x*y, math.Sqrt(x*x+y*y+1)) }
+
+	return area(u-h, v-h) - area(u-h, v+h) - area(u+h, v-h) + area(u+h, v+h)
+}
+
+// tangentBasis returns two vectors that form an orthonormal basis with the normal.
+func tangentBasis(n [3]float64) ([3]float64, [3]float64) {
+	up := [3]float64{0, 0, 1}
+	if math.Abs(n[2]) > 0.999 {
+		up = [3]float64{1, 0, 0}
+	}
+
+	t := normalize3(cross3(up, n))
+
+	return t, cross3(n, t)
+}
+
+// forEachCubeFace calls fn for the six faces concurrently and waits for it to return.
+func forEachCubeFace(fn func(face CubeFace)) {
+	var wg sync.WaitGroup
+
+	for face := CubeFacePositiveX; face <= CubeFaceNegativeZ; face++ {
+		wg.Add(1)
+
+		go func(face CubeFace) {
+			defer wg.Done()
+			fn(face)
+		}(face)
+	}
+
+	wg.Wait()
+}
+
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func normalize3(v [3]float64) [3]float64 {
+	l := math.Sqrt(dot3(v, v))
+	if l == 0 {
+		return v
+	}
+
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
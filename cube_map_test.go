@@ -0,0 +1,217 @@
+package mtl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCubeMap(size int) *CubeMap {
+	c := NewCubeMap(size)
+
+	for face, img := range c.Faces {
+		for i := range img.Pix {
+			img.Pix[i] = FloatColor{float32(face) / 5, float32(i) / float32(len(img.Pix)), 0.5, 1}
+		}
+	}
+
+	return c
+}
+
+func TestCubeFaceDirection(t *testing.T) {
+	require.Equal(t, [3]float64{0, 0, 1}, CubeFacePositiveZ.Direction(0, 0))
+	require.Equal(t, [3]float64{0, 1, 0}, CubeFacePositiveY.Direction(0, 0))
+
+	// The top left corner of +X points up and toward +Z.
+	d := CubeFacePositiveX.Direction(-1, -1)
+	require.InDeltaSlice(t, []float64{1, 1, 1}, []float64{d[0] * math.Sqrt(3), d[1] * math.Sqrt(3), d[2] * math.Sqrt(3)}, 1e-12)
+
+	for face := CubeFacePositiveX; face <= CubeFaceNegativeZ; face++ {
+		for _, uv := range [][2]float64{{0, 0}, {0.5, -0.25}, {-0.9, 0.9}} {
+			got, u, v := cubeFaceUV(face.Direction(uv[0], uv[1]))
+			require.Equal(t, face, got)
+			require.InDelta(t, uv[0], u, 1e-12)
+			require.InDelta(t, uv[1], v, 1e-12)
+		}
+	}
+}
+
+func TestCubeMapCross(t *testing.T) {
+	c := newTestCubeMap(4)
+
+	cross := c.Cross()
+	require.Equal(t, 16, cross.Width)
+	require.Equal(t, 12, cross.Height)
+	require.Equal(t, c.Faces[CubeFacePositiveY].Pix[0], cross.Pix[4])
+	require.Equal(t, FloatColor{}, cross.Pix[0])
+
+	got, err := NewCubeMapFromCross(cross)
+	require.NoError(t, err)
+	require.Equal(t, c, got)
+
+	_, err = NewCubeMapFromCross(NewFloatImage(8, 8))
+	require.ErrorContains(t, err, "invalid cross dimensions")
+}
+
+func TestCubeMapFromFaces(t *testing.T) {
+	c := newTestCubeMap(4)
+
+	got, err := NewCubeMapFromFaces(c.Faces)
+	require.NoError(t, err)
+	require.Equal(t, c, got)
+
+	faces := c.Faces
+	faces[CubeFaceNegativeY] = nil
+	_, err = NewCubeMapFromFaces(faces)
+	require.EqualError(t, err, "face 3 is nil")
+
+	faces[CubeFaceNegativeY] = NewFloatImage(4, 2)
+	_, err = NewCubeMapFromFaces(faces)
+	require.EqualError(t, err, "face 3 is 4x2, want 4x4")
+}
+
+func TestCubeMapTextureLevel(t *testing.T) {
+	c := newTestCubeMap(4)
+
+	l, err := c.TextureLevel(PixelFormatRGBA32Float)
+	require.NoError(t, err)
+	require.Len(t, l.Slices, 6)
+
+	got, err := NewCubeMapFromTextureLevel(l, PixelFormatRGBA32Float)
+	require.NoError(t, err)
+	require.Equal(t, c, got)
+}
+
+func TestEquirectToCubeMap(t *testing.T) {
+	// The red channel of the panorama holds the horizontal and the green channel
+	// the vertical panorama coordinate.
+	pano := NewFloatImage(64, 32)
+	for y := 0; y < pano.Height; y++ {
+		for x := 0; x < pano.Width; x++ {
+			pano.Pix[y*pano.Width+x] = FloatColor{(float32(x) + 0.5) / 64, (float32(y) + 0.5) / 32, 0, 1}
+		}
+	}
+
+	for _, filter := range []ResampleFilter{ResampleFilterNearest, ResampleFilterBilinear, ResampleFilterBicubic} {
+		c := EquirectToCubeMap(pano, 8, func(o *CubeMapOptions) {
+			o.Filter = filter
+			o.Supersampling = 2
+		})
+
+		center := func(face CubeFace) FloatColor {
+			f := c.Faces[face]
+			var sum [4]float64
+			for _, i := range []int{27, 28, 35, 36} {
+				sum = addScaled(sum, f.Pix[i], 0.25)
+			}
+
+			return FloatColor{float32(sum[0]), float32(sum[1]), float32(sum[2]), float32(sum[3])}
+		}
+
+		require.InDelta(t, 0.5, center(CubeFacePositiveZ).R, 0.02, filter)
+		require.InDelta(t, 0.5, center(CubeFacePositiveZ).G, 0.02, filter)
+		require.InDelta(t, 0.75, center(CubeFacePositiveX).R, 0.02, filter)
+		require.InDelta(t, 0.25, center(CubeFaceNegativeX).R, 0.02, filter)
+		require.Less(t, center(CubeFacePositiveY).G, float32(0.1), filter)
+		require.Greater(t, center(CubeFaceNegativeY).G, float32(0.9), filter)
+	}
+
+	// Converting back reproduces the panorama away from the seam and the poles.
+	back := EquirectToCubeMap(pano, 32).Equirect(64, 32)
+	for y := 8; y < 24; y++ {
+		for x := 4; x < 60; x++ {
+			require.InDelta(t, pano.Pix[y*64+x].R, back.Pix[y*64+x].R, 0.02)
+			require.InDelta(t, pano.Pix[y*64+x].G, back.Pix[y*64+x].G, 0.02)
+		}
+	}
+}
+
+func TestCubeMapIrradiance(t *testing.T) {
+	c := NewCubeMap(8)
+	for _, f := range c.Faces {
+		for i := range f.Pix {
+			f.Pix[i] = FloatColor{1, 0.5, 0.25, 1}
+		}
+	}
+
+	// A constant environment has only a constant term, and reflects its own radiance.
+	sh := c.SphericalHarmonics()
+	require.InDelta(t, 2*math.Sqrt(math.Pi), sh[0][0], 1e-3)
+	require.InDelta(t, 0, sh[2][0], 1e-9)
+
+	irradiance := c.Irradiance(4)
+	require.Equal(t, 4, irradiance.Size)
+	require.InDelta(t, 1, irradiance.Faces[CubeFaceNegativeY].Pix[5].R, 1e-3)
+	require.InDelta(t, 0.25, irradiance.Faces[CubeFacePositiveZ].Pix[0].B, 1e-3)
+
+	// Light from above brightens surfaces facing up.
+	c = NewCubeMap(8)
+	for i := range c.Faces[CubeFacePositiveY].Pix {
+		c.Faces[CubeFacePositiveY].Pix[i] = FloatColor{1, 1, 1, 1}
+	}
+
+	sh = c.SphericalHarmonics()
+	up, down := sh.Irradiance([3]float64{0, 1, 0}), sh.Irradiance([3]float64{0, -1, 0})
+	side := sh.Irradiance([3]float64{1, 0, 0})
+	require.Greater(t, up.R, side.R)
+	require.Greater(t, side.R, down.R)
+	require.InDelta(t, 0, down.R, 0.05)
+}
+
+func TestCubeMapPrefilterSpecular(t *testing.T) {
+	c := NewCubeMap(16)
+	for face, f := range c.Faces {
+		for i := range f.Pix {
+			f.Pix[i] = FloatColor{0.5, 0.5, 0.5, 1}
+			if face == int(CubeFacePositiveZ) {
+				f.Pix[i] = FloatColor{4, 4, 4, 1}
+			}
+		}
+	}
+
+	levels, err := c.PrefilterSpecular(func(o *PrefilterOptions) { o.SampleCount = 64 })
+	require.NoError(t, err)
+	require.Len(t, levels, 5)
+	require.Same(t, c, levels[0])
+
+	// Rougher levels are smaller and spread the bright face into its neighbors,
+	// while the opposite face stays dark at low roughness.
+	for i, l := range levels[1:] {
+		require.Equal(t, 16>>(i+1), l.Size)
+
+		edge := l.Faces[CubeFacePositiveX].Pix[l.Size/2*l.Size]
+		require.Greater(t, edge.R, float32(0.5), i)
+		require.InDelta(t, 1, edge.A, 1e-5)
+	}
+
+	require.InDelta(t, 0.5, levels[1].Faces[CubeFaceNegativeZ].Pix[4*8+4].R, 0.01)
+
+	levels, err = c.PrefilterSpecular(func(o *PrefilterOptions) { o.LevelCount = 2 })
+	require.NoError(t, err)
+	require.Len(t, levels, 2)
+
+	_, err = c.PrefilterSpecular(func(o *PrefilterOptions) { o.SampleCount = -1 })
+	require.ErrorContains(t, err, "invalid sample count")
+}
+
+func TestFloatImage(t *testing.T) {
+	img, err := NewFloatImageFromTexture([]byte{188, 0, 255, 128}, PixelFormatRGBA8UnormSRGB, 1, 1, 0)
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, img.Pix[0].R, 0.005)
+	require.InDelta(t, 128.0/255, img.Pix[0].A, 1e-6)
+
+	data, err := img.TextureBytes(PixelFormatRGBA8UnormSRGB)
+	require.NoError(t, err)
+	require.Equal(t, []byte{188, 0, 255, 128}, data)
+
+	img = NewFloatImage(2, 1)
+	img.Pix[0], img.Pix[1] = FloatColor{0, 0, 0, 1}, FloatColor{1, 1, 1, 1}
+	require.Equal(t, float32(0.5), img.sample(ResampleFilterBilinear, 1, 0.5, false).R)
+	require.Equal(t, float32(0.5), img.sample(ResampleFilterBilinear, 2, 0.5, true).R)
+	require.Equal(t, float32(1), img.sample(ResampleFilterBilinear, 2, 0.5, false).R)
+	require.Equal(t, float32(1), img.sample(ResampleFilterNearest, 1.6, 0.5, false).R)
+
+	_, err = img.TextureBytes(PixelFormatR8Uint)
+	require.ErrorContains(t, err, "cannot be filtered")
+}
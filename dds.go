@@ -0,0 +1,566 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Values of the DDS header.
+const (
+	ddsMagic = 0x20534444 // "DDS "
+
+	ddsdCaps        = 0x1
+	ddsdHeight      = 0x2
+	ddsdWidth       = 0x4
+	ddsdPitch       = 0x8
+	ddsdPixelFormat = 0x1000
+	ddsdMipmapCount = 0x20000
+	ddsdLinearSize  = 0x80000
+	ddsdDepth       = 0x800000
+
+	ddpfAlphaPixels = 0x1
+	ddpfAlpha       = 0x2
+	ddpfFourCC      = 0x4
+	ddpfRGB         = 0x40
+	ddpfLuminance   = 0x20000
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipmap  = 0x400000
+
+	ddsCaps2Cubemap         = 0x200
+	ddsCaps2CubemapAllFaces = 0xFC00
+	ddsCaps2Volume          = 0x200000
+
+	ddsDimensionTexture1D = 2
+	ddsDimensionTexture2D = 3
+	ddsDimensionTexture3D = 4
+
+	ddsMiscTextureCube = 0x4
+)
+
+// fourCC returns the little-endian code of a four-character string.
+func fourCC(s string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(s))
+}
+
+// dxgiFormats maps DXGI_FORMAT values to pixel formats.
+var dxgiFormats = []struct {
+	dxgiFormat  uint32
+	pixelFormat PixelFormat
+}{
+	{2, PixelFormatRGBA32Float},
+	{3, PixelFormatRGBA32Uint},
+	{4, PixelFormatRGBA32Sint},
+	{10, PixelFormatRGBA16Float},
+	{11, PixelFormatRGBA16Unorm},
+	{12, PixelFormatRGBA16Uint},
+	{13, PixelFormatRGBA16Snorm},
+	{14, PixelFormatRGBA16Sint},
+	{16, PixelFormatRG32Float},
+	{17, PixelFormatRG32Uint},
+	{18, PixelFormatRG32Sint},
+	{20, PixelFormatDepth32FloatStencil8},
+	{24, PixelFormatRGB10A2Unorm},
+	{25, PixelFormatRGB10A2Uint},
+	{26, PixelFormatRG11B10Float},
+	{28, PixelFormatRGBA8Unorm},
+	{29, PixelFormatRGBA8UnormSRGB},
+	{30, PixelFormatRGBA8Uint},
+	{31, PixelFormatRGBA8Snorm},
+	{32, PixelFormatRGBA8Sint},
+	{34, PixelFormatRG16Float},
+	{35, PixelFormatRG16Unorm},
+	{36, PixelFormatRG16Uint},
+	{37, PixelFormatRG16Snorm},
+	{38, PixelFormatRG16Sint},
+	{40, PixelFormatDepth32Float},
+	{41, PixelFormatR32Float},
+	{42, PixelFormatR32Uint},
+	{43, PixelFormatR32Sint},
+	{45, PixelFormatDepth24UnormStencil8},
+	{49, PixelFormatRG8Unorm},
+	{50, PixelFormatRG8Uint},
+	{51, PixelFormatRG8Snorm},
+	{52, PixelFormatRG8Sint},
+	{54, PixelFormatR16Float},
+	{55, PixelFormatDepth16Unorm},
+	{56, PixelFormatR16Unorm},
+	{57, PixelFormatR16Uint},
+	{58, PixelFormatR16Snorm},
+	{59, PixelFormatR16Sint},
+	{61, PixelFormatR8Unorm},
+	{62, PixelFormatR8Uint},
+	{63, PixelFormatR8Snorm},
+	{64, PixelFormatR8Sint},
+	{65, PixelFormatA8Unorm},
+	{67, PixelFormatRGB9E5Float},
+	{71, PixelFormatBC1RGBA},
+	{72, PixelFormatBC1RGBASRGB},
+	{74, PixelFormatBC2RGBA},
+	{75, PixelFormatBC2RGBASRGB},
+	{77, PixelFormatBC3RGBA},
+	{78, PixelFormatBC3RGBASRGB},
+	{80, PixelFormatBC4RUnorm},
+	{81, PixelFormatBC4RSnorm},
+	{83, PixelFormatBC5RGUnorm},
+	{84, PixelFormatBC5RGSnorm},
+	{85, PixelFormatB5G6R5Unorm},
+	{86, PixelFormatBGR5A1Unorm},
+	{87, PixelFormatBGRA8Unorm},
+	{91, PixelFormatBGRA8UnormSRGB},
+	{95, PixelFormatBC6HRGBUfloat},
+	{96, PixelFormatBC6HRGBFloat},
+	{98, PixelFormatBC7RGBAUnorm},
+	{99, PixelFormatBC7RGBAUnormSRGB},
+}
+
+// ddsFourCCs maps the FourCC codes of legacy DDS headers to pixel formats.
+// Numeric codes are D3DFORMAT values. The first entry wins when writing.
+var ddsFourCCs = []struct {
+	fourCC      uint32
+	pixelFormat PixelFormat
+}{
+	{fourCC("DXT1"), PixelFormatBC1RGBA},
+	{fourCC("DXT3"), PixelFormatBC2RGBA},
+	{fourCC("DXT2"), PixelFormatBC2RGBA},
+	{fourCC("DXT5"), PixelFormatBC3RGBA},
+	{fourCC("DXT4"), PixelFormatBC3RGBA},
+	{fourCC("ATI1"), PixelFormatBC4RUnorm},
+	{fourCC("BC4U"), PixelFormatBC4RUnorm},
+	{fourCC("BC4S"), PixelFormatBC4RSnorm},
+	{fourCC("ATI2"), PixelFormatBC5RGUnorm},
+	{fourCC("BC5U"), PixelFormatBC5RGUnorm},
+	{fourCC("BC5S"), PixelFormatBC5RGSnorm},
+	{fourCC("BC6H"), PixelFormatBC6HRGBUfloat},
+	{fourCC("BC7L"), PixelFormatBC7RGBAUnorm},
+	{fourCC("BC7\x00"), PixelFormatBC7RGBAUnorm},
+	{36, PixelFormatRGBA16Unorm},
+	{110, PixelFormatRGBA16Snorm},
+	{111, PixelFormatR16Float},
+	{112, PixelFormatRG16Float},
+	{113, PixelFormatRGBA16Float},
+	{114, PixelFormatR32Float},
+	{115, PixelFormatRG32Float},
+	{116, PixelFormatRGBA32Float},
+}
+
+// ddsMask describes an uncompressed pixel format of a legacy DDS header.
+type ddsMask struct {
+	flags       uint32
+	bitCount    uint32
+	masks       [4]uint32
+	pixelFormat PixelFormat
+}
+
+// ddsMasks maps the bit masks of legacy uncompressed DDS headers to pixel formats.
+var ddsMasks = []ddsMask{
+	{ddpfRGB | ddpfAlphaPixels, 32, [4]uint32{0xff, 0xff00, 0xff0000, 0xff000000}, PixelFormatRGBA8Unorm},
+	{ddpfRGB | ddpfAlphaPixels, 32, [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}, PixelFormatBGRA8Unorm},
+	{ddpfRGB | ddpfAlphaPixels, 32, [4]uint32{0x3ff, 0xffc00, 0x3ff00000, 0xc0000000}, PixelFormatRGB10A2Unorm},
+	{ddpfRGB | ddpfAlphaPixels, 32, [4]uint32{0x3ff00000, 0xffc00, 0x3ff, 0xc0000000}, PixelFormatBGR10A2Unorm},
+	{ddpfRGB, 32, [4]uint32{0xffff, 0xffff0000, 0, 0}, PixelFormatRG16Unorm},
+	{ddpfRGB, 16, [4]uint32{0xf800, 0x7e0, 0x1f, 0}, PixelFormatB5G6R5Unorm},
+	{ddpfRGB | ddpfAlphaPixels, 16, [4]uint32{0x7c00, 0x3e0, 0x1f, 0x8000}, PixelFormatBGR5A1Unorm},
+	{ddpfLuminance, 8, [4]uint32{0xff, 0, 0, 0}, PixelFormatR8Unorm},
+	{ddpfLuminance, 16, [4]uint32{0xffff, 0, 0, 0}, PixelFormatR16Unorm},
+	{ddpfAlpha, 8, [4]uint32{0, 0, 0, 0xff}, PixelFormatA8Unorm},
+}
+
+// DDSTexture is a texture stored in the DirectDraw Surface file format.
+//
+// Reference: https://learn.microsoft.com/en-us/windows/win32/direct3ddds/dx-graphics-dds-pguide
+type DDSTexture struct {
+	// PixelFormat is the pixel format of the texture data.
+	PixelFormat PixelFormat
+
+	// Width, Height and Depth are the dimensions of the base level in pixels.
+	// Height is 0 for 1D textures and Depth is 0 for textures that are not volumes.
+	Width, Height, Depth int
+
+	// ArrayLength is the number of array elements, or 0 for textures that are not arrays.
+	ArrayLength int
+
+	// FaceCount is 6 for cube textures and 1 otherwise.
+	FaceCount int
+
+	// Levels holds the mipmap levels, starting at the base level. Every level has
+	// max(ArrayLength, 1) * FaceCount slices with tightly packed rows.
+	Levels []TextureLevel
+}
+
+// TextureDescriptor returns a descriptor for a texture that holds all levels of the DDS texture.
+func (d *DDSTexture) TextureDescriptor() TextureDescriptor {
+	return levelsTextureDescriptor(d.PixelFormat, d.Width, d.Height, d.Depth, d.ArrayLength, d.FaceCount, len(d.Levels))
+}
+
+// ReadDDS reads a texture in the DDS file format with a legacy or a DX10 header.
+func ReadDDS(r io.Reader) (*DDSTexture, error) {
+	var header [128]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read DDS header: %w", err)
+	}
+
+	le := binary.LittleEndian
+	h := header[4:]
+
+	if le.Uint32(header[:]) != ddsMagic || le.Uint32(h) != 124 {
+		return nil, errors.New("invalid DDS file identifier")
+	}
+
+	flags, height, width := le.Uint32(h[4:]), le.Uint32(h[8:]), le.Uint32(h[12:])
+	depth, levelCount := le.Uint32(h[20:]), le.Uint32(h[24:])
+	pfFlags, pfFourCC, pfBitCount := le.Uint32(h[76:]), le.Uint32(h[80:]), le.Uint32(h[84:])
+	masks := [4]uint32{le.Uint32(h[88:]), le.Uint32(h[92:]), le.Uint32(h[96:]), le.Uint32(h[100:])}
+	caps2 := le.Uint32(h[108:])
+
+	d := &DDSTexture{
+		Width:     int(width),
+		Height:    int(height),
+		FaceCount: 1,
+	}
+
+	if flags&ddsdMipmapCount == 0 || levelCount == 0 {
+		levelCount = 1
+	}
+
+	switch {
+	case pfFlags&ddpfFourCC != 0 && pfFourCC == fourCC("DX10"):
+		var dx10 [20]byte
+		if _, err := io.ReadFull(r, dx10[:]); err != nil {
+			return nil, fmt.Errorf("failed to read DDS DX10 header: %w", err)
+		}
+
+		format, dimension, misc, arraySize := le.Uint32(dx10[:]), le.Uint32(dx10[4:]), le.Uint32(dx10[8:]), le.Uint32(dx10[12:])
+
+		pf, ok := dxgiPixelFormat(format)
+		if !ok {
+			return nil, fmt.Errorf("unsupported DDS DXGI format %d", format)
+		}
+
+		d.PixelFormat = pf
+
+		switch dimension {
+		case ddsDimensionTexture1D:
+			d.Height = 0
+		case ddsDimensionTexture2D:
+			if misc&ddsMiscTextureCube != 0 {
+				d.FaceCount = 6
+			}
+		case ddsDimensionTexture3D:
+			d.Depth = int(depth)
+		default:
+			return nil, fmt.Errorf("unsupported DDS resource dimension %d", dimension)
+		}
+
+		if arraySize > 1 {
+			d.ArrayLength = int(arraySize)
+		}
+	case pfFlags&ddpfFourCC != 0:
+		pf, ok := fourCCPixelFormat(pfFourCC)
+		if !ok {
+			return nil, fmt.Errorf("unsupported DDS FourCC %q", string(le.AppendUint32(nil, pfFourCC)))
+		}
+
+		d.PixelFormat = pf
+	default:
+		pf, ok := maskPixelFormat(pfFlags, pfBitCount, masks)
+		if !ok {
+			return nil, fmt.Errorf("unsupported DDS pixel format with %d bits and masks %#x", pfBitCount, masks)
+		}
+
+		d.PixelFormat = pf
+	}
+
+	if caps2&ddsCaps2Cubemap != 0 {
+		if caps2&ddsCaps2CubemapAllFaces != ddsCaps2CubemapAllFaces {
+			return nil, errors.New("DDS cube maps with missing faces are not supported")
+		}
+
+		d.FaceCount = 6
+	}
+
+	if caps2&ddsCaps2Volume != 0 && flags&ddsdDepth != 0 {
+		d.Depth = int(depth)
+	}
+
+	if d.Width == 0 || d.Width > 1<<16 || d.Height > 1<<16 || d.Depth > 1<<16 || d.ArrayLength > 1<<16 {
+		return nil, fmt.Errorf("invalid DDS dimensions %dx%dx%d with %d array elements", d.Width, d.Height, d.Depth, d.ArrayLength)
+	}
+
+	if levelCount > 17 {
+		return nil, fmt.Errorf("invalid DDS mipmap level count %d", levelCount)
+	}
+
+	slices := d.FaceCount
+	if d.ArrayLength > 0 {
+		slices *= d.ArrayLength
+	}
+
+	for i := 0; i < int(levelCount); i++ {
+		d.Levels = append(d.Levels, newTextureLevel(d.PixelFormat, mipmapSize(d.Width, i), mipmapSize(d.Height, i), mipmapSize(d.Depth, i), 0))
+	}
+
+	// The mipmap chains of the array elements and faces are stored one after another.
+	for s := 0; s < slices; s++ {
+		for i := range d.Levels {
+			l := &d.Levels[i]
+
+			data, err := readFull(r, l.BytesPerImage*l.Depth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read DDS data of slice %d, level %d: %w", s, i, err)
+			}
+
+			l.Slices = append(l.Slices, data)
+		}
+	}
+
+	return d, nil
+}
+
+// DDSOptions configures WriteDDS.
+type DDSOptions struct {
+	// LegacyHeader writes a header without the DX10 extension, which older tools
+	// require. Texture arrays and pixel formats without a FourCC code or bit masks
+	// cannot be written with a legacy header.
+	LegacyHeader bool
+}
+
+// WriteDDS writes a texture in the DDS file format.
+func WriteDDS(w io.Writer, d *DDSTexture, optFns ...func(*DDSOptions)) error {
+	opts := DDSOptions{
+		LegacyHeader: false,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if d.FaceCount != 1 && d.FaceCount != 6 {
+		return fmt.Errorf("invalid face count %d", d.FaceCount)
+	}
+
+	if len(d.Levels) == 0 {
+		return errors.New("texture has no mipmap levels")
+	}
+
+	slices := d.FaceCount
+	if d.ArrayLength > 0 {
+		slices *= d.ArrayLength
+	}
+
+	le := binary.LittleEndian
+	header := make([]byte, 128)
+	h := header[4:]
+
+	height := d.Height
+	if height == 0 {
+		height = 1
+	}
+
+	bytesPerRow, rows := d.PixelFormat.imageSize(d.Width, height)
+
+	flags := uint32(ddsdCaps | ddsdHeight | ddsdWidth | ddsdPixelFormat)
+	pitch := bytesPerRow
+
+	if d.PixelFormat.IsCompressed() {
+		flags |= ddsdLinearSize
+		pitch = bytesPerRow * rows
+	} else {
+		flags |= ddsdPitch
+	}
+
+	caps := uint32(ddsCapsTexture)
+	caps2 := uint32(0)
+
+	if len(d.Levels) > 1 {
+		flags |= ddsdMipmapCount
+		caps |= ddsCapsComplex | ddsCapsMipmap
+	}
+
+	if d.FaceCount == 6 {
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Cubemap | ddsCaps2CubemapAllFaces
+	}
+
+	if d.Depth > 0 {
+		flags |= ddsdDepth
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Volume
+	}
+
+	le.PutUint32(header, ddsMagic)
+	le.PutUint32(h, 124)
+	le.PutUint32(h[4:], flags)
+	le.PutUint32(h[8:], uint32(height))
+	le.PutUint32(h[12:], uint32(d.Width))
+	le.PutUint32(h[16:], uint32(pitch))
+	le.PutUint32(h[20:], uint32(d.Depth))
+	le.PutUint32(h[24:], uint32(len(d.Levels)))
+	le.PutUint32(h[72:], 32)
+	le.PutUint32(h[104:], caps)
+	le.PutUint32(h[108:], caps2)
+
+	if opts.LegacyHeader {
+		if d.ArrayLength > 0 || d.Height == 0 {
+			return errors.New("texture arrays and 1D textures require a DX10 header")
+		}
+
+		if code, ok := pixelFormatFourCC(d.PixelFormat); ok {
+			le.PutUint32(h[76:], ddpfFourCC)
+			le.PutUint32(h[80:], code)
+		} else if m, ok := pixelFormatMasks(d.PixelFormat); ok {
+			le.PutUint32(h[76:], m.flags)
+			le.PutUint32(h[84:], m.bitCount)
+
+			for i, mask := range m.masks {
+				le.PutUint32(h[88+4*i:], mask)
+			}
+		} else {
+			return fmt.Errorf("pixel format %d cannot be written with a legacy DDS header", d.PixelFormat)
+		}
+	} else {
+		format, ok := pixelFormatDXGI(d.PixelFormat)
+		if !ok {
+			return fmt.Errorf("pixel format %d is not supported by DDS", d.PixelFormat)
+		}
+
+		le.PutUint32(h[76:], ddpfFourCC)
+		le.PutUint32(h[80:], fourCC("DX10"))
+
+		dimension, misc := uint32(ddsDimensionTexture2D), uint32(0)
+
+		switch {
+		case d.Depth > 0:
+			dimension = ddsDimensionTexture3D
+		case d.Height == 0:
+			dimension = ddsDimensionTexture1D
+		}
+
+		if d.FaceCount == 6 {
+			misc = ddsMiscTextureCube
+		}
+
+		arraySize := d.ArrayLength
+		if arraySize == 0 {
+			arraySize = 1
+		}
+
+		dx10 := make([]byte, 20)
+		le.PutUint32(dx10, format)
+		le.PutUint32(dx10[4:], dimension)
+		le.PutUint32(dx10[8:], misc)
+		le.PutUint32(dx10[12:], uint32(arraySize))
+		header = append(header, dx10...)
+	}
+
+	buf := bytes.NewBuffer(header)
+
+	for s := 0; s < slices; s++ {
+		for i, l := range d.Levels {
+			if len(l.Slices) != slices {
+				return fmt.Errorf("level %d has %d slices, want %d", i, len(l.Slices), slices)
+			}
+
+			data, err := packLevel(d.PixelFormat, TextureLevel{
+				Width:         l.Width,
+				Height:        l.Height,
+				Depth:         l.Depth,
+				BytesPerRow:   l.BytesPerRow,
+				BytesPerImage: l.BytesPerImage,
+				Slices:        l.Slices[s : s+1],
+			})
+			if err != nil {
+				return fmt.Errorf("level %d: %w", i, err)
+			}
+
+			buf.Write(data)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// dxgiPixelFormat returns the pixel format of a DXGI_FORMAT value.
+func dxgiPixelFormat(format uint32) (PixelFormat, bool) {
+	for _, f := range dxgiFormats {
+		if f.dxgiFormat == format {
+			return f.pixelFormat, true
+		}
+	}
+
+	return 0, false
+}
+
+// pixelFormatDXGI returns the DXGI_FORMAT value of a pixel format.
+func pixelFormatDXGI(pf PixelFormat) (uint32, bool) {
+	for _, f := range dxgiFormats {
+		if f.pixelFormat == pf {
+			return f.dxgiFormat, true
+		}
+	}
+
+	return 0, false
+}
+
+// fourCCPixelFormat returns the pixel format of a legacy FourCC code.
+func fourCCPixelFormat(code uint32) (PixelFormat, bool) {
+	for _, f := range ddsFourCCs {
+		if f.fourCC == code {
+			return f.pixelFormat, true
+		}
+	}
+
+	return 0, false
+}
+
+// pixelFormatFourCC returns the legacy FourCC code of a pixel format.
+func pixelFormatFourCC(pf PixelFormat) (uint32, bool) {
+	for _, f := range ddsFourCCs {
+		if f.pixelFormat == pf {
+			return f.fourCC, true
+		}
+	}
+
+	return 0, false
+}
+
+// maskPixelFormat returns the pixel format of legacy bit masks. Alpha masks of
+// formats that do not flag alpha pixels are ignored.
+func maskPixelFormat(flags, bitCount uint32, masks [4]uint32) (PixelFormat, bool) {
+	for _, m := range ddsMasks {
+		if m.bitCount != bitCount || flags&(ddpfRGB|ddpfLuminance|ddpfAlpha) != m.flags&(ddpfRGB|ddpfLuminance|ddpfAlpha) {
+			continue
+		}
+
+		want, got := m.masks, masks
+		if flags&(ddpfAlphaPixels|ddpfAlpha) == 0 {
+			got[3] = 0
+		}
+
+		if want == got {
+			return m.pixelFormat, true
+		}
+	}
+
+	return 0, false
+}
+
+// pixelFormatMasks returns the legacy bit masks of a pixel format.
+func pixelFormatMasks(pf PixelFormat) (ddsMask, bool) {
+	for _, m := range ddsMasks {
+		if m.pixelFormat == pf {
+			return m, true
+		}
+	}
+
+	return ddsMask{}, false
+}
@@ -0,0 +1,120 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDDSRoundTrip(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		d := newTestTexture[DDSTexture](PixelFormatBC1RGBA, 16, 8, 0, 5, 1)
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteDDS(&buf, d, func(o *DDSOptions) { o.LegacyHeader = legacy }))
+
+		data := buf.Bytes()
+		if legacy {
+			require.Equal(t, "DXT1", string(data[84:88]))
+		} else {
+			require.Equal(t, "DX10", string(data[84:88]))
+			require.Equal(t, uint32(71), binary.LittleEndian.Uint32(data[128:]))
+		}
+
+		// The linear size is the size of the base level.
+		require.Equal(t, uint32(64), binary.LittleEndian.Uint32(data[20:]))
+
+		got, err := ReadDDS(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, d, got)
+	}
+}
+
+func TestDDSCubeArray(t *testing.T) {
+	d := newTestTexture[DDSTexture](PixelFormatRGBA16Float, 4, 4, 0, 3, 12)
+	d.ArrayLength = 2
+	d.FaceCount = 6
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDDS(&buf, d))
+
+	data := buf.Bytes()
+	require.Equal(t, uint32(ddsMiscTextureCube), binary.LittleEndian.Uint32(data[136:]))
+	require.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[140:]))
+
+	// The mipmap chain of the first face precedes the second face.
+	offset := 148 + d.Levels[0].BytesPerImage + d.Levels[1].BytesPerImage + d.Levels[2].BytesPerImage
+	require.Equal(t, d.Levels[0].Slices[1], data[offset:offset+len(d.Levels[0].Slices[1])])
+
+	got, err := ReadDDS(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, d, got)
+	require.Equal(t, TextureTypeCubeArray, got.TextureDescriptor().TextureType)
+
+	require.ErrorContains(t, WriteDDS(&buf, d, func(o *DDSOptions) { o.LegacyHeader = true }), "DX10 header")
+}
+
+func TestDDSVolume(t *testing.T) {
+	d := newTestTexture[DDSTexture](PixelFormatBGRA8Unorm, 4, 4, 4, 3, 1)
+
+	for _, legacy := range []bool{false, true} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteDDS(&buf, d, func(o *DDSOptions) { o.LegacyHeader = legacy }))
+
+		got, err := ReadDDS(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, d, got)
+		require.Equal(t, TextureType3D, got.TextureDescriptor().TextureType)
+	}
+}
+
+func TestDDSLegacyMasks(t *testing.T) {
+	d := newTestTexture[DDSTexture](PixelFormatB5G6R5Unorm, 2, 2, 0, 1, 1)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDDS(&buf, d, func(o *DDSOptions) { o.LegacyHeader = true }))
+
+	data := buf.Bytes()
+	require.Equal(t, uint32(ddpfRGB), binary.LittleEndian.Uint32(data[80:]))
+	require.Equal(t, uint32(0xf800), binary.LittleEndian.Uint32(data[92:]))
+
+	got, err := ReadDDS(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, PixelFormatB5G6R5Unorm, got.PixelFormat)
+
+	// X8R8G8B8 has an alpha mask without alpha pixels and is not supported.
+	binary.LittleEndian.PutUint32(data[80:], ddpfRGB)
+	binary.LittleEndian.PutUint32(data[88:], 32)
+	binary.LittleEndian.PutUint32(data[92:], 0xff0000)
+	binary.LittleEndian.PutUint32(data[96:], 0xff00)
+	binary.LittleEndian.PutUint32(data[100:], 0xff)
+	_, err = ReadDDS(bytes.NewReader(data))
+	require.ErrorContains(t, err, "unsupported DDS pixel format")
+}
+
+func TestDDSErrors(t *testing.T) {
+	_, err := ReadDDS(bytes.NewReader(make([]byte, 128)))
+	require.ErrorContains(t, err, "invalid DDS file identifier")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDDS(&buf, newTestTexture[DDSTexture](PixelFormatBC7RGBAUnorm, 4, 4, 0, 1, 1)))
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[128:], 100)
+	_, err = ReadDDS(bytes.NewReader(data))
+	require.ErrorContains(t, err, "unsupported DDS DXGI format 100")
+
+	binary.LittleEndian.PutUint32(data[84:], fourCC("ETC1"))
+	_, err = ReadDDS(bytes.NewReader(data))
+	require.ErrorContains(t, err, `unsupported DDS FourCC "ETC1"`)
+
+	require.ErrorContains(t, WriteDDS(&buf, newTestTexture[DDSTexture](PixelFormatASTC4x4LDR, 4, 4, 0, 1, 1)), "not supported by DDS")
+
+	d := newTestTexture[DDSTexture](PixelFormatRGBA8Unorm, 4, 4, 0, 2, 1)
+	buf.Reset()
+	require.NoError(t, WriteDDS(&buf, d))
+	_, err = ReadDDS(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.ErrorContains(t, err, "failed to read DDS data")
+}
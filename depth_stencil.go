@@ -0,0 +1,412 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// CPU-side layouts of the depth and stencil pixel formats, as produced by
+// Texture.GetBytes or a blit into a buffer. All multi-byte values are little-endian.
+//
+//	PixelFormatDepth16Unorm         2 bytes: uint16 depth, normalized to [0, 1].
+//	PixelFormatDepth32Float         4 bytes: float32 depth.
+//	PixelFormatStencil8             1 byte:  uint8 stencil.
+//	PixelFormatDepth24UnormStencil8 4 bytes: uint32 with depth in bits 0-23 (normalized to [0, 1]) and stencil in bits 24-31.
+//	PixelFormatDepth32FloatStencil8 8 bytes: float32 depth, uint8 stencil, 3 unused bytes.
+//	PixelFormatX32Stencil8          8 bytes: the Depth32FloatStencil8 layout with the depth bytes ignored.
+//	PixelFormatX24Stencil8          4 bytes: the Depth24UnormStencil8 layout with the depth bits ignored.
+
+const (
+	depth16Max = 1<<16 - 1
+	depth24Max = 1<<24 - 1
+)
+
+// PackDepth16Unorm writes depth, clamped to [0, 1], into dst using the PixelFormatDepth16Unorm layout.
+func PackDepth16Unorm(dst []byte, depth float32) {
+	binary.LittleEndian.PutUint16(dst, uint16(unormQuantize(depth, depth16Max)))
+}
+
+// UnpackDepth16Unorm reads a PixelFormatDepth16Unorm value from src.
+func UnpackDepth16Unorm(src []byte) float32 {
+	return float32(binary.LittleEndian.Uint16(src)) / depth16Max
+}
+
+// PackDepth32Float writes depth into dst using the PixelFormatDepth32Float layout.
+func PackDepth32Float(dst []byte, depth float32) {
+	binary.LittleEndian.PutUint32(dst, math.Float32bits(depth))
+}
+
+// UnpackDepth32Float reads a PixelFormatDepth32Float value from src.
+func UnpackDepth32Float(src []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(src))
+}
+
+// PackStencil8 writes stencil into dst using the PixelFormatStencil8 layout.
+func PackStencil8(dst []byte, stencil uint8) {
+	dst[0] = stencil
+}
+
+// UnpackStencil8 reads a PixelFormatStencil8 value from src.
+func UnpackStencil8(src []byte) uint8 {
+	return src[0]
+}
+
+// PackDepth24UnormStencil8 writes depth, clamped to [0, 1], and stencil into dst
+// using the PixelFormatDepth24UnormStencil8 layout.
+func PackDepth24UnormStencil8(dst []byte, depth float32, stencil uint8) {
+	binary.LittleEndian.PutUint32(dst, unormQuantize(depth, depth24Max)|uint32(stencil)<<24)
+}
+
+// UnpackDepth24UnormStencil8 reads a PixelFormatDepth24UnormStencil8 value from src.
+func UnpackDepth24UnormStencil8(src []byte) (float32, uint8) {
+	v := binary.LittleEndian.Uint32(src)
+	return float32(v&depth24Max) / depth24Max, uint8(v >> 24)
+}
+
+// PackDepth32FloatStencil8 writes depth and stencil into dst using the
+// PixelFormatDepth32FloatStencil8 layout. The unused bytes are zeroed.
+func PackDepth32FloatStencil8(dst []byte, depth float32, stencil uint8) {
+	binary.LittleEndian.PutUint32(dst, math.Float32bits(depth))
+	dst[4] = stencil
+	dst[5], dst[6], dst[7] = 0, 0, 0
+}
+
+// UnpackDepth32FloatStencil8 reads a PixelFormatDepth32FloatStencil8 value from src.
+func UnpackDepth32FloatStencil8(src []byte) (float32, uint8) {
+	return math.Float32frombits(binary.LittleEndian.Uint32(src)), src[4]
+}
+
+// PackX32Stencil8 writes stencil into dst using the PixelFormatX32Stencil8 layout.
+// The depth bytes are left untouched.
+func PackX32Stencil8(dst []byte, stencil uint8) {
+	dst[4] = stencil
+}
+
+// UnpackX32Stencil8 reads the stencil value of a PixelFormatX32Stencil8 texel from src.
+func UnpackX32Stencil8(src []byte) uint8 {
+	return src[4]
+}
+
+// PackX24Stencil8 writes stencil into dst using the PixelFormatX24Stencil8 layout.
+// The depth bits are left untouched.
+func PackX24Stencil8(dst []byte, stencil uint8) {
+	dst[3] = stencil
+}
+
+// UnpackX24Stencil8 reads the stencil value of a PixelFormatX24Stencil8 texel from src.
+func UnpackX24Stencil8(src []byte) uint8 {
+	return src[3]
+}
+
+// unormQuantize converts v, clamped to [0, 1], into an unsigned normalized integer with the given maximum.
+func unormQuantize(v float32, maxValue uint32) uint32 {
+	switch {
+	case !(v > 0): // Also catches NaN.
+		return 0
+	case v >= 1:
+		return maxValue
+	}
+
+	return uint32(float64(v)*float64(maxValue) + 0.5)
+}
+
+// depthStencilBytesPerPixel returns the size of one texel of a depth or stencil
+// pixel format and reports whether the format carries depth and stencil data.
+func depthStencilBytesPerPixel(pf PixelFormat) (size int, hasDepth, hasStencil bool) {
+	switch pf {
+	case PixelFormatDepth16Unorm:
+		return 2, true, false
+	case PixelFormatDepth32Float:
+		return 4, true, false
+	case PixelFormatStencil8:
+		return 1, false, true
+	case PixelFormatDepth24UnormStencil8:
+		return 4, true, true
+	case PixelFormatDepth32FloatStencil8:
+		return 8, true, true
+	case PixelFormatX32Stencil8:
+		return 8, false, true
+	case PixelFormatX24Stencil8:
+		return 4, false, true
+	}
+
+	return 0, false, false
+}
+
+// SplitDepthStencil splits the texels of a depth, stencil or combined depth/stencil
+// readback into separate depth and stencil planes of width*height values each.
+// The depth plane is nil for stencil-only formats and the stencil plane is nil
+// for depth-only formats. A bytesPerRow of 0 means the rows are tightly packed.
+func SplitDepthStencil(pf PixelFormat, data []byte, width, height, bytesPerRow int) ([]float32, []uint8, error) {
+	size, hasDepth, hasStencil := depthStencilBytesPerPixel(pf)
+	if size == 0 {
+		return nil, nil, fmt.Errorf("pixel format %d is not a depth or stencil format", pf)
+	}
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * size
+	}
+
+	if width < 0 || height < 0 || bytesPerRow < width*size {
+		return nil, nil, fmt.Errorf("invalid dimensions %dx%d with %d bytes per row", width, height, bytesPerRow)
+	}
+
+	if height > 0 && len(data) < (height-1)*bytesPerRow+width*size {
+		return nil, nil, fmt.Errorf("data too short: got %d bytes", len(data))
+	}
+
+	var (
+		depth   []float32
+		stencil []uint8
+	)
+
+	if hasDepth {
+		depth = make([]float32, width*height)
+	}
+
+	if hasStencil {
+		stencil = make([]uint8, width*height)
+	}
+
+	for y := 0; y < height; y++ {
+		row := data[y*bytesPerRow:]
+
+		for x := 0; x < width; x++ {
+			texel := row[x*size:]
+			i := y*width + x
+
+			switch pf {
+			case PixelFormatDepth16Unorm:
+				depth[i] = UnpackDepth16Unorm(texel)
+			case PixelFormatDepth32Float:
+				depth[i] = UnpackDepth32Float(texel)
+			case PixelFormatStencil8:
+				stencil[i] = UnpackStencil8(texel)
+			case PixelFormatDepth24UnormStencil8:
+				depth[i], stencil[i] = UnpackDepth24UnormStencil8(texel)
+			case PixelFormatDepth32FloatStencil8:
+				depth[i], stencil[i] = UnpackDepth32FloatStencil8(texel)
+			case PixelFormatX32Stencil8:
+				stencil[i] = UnpackX32Stencil8(texel)
+			case PixelFormatX24Stencil8:
+				stencil[i] = UnpackX24Stencil8(texel)
+			}
+		}
+	}
+
+	return depth, stencil, nil
+}
+
+// DepthEncoding describes how depth values relate to the distance from the camera.
+type DepthEncoding uint8
+
+const (
+	// DepthEncodingLinear indicates depth values that are already linear,
+	// with 0 at the near plane and 1 at the far plane.
+	DepthEncodingLinear DepthEncoding = 0
+
+	// DepthEncodingPerspective indicates depth values written with a standard
+	// perspective projection, with 0 at the near plane and 1 at the far plane.
+	DepthEncodingPerspective DepthEncoding = 1
+
+	// DepthEncodingReversedZ indicates depth values written with a reversed-Z
+	// perspective projection, with 1 at the near plane and 0 at the far plane.
+	DepthEncodingReversedZ DepthEncoding = 2
+)
+
+// DepthVisualizationOptions specifies how VisualizeDepth maps depth values to colors.
+type DepthVisualizationOptions struct {
+	// Encoding describes how the depth values were written.
+	Encoding DepthEncoding
+
+	// Near is the distance to the near clip plane. Used to linearize perspective encodings.
+	Near float32
+
+	// Far is the distance to the far clip plane. Used to linearize perspective encodings.
+	Far float32
+
+	// FalseColor maps depth through a rainbow color map instead of grayscale.
+	FalseColor bool
+}
+
+// VisualizeDepth maps a plane of width*height depth values to an image for debugging.
+// Depth is linearized according to the encoding and displayed from near (black, or blue
+// in false color) to far (white, or red in false color). Non-finite values are drawn magenta.
+func VisualizeDepth(depth []float32, width, height int, optFns ...func(*DepthVisualizationOptions)) (*image.RGBA, error) {
+	opts := DepthVisualizationOptions{
+		Encoding:   DepthEncodingLinear,
+		Near:       0,
+		Far:        1,
+		FalseColor: false,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid dimensions %dx%d", width, height)
+	}
+
+	if len(depth) < width*height {
+		return nil, fmt.Errorf("depth plane too short: got %d values, want %d", len(depth), width*height)
+	}
+
+	if opts.Encoding != DepthEncodingLinear && !(opts.Near > 0 && opts.Far > opts.Near) {
+		return nil, fmt.Errorf("invalid clip planes near=%v far=%v", opts.Near, opts.Far)
+	}
+
+	near, far := float64(opts.Near), float64(opts.Far)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i, d := range depth[:width*height] {
+		v := float64(d)
+
+		var t float64
+
+		switch opts.Encoding {
+		case DepthEncodingPerspective:
+			t = (near*far/(far-v*(far-near)) - near) / (far - near)
+		case DepthEncodingReversedZ:
+			t = (near*far/(near+v*(far-near)) - near) / (far - near)
+		default:
+			t = v
+		}
+
+		var c color.RGBA
+
+		switch {
+		case math.IsNaN(t) || math.IsInf(t, 0):
+			c = color.RGBA{R: 255, B: 255, A: 255}
+		case opts.FalseColor:
+			c = turbo(t)
+		default:
+			g := uint8(unormQuantize(float32(t), 255))
+			c = color.RGBA{R: g, G: g, B: g, A: 255}
+		}
+
+		img.SetRGBA(i%width, i/width, c)
+	}
+
+	return img, nil
+}
+
+// StencilVisualizationOptions specifies how VisualizeStencil maps stencil values to colors.
+type StencilVisualizationOptions struct {
+	// MaxValue is the stencil value displayed as white in grayscale mode.
+	// Zero selects the largest value in the plane.
+	MaxValue uint8
+
+	// FalseColor gives every non-zero stencil value a distinct hue instead of a gray level.
+	FalseColor bool
+}
+
+// VisualizeStencil maps a plane of width*height stencil values to an image for debugging.
+// Zero is always drawn black.
+func VisualizeStencil(stencil []uint8, width, height int, optFns ...func(*StencilVisualizationOptions)) (*image.RGBA, error) {
+	opts := StencilVisualizationOptions{
+		MaxValue:   0,
+		FalseColor: false,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid dimensions %dx%d", width, height)
+	}
+
+	if len(stencil) < width*height {
+		return nil, fmt.Errorf("stencil plane too short: got %d values, want %d", len(stencil), width*height)
+	}
+
+	maxValue := opts.MaxValue
+	if maxValue == 0 {
+		for _, s := range stencil[:width*height] {
+			if s > maxValue {
+				maxValue = s
+			}
+		}
+
+		if maxValue == 0 {
+			maxValue = 1
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i, s := range stencil[:width*height] {
+		var c color.RGBA
+
+		switch {
+		case s == 0:
+			c = color.RGBA{A: 255}
+		case opts.FalseColor:
+			// Step around the hue circle by the golden angle so that adjacent values differ clearly.
+			c = hsvToRGBA(math.Mod(float64(s)*0.618033988749895, 1), 0.85, 1)
+		default:
+			g := uint8(unormQuantize(float32(s)/float32(maxValue), 255))
+			c = color.RGBA{R: g, G: g, B: g, A: 255}
+		}
+
+		img.SetRGBA(i%width, i/width, c)
+	}
+
+	return img, nil
+}
+
+// turbo maps t in [0, 1] to the Turbo rainbow color map using its polynomial approximation.
+func turbo(t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+
+	r := 0.13572138 + t*(4.61539260+t*(-42.66032258+t*(132.13108234+t*(-152.94239396+t*59.28637943))))
+	g := 0.09140261 + t*(2.19418839+t*(4.84296658+t*(-14.18503333+t*(4.27729857+t*2.82956604))))
+	b := 0.10667330 + t*(12.64194608+t*(-60.58204836+t*(110.36276771+t*(-89.90310912+t*27.34824973))))
+
+	return color.RGBA{
+		R: uint8(unormQuantize(float32(r), 255)),
+		G: uint8(unormQuantize(float32(g), 255)),
+		B: uint8(unormQuantize(float32(b), 255)),
+		A: 255,
+	}
+}
+
+// hsvToRGBA converts a hue, saturation and value, each in [0, 1], to an opaque color.
+func hsvToRGBA(h, s, v float64) color.RGBA {
+	h6 := h * 6
+	i := math.Floor(h6)
+	f := h6 - i
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+
+	var r, g, b float64
+
+	switch int(i) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+
+	return color.RGBA{
+		R: uint8(unormQuantize(float32(r), 255)),
+		G: uint8(unormQuantize(float32(g), 255)),
+		B: uint8(unormQuantize(float32(b), 255)),
+		A: 255,
+	}
+}
@@ -0,0 +1,125 @@
+package mtl
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepthStencilPacking(t *testing.T) {
+	b := make([]byte, 8)
+
+	PackDepth16Unorm(b, 0.5)
+	require.Equal(t, []byte{0x00, 0x80}, b[:2])
+	require.InDelta(t, 0.5, UnpackDepth16Unorm(b), 1.0/depth16Max)
+
+	PackDepth16Unorm(b, 2)
+	require.Equal(t, float32(1), UnpackDepth16Unorm(b))
+
+	PackDepth32Float(b, 0.25)
+	require.Equal(t, float32(0.25), UnpackDepth32Float(b))
+
+	PackStencil8(b, 7)
+	require.Equal(t, uint8(7), UnpackStencil8(b))
+
+	PackDepth24UnormStencil8(b, 1, 0xAB)
+	require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xAB}, b[:4])
+
+	d, s := UnpackDepth24UnormStencil8(b)
+	require.Equal(t, float32(1), d)
+	require.Equal(t, uint8(0xAB), s)
+	require.Equal(t, uint8(0xAB), UnpackX24Stencil8(b))
+
+	PackX24Stencil8(b, 3)
+	d, s = UnpackDepth24UnormStencil8(b)
+	require.Equal(t, float32(1), d)
+	require.Equal(t, uint8(3), s)
+
+	PackDepth32FloatStencil8(b, 0.75, 9)
+	d, s = UnpackDepth32FloatStencil8(b)
+	require.Equal(t, float32(0.75), d)
+	require.Equal(t, uint8(9), s)
+	require.Equal(t, uint8(9), UnpackX32Stencil8(b))
+
+	PackX32Stencil8(b, 4)
+	require.Equal(t, float32(0.75), UnpackDepth32Float(b))
+	require.Equal(t, uint8(4), UnpackX32Stencil8(b))
+}
+
+func TestSplitDepthStencil(t *testing.T) {
+	const bytesPerRow = 20 // 2 texels of 8 bytes plus 4 bytes of row padding.
+
+	data := make([]byte, 2*bytesPerRow)
+	PackDepth32FloatStencil8(data[0:], 0.1, 1)
+	PackDepth32FloatStencil8(data[8:], 0.2, 2)
+	PackDepth32FloatStencil8(data[bytesPerRow:], 0.3, 3)
+	PackDepth32FloatStencil8(data[bytesPerRow+8:], 0.4, 4)
+
+	depth, stencil, err := SplitDepthStencil(PixelFormatDepth32FloatStencil8, data, 2, 2, bytesPerRow)
+	require.NoError(t, err)
+	require.Equal(t, []float32{0.1, 0.2, 0.3, 0.4}, depth)
+	require.Equal(t, []uint8{1, 2, 3, 4}, stencil)
+
+	depth, stencil, err = SplitDepthStencil(PixelFormatX32Stencil8, data, 2, 2, bytesPerRow)
+	require.NoError(t, err)
+	require.Nil(t, depth)
+	require.Equal(t, []uint8{1, 2, 3, 4}, stencil)
+
+	_, _, err = SplitDepthStencil(PixelFormatRGBA8Unorm, data, 2, 2, 0)
+	require.Error(t, err)
+
+	_, _, err = SplitDepthStencil(PixelFormatDepth32FloatStencil8, data[:30], 2, 2, bytesPerRow)
+	require.Error(t, err)
+}
+
+func TestVisualizeDepth(t *testing.T) {
+	img, err := VisualizeDepth([]float32{0, 1}, 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{A: 255}, img.RGBAAt(0, 0))
+	require.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, img.RGBAAt(1, 0))
+
+	// With reversed-Z, depth 1 is at the near plane and 0 at the far plane.
+	img, err = VisualizeDepth([]float32{1, 0}, 2, 1, func(o *DepthVisualizationOptions) {
+		o.Encoding = DepthEncodingReversedZ
+		o.Near = 0.1
+		o.Far = 100
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint8(0), img.RGBAAt(0, 0).R)
+	require.Equal(t, uint8(255), img.RGBAAt(1, 0).R)
+
+	// The midpoint of a perspective depth range lies much closer to the near plane.
+	img, err = VisualizeDepth([]float32{0.5}, 1, 1, func(o *DepthVisualizationOptions) {
+		o.Encoding = DepthEncodingPerspective
+		o.Near = 1
+		o.Far = 100
+	})
+	require.NoError(t, err)
+	require.Less(t, img.RGBAAt(0, 0).R, uint8(10))
+
+	_, err = VisualizeDepth([]float32{0}, 1, 1, func(o *DepthVisualizationOptions) {
+		o.Encoding = DepthEncodingPerspective
+	})
+	require.Error(t, err)
+
+	_, err = VisualizeDepth(nil, -1, -1)
+	require.EqualError(t, err, "invalid dimensions -1x-1")
+}
+
+func TestVisualizeStencil(t *testing.T) {
+	img, err := VisualizeStencil([]uint8{0, 2, 4}, 3, 1)
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{A: 255}, img.RGBAAt(0, 0))
+	require.Equal(t, uint8(128), img.RGBAAt(1, 0).R)
+	require.Equal(t, uint8(255), img.RGBAAt(2, 0).R)
+
+	img, err = VisualizeStencil([]uint8{1, 2}, 2, 1, func(o *StencilVisualizationOptions) {
+		o.FalseColor = true
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, img.RGBAAt(0, 0), img.RGBAAt(1, 0))
+
+	_, err = VisualizeStencil(nil, 0, 1)
+	require.EqualError(t, err, "invalid dimensions 0x1")
+}
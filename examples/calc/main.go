@@ -8,20 +8,7 @@ import (
 	"github.com/hupe1980/go-mtl"
 )
 
-const source = `#include <metal_stdlib>
-
-using namespace metal;
-
-kernel void add_arrays(device const float* inA,
-	device const float* inB,
-	device float* result,
-	uint index [[thread_position_in_grid]])
-{
-// the for-loop is replaced with a collection of threads, each of which
-// calls this function.
-result[index] = inA[index] + inB[index];
-}
-`
+//go:generate go run ../../cmd/mtlgen add.metal
 
 func main() {
 	// Create a Metal device.
@@ -30,20 +17,14 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Create a Metal library from the provided source code.
-	lib, err := device.NewLibraryWithSource(source)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Retrieve the Metal function named "add_arrays" from the library.
-	addArrays, err := lib.NewFunctionWithName("add_arrays")
+	// Create a Metal library from the embedded source of add.metal.
+	lib, err := NewAddLibrary(device)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create a Metal compute pipeline state with the function.
-	pipelineState, err := device.NewComputePipelineStateWithFunction(addArrays)
+	// Create a Metal compute pipeline state with the function named "add_arrays".
+	pipelineState, err := NewAddArraysPipelineState(device, lib)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -70,22 +51,18 @@ func main() {
 	// Create a compute command encoder to encode compute commands.
 	cce := cb.ComputeCommandEncoder()
 
-	// Set the compute pipeline state to specify the function to be executed.
-	cce.SetComputePipelineState(pipelineState)
-
-	// Set the input and output buffers for the compute function.
-	cce.SetBuffer(b1, 0, 0)
-	cce.SetBuffer(b2, 0, 1)
-	cce.SetBuffer(r, 0, 2)
-
 	// Specify threadgroup size
 	tgs := pipelineState.MaxTotalThreadsPerThreadgroup
 	if tgs > arrLen {
 		tgs = arrLen
 	}
 
-	// Dispatch compute threads to perform the calculation.
-	cce.DispatchThreads(mtl.Size{Width: arrLen, Height: 1, Depth: 1}, mtl.Size{Width: tgs, Height: 1, Depth: 1})
+	// Set the pipeline state and the input and output buffers, and dispatch
+	// compute threads to perform the calculation.
+	addArrays := AddArrays{InA: &b1, InB: &b2, Result: &r}
+	if err := addArrays.Encode(cce, pipelineState, mtl.Size{Width: arrLen, Height: 1, Depth: 1}, mtl.Size{Width: tgs, Height: 1, Depth: 1}); err != nil {
+		log.Fatal(err)
+	}
 
 	// End encoding the compute command.
 	cce.EndEncoding()
@@ -9,20 +9,26 @@ import (
 	"unsafe"
 
 	"github.com/hupe1980/go-mtl"
+	"github.com/hupe1980/go-mtl/msl"
+	"github.com/hupe1980/go-mtl/simd"
 )
 
-// The source code for the Metal shaders.
-const source = `#include <metal_stdlib>
+// Vertex is the vertex structure with position and color attributes. Its MSL
+// declaration is generated, so the shaders and the vertex data always agree.
+type Vertex struct {
+	Position simd.Float4 `msl:"position,position"`
+	Color    simd.Float4
+}
+
+// The header of the Metal shaders.
+const header = `#include <metal_stdlib>
 
 using namespace metal;
 
-// Define the vertex structure with position and color attributes.
-struct Vertex {
-	float4 position [[position]];
-	float4 color;
-};
+`
 
-// Vertex shader function that returns the vertex data.
+// The source code of the Metal shaders, which use the generated Vertex declaration.
+const shaders = `// Vertex shader function that returns the vertex data.
 vertex Vertex vertex_shader(
 	uint vertexID [[vertex_id]],
 	device Vertex * vertices [[buffer(0)]]
@@ -43,8 +49,14 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Create a Metal library from the provided source code.
-	lib, err := device.NewLibraryWithSource(source)
+	// Generate the MSL declaration of the vertex structure.
+	structs, err := msl.GenerateStructs([]any{Vertex{}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create a Metal library from the header, the declaration and the shaders.
+	lib, err := device.NewLibraryWithSource(header + structs + shaders)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -74,15 +86,10 @@ func main() {
 	}
 
 	// Define the vertex data for the triangle.
-	type Vertex struct {
-		Position [4]float32
-		Color    [4]float32
-	}
-
 	vertexData := [...]Vertex{
-		{Position: [4]float32{+0.00, +0.5, 0, 1}, Color: [4]float32{1, 0, 0, 1}},
-		{Position: [4]float32{-0.5, -0.5, 0, 1}, Color: [4]float32{0, 1, 0, 1}},
-		{Position: [4]float32{+0.5, -0.5, 0, 1}, Color: [4]float32{0, 0, 1, 1}},
+		{Position: simd.Float4{X: +0.00, Y: +0.5, Z: 0, W: 1}, Color: simd.Float4{X: 1, Y: 0, Z: 0, W: 1}},
+		{Position: simd.Float4{X: -0.5, Y: -0.5, Z: 0, W: 1}, Color: simd.Float4{X: 0, Y: 1, Z: 0, W: 1}},
+		{Position: simd.Float4{X: +0.5, Y: -0.5, Z: 0, W: 1}, Color: simd.Float4{X: 0, Y: 0, Z: 1, W: 1}},
 	}
 
 	// Create a vertex buffer with the vertex data.
@@ -96,7 +103,10 @@ func main() {
 		StorageMode: mtl.StorageModeManaged,
 	}
 
-	texture := device.NewTextureWithDescriptor(td)
+	texture, err := device.NewTextureWithDescriptor(td)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create a command queue for the device.
 	cq := device.NewCommandQueue()
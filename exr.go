@@ -0,0 +1,885 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// Values of the OpenEXR header.
+const (
+	exrMagic = 20000630
+
+	exrFlagTiled     = 0x200
+	exrFlagLongNames = 0x400
+	exrFlagDeep      = 0x800
+	exrFlagMultipart = 0x1000
+)
+
+// EXRPixelType is the data type of the samples of an OpenEXR channel.
+type EXRPixelType int32
+
+const (
+	// EXRPixelTypeUint indicates 32-bit unsigned integer samples.
+	EXRPixelTypeUint EXRPixelType = 0
+	// EXRPixelTypeHalf indicates 16-bit floating-point samples.
+	EXRPixelTypeHalf EXRPixelType = 1
+	// EXRPixelTypeFloat indicates 32-bit floating-point samples.
+	EXRPixelTypeFloat EXRPixelType = 2
+)
+
+// Size returns the size of a sample in bytes.
+func (t EXRPixelType) Size() int {
+	if t == EXRPixelTypeHalf {
+		return 2
+	}
+
+	return 4
+}
+
+// EXRCompression is the compression method of the pixel data of an OpenEXR file.
+type EXRCompression uint8
+
+const (
+	// EXRCompressionNone indicates uncompressed pixel data.
+	EXRCompressionNone EXRCompression = 0
+	// EXRCompressionRLE indicates run-length encoded differences of adjacent bytes.
+	EXRCompressionRLE EXRCompression = 1
+	// EXRCompressionZIPS indicates zlib compressed single scanlines.
+	EXRCompressionZIPS EXRCompression = 2
+	// EXRCompressionZIP indicates zlib compressed blocks of 16 scanlines.
+	EXRCompressionZIP EXRCompression = 3
+)
+
+// exrCompressionNames holds the names of the compression methods defined by OpenEXR.
+var exrCompressionNames = [...]string{"NONE", "RLE", "ZIPS", "ZIP", "PIZ", "PXR24", "B44", "B44A", "DWAA", "DWAB"}
+
+// linesPerChunk returns the number of scanlines that are compressed together.
+func (c EXRCompression) linesPerChunk() int {
+	if c == EXRCompressionZIP {
+		return 16
+	}
+
+	return 1
+}
+
+// maxExpansion returns an upper bound of the ratio between the decompressed and
+// the compressed size of a chunk.
+func (c EXRCompression) maxExpansion() uint64 {
+	switch c {
+	case EXRCompressionRLE:
+		// A run of two bytes expands to at most 128 bytes.
+		return 64
+	case EXRCompressionZIPS, EXRCompressionZIP:
+		// Deflate expands a stream by at most a factor of 1032.
+		return 1032
+	}
+
+	return 1
+}
+
+// EXRAttribute is a header attribute of an OpenEXR file.
+type EXRAttribute struct {
+	// Name is the name of the attribute.
+	Name string
+
+	// Type is the name of the attribute type, such as "float" or "string".
+	Type string
+
+	// Value holds the raw little-endian value of the attribute.
+	Value []byte
+}
+
+// EXRChannel is a channel of an OpenEXR image, such as "R", "Z" or "diffuse.R".
+type EXRChannel struct {
+	// Name is the name of the channel.
+	Name string
+
+	// Type is the data type of the samples.
+	Type EXRPixelType
+
+	// Linear hints that the samples are perceptually linear.
+	Linear bool
+
+	// Data holds the little-endian samples of the channel in row-major order.
+	Data []byte
+}
+
+// Float32 returns sample i of the channel as float32.
+func (c *EXRChannel) Float32(i int) float32 {
+	switch c.Type {
+	case EXRPixelTypeHalf:
+		return halfToFloat32(binary.LittleEndian.Uint16(c.Data[2*i:]))
+	case EXRPixelTypeFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(c.Data[4*i:]))
+	default:
+		return float32(binary.LittleEndian.Uint32(c.Data[4*i:]))
+	}
+}
+
+// SetFloat32 sets sample i of the channel to v. Unsigned integer samples are
+// rounded and clamped.
+func (c *EXRChannel) SetFloat32(i int, v float32) {
+	switch c.Type {
+	case EXRPixelTypeHalf:
+		binary.LittleEndian.PutUint16(c.Data[2*i:], float32ToHalf(v))
+	case EXRPixelTypeFloat:
+		binary.LittleEndian.PutUint32(c.Data[4*i:], math.Float32bits(v))
+	default:
+		binary.LittleEndian.PutUint32(c.Data[4*i:], uint32(clamp(math.Round(float64(v)), 0, math.MaxUint32)))
+	}
+}
+
+// EXRImage is a scanline image stored in the OpenEXR file format.
+//
+// Reference: https://openexr.com/en/latest/OpenEXRFileLayout.html
+type EXRImage struct {
+	// DataWindow is the region covered by the pixel data.
+	DataWindow image.Rectangle
+
+	// DisplayWindow is the region of the image that is meant to be displayed.
+	DisplayWindow image.Rectangle
+
+	// Compression is the compression method of the pixel data.
+	Compression EXRCompression
+
+	// Channels holds the channels of the image in the order of their names.
+	Channels []*EXRChannel
+
+	// Attributes holds header attributes other than channels, compression,
+	// dataWindow, displayWindow and lineOrder.
+	Attributes []EXRAttribute
+}
+
+// NewEXRImage returns an image of the given dimensions without channels.
+func NewEXRImage(width, height int) *EXRImage {
+	r := image.Rect(0, 0, width, height)
+
+	return &EXRImage{
+		DataWindow:    r,
+		DisplayWindow: r,
+		Compression:   EXRCompressionZIP,
+	}
+}
+
+// AddChannel adds a channel of zeroed samples to the image and returns it.
+func (img *EXRImage) AddChannel(name string, typ EXRPixelType) *EXRChannel {
+	c := &EXRChannel{
+		Name: name,
+		Type: typ,
+		Data: make([]byte, img.DataWindow.Dx()*img.DataWindow.Dy()*typ.Size()),
+	}
+
+	img.Channels = append(img.Channels, c)
+
+	return c
+}
+
+// Channel returns the channel with the given name, or nil if the image has no such channel.
+func (img *EXRImage) Channel(name string) *EXRChannel {
+	for _, c := range img.Channels {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// exrTextureFormats maps pixel formats to the type and names of OpenEXR channels.
+var exrTextureFormats = map[PixelFormat]struct {
+	typ   EXRPixelType
+	names []string
+}{
+	PixelFormatR16Float:     {EXRPixelTypeHalf, []string{"R"}},
+	PixelFormatRG16Float:    {EXRPixelTypeHalf, []string{"R", "G"}},
+	PixelFormatRGBA16Float:  {EXRPixelTypeHalf, []string{"R", "G", "B", "A"}},
+	PixelFormatR32Float:     {EXRPixelTypeFloat, []string{"R"}},
+	PixelFormatRG32Float:    {EXRPixelTypeFloat, []string{"R", "G"}},
+	PixelFormatRGBA32Float:  {EXRPixelTypeFloat, []string{"R", "G", "B", "A"}},
+	PixelFormatDepth32Float: {EXRPixelTypeFloat, []string{"Z"}},
+	PixelFormatR32Uint:      {EXRPixelTypeUint, []string{"R"}},
+	PixelFormatRG32Uint:     {EXRPixelTypeUint, []string{"R", "G"}},
+	PixelFormatRGBA32Uint:   {EXRPixelTypeUint, []string{"R", "G", "B", "A"}},
+}
+
+// NewEXRImageFromTexture returns an image with the channels of texture data in the
+// pixel format pf, such as the bytes returned by Texture.GetBytes. The samples are
+// copied without conversion. A bytesPerRow of 0 denotes tightly packed rows.
+func NewEXRImageFromTexture(data []byte, pf PixelFormat, width, height, bytesPerRow int) (*EXRImage, error) {
+	f, ok := exrTextureFormats[pf]
+	if !ok {
+		return nil, fmt.Errorf("pixel format %d is not supported by OpenEXR", pf)
+	}
+
+	size := f.typ.Size()
+	pixelSize := size * len(f.names)
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * pixelSize
+	}
+
+	if err := checkRows(data, "texture", width, height, pixelSize, bytesPerRow); err != nil {
+		return nil, err
+	}
+
+	img := NewEXRImage(width, height)
+
+	for i, name := range f.names {
+		c := img.AddChannel(name, f.typ)
+
+		for y := 0; y < height; y++ {
+			row := data[y*bytesPerRow:]
+			for x := 0; x < width; x++ {
+				copy(c.Data[(y*width+x)*size:], row[x*pixelSize+i*size:x*pixelSize+(i+1)*size])
+			}
+		}
+	}
+
+	sort.Slice(img.Channels, func(i, j int) bool { return img.Channels[i].Name < img.Channels[j].Name })
+
+	return img, nil
+}
+
+// TextureBytes returns the image as tightly packed texture data in the pixel format
+// pf. Samples of other types are converted, missing alpha channels are set to 1 and
+// other missing channels to 0.
+func (img *EXRImage) TextureBytes(pf PixelFormat) ([]byte, error) {
+	f, ok := exrTextureFormats[pf]
+	if !ok {
+		return nil, fmt.Errorf("pixel format %d is not supported by OpenEXR", pf)
+	}
+
+	size := f.typ.Size()
+	pixelSize := size * len(f.names)
+	n := img.DataWindow.Dx() * img.DataWindow.Dy()
+	data := make([]byte, n*pixelSize)
+
+	for i, name := range f.names {
+		c := img.Channel(name)
+
+		if c == nil || c.Type != f.typ {
+			// Convert through a temporary channel of the destination type.
+			tmp := &EXRChannel{Type: f.typ, Data: make([]byte, n*size)}
+
+			for j := 0; j < n; j++ {
+				switch {
+				case c != nil:
+					tmp.SetFloat32(j, c.Float32(j))
+				case name == "A":
+					tmp.SetFloat32(j, 1)
+				}
+			}
+
+			c = tmp
+		}
+
+		for j := 0; j < n; j++ {
+			copy(data[j*pixelSize+i*size:], c.Data[j*size:(j+1)*size])
+		}
+	}
+
+	return data, nil
+}
+
+// ReadEXR reads a single-part scanline image in the OpenEXR file format.
+func ReadEXR(r io.Reader) (*EXRImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenEXR file: %w", err)
+	}
+
+	le := binary.LittleEndian
+
+	if len(data) < 8 || le.Uint32(data) != exrMagic {
+		return nil, errors.New("invalid OpenEXR file identifier")
+	}
+
+	version := le.Uint32(data[4:])
+
+	switch {
+	case version&0xff != 2:
+		return nil, fmt.Errorf("unsupported OpenEXR version %d", version&0xff)
+	case version&exrFlagTiled != 0:
+		return nil, errors.New("tiled OpenEXR files are not supported")
+	case version&exrFlagDeep != 0:
+		return nil, errors.New("deep OpenEXR files are not supported")
+	case version&exrFlagMultipart != 0:
+		return nil, errors.New("multi-part OpenEXR files are not supported")
+	}
+
+	img := &EXRImage{}
+	p := data[8:]
+	found := map[string]bool{}
+
+	for {
+		var (
+			name, typ string
+			ok        bool
+		)
+
+		if name, p, ok = cutCString(p); !ok {
+			return nil, errors.New("invalid OpenEXR header")
+		}
+
+		if name == "" {
+			break
+		}
+
+		if typ, p, ok = cutCString(p); !ok || len(p) < 4 {
+			return nil, errors.New("invalid OpenEXR header")
+		}
+
+		size := le.Uint32(p)
+		if uint64(size) > uint64(len(p)-4) {
+			return nil, fmt.Errorf("invalid OpenEXR attribute size %d", size)
+		}
+
+		value := p[4 : 4+size]
+		p = p[4+size:]
+		found[name] = true
+
+		switch name {
+		case "channels":
+			if img.Channels, err = parseEXRChannels(value); err != nil {
+				return nil, err
+			}
+		case "compression":
+			if len(value) != 1 {
+				return nil, errors.New("invalid OpenEXR compression")
+			}
+
+			img.Compression = EXRCompression(value[0])
+		case "dataWindow", "displayWindow":
+			if len(value) != 16 {
+				return nil, fmt.Errorf("invalid OpenEXR %s", name)
+			}
+
+			rect := image.Rect(
+				int(int32(le.Uint32(value))), int(int32(le.Uint32(value[4:]))),
+				int(int32(le.Uint32(value[8:])))+1, int(int32(le.Uint32(value[12:])))+1,
+			)
+
+			if name == "dataWindow" {
+				img.DataWindow = rect
+			} else {
+				img.DisplayWindow = rect
+			}
+		case "lineOrder":
+			// Scanline chunks carry their position, so every line order can be read.
+		default:
+			img.Attributes = append(img.Attributes, EXRAttribute{Name: name, Type: typ, Value: value})
+		}
+	}
+
+	for _, name := range []string{"channels", "compression", "dataWindow"} {
+		if !found[name] {
+			return nil, fmt.Errorf("missing OpenEXR attribute %q", name)
+		}
+	}
+
+	if !found["displayWindow"] {
+		img.DisplayWindow = img.DataWindow
+	}
+
+	if img.Compression > EXRCompressionZIP {
+		if int(img.Compression) < len(exrCompressionNames) {
+			return nil, fmt.Errorf("unsupported OpenEXR compression %s", exrCompressionNames[img.Compression])
+		}
+
+		return nil, fmt.Errorf("unsupported OpenEXR compression %d", img.Compression)
+	}
+
+	width, height := img.DataWindow.Dx(), img.DataWindow.Dy()
+	if width <= 0 || height <= 0 || int64(width)*int64(height) > 1<<28 {
+		return nil, fmt.Errorf("invalid OpenEXR data window %v", img.DataWindow)
+	}
+
+	rowSize := 0
+
+	for _, c := range img.Channels {
+		rowSize += width * c.Type.Size()
+	}
+
+	// The samples of all channels are capped at the size of 1<<28 pixels with
+	// four 32-bit channels, so the number of channels cannot force arbitrarily
+	// large allocations.
+	if int64(rowSize)*int64(height) > 1<<32 {
+		return nil, fmt.Errorf("OpenEXR image of %dx%d pixels with %d channels is too large", width, height, len(img.Channels))
+	}
+
+	lines := img.Compression.linesPerChunk()
+	chunks := (height + lines - 1) / lines
+
+	if len(p) < 8*chunks {
+		return nil, errors.New("invalid OpenEXR offset table")
+	}
+
+	// The offset table is validated before the channels are allocated, and every
+	// chunk must be large enough to hold its scanlines once decompressed.
+	for i := 0; i < chunks; i++ {
+		offset := le.Uint64(p[8*i:])
+		if offset > uint64(len(data)-8) {
+			return nil, fmt.Errorf("invalid OpenEXR chunk offset %d", offset)
+		}
+
+		chunk := data[offset:]
+		y := int(int32(le.Uint32(chunk))) - img.DataWindow.Min.Y
+		size := uint64(le.Uint32(chunk[4:]))
+
+		if y < 0 || y >= height || y%lines != 0 || size > uint64(len(chunk)-8) {
+			return nil, fmt.Errorf("invalid OpenEXR chunk %d", i)
+		}
+
+		n := lines
+		if y+n > height {
+			n = height - y
+		}
+
+		if size*img.Compression.maxExpansion() < uint64(n*rowSize) {
+			return nil, fmt.Errorf("invalid OpenEXR chunk %d", i)
+		}
+	}
+
+	for _, c := range img.Channels {
+		c.Data = make([]byte, width*height*c.Type.Size())
+	}
+
+	for i := 0; i < chunks; i++ {
+		chunk := data[le.Uint64(p[8*i:]):]
+		y := int(int32(le.Uint32(chunk))) - img.DataWindow.Min.Y
+		size := le.Uint32(chunk[4:])
+
+		n := lines
+		if y+n > height {
+			n = height - y
+		}
+
+		raw, err := exrDecompress(img.Compression, chunk[8:8+size], n*rowSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress OpenEXR chunk %d: %w", i, err)
+		}
+
+		// Every scanline holds the samples of one channel after another.
+		for l := 0; l < n; l++ {
+			for _, c := range img.Channels {
+				size := width * c.Type.Size()
+				copy(c.Data[(y+l)*size:], raw[:size])
+				raw = raw[size:]
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// EXROptions configures WriteEXR.
+type EXROptions struct {
+	// CompressionLevel is the zlib compression level used for EXRCompressionZIPS and EXRCompressionZIP.
+	CompressionLevel int
+}
+
+// WriteEXR writes an image in the OpenEXR file format. The channels are written in
+// the order of their names.
+func WriteEXR(w io.Writer, img *EXRImage, optFns ...func(*EXROptions)) error {
+	opts := EXROptions{
+		CompressionLevel: zlib.DefaultCompression,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if img.Compression > EXRCompressionZIP {
+		return fmt.Errorf("unsupported OpenEXR compression %d", img.Compression)
+	}
+
+	width, height := img.DataWindow.Dx(), img.DataWindow.Dy()
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid data window %v", img.DataWindow)
+	}
+
+	if len(img.Channels) == 0 {
+		return errors.New("image has no channels")
+	}
+
+	channels := append([]*EXRChannel(nil), img.Channels...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	version := uint32(2)
+	rowSize := 0
+
+	for i, c := range channels {
+		if c.Name == "" || (i > 0 && channels[i-1].Name == c.Name) {
+			return fmt.Errorf("invalid channel name %q", c.Name)
+		}
+
+		if len(c.Name) > 31 {
+			version |= exrFlagLongNames
+		}
+
+		if len(c.Data) != width*height*c.Type.Size() {
+			return fmt.Errorf("channel %q has %d bytes, want %d", c.Name, len(c.Data), width*height*c.Type.Size())
+		}
+
+		rowSize += width * c.Type.Size()
+	}
+
+	le := binary.LittleEndian
+	header := le.AppendUint32(nil, exrMagic)
+	header = le.AppendUint32(header, version)
+
+	var chlist []byte
+
+	for _, c := range channels {
+		chlist = append(chlist, c.Name...)
+		chlist = append(chlist, 0)
+		chlist = le.AppendUint32(chlist, uint32(c.Type))
+
+		if c.Linear {
+			chlist = append(chlist, 1, 0, 0, 0)
+		} else {
+			chlist = append(chlist, 0, 0, 0, 0)
+		}
+
+		chlist = le.AppendUint32(chlist, 1)
+		chlist = le.AppendUint32(chlist, 1)
+	}
+
+	attributes := []EXRAttribute{
+		{Name: "channels", Type: "chlist", Value: append(chlist, 0)},
+		{Name: "compression", Type: "compression", Value: []byte{byte(img.Compression)}},
+		{Name: "dataWindow", Type: "box2i", Value: exrBox2i(img.DataWindow)},
+		{Name: "displayWindow", Type: "box2i", Value: exrBox2i(img.DisplayWindow)},
+		{Name: "lineOrder", Type: "lineOrder", Value: []byte{0}},
+	}
+
+	// The remaining required attributes get default values unless the image has them.
+	for _, a := range []EXRAttribute{
+		{Name: "pixelAspectRatio", Type: "float", Value: le.AppendUint32(nil, math.Float32bits(1))},
+		{Name: "screenWindowCenter", Type: "v2f", Value: make([]byte, 8)},
+		{Name: "screenWindowWidth", Type: "float", Value: le.AppendUint32(nil, math.Float32bits(1))},
+	} {
+		if !img.hasAttribute(a.Name) {
+			attributes = append(attributes, a)
+		}
+	}
+
+	for _, a := range append(attributes, img.Attributes...) {
+		if len(a.Name) > 31 || len(a.Type) > 31 {
+			le.PutUint32(header[4:], version|exrFlagLongNames)
+		}
+
+		header = append(header, a.Name...)
+		header = append(header, 0)
+		header = append(header, a.Type...)
+		header = append(header, 0)
+		header = le.AppendUint32(header, uint32(len(a.Value)))
+		header = append(header, a.Value...)
+	}
+
+	header = append(header, 0)
+
+	lines := img.Compression.linesPerChunk()
+	chunks := (height + lines - 1) / lines
+	offsets := make([]byte, 8*chunks)
+	buf := bytes.NewBuffer(append(header, offsets...))
+	raw := make([]byte, 0, lines*rowSize)
+
+	for i := 0; i < chunks; i++ {
+		y := i * lines
+
+		n := lines
+		if y+n > height {
+			n = height - y
+		}
+
+		raw = raw[:0]
+
+		for l := y; l < y+n; l++ {
+			for _, c := range channels {
+				size := width * c.Type.Size()
+				raw = append(raw, c.Data[l*size:(l+1)*size]...)
+			}
+		}
+
+		data, err := exrCompress(img.Compression, raw, opts.CompressionLevel)
+		if err != nil {
+			return err
+		}
+
+		le.PutUint64(buf.Bytes()[len(header)+8*i:], uint64(buf.Len()))
+
+		var chunk [8]byte
+
+		le.PutUint32(chunk[:], uint32(int32(y+img.DataWindow.Min.Y)))
+		le.PutUint32(chunk[4:], uint32(len(data)))
+		buf.Write(chunk[:])
+		buf.Write(data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// hasAttribute reports whether the image has an attribute with the given name.
+func (img *EXRImage) hasAttribute(name string) bool {
+	for _, a := range img.Attributes {
+		if a.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseEXRChannels parses the value of a chlist attribute.
+func parseEXRChannels(p []byte) ([]*EXRChannel, error) {
+	var channels []*EXRChannel
+
+	for {
+		name, rest, ok := cutCString(p)
+		if !ok {
+			return nil, errors.New("invalid OpenEXR channel list")
+		}
+
+		if name == "" {
+			break
+		}
+
+		if len(rest) < 16 {
+			return nil, errors.New("invalid OpenEXR channel list")
+		}
+
+		le := binary.LittleEndian
+		typ := EXRPixelType(le.Uint32(rest))
+
+		if typ < EXRPixelTypeUint || typ > EXRPixelTypeFloat {
+			return nil, fmt.Errorf("unsupported OpenEXR pixel type %d of channel %q", typ, name)
+		}
+
+		if le.Uint32(rest[8:]) != 1 || le.Uint32(rest[12:]) != 1 {
+			return nil, fmt.Errorf("subsampled OpenEXR channel %q is not supported", name)
+		}
+
+		channels = append(channels, &EXRChannel{Name: name, Type: typ, Linear: rest[4] != 0})
+		p = rest[16:]
+	}
+
+	if len(channels) == 0 {
+		return nil, errors.New("OpenEXR image has no channels")
+	}
+
+	return channels, nil
+}
+
+// exrBox2i returns the value of a box2i attribute with inclusive maximum coordinates.
+func exrBox2i(r image.Rectangle) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, uint32(int32(r.Min.X)))
+	b = le.AppendUint32(b, uint32(int32(r.Min.Y)))
+	b = le.AppendUint32(b, uint32(int32(r.Max.X-1)))
+
+	return le.AppendUint32(b, uint32(int32(r.Max.Y-1)))
+}
+
+// cutCString returns the null-terminated string at the start of p and the bytes after it.
+func cutCString(p []byte) (string, []byte, bool) {
+	s, rest, ok := bytes.Cut(p, []byte{0})
+
+	return string(s), rest, ok
+}
+
+// exrCompress compresses the raw bytes of a chunk. Chunks that do not get smaller
+// are stored uncompressed, as OpenEXR requires.
+func exrCompress(c EXRCompression, raw []byte, level int) ([]byte, error) {
+	var data []byte
+
+	switch c {
+	case EXRCompressionRLE:
+		data = exrRLEEncode(exrPredict(exrSplit(raw)))
+	case EXRCompressionZIPS, EXRCompressionZIP:
+		var buf bytes.Buffer
+
+		zw, err := zlib.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := zw.Write(exrPredict(exrSplit(raw))); err != nil {
+			return nil, err
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		data = buf.Bytes()
+	default:
+		return raw, nil
+	}
+
+	if len(data) >= len(raw) {
+		return raw, nil
+	}
+
+	return data, nil
+}
+
+// exrDecompress decompresses a chunk into size raw bytes.
+func exrDecompress(c EXRCompression, data []byte, size int) ([]byte, error) {
+	if len(data) == size {
+		return data, nil
+	}
+
+	var (
+		raw []byte
+		err error
+	)
+
+	switch c {
+	case EXRCompressionRLE:
+		raw, err = exrRLEDecode(data, size)
+	case EXRCompressionZIPS, EXRCompressionZIP:
+		var zr io.ReadCloser
+
+		if zr, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			raw, err = io.ReadAll(io.LimitReader(zr, int64(size)+1))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != size {
+		return nil, fmt.Errorf("invalid chunk size %d, want %d", len(raw), size)
+	}
+
+	return exrMerge(exrUnpredict(raw)), nil
+}
+
+// exrSplit moves the bytes at even offsets to the first half and the bytes at odd
+// offsets to the second half.
+func exrSplit(raw []byte) []byte {
+	out := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+
+	for i, b := range raw {
+		if i%2 == 0 {
+			out[i/2] = b
+		} else {
+			out[half+i/2] = b
+		}
+	}
+
+	return out
+}
+
+// exrMerge reverses exrSplit.
+func exrMerge(data []byte) []byte {
+	out := make([]byte, len(data))
+	half := (len(data) + 1) / 2
+
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = data[i/2]
+		} else {
+			out[i] = data[half+i/2]
+		}
+	}
+
+	return out
+}
+
+// exrPredict replaces the bytes with the differences to their predecessors in place.
+func exrPredict(data []byte) []byte {
+	for i := len(data) - 1; i > 0; i-- {
+		data[i] = data[i] - data[i-1] + 128
+	}
+
+	return data
+}
+
+// exrUnpredict reverses exrPredict in place.
+func exrUnpredict(data []byte) []byte {
+	for i := 1; i < len(data); i++ {
+		data[i] = data[i-1] + data[i] - 128
+	}
+
+	return data
+}
+
+// exrRLEEncode run-length encodes data. A non-negative count byte n is followed by
+// a byte that repeats n+1 times, a negative count byte by -n literal bytes.
+func exrRLEEncode(data []byte) []byte {
+	const minRun, maxRun = 3, 127
+
+	var out []byte
+
+	for start := 0; start < len(data); {
+		end := start + 1
+		for end < len(data) && data[end] == data[start] && end-start-1 < maxRun {
+			end++
+		}
+
+		if end-start >= minRun {
+			out = append(out, byte(end-start-1), data[start])
+		} else {
+			for end < len(data) && end-start < maxRun &&
+				(end+2 >= len(data) || data[end] != data[end+1] || data[end+1] != data[end+2]) {
+				end++
+			}
+
+			out = append(out, byte(int8(start-end)))
+			out = append(out, data[start:end]...)
+		}
+
+		start = end
+	}
+
+	return out
+}
+
+// exrRLEDecode reverses exrRLEEncode for at most size bytes of output.
+func exrRLEDecode(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+
+	for len(data) > 0 {
+		n := int(int8(data[0]))
+		data = data[1:]
+
+		if n < 0 {
+			if -n > len(data) || len(out)-n > size {
+				return nil, errors.New("invalid run-length encoding")
+			}
+
+			out = append(out, data[:-n]...)
+			data = data[-n:]
+
+			continue
+		}
+
+		if len(data) == 0 || len(out)+n+1 > size {
+			return nil, errors.New("invalid run-length encoding")
+		}
+
+		for i := 0; i <= n; i++ {
+			out = append(out, data[0])
+		}
+
+		data = data[1:]
+	}
+
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEXRImage(compression EXRCompression) *EXRImage {
+	img := NewEXRImage(37, 21)
+	img.DataWindow = img.DataWindow.Add(image.Pt(-5, 3))
+	img.Compression = compression
+	img.Attributes = []EXRAttribute{{Name: "owner", Type: "string", Value: []byte("go-mtl")}}
+
+	r := img.AddChannel("R", EXRPixelTypeHalf)
+	z := img.AddChannel("Z", EXRPixelTypeFloat)
+	id := img.AddChannel("object.id", EXRPixelTypeUint)
+	id.Linear = true
+
+	for i := 0; i < 37*21; i++ {
+		// Smooth gradients with flat areas exercise both runs and literals.
+		r.SetFloat32(i, float32(i/8)/16)
+		z.SetFloat32(i, float32(math.Sin(float64(i))))
+		id.SetFloat32(i, float32(i/100))
+	}
+
+	return img
+}
+
+func TestEXRRoundTrip(t *testing.T) {
+	for _, compression := range []EXRCompression{EXRCompressionNone, EXRCompressionRLE, EXRCompressionZIPS, EXRCompressionZIP} {
+		img := newTestEXRImage(compression)
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteEXR(&buf, img))
+
+		data := buf.Bytes()
+		require.Equal(t, uint32(exrMagic), binary.LittleEndian.Uint32(data))
+		require.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[4:]))
+
+		got, err := ReadEXR(bytes.NewReader(data))
+		require.NoError(t, err, compression)
+		require.Equal(t, img.DataWindow, got.DataWindow)
+		require.Equal(t, img.DisplayWindow, got.DisplayWindow)
+		require.Equal(t, compression, got.Compression)
+
+		// Channels are stored in the order of their names.
+		require.Equal(t, []string{"R", "Z", "object.id"}, []string{got.Channels[0].Name, got.Channels[1].Name, got.Channels[2].Name})
+
+		for _, c := range img.Channels {
+			require.Equal(t, c, got.Channel(c.Name), c.Name)
+		}
+
+		require.Equal(t, img.Attributes[0], got.Attributes[len(got.Attributes)-1])
+		require.True(t, got.hasAttribute("pixelAspectRatio"))
+	}
+}
+
+func TestEXRTexture(t *testing.T) {
+	data := make([]byte, 3*2*8+8)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	img, err := NewEXRImageFromTexture(data, PixelFormatRGBA16Float, 3, 2, 32)
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "G", "R"}, []string{img.Channels[0].Name, img.Channels[1].Name, img.Channels[2].Name, img.Channels[3].Name})
+	require.Equal(t, []byte{6, 7}, img.Channel("A").Data[:2])
+	require.Equal(t, []byte{32, 33}, img.Channel("R").Data[6:8])
+
+	got, err := img.TextureBytes(PixelFormatRGBA16Float)
+	require.NoError(t, err)
+	require.Equal(t, data[:24], got[:24])
+	require.Equal(t, data[32:56], got[24:])
+
+	// Half samples are converted to float and missing channels are filled in.
+	img = NewEXRImage(1, 1)
+	img.AddChannel("R", EXRPixelTypeHalf).SetFloat32(0, 0.5)
+
+	got, err = img.TextureBytes(PixelFormatRGBA32Float)
+	require.NoError(t, err)
+	require.Equal(t, []float32{0.5, 0, 0, 1}, []float32{
+		math.Float32frombits(binary.LittleEndian.Uint32(got)),
+		math.Float32frombits(binary.LittleEndian.Uint32(got[4:])),
+		math.Float32frombits(binary.LittleEndian.Uint32(got[8:])),
+		math.Float32frombits(binary.LittleEndian.Uint32(got[12:])),
+	})
+
+	_, err = NewEXRImageFromTexture(data, PixelFormatRGBA8Unorm, 3, 2, 0)
+	require.ErrorContains(t, err, "not supported by OpenEXR")
+}
+
+func TestEXRRunLengthEncoding(t *testing.T) {
+	data := append(bytes.Repeat([]byte{7}, 300), 1, 2, 3, 3, 4, 4, 4, 5)
+	data = append(data, bytes.Repeat([]byte{1, 2}, 100)...)
+
+	encoded := exrRLEEncode(data)
+	require.Equal(t, []byte{127, 7, 127, 7, 43, 7}, encoded[:6])
+
+	got, err := exrRLEDecode(encoded, len(data))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = exrRLEDecode(encoded, len(data)-1)
+	require.Error(t, err)
+
+	require.Equal(t, data, exrMerge(exrUnpredict(exrPredict(exrSplit(data)))))
+}
+
+func TestEXRErrors(t *testing.T) {
+	_, err := ReadEXR(bytes.NewReader(make([]byte, 8)))
+	require.ErrorContains(t, err, "invalid OpenEXR file identifier")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEXR(&buf, newTestEXRImage(EXRCompressionNone)))
+
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte("compression\x00compression\x00"))
+	data[i+28] = 4
+
+	_, err = ReadEXR(bytes.NewReader(data))
+	require.ErrorContains(t, err, "unsupported OpenEXR compression PIZ")
+
+	binary.LittleEndian.PutUint32(data[4:], 2|exrFlagTiled)
+	_, err = ReadEXR(bytes.NewReader(data))
+	require.ErrorContains(t, err, "tiled OpenEXR files are not supported")
+
+	img := NewEXRImage(2, 2)
+	img.Channels = append(img.Channels, &EXRChannel{Name: "R", Type: EXRPixelTypeFloat, Data: make([]byte, 4)})
+	require.ErrorContains(t, WriteEXR(&buf, img), `channel "R" has 4 bytes, want 16`)
+}
+
+func TestEXROversized(t *testing.T) {
+	for _, tc := range []struct {
+		channels int
+		msg      string
+	}{
+		{channels: 1, msg: "invalid OpenEXR chunk 0"},
+		{channels: 5, msg: "OpenEXR image of 268435456x1 pixels with 5 channels is too large"},
+	} {
+		img := NewEXRImage(1, 1)
+		img.Compression = EXRCompressionZIPS
+
+		for i := 0; i < tc.channels; i++ {
+			img.AddChannel(string(rune('A'+i)), EXRPixelTypeFloat)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteEXR(&buf, img))
+
+		// The data window grows to 1<<28 pixels, while the file stays a few hundred bytes.
+		data := buf.Bytes()
+		i := bytes.Index(data, []byte("dataWindow\x00box2i\x00"))
+		binary.LittleEndian.PutUint32(data[i+21+8:], 1<<28-1)
+
+		_, err := ReadEXR(bytes.NewReader(data))
+		require.ErrorContains(t, err, tc.msg)
+	}
+}
@@ -0,0 +1,222 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// FloatImage is an in-memory image of linear floating-point RGBA values. It is the
+// working format of the CPU texture tools, which filter and convolve in linear space.
+type FloatImage struct {
+	// Width and Height are the dimensions of the image in pixels.
+	Width, Height int
+
+	// Pix holds the pixels from the top left to the bottom right.
+	Pix []FloatColor
+}
+
+// NewFloatImage returns a transparent black image of the given dimensions.
+func NewFloatImage(width, height int) *FloatImage {
+	return &FloatImage{
+		Width:  width,
+		Height: height,
+		Pix:    make([]FloatColor, width*height),
+	}
+}
+
+// NewFloatImageFromTexture returns an image of width*height pixels of data in the
+// uncompressed pixel format pf. Colors of sRGB pixel formats are converted to linear
+// space. A bytesPerRow of 0 means the rows are tightly packed.
+func NewFloatImageFromTexture(data []byte, pf PixelFormat, width, height, bytesPerRow int) (*FloatImage, error) {
+	l, err := filterableLayout(pf)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * l.size
+	}
+
+	if err := checkRows(data, "texture", width, height, l.size, bytesPerRow); err != nil {
+		return nil, err
+	}
+
+	img := NewFloatImage(width, height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := l.decode(data[y*bytesPerRow+x*l.size:])
+
+			if l.srgb {
+				for c := 0; c < 3; c++ {
+					v[c] = float32(SRGBToLinear(float64(v[c])))
+				}
+			}
+
+			img.Pix[y*width+x] = FloatColor{v[0], v[1], v[2], v[3]}
+		}
+	}
+
+	return img, nil
+}
+
+// TextureBytes returns the image as tightly packed texture data in the uncompressed
+// pixel format pf. Colors are encoded to sRGB for sRGB pixel formats.
+func (img *FloatImage) TextureBytes(pf PixelFormat) ([]byte, error) {
+	l, err := filterableLayout(pf)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, len(img.Pix)*l.size)
+
+	for i, p := range img.Pix {
+		v := [4]float32{p.R, p.G, p.B, p.A}
+
+		if l.srgb {
+			for c := 0; c < 3; c++ {
+				v[c] = float32(LinearToSRGB(clamp(float64(v[c]), 0, 1)))
+			}
+		}
+
+		l.encode(data[i*l.size:], v)
+	}
+
+	return data, nil
+}
+
+// ColorModel implements the image.Image interface.
+func (img *FloatImage) ColorModel() color.Model {
+	return FloatColorModel
+}
+
+// Bounds implements the image.Image interface.
+func (img *FloatImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, img.Width, img.Height)
+}
+
+// At implements the image.Image interface.
+func (img *FloatImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return FloatColor{}
+	}
+
+	return img.Pix[y*img.Width+x]
+}
+
+// Set implements the draw.Image interface.
+func (img *FloatImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return
+	}
+
+	img.Pix[y*img.Width+x] = toFloatColor(c)
+}
+
+// ResampleFilter selects how images are sampled between pixel centers.
+type ResampleFilter uint8
+
+const (
+	// ResampleFilterBilinear interpolates linearly between the 4 nearest pixels.
+	ResampleFilterBilinear ResampleFilter = 0
+
+	// ResampleFilterNearest uses the nearest pixel.
+	ResampleFilterNearest ResampleFilter = 1
+
+	// ResampleFilterBicubic interpolates the 16 nearest pixels with a Catmull-Rom spline.
+	ResampleFilterBicubic ResampleFilter = 2
+)
+
+// sample returns the color at the continuous coordinates (x, y), where pixel
+// centers lie at half-integer coordinates. Coordinates outside the image are
+// clamped to the edge, or wrapped horizontally if wrapX is set.
+func (img *FloatImage) sample(f ResampleFilter, x, y float64, wrapX bool) FloatColor {
+	x, y = x-0.5, y-0.5
+
+	if f == ResampleFilterNearest {
+		return img.texel(int(math.Round(x)), int(math.Round(y)), wrapX)
+	}
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	var wx, wy []float64
+
+	first := 0
+	if f == ResampleFilterBicubic {
+		wx, wy, first = catmullRom(fx), catmullRom(fy), -1
+	} else {
+		wx, wy = []float64{1 - fx, fx}, []float64{1 - fy, fy}
+	}
+
+	var sum [4]float64
+
+	for j, w := range wy {
+		for i, v := range wx {
+			p := img.texel(int(x0)+first+i, int(y0)+first+j, wrapX)
+			sum = addScaled(sum, p, w*v)
+		}
+	}
+
+	return FloatColor{float32(sum[0]), float32(sum[1]), float32(sum[2]), float32(sum[3])}
+}
+
+// texel returns the pixel at (x, y) with the coordinates clamped, or wrapped
+// horizontally if wrapX is set.
+func (img *FloatImage) texel(x, y int, wrapX bool) FloatColor {
+	if wrapX {
+		x %= img.Width
+		if x < 0 {
+			x += img.Width
+		}
+	} else if x < 0 {
+		x = 0
+	} else if x >= img.Width {
+		x = img.Width - 1
+	}
+
+	if y < 0 {
+		y = 0
+	} else if y >= img.Height {
+		y = img.Height - 1
+	}
+
+	return img.Pix[y*img.Width+x]
+}
+
+// catmullRom returns the weights of the 4 pixels around a position at fraction t
+// between the second and the third.
+func catmullRom(t float64) []float64 {
+	return []float64{
+		((-t+2)*t - 1) * t / 2,
+		((3*t-5)*t*t + 2) / 2,
+		((-3*t+4)*t + 1) * t / 2,
+		(t - 1) * t * t / 2,
+	}
+}
+
+// addScaled returns sum plus the color scaled by w.
+func addScaled(sum [4]float64, c FloatColor, w float64) [4]float64 {
+	sum[0] += float64(c.R) * w
+	sum[1] += float64(c.G) * w
+	sum[2] += float64(c.B) * w
+	sum[3] += float64(c.A) * w
+
+	return sum
+}
+
+// filterableLayout returns the layout of an uncompressed pixel format whose values
+// can be filtered, which excludes integer and stencil formats.
+func filterableLayout(pf PixelFormat) (pixelLayout, error) {
+	l, ok := pixelLayouts[pf]
+	if _, _, hasStencil := depthStencilBytesPerPixel(pf); !ok || hasStencil || l.typ == componentUint || l.typ == componentSint {
+		return pixelLayout{}, fmt.Errorf("pixel format %d cannot be filtered", pf)
+	}
+
+	return l, nil
+}
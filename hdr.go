@@ -0,0 +1,512 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// hdrFormat is the only pixel format of Radiance HDR files that is supported.
+const hdrFormat = "32-bit_rle_rgbe"
+
+// HDRImage is an image stored in the Radiance HDR (RGBE) file format.
+//
+// Reference: https://radsite.lbl.gov/radiance/refer/filefmts.pdf
+type HDRImage struct {
+	// Width and Height are the dimensions of the image in pixels.
+	Width, Height int
+
+	// Pix holds the red, green and blue values of the pixels from the top left to
+	// the bottom right.
+	Pix []float32
+
+	// Exposure is the product of the EXPOSURE values of the header. The values in
+	// Pix are divided by it to get the original radiance.
+	Exposure float64
+
+	// Variables holds the header lines other than FORMAT and EXPOSURE, such as
+	// "PRIMARIES=0.640 0.330 0.290 0.600 0.150 0.060 0.333 0.333".
+	Variables []string
+}
+
+// NewHDRImage returns a black image of the given dimensions.
+func NewHDRImage(width, height int) *HDRImage {
+	return &HDRImage{
+		Width:    width,
+		Height:   height,
+		Pix:      make([]float32, 3*width*height),
+		Exposure: 1,
+	}
+}
+
+// NewHDRImageFromTexture returns an image with the color channels of texture data
+// in a floating-point pixel format pf, such as PixelFormatRGB9E5Float or
+// PixelFormatRGBA16Float. A bytesPerRow of 0 denotes tightly packed rows.
+func NewHDRImageFromTexture(data []byte, pf PixelFormat, width, height, bytesPerRow int) (*HDRImage, error) {
+	l, ok := pixelLayouts[pf]
+	if !ok || l.typ != componentFloat || l.bits[0] == 0 {
+		return nil, fmt.Errorf("pixel format %d is not supported by HDR", pf)
+	}
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * l.size
+	}
+
+	if err := checkRows(data, "texture", width, height, l.size, bytesPerRow); err != nil {
+		return nil, err
+	}
+
+	img := NewHDRImage(width, height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := l.decode(data[y*bytesPerRow+x*l.size:])
+			copy(img.Pix[3*(y*width+x):], v[:3])
+		}
+	}
+
+	return img, nil
+}
+
+// TextureBytes returns the image as tightly packed texture data in a floating-point
+// pixel format pf, such as PixelFormatRGB9E5Float or PixelFormatRGBA16Float.
+// Alpha is set to 1.
+func (img *HDRImage) TextureBytes(pf PixelFormat) ([]byte, error) {
+	l, ok := pixelLayouts[pf]
+	if !ok || l.typ != componentFloat || l.bits[0] == 0 {
+		return nil, fmt.Errorf("pixel format %d is not supported by HDR", pf)
+	}
+
+	data := make([]byte, img.Width*img.Height*l.size)
+
+	for i := 0; i < img.Width*img.Height; i++ {
+		p := img.Pix[3*i:]
+		l.encode(data[i*l.size:], [4]float32{p[0], p[1], p[2], 1})
+	}
+
+	return data, nil
+}
+
+// ReadHDR reads an image in the Radiance HDR file format with flat, run-length or
+// adaptive run-length encoded scanlines in any orientation.
+func ReadHDR(r io.Reader) (*HDRImage, error) {
+	br := bufio.NewReader(r)
+
+	line, err := readHDRLine(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HDR header: %w", err)
+	}
+
+	if line != "#?RADIANCE" && line != "#?RGBE" {
+		return nil, errors.New("invalid HDR file identifier")
+	}
+
+	img := &HDRImage{Exposure: 1}
+
+	for {
+		if line, err = readHDRLine(br); err != nil {
+			return nil, fmt.Errorf("failed to read HDR header: %w", err)
+		}
+
+		if line == "" {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#"):
+			// Comments are not preserved.
+		case strings.HasPrefix(line, "FORMAT="):
+			if format := strings.TrimPrefix(line, "FORMAT="); format != hdrFormat {
+				return nil, fmt.Errorf("unsupported HDR format %q", format)
+			}
+		case strings.HasPrefix(line, "EXPOSURE="):
+			exposure, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "EXPOSURE=")), 64)
+			if err != nil || exposure <= 0 {
+				return nil, fmt.Errorf("invalid HDR exposure %q", line)
+			}
+
+			img.Exposure *= exposure
+		default:
+			img.Variables = append(img.Variables, line)
+		}
+	}
+
+	if line, err = readHDRLine(br); err != nil {
+		return nil, fmt.Errorf("failed to read HDR resolution: %w", err)
+	}
+
+	o, err := parseHDRResolution(line)
+	if err != nil {
+		return nil, err
+	}
+
+	img.Width, img.Height = o.width, o.height
+
+	// The scanlines are read before the pixels are allocated, so the memory grows
+	// with the input rather than with the resolution claimed by the header.
+	var rgbe []byte
+
+	scanline := make([]byte, 4*o.length)
+
+	for i := 0; i < o.scanlines; i++ {
+		if err := readHDRScanline(br, scanline); err != nil {
+			return nil, fmt.Errorf("failed to read HDR scanline %d: %w", i, err)
+		}
+
+		rgbe = append(rgbe, scanline...)
+	}
+
+	img.Pix = make([]float32, 3*img.Width*img.Height)
+
+	for i := 0; i < o.scanlines; i++ {
+		for j := 0; j < o.length; j++ {
+			x, y := o.position(i, j)
+			r, g, b := rgbeToFloat(rgbe[4*(i*o.length+j):])
+			copy(img.Pix[3*(y*img.Width+x):], []float32{r, g, b})
+		}
+	}
+
+	return img, nil
+}
+
+// WriteHDR writes an image in the Radiance HDR file format with top-to-bottom,
+// left-to-right scanlines. Scanlines are adaptive run-length encoded if their
+// length allows it.
+func WriteHDR(w io.Writer, img *HDRImage) error {
+	if img.Width <= 0 || img.Height <= 0 || len(img.Pix) != 3*img.Width*img.Height {
+		return fmt.Errorf("invalid image dimensions %dx%d for %d values", img.Width, img.Height, len(img.Pix))
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "#?RADIANCE\nFORMAT=%s\n", hdrFormat)
+
+	if img.Exposure > 0 && img.Exposure != 1 {
+		fmt.Fprintf(&buf, "EXPOSURE=%g\n", img.Exposure)
+	}
+
+	for _, v := range img.Variables {
+		if strings.ContainsRune(v, '\n') {
+			return fmt.Errorf("invalid header variable %q", v)
+		}
+
+		buf.WriteString(v + "\n")
+	}
+
+	fmt.Fprintf(&buf, "\n-Y %d +X %d\n", img.Height, img.Width)
+
+	rle := img.Width >= 8 && img.Width <= 0x7fff
+	scanline := make([]byte, 4*img.Width)
+	component := make([]byte, img.Width)
+
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			p := img.Pix[3*(y*img.Width+x):]
+			floatToRGBE(scanline[4*x:], p[0], p[1], p[2])
+		}
+
+		if !rle {
+			buf.Write(scanline)
+
+			continue
+		}
+
+		buf.Write([]byte{2, 2, byte(img.Width >> 8), byte(img.Width)})
+
+		for c := 0; c < 4; c++ {
+			for x := range component {
+				component[x] = scanline[4*x+c]
+			}
+
+			buf.Write(hdrRLEEncode(component))
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// hdrOrientation describes the order of the scanlines of a Radiance HDR file.
+type hdrOrientation struct {
+	width, height     int
+	scanlines, length int
+	transposed        bool
+	flipX, flipY      bool
+}
+
+// position returns the image coordinates of pixel j of scanline i.
+func (o hdrOrientation) position(i, j int) (x, y int) {
+	x, y = j, i
+	if o.transposed {
+		x, y = i, j
+	}
+
+	if o.flipX {
+		x = o.width - 1 - x
+	}
+
+	if o.flipY {
+		y = o.height - 1 - y
+	}
+
+	return x, y
+}
+
+// parseHDRResolution parses a resolution string such as "-Y 512 +X 1024". The
+// first axis selects the scanline and the second the pixel within it. Y grows
+// upwards and X to the right.
+func parseHDRResolution(line string) (hdrOrientation, error) {
+	var o hdrOrientation
+
+	f := strings.Fields(line)
+	if len(f) != 4 || len(f[0]) != 2 || len(f[2]) != 2 || f[0][1] == f[2][1] {
+		return o, fmt.Errorf("invalid HDR resolution %q", line)
+	}
+
+	n1, err1 := strconv.Atoi(f[1])
+	n2, err2 := strconv.Atoi(f[3])
+
+	if err1 != nil || err2 != nil || n1 <= 0 || n2 <= 0 || n1 > 1<<16 || n2 > 1<<16 || int64(n1)*int64(n2) > 1<<28 {
+		return o, fmt.Errorf("invalid HDR resolution %q", line)
+	}
+
+	o.scanlines, o.length = n1, n2
+
+	for i, axis := range []string{f[0], f[2]} {
+		n := n1
+		if i == 1 {
+			n = n2
+		}
+
+		switch axis {
+		case "-Y", "+Y":
+			o.height, o.flipY = n, axis == "+Y"
+			o.transposed = i == 1
+		case "+X", "-X":
+			o.width, o.flipX = n, axis == "-X"
+		default:
+			return o, fmt.Errorf("invalid HDR resolution %q", line)
+		}
+	}
+
+	return o, nil
+}
+
+// readHDRLine reads a header line of at most 4096 bytes without the line feed.
+func readHDRLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return "", errors.New("header line too long")
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(line[:len(line)-1]), "\r"), nil
+}
+
+// readHDRScanline reads a scanline of RGBE pixels in any of the three encodings.
+func readHDRScanline(br *bufio.Reader, scanline []byte) error {
+	n := len(scanline) / 4
+
+	if _, err := io.ReadFull(br, scanline[:4]); err != nil {
+		return err
+	}
+
+	if n < 8 || n > 0x7fff || scanline[0] != 2 || scanline[1] != 2 || scanline[2]&0x80 != 0 {
+		return readHDRFlatScanline(br, scanline)
+	}
+
+	if int(scanline[2])<<8|int(scanline[3]) != n {
+		return errors.New("invalid scanline width")
+	}
+
+	// Adaptive run-length encoding stores the components one after another.
+	for c := 0; c < 4; c++ {
+		for x := 0; x < n; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+
+			if count > 128 {
+				count -= 128
+
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+
+				if x+int(count) > n {
+					return errors.New("invalid run length")
+				}
+
+				for i := 0; i < int(count); i++ {
+					scanline[4*(x+i)+c] = v
+				}
+
+				x += int(count)
+
+				continue
+			}
+
+			if count == 0 || x+int(count) > n {
+				return errors.New("invalid run length")
+			}
+
+			for i := 0; i < int(count); i++ {
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+
+				scanline[4*(x+i)+c] = v
+			}
+
+			x += int(count)
+		}
+	}
+
+	return nil
+}
+
+// readHDRFlatScanline reads a scanline of flat or run-length encoded pixels whose
+// first pixel has already been read. A pixel of 1, 1, 1, n repeats the previous
+// pixel n times, with n shifted left by 8 bits for each directly preceding repeat.
+func readHDRFlatScanline(br *bufio.Reader, scanline []byte) error {
+	var p [4]byte
+
+	copy(p[:], scanline)
+
+	n := len(scanline) / 4
+	shift := 0
+
+	for x := 0; ; {
+		if p[0] == 1 && p[1] == 1 && p[2] == 1 {
+			count := int(p[3]) << shift
+			if x == 0 || shift > 16 || x+count > n {
+				return errors.New("invalid run length")
+			}
+
+			for i := 0; i < count; i++ {
+				copy(scanline[4*(x+i):], scanline[4*(x-1):4*x])
+			}
+
+			x += count
+			shift += 8
+		} else {
+			copy(scanline[4*x:], p[:])
+			x++
+			shift = 0
+		}
+
+		if x == n {
+			return nil
+		}
+
+		if _, err := io.ReadFull(br, p[:]); err != nil {
+			return err
+		}
+	}
+}
+
+// hdrRLEEncode encodes one component of a scanline with adaptive run-length
+// encoding. Runs of at least 4 equal bytes are stored as 128+n followed by the
+// byte, everything else as n followed by n literal bytes.
+func hdrRLEEncode(data []byte) []byte {
+	const minRun, maxRun, maxLiteral = 4, 127, 128
+
+	var out []byte
+
+	for cur := 0; cur < len(data); {
+		begin, run, prevRun := cur, 0, 0
+
+		// Find the next run of at least minRun bytes.
+		for run < minRun && begin < len(data) {
+			begin += run
+			prevRun = run
+			run = 1
+
+			for begin+run < len(data) && run < maxRun && data[begin] == data[begin+run] {
+				run++
+			}
+		}
+
+		// A short run right before it is still stored as a run.
+		if prevRun > 1 && prevRun == begin-cur {
+			out = append(out, byte(128+prevRun), data[cur])
+			cur = begin
+		}
+
+		for cur < begin {
+			n := begin - cur
+			if n > maxLiteral {
+				n = maxLiteral
+			}
+
+			out = append(out, byte(n))
+			out = append(out, data[cur:cur+n]...)
+			cur += n
+		}
+
+		if run >= minRun {
+			out = append(out, byte(128+run), data[begin])
+			cur += run
+		}
+	}
+
+	return out
+}
+
+// rgbeToFloat converts an RGBE pixel to floating-point values, reconstructing the
+// center of the quantization interval.
+func rgbeToFloat(p []byte) (r, g, b float32) {
+	if p[3] == 0 {
+		return 0, 0, 0
+	}
+
+	f := math.Ldexp(1, int(p[3])-(128+8))
+
+	return float32((float64(p[0]) + 0.5) * f),
+		float32((float64(p[1]) + 0.5) * f),
+		float32((float64(p[2]) + 0.5) * f)
+}
+
+// floatToRGBE converts floating-point values to an RGBE pixel. Negative values and
+// NaN are stored as 0, values too large to represent as the largest one.
+func floatToRGBE(p []byte, r, g, b float32) {
+	rc := clamp(float64(r), 0, math.MaxFloat64)
+	gc := clamp(float64(g), 0, math.MaxFloat64)
+	bc := clamp(float64(b), 0, math.MaxFloat64)
+	maxc := math.Max(rc, math.Max(gc, bc))
+
+	if maxc <= 1e-32 {
+		copy(p, []byte{0, 0, 0, 0})
+
+		return
+	}
+
+	frac, exp := math.Frexp(maxc)
+	if exp > 127 {
+		copy(p, []byte{255, 255, 255, 255})
+
+		return
+	}
+
+	scale := frac * 256 / maxc
+
+	p[0] = byte(rc * scale)
+	p[1] = byte(gc * scale)
+	p[2] = byte(bc * scale)
+	p[3] = byte(exp + 128)
+}
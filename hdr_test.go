@@ -0,0 +1,141 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHDRRoundTrip(t *testing.T) {
+	for _, width := range []int{5, 64} {
+		img := NewHDRImage(width, 3)
+		img.Exposure = 2
+		img.Variables = []string{"PRIMARIES=0.640 0.330 0.290 0.600 0.150 0.060 0.333 0.333"}
+
+		for i := range img.Pix {
+			// Flat areas and gradients exercise both runs and literals.
+			img.Pix[i] = float32(i/24) * 0.75
+			if i%7 == 0 {
+				img.Pix[i] = float32(i) * 100
+			}
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteHDR(&buf, img))
+
+		data := buf.String()
+		require.True(t, strings.HasPrefix(data, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\nEXPOSURE=2\nPRIMARIES="))
+		require.Contains(t, data, "\n\n-Y 3 +X "+strconv.Itoa(width)+"\n")
+
+		got, err := ReadHDR(strings.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, img.Width, got.Width)
+		require.Equal(t, img.Height, got.Height)
+		require.Equal(t, img.Exposure, got.Exposure)
+		require.Equal(t, img.Variables, got.Variables)
+
+		// The components of a pixel share an exponent, so the error depends on the largest.
+		for i, v := range img.Pix {
+			p := img.Pix[i/3*3 : i/3*3+3]
+			maxc := math.Max(float64(p[0]), math.Max(float64(p[1]), float64(p[2])))
+			require.InDelta(t, v, got.Pix[i], maxc/128, i)
+		}
+
+		// Decoded values are encoded to the same bytes.
+		var again bytes.Buffer
+		require.NoError(t, WriteHDR(&again, got))
+		require.Equal(t, data, again.String())
+	}
+}
+
+func TestHDRRunLengthEncoding(t *testing.T) {
+	data := append([]byte{1, 2, 2, 3}, bytes.Repeat([]byte{9}, 200)...)
+	data = append(data, 4, 4, 4, 5)
+
+	encoded := hdrRLEEncode(data)
+	require.Equal(t, []byte{4, 1, 2, 2, 3, 128 + 127, 9, 128 + 73, 9, 4, 4, 4, 4, 5}, encoded)
+
+	// A short run directly before a long one is stored as a run.
+	encoded = hdrRLEEncode(append([]byte{2, 2, 2}, bytes.Repeat([]byte{9}, 10)...))
+	require.Equal(t, []byte{128 + 3, 2, 128 + 10, 9}, encoded)
+}
+
+func TestHDROrientation(t *testing.T) {
+	// A 2x3 image stored bottom-to-top in columns from the right, with an old-style
+	// run that repeats the first pixel of the first column.
+	header := "#?RGBE\nEXPOSURE=0.5\nEXPOSURE=4\n\n-X 2 +Y 3\n"
+	pixels := []byte{
+		128, 0, 0, 129, 1, 1, 1, 2, // Right column: red, then 2 repeats.
+		0, 128, 0, 129, 0, 0, 128, 129, 0, 0, 0, 0, // Left column: green, blue, black.
+	}
+
+	img, err := ReadHDR(bytes.NewReader(append([]byte(header), pixels...)))
+	require.NoError(t, err)
+	require.Equal(t, 2, img.Width)
+	require.Equal(t, 3, img.Height)
+	require.Equal(t, 2.0, img.Exposure)
+
+	at := func(x, y int) []float32 { return img.Pix[3*(y*2+x) : 3*(y*2+x)+3] }
+
+	require.Equal(t, []float32{1.00390625, 0.00390625, 0.00390625}, at(1, 2))
+	require.Equal(t, at(1, 2), at(1, 0))
+	require.Equal(t, float32(1.00390625), at(0, 2)[1])
+	require.Equal(t, float32(1.00390625), at(0, 1)[2])
+	require.Equal(t, []float32{0, 0, 0}, at(0, 0))
+}
+
+func TestHDRTexture(t *testing.T) {
+	img := NewHDRImage(2, 1)
+	copy(img.Pix, []float32{1, 2, 4, 0.5, 0.25, 0})
+
+	data, err := img.TextureBytes(PixelFormatRGB9E5Float)
+	require.NoError(t, err)
+	require.Len(t, data, 8)
+
+	r, g, b := DecodeRGB9E5(binary.LittleEndian.Uint32(data[4:]))
+	require.Equal(t, []float32{0.5, 0.25, 0}, []float32{r, g, b})
+
+	got, err := NewHDRImageFromTexture(data, PixelFormatRGB9E5Float, 2, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, img.Pix, got.Pix)
+
+	data, err = img.TextureBytes(PixelFormatRGBA32Float)
+	require.NoError(t, err)
+	require.Equal(t, float32(1), math.Float32frombits(binary.LittleEndian.Uint32(data[12:])))
+
+	_, err = img.TextureBytes(PixelFormatRGBA8Unorm)
+	require.ErrorContains(t, err, "not supported by HDR")
+}
+
+func TestHDRErrors(t *testing.T) {
+	_, err := ReadHDR(strings.NewReader("P6\n"))
+	require.ErrorContains(t, err, "invalid HDR file identifier")
+
+	_, err = ReadHDR(strings.NewReader("#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n"))
+	require.ErrorContains(t, err, `unsupported HDR format "32-bit_rle_xyze"`)
+
+	_, err = ReadHDR(strings.NewReader("#?RADIANCE\n\n+X 1 -X 1\n"))
+	require.ErrorContains(t, err, "invalid HDR resolution")
+
+	_, err = ReadHDR(strings.NewReader("#?RADIANCE\n\n-Y 65536 +X 65536\n"))
+	require.ErrorContains(t, err, "invalid HDR resolution")
+
+	_, err = ReadHDR(strings.NewReader("#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x89\x00"))
+	require.ErrorContains(t, err, "invalid run length")
+
+	// A header without scanlines does not allocate the pixels it claims.
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+	_, err = ReadHDR(strings.NewReader("#?RADIANCE\n\n-Y 16384 +X 16384\n"))
+	runtime.ReadMemStats(&after)
+
+	require.ErrorContains(t, err, "failed to read HDR scanline 0")
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
@@ -0,0 +1,703 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ktxIdentifier is the file identifier at the start of every KTX 1.1 file.
+var ktxIdentifier = [12]byte{0xAB, 'K', 'T', 'X', ' ', '1', '1', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// ktxEndianness is the value of the endianness field in the byte order of the file.
+const ktxEndianness = 0x04030201
+
+// OpenGL enums used by the KTX 1.1 header.
+const (
+	glByte                      = 0x1400
+	glUnsignedByte              = 0x1401
+	glShort                     = 0x1402
+	glUnsignedShort             = 0x1403
+	glInt                       = 0x1404
+	glUnsignedInt               = 0x1405
+	glFloat                     = 0x1406
+	glHalfFloat                 = 0x140B
+	glUnsignedShort565          = 0x8363
+	glUnsignedShort4444         = 0x8033
+	glUnsignedShort5551         = 0x8034
+	glUnsignedShort1555Rev      = 0x8366
+	glUnsignedInt2101010Rev     = 0x8368
+	glUnsignedInt10F11F11FRev   = 0x8C3B
+	glUnsignedInt5999Rev        = 0x8C3E
+	glFloat32UnsignedInt248Rev  = 0x8DAD
+	glStencilIndex              = 0x1901
+	glDepthComponent            = 0x1902
+	glRed                       = 0x1903
+	glAlpha                     = 0x1906
+	glRGB                       = 0x1907
+	glRGBA                      = 0x1908
+	glBGRA                      = 0x80E1
+	glRG                        = 0x8227
+	glRGInteger                 = 0x8228
+	glRedInteger                = 0x8D94
+	glRGBAInteger               = 0x8D99
+	glDepthStencil              = 0x84F9
+	glAlpha8                    = 0x803C
+	glR8                        = 0x8229
+	glR8Snorm                   = 0x8F94
+	glR8UI                      = 0x8232
+	glR8I                       = 0x8231
+	glSR8                       = 0x8FBD
+	glR16                       = 0x822A
+	glR16Snorm                  = 0x8F98
+	glR16UI                     = 0x8234
+	glR16I                      = 0x8233
+	glR16F                      = 0x822D
+	glRG8                       = 0x822B
+	glRG8Snorm                  = 0x8F95
+	glRG8UI                     = 0x8238
+	glRG8I                      = 0x8237
+	glSRG8                      = 0x8FBE
+	glRGB565                    = 0x8D62
+	glRGB5A1                    = 0x8057
+	glRGBA4                     = 0x8056
+	glR32UI                     = 0x8236
+	glR32I                      = 0x8235
+	glR32F                      = 0x822E
+	glRG16                      = 0x822C
+	glRG16Snorm                 = 0x8F99
+	glRG16UI                    = 0x823A
+	glRG16I                     = 0x8239
+	glRG16F                     = 0x822F
+	glRGBA8                     = 0x8058
+	glSRGB8Alpha8               = 0x8C43
+	glRGBA8Snorm                = 0x8F97
+	glRGBA8UI                   = 0x8D7C
+	glRGBA8I                    = 0x8D8E
+	glRGB10A2                   = 0x8059
+	glRGB10A2UI                 = 0x906F
+	glR11FG11FB10F              = 0x8C3A
+	glRGB9E5                    = 0x8C3D
+	glRG32UI                    = 0x823C
+	glRG32I                     = 0x823B
+	glRG32F                     = 0x8230
+	glRGBA16                    = 0x805B
+	glRGBA16Snorm               = 0x8F9B
+	glRGBA16UI                  = 0x8D76
+	glRGBA16I                   = 0x8D88
+	glRGBA16F                   = 0x881A
+	glRGBA32UI                  = 0x8D70
+	glRGBA32I                   = 0x8D82
+	glRGBA32F                   = 0x8814
+	glDepthComponent16          = 0x81A5
+	glDepthComponent32F         = 0x8CAC
+	glStencilIndex8             = 0x8D48
+	glDepth32FStencil8          = 0x8CAD
+	glCompressedRGBAS3TCDXT1    = 0x83F1
+	glCompressedRGBAS3TCDXT3    = 0x83F2
+	glCompressedRGBAS3TCDXT5    = 0x83F3
+	glCompressedSRGBAlphaDXT1   = 0x8C4D
+	glCompressedSRGBAlphaDXT3   = 0x8C4E
+	glCompressedSRGBAlphaDXT5   = 0x8C4F
+	glCompressedRedRGTC1        = 0x8DBB
+	glCompressedSignedRedRGTC1  = 0x8DBC
+	glCompressedRGRGTC2         = 0x8DBD
+	glCompressedSignedRGRGTC2   = 0x8DBE
+	glCompressedRGBAUnormBPTC   = 0x8E8C
+	glCompressedSRGBAlphaBPTC   = 0x8E8D
+	glCompressedRGBSignedBPTC   = 0x8E8E
+	glCompressedRGBUnsignedBPTC = 0x8E8F
+	glCompressedR11EAC          = 0x9270
+	glCompressedSignedR11EAC    = 0x9271
+	glCompressedRG11EAC         = 0x9272
+	glCompressedSignedRG11EAC   = 0x9273
+	glCompressedRGB8ETC2        = 0x9274
+	glCompressedSRGB8ETC2       = 0x9275
+	glCompressedRGB8A1ETC2      = 0x9276
+	glCompressedSRGB8A1ETC2     = 0x9277
+	glCompressedRGBA8ETC2EAC    = 0x9278
+	glCompressedSRGB8A8ETC2EAC  = 0x9279
+	glCompressedRGBPVRTC4       = 0x8C00
+	glCompressedRGBPVRTC2       = 0x8C01
+	glCompressedRGBAPVRTC4      = 0x8C02
+	glCompressedRGBAPVRTC2      = 0x8C03
+	glCompressedSRGBPVRTC2      = 0x8A54
+	glCompressedSRGBPVRTC4      = 0x8A55
+	glCompressedSRGBAlphaPVRTC2 = 0x8A56
+	glCompressedSRGBAlphaPVRTC4 = 0x8A57
+	glCompressedRGBAASTC4x4     = 0x93B0
+	glCompressedSRGB8A8ASTC4x4  = 0x93D0
+)
+
+// ktxFormat maps a pixel format to the OpenGL format enums of a KTX 1.1 header.
+type ktxFormat struct {
+	pixelFormat        PixelFormat
+	internalFormat     uint32
+	format             uint32
+	typ                uint32
+	typeSize           uint32
+	baseInternalFormat uint32
+}
+
+// ktxFormats holds the supported pixel formats. Formats that share an internal
+// format are told apart by their format; the first entry wins when reading.
+var ktxFormats = func() []ktxFormat {
+	f := []ktxFormat{
+		// Ordinary 8-bit pixel formats.
+		{PixelFormatA8Unorm, glAlpha8, glAlpha, glUnsignedByte, 1, glAlpha},
+		{PixelFormatR8Unorm, glR8, glRed, glUnsignedByte, 1, glRed},
+		{PixelFormatR8UnormSRGB, glSR8, glRed, glUnsignedByte, 1, glRed},
+		{PixelFormatR8Snorm, glR8Snorm, glRed, glByte, 1, glRed},
+		{PixelFormatR8Uint, glR8UI, glRedInteger, glUnsignedByte, 1, glRed},
+		{PixelFormatR8Sint, glR8I, glRedInteger, glByte, 1, glRed},
+
+		// Ordinary 16-bit pixel formats.
+		{PixelFormatR16Unorm, glR16, glRed, glUnsignedShort, 2, glRed},
+		{PixelFormatR16Snorm, glR16Snorm, glRed, glShort, 2, glRed},
+		{PixelFormatR16Uint, glR16UI, glRedInteger, glUnsignedShort, 2, glRed},
+		{PixelFormatR16Sint, glR16I, glRedInteger, glShort, 2, glRed},
+		{PixelFormatR16Float, glR16F, glRed, glHalfFloat, 2, glRed},
+		{PixelFormatRG8Unorm, glRG8, glRG, glUnsignedByte, 1, glRG},
+		{PixelFormatRG8UnormSRGB, glSRG8, glRG, glUnsignedByte, 1, glRG},
+		{PixelFormatRG8Snorm, glRG8Snorm, glRG, glByte, 1, glRG},
+		{PixelFormatRG8Uint, glRG8UI, glRGInteger, glUnsignedByte, 1, glRG},
+		{PixelFormatRG8Sint, glRG8I, glRGInteger, glByte, 1, glRG},
+
+		// Packed 16-bit pixel formats.
+		{PixelFormatB5G6R5Unorm, glRGB565, glRGB, glUnsignedShort565, 2, glRGB},
+		{PixelFormatA1BGR5Unorm, glRGB5A1, glRGBA, glUnsignedShort5551, 2, glRGBA},
+		{PixelFormatABGR4Unorm, glRGBA4, glRGBA, glUnsignedShort4444, 2, glRGBA},
+		{PixelFormatBGR5A1Unorm, glRGB5A1, glBGRA, glUnsignedShort1555Rev, 2, glRGBA},
+
+		// Ordinary 32-bit pixel formats.
+		{PixelFormatR32Uint, glR32UI, glRedInteger, glUnsignedInt, 4, glRed},
+		{PixelFormatR32Sint, glR32I, glRedInteger, glInt, 4, glRed},
+		{PixelFormatR32Float, glR32F, glRed, glFloat, 4, glRed},
+		{PixelFormatRG16Unorm, glRG16, glRG, glUnsignedShort, 2, glRG},
+		{PixelFormatRG16Snorm, glRG16Snorm, glRG, glShort, 2, glRG},
+		{PixelFormatRG16Uint, glRG16UI, glRGInteger, glUnsignedShort, 2, glRG},
+		{PixelFormatRG16Sint, glRG16I, glRGInteger, glShort, 2, glRG},
+		{PixelFormatRG16Float, glRG16F, glRG, glHalfFloat, 2, glRG},
+		{PixelFormatRGBA8Unorm, glRGBA8, glRGBA, glUnsignedByte, 1, glRGBA},
+		{PixelFormatRGBA8UnormSRGB, glSRGB8Alpha8, glRGBA, glUnsignedByte, 1, glRGBA},
+		{PixelFormatRGBA8Snorm, glRGBA8Snorm, glRGBA, glByte, 1, glRGBA},
+		{PixelFormatRGBA8Uint, glRGBA8UI, glRGBAInteger, glUnsignedByte, 1, glRGBA},
+		{PixelFormatRGBA8Sint, glRGBA8I, glRGBAInteger, glByte, 1, glRGBA},
+		{PixelFormatBGRA8Unorm, glRGBA8, glBGRA, glUnsignedByte, 1, glRGBA},
+		{PixelFormatBGRA8UnormSRGB, glSRGB8Alpha8, glBGRA, glUnsignedByte, 1, glRGBA},
+
+		// Packed 32-bit pixel formats.
+		{PixelFormatRGB10A2Unorm, glRGB10A2, glRGBA, glUnsignedInt2101010Rev, 4, glRGBA},
+		{PixelFormatRGB10A2Uint, glRGB10A2UI, glRGBAInteger, glUnsignedInt2101010Rev, 4, glRGBA},
+		{PixelFormatBGR10A2Unorm, glRGB10A2, glBGRA, glUnsignedInt2101010Rev, 4, glRGBA},
+		{PixelFormatRG11B10Float, glR11FG11FB10F, glRGB, glUnsignedInt10F11F11FRev, 4, glRGB},
+		{PixelFormatRGB9E5Float, glRGB9E5, glRGB, glUnsignedInt5999Rev, 4, glRGB},
+
+		// Ordinary 64-bit and 128-bit pixel formats.
+		{PixelFormatRG32Uint, glRG32UI, glRGInteger, glUnsignedInt, 4, glRG},
+		{PixelFormatRG32Sint, glRG32I, glRGInteger, glInt, 4, glRG},
+		{PixelFormatRG32Float, glRG32F, glRG, glFloat, 4, glRG},
+		{PixelFormatRGBA16Unorm, glRGBA16, glRGBA, glUnsignedShort, 2, glRGBA},
+		{PixelFormatRGBA16Snorm, glRGBA16Snorm, glRGBA, glShort, 2, glRGBA},
+		{PixelFormatRGBA16Uint, glRGBA16UI, glRGBAInteger, glUnsignedShort, 2, glRGBA},
+		{PixelFormatRGBA16Sint, glRGBA16I, glRGBAInteger, glShort, 2, glRGBA},
+		{PixelFormatRGBA16Float, glRGBA16F, glRGBA, glHalfFloat, 2, glRGBA},
+		{PixelFormatRGBA32Uint, glRGBA32UI, glRGBAInteger, glUnsignedInt, 4, glRGBA},
+		{PixelFormatRGBA32Sint, glRGBA32I, glRGBAInteger, glInt, 4, glRGBA},
+		{PixelFormatRGBA32Float, glRGBA32F, glRGBA, glFloat, 4, glRGBA},
+
+		// Depth and stencil pixel formats.
+		{PixelFormatDepth16Unorm, glDepthComponent16, glDepthComponent, glUnsignedShort, 2, glDepthComponent},
+		{PixelFormatDepth32Float, glDepthComponent32F, glDepthComponent, glFloat, 4, glDepthComponent},
+		{PixelFormatStencil8, glStencilIndex8, glStencilIndex, glUnsignedByte, 1, glStencilIndex},
+		{PixelFormatDepth32FloatStencil8, glDepth32FStencil8, glDepthStencil, glFloat32UnsignedInt248Rev, 4, glDepthStencil},
+
+		// Compressed pixel formats.
+		{PixelFormatBC1RGBA, glCompressedRGBAS3TCDXT1, 0, 0, 1, glRGBA},
+		{PixelFormatBC1RGBASRGB, glCompressedSRGBAlphaDXT1, 0, 0, 1, glRGBA},
+		{PixelFormatBC2RGBA, glCompressedRGBAS3TCDXT3, 0, 0, 1, glRGBA},
+		{PixelFormatBC2RGBASRGB, glCompressedSRGBAlphaDXT3, 0, 0, 1, glRGBA},
+		{PixelFormatBC3RGBA, glCompressedRGBAS3TCDXT5, 0, 0, 1, glRGBA},
+		{PixelFormatBC3RGBASRGB, glCompressedSRGBAlphaDXT5, 0, 0, 1, glRGBA},
+		{PixelFormatBC4RUnorm, glCompressedRedRGTC1, 0, 0, 1, glRed},
+		{PixelFormatBC4RSnorm, glCompressedSignedRedRGTC1, 0, 0, 1, glRed},
+		{PixelFormatBC5RGUnorm, glCompressedRGRGTC2, 0, 0, 1, glRG},
+		{PixelFormatBC5RGSnorm, glCompressedSignedRGRGTC2, 0, 0, 1, glRG},
+		{PixelFormatBC6HRGBFloat, glCompressedRGBSignedBPTC, 0, 0, 1, glRGB},
+		{PixelFormatBC6HRGBUfloat, glCompressedRGBUnsignedBPTC, 0, 0, 1, glRGB},
+		{PixelFormatBC7RGBAUnorm, glCompressedRGBAUnormBPTC, 0, 0, 1, glRGBA},
+		{PixelFormatBC7RGBAUnormSRGB, glCompressedSRGBAlphaBPTC, 0, 0, 1, glRGBA},
+		{PixelFormatEACR11Unorm, glCompressedR11EAC, 0, 0, 1, glRed},
+		{PixelFormatEACR11Snorm, glCompressedSignedR11EAC, 0, 0, 1, glRed},
+		{PixelFormatEACRG11Unorm, glCompressedRG11EAC, 0, 0, 1, glRG},
+		{PixelFormatEACRG11Snorm, glCompressedSignedRG11EAC, 0, 0, 1, glRG},
+		{PixelFormatEACRGBA8, glCompressedRGBA8ETC2EAC, 0, 0, 1, glRGBA},
+		{PixelFormatEACRGBA8SRGB, glCompressedSRGB8A8ETC2EAC, 0, 0, 1, glRGBA},
+		{PixelFormatETC2RGB8, glCompressedRGB8ETC2, 0, 0, 1, glRGB},
+		{PixelFormatETC2RGB8SRGB, glCompressedSRGB8ETC2, 0, 0, 1, glRGB},
+		{PixelFormatETC2RGB8A1, glCompressedRGB8A1ETC2, 0, 0, 1, glRGBA},
+		{PixelFormatETC2RGB8A1SRGB, glCompressedSRGB8A1ETC2, 0, 0, 1, glRGBA},
+		{PixelFormatPVRTCRGB2BPP, glCompressedRGBPVRTC2, 0, 0, 1, glRGB},
+		{PixelFormatPVRTCRGB2BPPSRGB, glCompressedSRGBPVRTC2, 0, 0, 1, glRGB},
+		{PixelFormatPVRTCRGB4BPP, glCompressedRGBPVRTC4, 0, 0, 1, glRGB},
+		{PixelFormatPVRTCRGB4BPPSRGB, glCompressedSRGBPVRTC4, 0, 0, 1, glRGB},
+		{PixelFormatPVRTCRGBA2BPP, glCompressedRGBAPVRTC2, 0, 0, 1, glRGBA},
+		{PixelFormatPVRTCRGBA2BPPSRGB, glCompressedSRGBAlphaPVRTC2, 0, 0, 1, glRGBA},
+		{PixelFormatPVRTCRGBA4BPP, glCompressedRGBAPVRTC4, 0, 0, 1, glRGBA},
+		{PixelFormatPVRTCRGBA4BPPSRGB, glCompressedSRGBAlphaPVRTC4, 0, 0, 1, glRGBA},
+	}
+
+	// The ASTC enums follow the order of the block sizes. LDR and HDR data share
+	// the same enums, so files with ASTC data are read as LDR.
+	for i, b := range astcBlockSizes {
+		if b[0] == 0 {
+			continue
+		}
+
+		n := uint32(i)
+		if i > 5 {
+			n--
+		}
+
+		f = append(f,
+			ktxFormat{PixelFormatASTC4x4LDR + PixelFormat(i), glCompressedRGBAASTC4x4 + n, 0, 0, 1, glRGBA},
+			ktxFormat{PixelFormatASTC4x4SRGB + PixelFormat(i), glCompressedSRGB8A8ASTC4x4 + n, 0, 0, 1, glRGBA},
+		)
+	}
+
+	for i, b := range astcBlockSizes {
+		if b[0] == 0 {
+			continue
+		}
+
+		n := uint32(i)
+		if i > 5 {
+			n--
+		}
+
+		f = append(f, ktxFormat{PixelFormatASTC4x4HDR + PixelFormat(i), glCompressedRGBAASTC4x4 + n, 0, 0, 1, glRGBA})
+	}
+
+	return f
+}()
+
+// KTXKeyValue is a key/value pair of the metadata of a KTX file.
+type KTXKeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// KTXTexture is a texture stored in the KTX 1.1 file format.
+//
+// Reference: https://registry.khronos.org/KTX/specs/1.0/ktxspec.v1.html
+type KTXTexture struct {
+	// PixelFormat is the pixel format of the texture data.
+	PixelFormat PixelFormat
+
+	// Width, Height and Depth are the dimensions of the base level in pixels.
+	// Height is 0 for 1D textures and Depth is 0 for textures that are not 3D.
+	Width, Height, Depth int
+
+	// ArrayLength is the number of array elements, or 0 for textures that are not arrays.
+	ArrayLength int
+
+	// FaceCount is 6 for cube textures and 1 otherwise.
+	FaceCount int
+
+	// KeyValues holds the key/value metadata in file order.
+	KeyValues []KTXKeyValue
+
+	// Levels holds the mipmap levels, starting at the base level. Every level has
+	// max(ArrayLength, 1) * FaceCount slices with tightly packed rows.
+	Levels []TextureLevel
+}
+
+// TextureDescriptor returns a descriptor for a texture that holds all levels of the KTX texture.
+func (k *KTXTexture) TextureDescriptor() TextureDescriptor {
+	return levelsTextureDescriptor(k.PixelFormat, k.Width, k.Height, k.Depth, k.ArrayLength, k.FaceCount, len(k.Levels))
+}
+
+// ReadKTX reads a texture in the KTX 1.1 file format. Files in either byte order are supported.
+func ReadKTX(r io.Reader) (*KTXTexture, error) {
+	var header [64]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read KTX header: %w", err)
+	}
+
+	if !bytes.Equal(header[:12], ktxIdentifier[:]) {
+		return nil, errors.New("invalid KTX file identifier")
+	}
+
+	var order binary.ByteOrder
+
+	switch binary.LittleEndian.Uint32(header[12:]) {
+	case ktxEndianness:
+		order = binary.LittleEndian
+	case 0x01020304:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid KTX endianness")
+	}
+
+	var h [12]uint32
+	for i := range h {
+		h[i] = order.Uint32(header[16+4*i:])
+	}
+
+	glType, glTypeSize, glFormat, glInternalFormat := h[0], h[1], h[2], h[3]
+	width, height, depth, arrayLength, faceCount, levelCount, kvSize := h[5], h[6], h[7], h[8], h[9], h[10], h[11]
+
+	f, ok := findKTXFormat(glInternalFormat, glFormat)
+	if !ok {
+		return nil, fmt.Errorf("unsupported KTX format: internal format %#x, format %#x, type %#x", glInternalFormat, glFormat, glType)
+	}
+
+	if glTypeSize != 1 && glTypeSize != 2 && glTypeSize != 4 {
+		return nil, fmt.Errorf("invalid KTX type size %d", glTypeSize)
+	}
+
+	if faceCount != 1 && faceCount != 6 {
+		return nil, fmt.Errorf("invalid KTX face count %d", faceCount)
+	}
+
+	if width == 0 || width > 1<<16 || height > 1<<16 || depth > 1<<16 || arrayLength > 1<<16 {
+		return nil, fmt.Errorf("invalid KTX dimensions %dx%dx%d with %d array elements", width, height, depth, arrayLength)
+	}
+
+	if faceCount == 6 && (width != height || depth != 0) {
+		return nil, errors.New("invalid KTX cube map dimensions")
+	}
+
+	if levelCount == 0 {
+		levelCount = 1
+	}
+
+	if levelCount > 17 {
+		return nil, fmt.Errorf("invalid KTX mipmap level count %d", levelCount)
+	}
+
+	k := &KTXTexture{
+		PixelFormat: f.pixelFormat,
+		Width:       int(width),
+		Height:      int(height),
+		Depth:       int(depth),
+		ArrayLength: int(arrayLength),
+		FaceCount:   int(faceCount),
+	}
+
+	kv, err := readFull(r, int(kvSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KTX key/value data: %w", err)
+	}
+
+	if k.KeyValues, err = parseKTXKeyValues(kv, order); err != nil {
+		return nil, err
+	}
+
+	slices := k.FaceCount
+	if k.ArrayLength > 0 {
+		slices *= k.ArrayLength
+	}
+
+	compressed := k.PixelFormat.IsCompressed()
+
+	for i := 0; i < int(levelCount); i++ {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, fmt.Errorf("failed to read KTX image size of level %d: %w", i, err)
+		}
+
+		l := newTextureLevel(k.PixelFormat, mipmapSize(k.Width, i), mipmapSize(k.Height, i), mipmapSize(k.Depth, i), 0)
+		rows := l.BytesPerImage / l.BytesPerRow
+		fileBytesPerRow := l.BytesPerRow
+
+		if !compressed {
+			fileBytesPerRow = pad4(fileBytesPerRow)
+		}
+
+		sliceSize := fileBytesPerRow * rows * l.Depth
+
+		// The image size of non-array cube maps covers a single face.
+		imageSize := sliceSize * slices
+		if k.FaceCount == 6 && k.ArrayLength == 0 {
+			imageSize = sliceSize
+		}
+
+		if got := int(order.Uint32(size[:])); got != imageSize {
+			return nil, fmt.Errorf("invalid KTX image size of level %d: got %d bytes, want %d", i, got, imageSize)
+		}
+
+		for s := 0; s < slices; s++ {
+			data, err := readFull(r, sliceSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read KTX image data of level %d: %w", i, err)
+			}
+
+			if k.FaceCount == 6 && k.ArrayLength == 0 {
+				if _, err := readFull(r, pad4(sliceSize)-sliceSize); err != nil {
+					return nil, fmt.Errorf("failed to read KTX cube padding of level %d: %w", i, err)
+				}
+			}
+
+			pix := make([]byte, 0, l.BytesPerImage*l.Depth)
+			for row := 0; row < rows*l.Depth; row++ {
+				pix = append(pix, data[row*fileBytesPerRow:][:l.BytesPerRow]...)
+			}
+
+			swapWords(pix, int(glTypeSize), order, binary.LittleEndian)
+			l.Slices = append(l.Slices, pix)
+		}
+
+		if _, err := readFull(r, pad4(imageSize)-imageSize); err != nil {
+			return nil, fmt.Errorf("failed to read KTX mipmap padding of level %d: %w", i, err)
+		}
+
+		k.Levels = append(k.Levels, l)
+	}
+
+	return k, nil
+}
+
+// KTXOptions configures WriteKTX.
+type KTXOptions struct {
+	// ByteOrder is the byte order of the written file.
+	ByteOrder binary.ByteOrder
+}
+
+// WriteKTX writes a texture in the KTX 1.1 file format.
+func WriteKTX(w io.Writer, k *KTXTexture, optFns ...func(*KTXOptions)) error {
+	opts := KTXOptions{
+		ByteOrder: binary.LittleEndian,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	f, ok := ktxFormatOf(k.PixelFormat)
+	if !ok {
+		return fmt.Errorf("pixel format %d is not supported by KTX", k.PixelFormat)
+	}
+
+	if k.FaceCount != 1 && k.FaceCount != 6 {
+		return fmt.Errorf("invalid face count %d", k.FaceCount)
+	}
+
+	if len(k.Levels) == 0 {
+		return errors.New("texture has no mipmap levels")
+	}
+
+	slices := k.FaceCount
+	if k.ArrayLength > 0 {
+		slices *= k.ArrayLength
+	}
+
+	order := opts.ByteOrder
+	buf := &bytes.Buffer{}
+
+	buf.Write(ktxIdentifier[:])
+
+	for _, v := range []uint32{
+		ktxEndianness, f.typ, f.typeSize, f.format, f.internalFormat, f.baseInternalFormat,
+		uint32(k.Width), uint32(k.Height), uint32(k.Depth), uint32(k.ArrayLength), uint32(k.FaceCount),
+		uint32(len(k.Levels)), 0,
+	} {
+		_ = binary.Write(buf, order, v)
+	}
+
+	kvStart := buf.Len()
+
+	for _, kv := range k.KeyValues {
+		size := len(kv.Key) + 1 + len(kv.Value)
+
+		_ = binary.Write(buf, order, uint32(size))
+		buf.WriteString(kv.Key)
+		buf.WriteByte(0)
+		buf.Write(kv.Value)
+		buf.Write(make([]byte, pad4(size)-size))
+	}
+
+	header := buf.Bytes()
+	order.PutUint32(header[60:], uint32(buf.Len()-kvStart))
+
+	compressed := k.PixelFormat.IsCompressed()
+
+	for i, l := range k.Levels {
+		if len(l.Slices) != slices {
+			return fmt.Errorf("level %d has %d slices, want %d", i, len(l.Slices), slices)
+		}
+
+		bytesPerRow, rows := k.PixelFormat.imageSize(l.Width, l.Height)
+		fileBytesPerRow := bytesPerRow
+
+		if !compressed {
+			fileBytesPerRow = pad4(fileBytesPerRow)
+		}
+
+		depth := l.Depth
+		if depth < 1 {
+			depth = 1
+		}
+
+		sliceSize := fileBytesPerRow * rows * depth
+
+		imageSize := sliceSize * slices
+		if k.FaceCount == 6 && k.ArrayLength == 0 {
+			imageSize = sliceSize
+		}
+
+		_ = binary.Write(buf, order, uint32(imageSize))
+
+		// Levels without strides are tightly packed.
+		srcBytesPerRow := l.BytesPerRow
+		if srcBytesPerRow == 0 {
+			srcBytesPerRow = bytesPerRow
+		}
+
+		bytesPerImage := l.BytesPerImage
+		if bytesPerImage == 0 {
+			bytesPerImage = srcBytesPerRow * rows
+		}
+
+		for s, data := range l.Slices {
+			if len(data) < (depth-1)*bytesPerImage+(rows-1)*srcBytesPerRow+bytesPerRow {
+				return fmt.Errorf("slice %d of level %d too short: got %d bytes", s, i, len(data))
+			}
+
+			for z := 0; z < depth; z++ {
+				for row := 0; row < rows; row++ {
+					line := make([]byte, fileBytesPerRow)
+					copy(line, data[z*bytesPerImage+row*srcBytesPerRow:][:bytesPerRow])
+					swapWords(line[:bytesPerRow], int(f.typeSize), binary.LittleEndian, order)
+					buf.Write(line)
+				}
+			}
+
+			if k.FaceCount == 6 && k.ArrayLength == 0 {
+				buf.Write(make([]byte, pad4(sliceSize)-sliceSize))
+			}
+		}
+
+		buf.Write(make([]byte, pad4(imageSize)-imageSize))
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// findKTXFormat returns the entry for an internal format, preferring one with a matching format.
+func findKTXFormat(internalFormat, format uint32) (ktxFormat, bool) {
+	var (
+		match ktxFormat
+		found bool
+	)
+
+	for _, f := range ktxFormats {
+		if f.internalFormat != internalFormat {
+			continue
+		}
+
+		if f.format == format {
+			return f, true
+		}
+
+		if !found {
+			match, found = f, true
+		}
+	}
+
+	return match, found
+}
+
+// ktxFormatOf returns the entry for a pixel format.
+func ktxFormatOf(pf PixelFormat) (ktxFormat, bool) {
+	for _, f := range ktxFormats {
+		if f.pixelFormat == pf {
+			return f, true
+		}
+	}
+
+	return ktxFormat{}, false
+}
+
+// parseKTXKeyValues parses the key/value data of a KTX file.
+func parseKTXKeyValues(data []byte, order binary.ByteOrder) ([]KTXKeyValue, error) {
+	var kvs []KTXKeyValue
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("truncated KTX key/value data")
+		}
+
+		size := int(order.Uint32(data))
+		data = data[4:]
+
+		if size > len(data) {
+			return nil, errors.New("truncated KTX key/value data")
+		}
+
+		kv := data[:size]
+
+		key, value, ok := bytes.Cut(kv, []byte{0})
+		if !ok {
+			return nil, errors.New("KTX key is not NUL-terminated")
+		}
+
+		kvs = append(kvs, KTXKeyValue{Key: string(key), Value: append([]byte(nil), value...)})
+
+		if pad4(size) > len(data) {
+			data = nil
+		} else {
+			data = data[pad4(size):]
+		}
+	}
+
+	return kvs, nil
+}
+
+// readFull reads exactly n bytes from r without trusting n for the initial allocation.
+func readFull(r io.Reader, n int) ([]byte, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+// swapWords converts the words of size bytes in data from one byte order to another.
+func swapWords(data []byte, size int, from, to binary.ByteOrder) {
+	if from == to {
+		return
+	}
+
+	switch size {
+	case 2:
+		for i := 0; i+2 <= len(data); i += 2 {
+			to.PutUint16(data[i:], from.Uint16(data[i:]))
+		}
+	case 4:
+		for i := 0; i+4 <= len(data); i += 4 {
+			to.PutUint32(data[i:], from.Uint32(data[i:]))
+		}
+	}
+}
+
+// pad4 rounds n up to a multiple of 4.
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
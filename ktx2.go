@@ -0,0 +1,920 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ktx2Identifier is the file identifier at the start of every KTX 2.0 file.
+var ktx2Identifier = [12]byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// KTX2Supercompression represents the supercompression scheme applied to the mipmap levels of a KTX 2.0 file.
+type KTX2Supercompression uint32
+
+const (
+	// KTX2SupercompressionNone indicates that the mipmap levels are stored uncompressed.
+	KTX2SupercompressionNone KTX2Supercompression = 0
+
+	// KTX2SupercompressionBasisLZ indicates Basis Universal BasisLZ/ETC1S data. It is not supported.
+	KTX2SupercompressionBasisLZ KTX2Supercompression = 1
+
+	// KTX2SupercompressionZstandard indicates Zstandard compressed mipmap levels. It is not supported.
+	KTX2SupercompressionZstandard KTX2Supercompression = 2
+
+	// KTX2SupercompressionZlib indicates zlib compressed mipmap levels.
+	KTX2SupercompressionZlib KTX2Supercompression = 3
+)
+
+// Values of the Khronos Data Format Descriptor basic block.
+const (
+	dfdModelRGBSDA = 1
+	dfdModelBC1A   = 128
+	dfdModelBC2    = 129
+	dfdModelBC3    = 130
+	dfdModelBC4    = 131
+	dfdModelBC5    = 132
+	dfdModelBC6H   = 133
+	dfdModelBC7    = 134
+	dfdModelETC2   = 161
+	dfdModelASTC   = 162
+	dfdModelPVRTC  = 164
+
+	dfdPrimariesBT709 = 1
+
+	dfdTransferLinear = 1
+	dfdTransferSRGB   = 2
+
+	dfdChannelRed     = 0
+	dfdChannelGreen   = 1
+	dfdChannelBlue    = 2
+	dfdChannelColor   = 2
+	dfdChannelStencil = 13
+	dfdChannelDepth   = 14
+	dfdChannelAlpha   = 15
+
+	dfdSampleLinear   = 0x10
+	dfdSampleExponent = 0x20
+	dfdSampleSigned   = 0x40
+	dfdSampleFloat    = 0x80
+
+	dfdFloatOne      = 0x3F800000
+	dfdFloatMinusOne = 0xBF800000
+)
+
+// KTX2DataFormatDescriptor is the basic descriptor block of the Khronos Data Format
+// Descriptor of a KTX 2.0 file.
+//
+// Reference: https://registry.khronos.org/DataFormat/specs/1.3/dataformat.1.3.html
+type KTX2DataFormatDescriptor struct {
+	ColorModel       uint8
+	ColorPrimaries   uint8
+	TransferFunction uint8
+	Flags            uint8
+
+	// TexelBlockDimensions holds the width, height, depth and fourth dimension of a texel block.
+	TexelBlockDimensions [4]int
+
+	// BytesPlane holds the number of bytes of a texel block in each plane.
+	BytesPlane [8]uint8
+
+	Samples []KTX2Sample
+}
+
+// KTX2Sample describes one sample of a texel block in a Khronos Data Format Descriptor.
+type KTX2Sample struct {
+	BitOffset int
+	BitLength int
+
+	// ChannelType holds the channel ID in the lower four bits and the qualifier flags in the upper four bits.
+	ChannelType    uint8
+	SamplePosition [4]uint8
+	Lower          uint32
+	Upper          uint32
+}
+
+// KTX2Texture is a texture stored in the KTX 2.0 file format.
+//
+// Reference: https://registry.khronos.org/KTX/specs/2.0/ktxspec.v2.html
+type KTX2Texture struct {
+	// PixelFormat is the pixel format of the texture data.
+	PixelFormat PixelFormat
+
+	// Width, Height and Depth are the dimensions of the base level in pixels.
+	// Height is 0 for 1D textures and Depth is 0 for textures that are not 3D.
+	Width, Height, Depth int
+
+	// LayerCount is the number of array elements, or 0 for textures that are not arrays.
+	LayerCount int
+
+	// FaceCount is 6 for cube textures and 1 otherwise.
+	FaceCount int
+
+	// Supercompression is the supercompression scheme of the mipmap levels in the file.
+	Supercompression KTX2Supercompression
+
+	// DataFormatDescriptor describes the texel blocks. WriteKTX2 generates it from
+	// the pixel format if it has no color model.
+	DataFormatDescriptor KTX2DataFormatDescriptor
+
+	// KeyValues holds the key/value metadata. It is written sorted by key.
+	KeyValues []KTXKeyValue
+
+	// Levels holds the mipmap levels, starting at the base level. Every level has
+	// max(LayerCount, 1) * FaceCount slices with tightly packed rows.
+	Levels []TextureLevel
+}
+
+// TextureDescriptor returns a descriptor for a texture that holds all levels of the KTX 2.0 texture.
+func (k *KTX2Texture) TextureDescriptor() TextureDescriptor {
+	return levelsTextureDescriptor(k.PixelFormat, k.Width, k.Height, k.Depth, k.LayerCount, k.FaceCount, len(k.Levels))
+}
+
+// vkFormat maps a pixel format to its VkFormat value.
+type vkFormat struct {
+	pixelFormat PixelFormat
+	vkFormat    uint32
+	typeSize    uint32
+}
+
+// vkFormats holds the supported pixel formats. The first entry wins when reading.
+var vkFormats = func() []vkFormat {
+	f := []vkFormat{
+		// Ordinary 8-bit pixel formats.
+		{PixelFormatA8Unorm, 1000470001, 1},
+		{PixelFormatR8Unorm, 9, 1},
+		{PixelFormatR8Snorm, 10, 1},
+		{PixelFormatR8Uint, 13, 1},
+		{PixelFormatR8Sint, 14, 1},
+		{PixelFormatR8UnormSRGB, 15, 1},
+
+		// Ordinary and packed 16-bit pixel formats.
+		{PixelFormatRG8Unorm, 16, 1},
+		{PixelFormatRG8Snorm, 17, 1},
+		{PixelFormatRG8Uint, 20, 1},
+		{PixelFormatRG8Sint, 21, 1},
+		{PixelFormatRG8UnormSRGB, 22, 1},
+		{PixelFormatR16Unorm, 70, 2},
+		{PixelFormatR16Snorm, 71, 2},
+		{PixelFormatR16Uint, 74, 2},
+		{PixelFormatR16Sint, 75, 2},
+		{PixelFormatR16Float, 76, 2},
+		{PixelFormatABGR4Unorm, 2, 2},
+		{PixelFormatB5G6R5Unorm, 4, 2},
+		{PixelFormatA1BGR5Unorm, 6, 2},
+		{PixelFormatBGR5A1Unorm, 8, 2},
+
+		// Ordinary and packed 32-bit pixel formats.
+		{PixelFormatRGBA8Unorm, 37, 1},
+		{PixelFormatRGBA8Snorm, 38, 1},
+		{PixelFormatRGBA8Uint, 41, 1},
+		{PixelFormatRGBA8Sint, 42, 1},
+		{PixelFormatRGBA8UnormSRGB, 43, 1},
+		{PixelFormatBGRA8Unorm, 44, 1},
+		{PixelFormatBGRA8UnormSRGB, 50, 1},
+		{PixelFormatBGR10A2Unorm, 58, 4},
+		{PixelFormatRGB10A2Unorm, 64, 4},
+		{PixelFormatRGB10A2Uint, 68, 4},
+		{PixelFormatRG16Unorm, 77, 2},
+		{PixelFormatRG16Snorm, 78, 2},
+		{PixelFormatRG16Uint, 81, 2},
+		{PixelFormatRG16Sint, 82, 2},
+		{PixelFormatRG16Float, 83, 2},
+		{PixelFormatR32Uint, 98, 4},
+		{PixelFormatR32Sint, 99, 4},
+		{PixelFormatR32Float, 100, 4},
+		{PixelFormatRG11B10Float, 122, 4},
+		{PixelFormatRGB9E5Float, 123, 4},
+
+		// Ordinary 64-bit and 128-bit pixel formats.
+		{PixelFormatRGBA16Unorm, 91, 2},
+		{PixelFormatRGBA16Snorm, 92, 2},
+		{PixelFormatRGBA16Uint, 95, 2},
+		{PixelFormatRGBA16Sint, 96, 2},
+		{PixelFormatRGBA16Float, 97, 2},
+		{PixelFormatRG32Uint, 101, 4},
+		{PixelFormatRG32Sint, 102, 4},
+		{PixelFormatRG32Float, 103, 4},
+		{PixelFormatRGBA32Uint, 107, 4},
+		{PixelFormatRGBA32Sint, 108, 4},
+		{PixelFormatRGBA32Float, 109, 4},
+
+		// Depth and stencil pixel formats.
+		{PixelFormatDepth16Unorm, 124, 2},
+		{PixelFormatDepth32Float, 126, 4},
+		{PixelFormatStencil8, 127, 1},
+		{PixelFormatDepth32FloatStencil8, 130, 4},
+
+		// Compressed pixel formats.
+		{PixelFormatBC1RGBA, 133, 1},
+		{PixelFormatBC1RGBASRGB, 134, 1},
+		{PixelFormatBC2RGBA, 135, 1},
+		{PixelFormatBC2RGBASRGB, 136, 1},
+		{PixelFormatBC3RGBA, 137, 1},
+		{PixelFormatBC3RGBASRGB, 138, 1},
+		{PixelFormatBC4RUnorm, 139, 1},
+		{PixelFormatBC4RSnorm, 140, 1},
+		{PixelFormatBC5RGUnorm, 141, 1},
+		{PixelFormatBC5RGSnorm, 142, 1},
+		{PixelFormatBC6HRGBUfloat, 143, 1},
+		{PixelFormatBC6HRGBFloat, 144, 1},
+		{PixelFormatBC7RGBAUnorm, 145, 1},
+		{PixelFormatBC7RGBAUnormSRGB, 146, 1},
+		{PixelFormatETC2RGB8, 147, 1},
+		{PixelFormatETC2RGB8SRGB, 148, 1},
+		{PixelFormatETC2RGB8A1, 149, 1},
+		{PixelFormatETC2RGB8A1SRGB, 150, 1},
+		{PixelFormatEACRGBA8, 151, 1},
+		{PixelFormatEACRGBA8SRGB, 152, 1},
+		{PixelFormatEACR11Unorm, 153, 1},
+		{PixelFormatEACR11Snorm, 154, 1},
+		{PixelFormatEACRG11Unorm, 155, 1},
+		{PixelFormatEACRG11Snorm, 156, 1},
+
+		// Vulkan does not distinguish PVRTC data with and without alpha,
+		// so files with PVRTC data are read as RGBA.
+		{PixelFormatPVRTCRGBA2BPP, 1000054000, 1},
+		{PixelFormatPVRTCRGBA4BPP, 1000054001, 1},
+		{PixelFormatPVRTCRGBA2BPPSRGB, 1000054004, 1},
+		{PixelFormatPVRTCRGBA4BPPSRGB, 1000054005, 1},
+		{PixelFormatPVRTCRGB2BPP, 1000054000, 1},
+		{PixelFormatPVRTCRGB4BPP, 1000054001, 1},
+		{PixelFormatPVRTCRGB2BPPSRGB, 1000054004, 1},
+		{PixelFormatPVRTCRGB4BPPSRGB, 1000054005, 1},
+	}
+
+	// The ASTC values follow the order of the block sizes, with the UNORM and SRGB
+	// values interleaved.
+	n := uint32(0)
+
+	for i, b := range astcBlockSizes {
+		if b[0] == 0 {
+			continue
+		}
+
+		f = append(f,
+			vkFormat{PixelFormatASTC4x4LDR + PixelFormat(i), 157 + 2*n, 1},
+			vkFormat{PixelFormatASTC4x4SRGB + PixelFormat(i), 158 + 2*n, 1},
+			vkFormat{PixelFormatASTC4x4HDR + PixelFormat(i), 1000066000 + n, 1},
+		)
+		n++
+	}
+
+	return f
+}()
+
+// ReadKTX2 reads a texture in the KTX 2.0 file format. Mipmap levels without
+// supercompression or with zlib supercompression are supported.
+func ReadKTX2(r io.Reader) (*KTX2Texture, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KTX2 file: %w", err)
+	}
+
+	if len(data) < 80 || !bytes.Equal(data[:12], ktx2Identifier[:]) {
+		return nil, errors.New("invalid KTX2 file identifier")
+	}
+
+	le := binary.LittleEndian
+	vk := le.Uint32(data[12:])
+	width, height, depth := le.Uint32(data[20:]), le.Uint32(data[24:]), le.Uint32(data[28:])
+	layerCount, faceCount, levelCount := le.Uint32(data[32:]), le.Uint32(data[36:]), le.Uint32(data[40:])
+	scheme := KTX2Supercompression(le.Uint32(data[44:]))
+	dfdOffset, dfdLength := le.Uint32(data[48:]), le.Uint32(data[52:])
+	kvdOffset, kvdLength := le.Uint32(data[56:]), le.Uint32(data[60:])
+
+	switch scheme {
+	case KTX2SupercompressionNone, KTX2SupercompressionZlib:
+	case KTX2SupercompressionBasisLZ:
+		return nil, errors.New("KTX2 BasisLZ supercompression is not supported")
+	case KTX2SupercompressionZstandard:
+		return nil, errors.New("KTX2 Zstandard supercompression is not supported")
+	default:
+		return nil, fmt.Errorf("unknown KTX2 supercompression scheme %d", scheme)
+	}
+
+	if vk == 0 {
+		return nil, errors.New("KTX2 files without a VkFormat, such as Basis Universal files, are not supported")
+	}
+
+	f, ok := findVkFormat(vk)
+	if !ok {
+		return nil, fmt.Errorf("unsupported KTX2 VkFormat %d", vk)
+	}
+
+	if faceCount != 1 && faceCount != 6 {
+		return nil, fmt.Errorf("invalid KTX2 face count %d", faceCount)
+	}
+
+	if width == 0 || width > 1<<16 || height > 1<<16 || depth > 1<<16 || layerCount > 1<<16 {
+		return nil, fmt.Errorf("invalid KTX2 dimensions %dx%dx%d with %d layers", width, height, depth, layerCount)
+	}
+
+	if faceCount == 6 && (width != height || depth != 0) {
+		return nil, errors.New("invalid KTX2 cube map dimensions")
+	}
+
+	// The level sizes and the allocations for the levels are derived from the
+	// untrusted header dimensions, so the pixels of all slices of the base level
+	// are capped to keep them bounded and free of overflow.
+	pixels := uint64(faceCount)
+
+	for _, n := range []uint32{width, height, depth, layerCount} {
+		if n > 1 {
+			pixels *= uint64(n)
+		}
+
+		if pixels > 1<<28 {
+			return nil, fmt.Errorf("invalid KTX2 dimensions %dx%dx%d with %d layers", width, height, depth, layerCount)
+		}
+	}
+
+	if levelCount == 0 {
+		levelCount = 1
+	}
+
+	if levelCount > 17 || len(data) < 80+24*int(levelCount) {
+		return nil, fmt.Errorf("invalid KTX2 mipmap level count %d", levelCount)
+	}
+
+	k := &KTX2Texture{
+		PixelFormat:      f.pixelFormat,
+		Width:            int(width),
+		Height:           int(height),
+		Depth:            int(depth),
+		LayerCount:       int(layerCount),
+		FaceCount:        int(faceCount),
+		Supercompression: scheme,
+	}
+
+	dfd, err := ktx2Section(data, uint64(dfdOffset), uint64(dfdLength))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KTX2 data format descriptor: %w", err)
+	}
+
+	if k.DataFormatDescriptor, err = parseKTX2DataFormatDescriptor(dfd); err != nil {
+		return nil, err
+	}
+
+	kvd, err := ktx2Section(data, uint64(kvdOffset), uint64(kvdLength))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KTX2 key/value data: %w", err)
+	}
+
+	if k.KeyValues, err = parseKTXKeyValues(kvd, le); err != nil {
+		return nil, err
+	}
+
+	slices := k.FaceCount
+	if k.LayerCount > 0 {
+		slices *= k.LayerCount
+	}
+
+	for i := 0; i < int(levelCount); i++ {
+		index := data[80+24*i:]
+		offset, length, uncompressedLength := le.Uint64(index), le.Uint64(index[8:]), le.Uint64(index[16:])
+
+		l := newTextureLevel(k.PixelFormat, mipmapSize(k.Width, i), mipmapSize(k.Height, i), mipmapSize(k.Depth, i), 0)
+		sliceSize := l.BytesPerImage * l.Depth
+		levelSize := sliceSize * slices
+
+		level, err := ktx2Section(data, offset, length)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KTX2 mipmap level %d: %w", i, err)
+		}
+
+		if scheme == KTX2SupercompressionZlib {
+			if uncompressedLength != uint64(levelSize) {
+				return nil, fmt.Errorf("invalid KTX2 uncompressed size of level %d: got %d bytes, want %d", i, uncompressedLength, levelSize)
+			}
+
+			zr, err := zlib.NewReader(bytes.NewReader(level))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress KTX2 mipmap level %d: %w", i, err)
+			}
+
+			if level, err = io.ReadAll(io.LimitReader(zr, int64(levelSize)+1)); err != nil {
+				return nil, fmt.Errorf("failed to decompress KTX2 mipmap level %d: %w", i, err)
+			}
+		}
+
+		if len(level) != levelSize {
+			return nil, fmt.Errorf("invalid KTX2 size of level %d: got %d bytes, want %d", i, len(level), levelSize)
+		}
+
+		for s := 0; s < slices; s++ {
+			l.Slices = append(l.Slices, level[s*sliceSize:(s+1)*sliceSize:(s+1)*sliceSize])
+		}
+
+		k.Levels = append(k.Levels, l)
+	}
+
+	return k, nil
+}
+
+// KTX2Options configures WriteKTX2.
+type KTX2Options struct {
+	// CompressionLevel is the zlib compression level used for KTX2SupercompressionZlib.
+	CompressionLevel int
+}
+
+// WriteKTX2 writes a texture in the KTX 2.0 file format. The mipmap levels are
+// supercompressed according to k.Supercompression, which must be
+// KTX2SupercompressionNone or KTX2SupercompressionZlib.
+func WriteKTX2(w io.Writer, k *KTX2Texture, optFns ...func(*KTX2Options)) error {
+	opts := KTX2Options{
+		CompressionLevel: zlib.DefaultCompression,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	f, ok := vkFormatOf(k.PixelFormat)
+	if !ok {
+		return fmt.Errorf("pixel format %d is not supported by KTX2", k.PixelFormat)
+	}
+
+	if k.Supercompression != KTX2SupercompressionNone && k.Supercompression != KTX2SupercompressionZlib {
+		return fmt.Errorf("unsupported KTX2 supercompression scheme %d", k.Supercompression)
+	}
+
+	if k.FaceCount != 1 && k.FaceCount != 6 {
+		return fmt.Errorf("invalid face count %d", k.FaceCount)
+	}
+
+	if len(k.Levels) == 0 {
+		return errors.New("texture has no mipmap levels")
+	}
+
+	dfd := k.DataFormatDescriptor
+	if dfd.ColorModel == 0 {
+		var err error
+		if dfd, err = newKTX2DataFormatDescriptor(k.PixelFormat); err != nil {
+			return err
+		}
+	}
+
+	slices := k.FaceCount
+	if k.LayerCount > 0 {
+		slices *= k.LayerCount
+	}
+
+	// Gather the tightly packed data of every level.
+	levels := make([][]byte, len(k.Levels))
+	uncompressed := make([]int, len(k.Levels))
+
+	for i, l := range k.Levels {
+		if len(l.Slices) != slices {
+			return fmt.Errorf("level %d has %d slices, want %d", i, len(l.Slices), slices)
+		}
+
+		data, err := packLevel(k.PixelFormat, l)
+		if err != nil {
+			return fmt.Errorf("level %d: %w", i, err)
+		}
+
+		uncompressed[i] = len(data)
+
+		if k.Supercompression == KTX2SupercompressionZlib {
+			var buf bytes.Buffer
+
+			zw, err := zlib.NewWriterLevel(&buf, opts.CompressionLevel)
+			if err != nil {
+				return err
+			}
+
+			if _, err := zw.Write(data); err != nil {
+				return err
+			}
+
+			if err := zw.Close(); err != nil {
+				return err
+			}
+
+			data = buf.Bytes()
+		}
+
+		levels[i] = data
+	}
+
+	dfdData := encodeKTX2DataFormatDescriptor(dfd)
+
+	kvs := append([]KTXKeyValue(nil), k.KeyValues...)
+	sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+
+	var kvdData bytes.Buffer
+
+	for _, kv := range kvs {
+		size := len(kv.Key) + 1 + len(kv.Value)
+
+		_ = binary.Write(&kvdData, binary.LittleEndian, uint32(size))
+		kvdData.WriteString(kv.Key)
+		kvdData.WriteByte(0)
+		kvdData.Write(kv.Value)
+		kvdData.Write(make([]byte, pad4(size)-size))
+	}
+
+	dfdOffset := 80 + 24*len(levels)
+	kvdOffset := dfdOffset + len(dfdData)
+	kvdLength := kvdData.Len()
+
+	if kvdLength == 0 {
+		kvdOffset = 0
+	}
+
+	// Without supercompression, levels are aligned to the least common multiple
+	// of the texel block size and 4.
+	alignment := 1
+	if k.Supercompression == KTX2SupercompressionNone {
+		_, _, size := k.PixelFormat.BlockSize()
+		alignment = lcm(size, 4)
+	}
+
+	// Levels are stored from the smallest to the base level.
+	offsets := make([]int, len(levels))
+	end := dfdOffset + len(dfdData) + kvdLength
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		end = (end + alignment - 1) / alignment * alignment
+		offsets[i] = end
+		end += len(levels[i])
+	}
+
+	le := binary.LittleEndian
+	out := make([]byte, end)
+
+	copy(out, ktx2Identifier[:])
+	le.PutUint32(out[12:], f.vkFormat)
+	le.PutUint32(out[16:], f.typeSize)
+	le.PutUint32(out[20:], uint32(k.Width))
+	le.PutUint32(out[24:], uint32(k.Height))
+	le.PutUint32(out[28:], uint32(k.Depth))
+	le.PutUint32(out[32:], uint32(k.LayerCount))
+	le.PutUint32(out[36:], uint32(k.FaceCount))
+	le.PutUint32(out[40:], uint32(len(levels)))
+	le.PutUint32(out[44:], uint32(k.Supercompression))
+	le.PutUint32(out[48:], uint32(dfdOffset))
+	le.PutUint32(out[52:], uint32(len(dfdData)))
+	le.PutUint32(out[56:], uint32(kvdOffset))
+	le.PutUint32(out[60:], uint32(kvdLength))
+
+	for i, data := range levels {
+		index := out[80+24*i:]
+		le.PutUint64(index, uint64(offsets[i]))
+		le.PutUint64(index[8:], uint64(len(data)))
+		le.PutUint64(index[16:], uint64(uncompressed[i]))
+		copy(out[offsets[i]:], data)
+	}
+
+	copy(out[dfdOffset:], dfdData)
+	copy(out[dfdOffset+len(dfdData):], kvdData.Bytes())
+
+	_, err := w.Write(out)
+
+	return err
+}
+
+// packLevel returns the slices of a level with tightly packed rows and images, one after another.
+func packLevel(pf PixelFormat, l TextureLevel) ([]byte, error) {
+	bytesPerRow, rows := pf.imageSize(l.Width, l.Height)
+
+	depth := l.Depth
+	if depth < 1 {
+		depth = 1
+	}
+
+	srcBytesPerRow := l.BytesPerRow
+	if srcBytesPerRow == 0 {
+		srcBytesPerRow = bytesPerRow
+	}
+
+	bytesPerImage := l.BytesPerImage
+	if bytesPerImage == 0 {
+		bytesPerImage = srcBytesPerRow * rows
+	}
+
+	data := make([]byte, 0, bytesPerRow*rows*depth*len(l.Slices))
+
+	for s, slice := range l.Slices {
+		if len(slice) < (depth-1)*bytesPerImage+(rows-1)*srcBytesPerRow+bytesPerRow {
+			return nil, fmt.Errorf("slice %d too short: got %d bytes", s, len(slice))
+		}
+
+		for z := 0; z < depth; z++ {
+			for row := 0; row < rows; row++ {
+				data = append(data, slice[z*bytesPerImage+row*srcBytesPerRow:][:bytesPerRow]...)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// ktx2Section returns the bytes of a section of a KTX2 file.
+func ktx2Section(data []byte, offset, length uint64) ([]byte, error) {
+	if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+		return nil, fmt.Errorf("section at %d with %d bytes exceeds file size %d", offset, length, len(data))
+	}
+
+	return data[offset : offset+length], nil
+}
+
+// findVkFormat returns the entry for a VkFormat value.
+func findVkFormat(vk uint32) (vkFormat, bool) {
+	for _, f := range vkFormats {
+		if f.vkFormat == vk {
+			return f, true
+		}
+	}
+
+	return vkFormat{}, false
+}
+
+// vkFormatOf returns the entry for a pixel format.
+func vkFormatOf(pf PixelFormat) (vkFormat, bool) {
+	for _, f := range vkFormats {
+		if f.pixelFormat == pf {
+			return f, true
+		}
+	}
+
+	return vkFormat{}, false
+}
+
+// parseKTX2DataFormatDescriptor parses the basic descriptor block of a data format descriptor.
+func parseKTX2DataFormatDescriptor(data []byte) (KTX2DataFormatDescriptor, error) {
+	le := binary.LittleEndian
+
+	if len(data) < 4 || int(le.Uint32(data)) != len(data) {
+		return KTX2DataFormatDescriptor{}, errors.New("invalid KTX2 data format descriptor size")
+	}
+
+	for blocks := data[4:]; len(blocks) >= 8; {
+		header, info := le.Uint32(blocks), le.Uint32(blocks[4:])
+		size := int(info >> 16)
+
+		if size < 8 || size > len(blocks) {
+			return KTX2DataFormatDescriptor{}, errors.New("invalid KTX2 descriptor block size")
+		}
+
+		// The basic block has vendor ID 0 (Khronos) and descriptor type 0.
+		if header != 0 || size < 24 {
+			blocks = blocks[size:]
+			continue
+		}
+
+		block := blocks[:size]
+		dfd := KTX2DataFormatDescriptor{
+			ColorModel:       block[8],
+			ColorPrimaries:   block[9],
+			TransferFunction: block[10],
+			Flags:            block[11],
+		}
+
+		for i := range dfd.TexelBlockDimensions {
+			dfd.TexelBlockDimensions[i] = int(block[12+i]) + 1
+		}
+
+		copy(dfd.BytesPlane[:], block[16:24])
+
+		for s := block[24:]; len(s) >= 16; s = s[16:] {
+			v := le.Uint32(s)
+			dfd.Samples = append(dfd.Samples, KTX2Sample{
+				BitOffset:      int(v & 0xffff),
+				BitLength:      int(v>>16&0xff) + 1,
+				ChannelType:    uint8(v >> 24),
+				SamplePosition: [4]uint8{s[4], s[5], s[6], s[7]},
+				Lower:          le.Uint32(s[8:]),
+				Upper:          le.Uint32(s[12:]),
+			})
+		}
+
+		return dfd, nil
+	}
+
+	return KTX2DataFormatDescriptor{}, errors.New("KTX2 data format descriptor has no basic block")
+}
+
+// encodeKTX2DataFormatDescriptor encodes a data format descriptor with a single basic block.
+func encodeKTX2DataFormatDescriptor(dfd KTX2DataFormatDescriptor) []byte {
+	le := binary.LittleEndian
+	blockSize := 24 + 16*len(dfd.Samples)
+	data := make([]byte, 4+blockSize)
+
+	le.PutUint32(data, uint32(len(data)))
+	le.PutUint32(data[8:], 2|uint32(blockSize)<<16)
+
+	block := data[4:]
+	block[8], block[9], block[10], block[11] = dfd.ColorModel, dfd.ColorPrimaries, dfd.TransferFunction, dfd.Flags
+
+	for i, d := range dfd.TexelBlockDimensions {
+		if d > 0 {
+			block[12+i] = uint8(d - 1)
+		}
+	}
+
+	copy(block[16:24], dfd.BytesPlane[:])
+
+	for i, s := range dfd.Samples {
+		b := block[24+16*i:]
+		le.PutUint32(b, uint32(s.BitOffset)|uint32(s.BitLength-1)<<16|uint32(s.ChannelType)<<24)
+		copy(b[4:8], s.SamplePosition[:])
+		le.PutUint32(b[8:], s.Lower)
+		le.PutUint32(b[12:], s.Upper)
+	}
+
+	return data
+}
+
+// newKTX2DataFormatDescriptor returns the data format descriptor of a pixel format.
+func newKTX2DataFormatDescriptor(pf PixelFormat) (KTX2DataFormatDescriptor, error) {
+	bw, bh, size := pf.BlockSize()
+
+	dfd := KTX2DataFormatDescriptor{
+		ColorModel:           dfdModelRGBSDA,
+		ColorPrimaries:       dfdPrimariesBT709,
+		TransferFunction:     dfdTransferLinear,
+		TexelBlockDimensions: [4]int{bw, bh, 1, 1},
+		BytesPlane:           [8]uint8{uint8(size)},
+	}
+
+	if pf.IsSRGB() {
+		dfd.TransferFunction = dfdTransferSRGB
+	}
+
+	if l, ok := pixelLayouts[pf]; ok {
+		dfd.Samples = uncompressedSamples(pf, l)
+		return dfd, nil
+	}
+
+	// block returns a sample that covers 64 bits of a compressed block.
+	block := func(channel uint8, offset int) KTX2Sample {
+		return KTX2Sample{BitOffset: offset, BitLength: 64, ChannelType: channel, Upper: 0xFFFFFFFF}
+	}
+
+	switch pf {
+	case PixelFormatBC1RGBA, PixelFormatBC1RGBASRGB:
+		dfd.ColorModel = dfdModelBC1A
+		dfd.Samples = []KTX2Sample{block(1, 0)}
+	case PixelFormatBC2RGBA, PixelFormatBC2RGBASRGB:
+		dfd.ColorModel = dfdModelBC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelAlpha, 0), block(0, 64)}
+	case PixelFormatBC3RGBA, PixelFormatBC3RGBASRGB:
+		dfd.ColorModel = dfdModelBC3
+		dfd.Samples = []KTX2Sample{block(dfdChannelAlpha, 0), block(0, 64)}
+	case PixelFormatBC4RUnorm:
+		dfd.ColorModel = dfdModelBC4
+		dfd.Samples = []KTX2Sample{block(0, 0)}
+	case PixelFormatBC4RSnorm:
+		dfd.ColorModel = dfdModelBC4
+		dfd.Samples = []KTX2Sample{block(dfdSampleSigned, 0)}
+	case PixelFormatBC5RGUnorm:
+		dfd.ColorModel = dfdModelBC5
+		dfd.Samples = []KTX2Sample{block(dfdChannelRed, 0), block(dfdChannelGreen, 64)}
+	case PixelFormatBC5RGSnorm:
+		dfd.ColorModel = dfdModelBC5
+		dfd.Samples = []KTX2Sample{block(dfdSampleSigned|dfdChannelRed, 0), block(dfdSampleSigned|dfdChannelGreen, 64)}
+	case PixelFormatBC6HRGBUfloat:
+		dfd.ColorModel = dfdModelBC6H
+		dfd.Samples = []KTX2Sample{{BitLength: 128, ChannelType: dfdSampleFloat, Upper: dfdFloatOne}}
+	case PixelFormatBC6HRGBFloat:
+		dfd.ColorModel = dfdModelBC6H
+		dfd.Samples = []KTX2Sample{{BitLength: 128, ChannelType: dfdSampleFloat | dfdSampleSigned, Lower: dfdFloatMinusOne, Upper: dfdFloatOne}}
+	case PixelFormatBC7RGBAUnorm, PixelFormatBC7RGBAUnormSRGB:
+		dfd.ColorModel = dfdModelBC7
+		dfd.Samples = []KTX2Sample{{BitLength: 128, Upper: 0xFFFFFFFF}}
+	case PixelFormatETC2RGB8, PixelFormatETC2RGB8SRGB:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelColor, 0)}
+	case PixelFormatETC2RGB8A1, PixelFormatETC2RGB8A1SRGB:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelColor, 0), block(dfdChannelAlpha, 0)}
+	case PixelFormatEACRGBA8, PixelFormatEACRGBA8SRGB:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelAlpha, 0), block(dfdChannelColor, 64)}
+	case PixelFormatEACR11Unorm:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelRed, 0)}
+	case PixelFormatEACR11Snorm:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdSampleSigned|dfdChannelRed, 0)}
+	case PixelFormatEACRG11Unorm:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdChannelRed, 0), block(dfdChannelGreen, 64)}
+	case PixelFormatEACRG11Snorm:
+		dfd.ColorModel = dfdModelETC2
+		dfd.Samples = []KTX2Sample{block(dfdSampleSigned|dfdChannelRed, 0), block(dfdSampleSigned|dfdChannelGreen, 64)}
+	default:
+		switch {
+		case pf.isPVRTC():
+			dfd.ColorModel = dfdModelPVRTC
+			dfd.Samples = []KTX2Sample{block(0, 0)}
+		case pf >= PixelFormatASTC4x4HDR && pf <= PixelFormatASTC12x12HDR:
+			dfd.ColorModel = dfdModelASTC
+			dfd.Samples = []KTX2Sample{{BitLength: 128, ChannelType: dfdSampleFloat | dfdSampleSigned, Lower: dfdFloatMinusOne, Upper: dfdFloatOne}}
+		case size == 16 && bw*bh > 1:
+			dfd.ColorModel = dfdModelASTC
+			dfd.Samples = []KTX2Sample{{BitLength: 128, Upper: 0xFFFFFFFF}}
+		default:
+			return KTX2DataFormatDescriptor{}, fmt.Errorf("pixel format %d has no data format descriptor", pf)
+		}
+	}
+
+	return dfd, nil
+}
+
+// uncompressedSamples returns the data format descriptor samples of an uncompressed pixel format.
+func uncompressedSamples(pf PixelFormat, l pixelLayout) []KTX2Sample {
+	channelIDs := [4]uint8{dfdChannelRed, dfdChannelGreen, dfdChannelBlue, dfdChannelAlpha}
+
+	if _, hasDepth, hasStencil := depthStencilBytesPerPixel(pf); hasDepth {
+		channelIDs[0], channelIDs[1] = dfdChannelDepth, dfdChannelStencil
+	} else if hasStencil {
+		channelIDs[0] = dfdChannelStencil
+	}
+
+	var samples []KTX2Sample
+
+	for c, n := range l.bits {
+		if n == 0 {
+			continue
+		}
+
+		s := KTX2Sample{BitOffset: l.offsets[c], BitLength: n, ChannelType: channelIDs[c]}
+
+		typ := l.typ
+		if channelIDs[c] == dfdChannelStencil {
+			typ = componentUint
+		}
+
+		switch typ {
+		case componentUnorm:
+			s.Upper = uint32(uint64(1)<<n - 1)
+		case componentSnorm:
+			s.ChannelType |= dfdSampleSigned
+			s.Upper = uint32(uint64(1)<<(n-1) - 1)
+			s.Lower = -s.Upper
+		case componentUint:
+			s.Upper = 1
+		case componentSint:
+			s.ChannelType |= dfdSampleSigned
+			s.Lower, s.Upper = 0xFFFFFFFF, 1
+		case componentFloat:
+			s.ChannelType |= dfdSampleFloat
+			s.Upper = dfdFloatOne
+
+			// Only the 16-bit and 32-bit floats have a sign bit.
+			if n == 16 || n == 32 {
+				s.ChannelType |= dfdSampleSigned
+				s.Lower = dfdFloatMinusOne
+			}
+		}
+
+		if pf.IsSRGB() && c == 3 {
+			s.ChannelType |= dfdSampleLinear
+		}
+
+		samples = append(samples, s)
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].BitOffset < samples[j].BitOffset })
+
+	// The shared exponent is described by an additional sample after every mantissa.
+	if pf == PixelFormatRGB9E5Float {
+		mantissas := samples
+		samples = nil
+
+		for c, m := range mantissas {
+			m.ChannelType &^= dfdSampleFloat
+			m.Lower, m.Upper = 0, 8448
+
+			samples = append(samples, m, KTX2Sample{
+				BitOffset:   27,
+				BitLength:   5,
+				ChannelType: channelIDs[c] | dfdSampleExponent,
+				Lower:       15,
+				Upper:       31,
+			})
+		}
+	}
+
+	return samples
+}
+
+// lcm returns the least common multiple of two positive integers.
+func lcm(a, b int) int {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+
+	return a / x * b
+}
@@ -0,0 +1,152 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKTX2RoundTrip(t *testing.T) {
+	for _, scheme := range []KTX2Supercompression{KTX2SupercompressionNone, KTX2SupercompressionZlib} {
+		k := newTestTexture[KTX2Texture](PixelFormatRGBA8UnormSRGB, 8, 4, 0, 4, 1)
+		k.Supercompression = scheme
+		k.KeyValues = []KTXKeyValue{
+			{Key: "KTXwriter", Value: []byte("go-mtl\x00")},
+			{Key: "KTXorientation", Value: []byte("rd\x00")},
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteKTX2(&buf, k))
+
+		data := buf.Bytes()
+		require.Equal(t, ktx2Identifier[:], data[:12])
+		require.Equal(t, uint32(43), binary.LittleEndian.Uint32(data[12:]))
+
+		// The smallest level is stored first.
+		require.Less(t, binary.LittleEndian.Uint64(data[80+3*24:]), binary.LittleEndian.Uint64(data[80:]))
+
+		got, err := ReadKTX2(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, k.Levels, got.Levels)
+		require.Equal(t, scheme, got.Supercompression)
+
+		// Key/value pairs are sorted by key.
+		require.Equal(t, "KTXorientation", got.KeyValues[0].Key)
+		require.Equal(t, "KTXwriter", got.KeyValues[1].Key)
+
+		dfd := got.DataFormatDescriptor
+		require.Equal(t, uint8(dfdModelRGBSDA), dfd.ColorModel)
+		require.Equal(t, uint8(dfdTransferSRGB), dfd.TransferFunction)
+		require.Equal(t, [8]uint8{4}, dfd.BytesPlane)
+		require.Len(t, dfd.Samples, 4)
+		require.Equal(t, KTX2Sample{BitOffset: 24, BitLength: 8, ChannelType: dfdChannelAlpha | dfdSampleLinear, Upper: 255}, dfd.Samples[3])
+	}
+}
+
+func TestKTX2DataFormatDescriptor(t *testing.T) {
+	dfd, err := newKTX2DataFormatDescriptor(PixelFormatBGRA8Unorm)
+	require.NoError(t, err)
+	require.Equal(t, []uint8{dfdChannelBlue, dfdChannelGreen, dfdChannelRed, dfdChannelAlpha}, []uint8{
+		dfd.Samples[0].ChannelType, dfd.Samples[1].ChannelType, dfd.Samples[2].ChannelType, dfd.Samples[3].ChannelType,
+	})
+
+	dfd, err = newKTX2DataFormatDescriptor(PixelFormatRGBA16Float)
+	require.NoError(t, err)
+	require.Equal(t, KTX2Sample{BitOffset: 16, BitLength: 16, ChannelType: dfdChannelGreen | dfdSampleFloat | dfdSampleSigned, Lower: dfdFloatMinusOne, Upper: dfdFloatOne}, dfd.Samples[1])
+
+	dfd, err = newKTX2DataFormatDescriptor(PixelFormatRGB9E5Float)
+	require.NoError(t, err)
+	require.Len(t, dfd.Samples, 6)
+	require.Equal(t, 27, dfd.Samples[1].BitOffset)
+	require.Equal(t, uint8(dfdChannelRed|dfdSampleExponent), dfd.Samples[1].ChannelType)
+
+	dfd, err = newKTX2DataFormatDescriptor(PixelFormatR8Snorm)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xFFFFFF81), dfd.Samples[0].Lower)
+
+	dfd, err = newKTX2DataFormatDescriptor(PixelFormatASTC8x5LDR)
+	require.NoError(t, err)
+	require.Equal(t, uint8(dfdModelASTC), dfd.ColorModel)
+	require.Equal(t, [4]int{8, 5, 1, 1}, dfd.TexelBlockDimensions)
+
+	// Encoding and parsing are inverse operations.
+	got, err := parseKTX2DataFormatDescriptor(encodeKTX2DataFormatDescriptor(dfd))
+	require.NoError(t, err)
+	require.Equal(t, dfd, got)
+
+	_, err = newKTX2DataFormatDescriptor(PixelFormatGBGR422)
+	require.Error(t, err)
+}
+
+func TestKTX2CompressedArray(t *testing.T) {
+	k := newTestTexture[KTX2Texture](PixelFormatBC7RGBAUnorm, 8, 8, 0, 4, 3)
+	k.LayerCount = 3
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX2(&buf, k))
+
+	data := buf.Bytes()
+
+	// Levels are aligned to the 16-byte block size.
+	for i := 0; i < 4; i++ {
+		require.Zero(t, binary.LittleEndian.Uint64(data[80+24*i:])%16)
+	}
+
+	got, err := ReadKTX2(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, k.Levels, got.Levels)
+	require.Equal(t, TextureType2DArray, got.TextureDescriptor().TextureType)
+	require.Equal(t, uint8(dfdModelBC7), got.DataFormatDescriptor.ColorModel)
+}
+
+func TestKTX2Errors(t *testing.T) {
+	k := newTestTexture[KTX2Texture](PixelFormatR8Unorm, 4, 4, 0, 1, 1)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX2(&buf, k))
+
+	data := buf.Bytes()
+
+	for scheme, msg := range map[uint32]string{1: "BasisLZ", 2: "Zstandard"} {
+		bad := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(bad[44:], scheme)
+
+		_, err := ReadKTX2(bytes.NewReader(bad))
+		require.ErrorContains(t, err, msg)
+	}
+
+	bad := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(bad[12:], 0)
+	_, err := ReadKTX2(bytes.NewReader(bad))
+	require.Error(t, err)
+
+	_, err = ReadKTX2(bytes.NewReader(data[:len(data)-1]))
+	require.Error(t, err)
+
+	_, err = ReadKTX2(bytes.NewReader([]byte("KTX")))
+	require.Error(t, err)
+
+	k.Supercompression = KTX2SupercompressionZstandard
+	require.Error(t, WriteKTX2(&buf, k))
+}
+
+func TestKTX2Oversized(t *testing.T) {
+	k := newTestTexture[KTX2Texture](PixelFormatRGBA32Float, 1, 1, 0, 1, 1)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX2(&buf, k))
+
+	// A 65536x65536x65536 texture with 65536 layers has a level size of 1<<68
+	// bytes, which wraps around to an empty level.
+	data := buf.Bytes()
+	for _, offset := range []int{20, 24, 28, 32} {
+		binary.LittleEndian.PutUint32(data[offset:], 1<<16)
+	}
+
+	binary.LittleEndian.PutUint64(data[80+8:], 0)
+
+	_, err := ReadKTX2(bytes.NewReader(data))
+	require.ErrorContains(t, err, "invalid KTX2 dimensions")
+}
@@ -0,0 +1,175 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKTXRoundTrip(t *testing.T) {
+	k := newTestTexture[KTXTexture](PixelFormatRGBA16Float, 4, 2, 0, 3, 1)
+	k.KeyValues = []KTXKeyValue{
+		{Key: "KTXorientation", Value: []byte("S=r,T=d\x00")},
+		{Key: "tool", Value: []byte("go-mtl")},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteKTX(&buf, k, func(o *KTXOptions) {
+			o.ByteOrder = order
+		}))
+
+		data := buf.Bytes()
+		require.Equal(t, ktxIdentifier[:], data[:12])
+		require.Equal(t, uint32(ktxEndianness), order.Uint32(data[12:]))
+		require.Equal(t, uint32(glHalfFloat), order.Uint32(data[16:]))
+		require.Equal(t, uint32(glRGBA16F), order.Uint32(data[28:]))
+
+		got, err := ReadKTX(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, k, got)
+
+		// Half floats are stored in the byte order of the file.
+		imageSize := 64 + int(order.Uint32(data[60:]))
+		require.Equal(t, uint32(4*2*8), order.Uint32(data[imageSize:]))
+		require.Equal(t, order.Uint16(data[imageSize+4:]), binary.LittleEndian.Uint16(k.Levels[0].Slices[0]))
+	}
+}
+
+func TestKTXRowPadding(t *testing.T) {
+	k := &KTXTexture{
+		PixelFormat: PixelFormatR8Unorm,
+		Width:       3,
+		Height:      2,
+		FaceCount:   1,
+		Levels: []TextureLevel{{
+			Width: 3, Height: 2, Depth: 1, BytesPerRow: 3, BytesPerImage: 6,
+			Slices: [][]byte{{1, 2, 3, 4, 5, 6}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX(&buf, k))
+
+	data := buf.Bytes()
+	require.Len(t, data, 64+4+8)
+	require.Equal(t, []byte{8, 0, 0, 0, 1, 2, 3, 0, 4, 5, 6, 0}, data[64:])
+
+	got, err := ReadKTX(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, k.Levels, got.Levels)
+	require.Equal(t, TextureDescriptor{
+		TextureType:      TextureType2D,
+		PixelFormat:      PixelFormatR8Unorm,
+		Width:            3,
+		Height:           2,
+		MipmapLevelCount: 1,
+	}, got.TextureDescriptor())
+
+	// Levels without strides are tightly packed.
+	k.Levels[0].BytesPerRow, k.Levels[0].BytesPerImage = 0, 0
+
+	var packed bytes.Buffer
+	require.NoError(t, WriteKTX(&packed, k))
+	require.Equal(t, data, packed.Bytes())
+}
+
+func TestKTXCubeMap(t *testing.T) {
+	k := &KTXTexture{
+		PixelFormat: PixelFormatBC1RGBA,
+		Width:       8,
+		Height:      8,
+		FaceCount:   6,
+	}
+
+	for i := 0; i < 2; i++ {
+		l := newTextureLevel(k.PixelFormat, mipmapSize(8, i), mipmapSize(8, i), 1, 6)
+		for face := range l.Slices {
+			l.Slices[face][0] = byte(10*i + face)
+		}
+
+		k.Levels = append(k.Levels, l)
+	}
+
+	require.Equal(t, 16, k.Levels[0].BytesPerRow)
+	require.Len(t, k.Levels[1].Slices[5], 8)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX(&buf, k))
+
+	// The image size of a cube map covers a single face.
+	data := buf.Bytes()
+	require.Equal(t, uint32(32), binary.LittleEndian.Uint32(data[64:]))
+	require.Len(t, data, 64+4+6*32+4+6*8)
+
+	got, err := ReadKTX(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, k, got)
+	require.Equal(t, TextureTypeCube, got.TextureDescriptor().TextureType)
+}
+
+func TestKTXTextureDescriptor1D(t *testing.T) {
+	k := &KTXTexture{PixelFormat: PixelFormatR8Unorm, Width: 8, ArrayLength: 3, FaceCount: 1}
+
+	td := k.TextureDescriptor()
+	require.Equal(t, TextureType1DArray, td.TextureType)
+	require.Equal(t, uint(8), td.Width)
+	require.Equal(t, uint(1), td.Height)
+	require.Equal(t, uint(3), td.ArrayLength)
+}
+
+func TestKTXBGRA(t *testing.T) {
+	k := &KTXTexture{
+		PixelFormat: PixelFormatBGRA8UnormSRGB,
+		Width:       1,
+		Height:      1,
+		ArrayLength: 2,
+		FaceCount:   1,
+		Levels:      []TextureLevel{newTextureLevel(PixelFormatBGRA8UnormSRGB, 1, 1, 1, 2)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX(&buf, k))
+	require.Equal(t, uint32(glBGRA), binary.LittleEndian.Uint32(buf.Bytes()[24:]))
+
+	got, err := ReadKTX(&buf)
+	require.NoError(t, err)
+	require.Equal(t, PixelFormatBGRA8UnormSRGB, got.PixelFormat)
+	require.Equal(t, TextureType2DArray, got.TextureDescriptor().TextureType)
+	require.Len(t, got.Levels[0].Slices, 2)
+}
+
+func TestKTXErrors(t *testing.T) {
+	_, err := ReadKTX(bytes.NewReader([]byte("not a ktx file")))
+	require.Error(t, err)
+
+	k := &KTXTexture{
+		PixelFormat: PixelFormatRGBA8Unorm,
+		Width:       2,
+		Height:      2,
+		FaceCount:   1,
+		Levels:      []TextureLevel{newTextureLevel(PixelFormatRGBA8Unorm, 2, 2, 1, 1)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKTX(&buf, k))
+
+	data := buf.Bytes()
+
+	_, err = ReadKTX(bytes.NewReader(data[:len(data)-1]))
+	require.Error(t, err)
+
+	bad := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(bad[28:], 0x1234)
+	_, err = ReadKTX(bytes.NewReader(bad))
+	require.Error(t, err)
+
+	k.PixelFormat = PixelFormatGBGR422
+	require.Error(t, WriteKTX(&buf, k))
+
+	k.PixelFormat = PixelFormatRGBA8Unorm
+	k.FaceCount = 6
+	require.Error(t, WriteKTX(&buf, k))
+}
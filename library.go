@@ -4,6 +4,7 @@
 package mtl
 
 /*
+#include <stdlib.h>
 #include "library.h"
 struct Library Go_Device_NewLibraryWithSource(void * device, _GoString_ source, struct CompileOptions opts) {
 	return Device_NewLibraryWithSource(device, _GoStringPtr(source), _GoStringLen(source), opts);
@@ -14,22 +15,9 @@ import (
 	"errors"
 	"fmt"
 	"unsafe"
-)
-
-// CompileOptions specifies optional compilation settings for
-// the graphics or compute functions within a library.
-//
-// Reference: https://developer.apple.com/documentation/metal/mtlcompileoptions
-type CompileOptions struct {
-	// Indicates whether the compiler can perform optimizations for floating-point arithmetic that may violate the IEEE 754 standard.
-	FastMathEnabled bool
-
-	// Indicates whether the compiler should compile vertex shaders conservatively to generate consistent position calculations.
-	PreserveInvariance bool
 
-	// The language version used to interpret the library source code.
-	LanguageVersion LanguageVersion
-}
+	"github.com/hupe1980/go-mtl/metallib"
+)
 
 // Library represents a collection of compiled graphics or compute functions.
 //
@@ -40,26 +28,79 @@ type Library struct {
 
 // NewLibraryWithSource creates a new library that contains
 // the functions stored in the specified source string.
+// If the source does not compile, the error is a *CompileError.
+// Options that the system does not support are ignored.
 //
 // Reference: https://developer.apple.com/documentation/metal/mtldevice/1433431-newlibrarywithsource
 func (d Device) NewLibraryWithSource(source string, optFns ...func(*CompileOptions)) (Library, error) {
-	opts := CompileOptions{
-		FastMathEnabled:    true,
-		PreserveInvariance: false,
-		LanguageVersion:    LanguageVersion3_0,
-	}
+	opts := newCompileOptions(optFns)
 
-	for _, fn := range optFns {
-		fn(&opts)
+	macros, err := opts.macros()
+	if err != nil {
+		return Library{}, err
 	}
 
 	co := C.struct_CompileOptions{
-		FastMathEnabled:    C.bool(opts.FastMathEnabled),
-		PreserveInvariance: C.bool(opts.PreserveInvariance),
-		LanguageVersion:    C.uint_t(opts.LanguageVersion),
+		FastMathEnabled:            C.bool(opts.mathMode() == MathModeFast),
+		PreserveInvariance:         C.bool(opts.PreserveInvariance),
+		LanguageVersion:            C.uint_t(opts.LanguageVersion),
+		MathMode:                   C.uint_t(opts.mathMode()),
+		MathFloatingPointFunctions: C.uint_t(opts.MathFloatingPointFunctions),
+		LibraryType:                C.uint_t(opts.LibraryType),
+		OptimizationLevel:          C.uint_t(opts.OptimizationLevel),
+		MacroCount:                 C.uint_t(len(macros)),
+	}
+
+	if opts.InstallName != "" {
+		co.InstallName = C.CString(opts.InstallName)
+		defer C.free(unsafe.Pointer(co.InstallName))
+	}
+
+	if len(macros) > 0 {
+		co.MacroNames = (**C.char)(C.malloc(C.size_t(len(macros)) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+		defer C.free(unsafe.Pointer(co.MacroNames))
+
+		co.MacroValues = (**C.char)(C.malloc(C.size_t(len(macros)) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+		defer C.free(unsafe.Pointer(co.MacroValues))
+
+		co.MacroKinds = (*C.uint8_t)(C.malloc(C.size_t(len(macros))))
+		defer C.free(unsafe.Pointer(co.MacroKinds))
+
+		names := unsafe.Slice(co.MacroNames, len(macros))
+		values := unsafe.Slice(co.MacroValues, len(macros))
+		kinds := unsafe.Slice(co.MacroKinds, len(macros))
+
+		for i, m := range macros {
+			names[i] = C.CString(m.Name)
+			defer C.free(unsafe.Pointer(names[i]))
+
+			values[i] = C.CString(m.Value)
+			defer C.free(unsafe.Pointer(values[i]))
+
+			kinds[i] = C.uint8_t(m.Kind)
+		}
+	}
+
+	l := C.Go_Device_NewLibraryWithSource(d.device, source, co)
+	if l.Library == nil {
+		return Library{}, newCompileError(source, C.GoString(l.Error))
+	}
+
+	return Library{l.Library}, nil
+}
+
+// NewLibraryWithData creates a new library from the contents of a precompiled
+// Metal library file (.metallib). The container is validated with metallib.Parse
+// before it is handed to Metal, so truncated or corrupt files fail with a
+// descriptive error instead of an opaque one.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtldevice/newlibrary(data:)
+func (d Device) NewLibraryWithData(data []byte) (Library, error) {
+	if _, err := metallib.Parse(data); err != nil {
+		return Library{}, err
 	}
 
-	l := C.Go_Device_NewLibraryWithSource(d.device, source, co) // TODO: opt.
+	l := C.Device_NewLibraryWithData(d.device, unsafe.Pointer(&data[0]), C.size_t(len(data)))
 	if l.Library == nil {
 		return Library{}, errors.New(C.GoString(l.Error))
 	}
@@ -11,8 +11,21 @@ struct CompileOptions {
 	bool FastMathEnabled;
 	bool PreserveInvariance;
 	uint_t LanguageVersion;
+	uint_t MathMode;
+	uint_t MathFloatingPointFunctions;
+	uint_t LibraryType;
+	const char * InstallName;
+	uint_t OptimizationLevel;
+
+	// Macros are passed as parallel arrays, see macroKind for the kinds.
+	const char ** MacroNames;
+	const char ** MacroValues;
+	uint8_t * MacroKinds;
+	uint_t MacroCount;
 };
 
 struct Library Device_NewLibraryWithSource(void * device, const char * source, size_t sourceLength, struct CompileOptions opts);
 
+struct Library Device_NewLibraryWithData(void * device, const void * data, size_t length);
+
 void * Library_NewFunctionWithName(void * library, const char * name);
\ No newline at end of file
@@ -5,9 +5,55 @@
 
 struct Library Device_NewLibraryWithSource(void * device, const char * source, size_t sourceLength, struct CompileOptions opts) {
 	MTLCompileOptions *compileOptions = [MTLCompileOptions new];
-	compileOptions.fastMathEnabled = opts.FastMathEnabled;
 	compileOptions.preserveInvariance = opts.PreserveInvariance;
 
+#if __MAC_OS_X_VERSION_MAX_ALLOWED >= 150000 || __IPHONE_OS_VERSION_MAX_ALLOWED >= 180000
+	if (@available(macOS 15.0, iOS 18.0, *)) {
+		compileOptions.mathMode = (MTLMathMode)opts.MathMode;
+		compileOptions.mathFloatingPointFunctions = (MTLMathFloatingPointFunctions)opts.MathFloatingPointFunctions;
+	} else {
+		compileOptions.fastMathEnabled = opts.FastMathEnabled;
+	}
+#else
+	compileOptions.fastMathEnabled = opts.FastMathEnabled;
+#endif
+
+	if (@available(macOS 11.0, iOS 14.0, *)) {
+		compileOptions.libraryType = (MTLLibraryType)opts.LibraryType;
+		if (opts.InstallName) {
+			compileOptions.installName = [NSString stringWithUTF8String:opts.InstallName];
+		}
+	}
+
+#if __MAC_OS_X_VERSION_MAX_ALLOWED >= 130000 || __IPHONE_OS_VERSION_MAX_ALLOWED >= 160000
+	if (@available(macOS 13.0, iOS 16.0, *)) {
+		compileOptions.optimizationLevel = (MTLLibraryOptimizationLevel)opts.OptimizationLevel;
+	}
+#endif
+
+	if (opts.MacroCount > 0) {
+		NSMutableDictionary<NSString *, NSObject *> * macros = [NSMutableDictionary dictionaryWithCapacity:opts.MacroCount];
+		for (uint_t i = 0; i < opts.MacroCount; i++) {
+			const char * value = opts.MacroValues[i];
+			NSObject * object;
+			switch (opts.MacroKinds[i]) {
+			case 1:
+				object = @(strtoll(value, NULL, 10));
+				break;
+			case 2:
+				object = @(strtoull(value, NULL, 10));
+				break;
+			case 3:
+				object = @(strtod(value, NULL));
+				break;
+			default:
+				object = [NSString stringWithUTF8String:value];
+			}
+			macros[[NSString stringWithUTF8String:opts.MacroNames[i]]] = object;
+		}
+		compileOptions.preprocessorMacros = macros;
+	}
+
 	NSError * error;
 	id<MTLLibrary> library = [(id<MTLDevice>)device
 		newLibraryWithSource:[[NSString alloc] initWithBytes:source length:sourceLength encoding:NSUTF8StringEncoding]
@@ -23,6 +69,25 @@ struct Library Device_NewLibraryWithSource(void * device, const char * source, s
 	return l;
 }
 
+struct Library Device_NewLibraryWithData(void * device, const void * data, size_t length) {
+	// The default destructor makes dispatch copy the bytes, which Go owns.
+	dispatch_data_t dispatchData = dispatch_data_create(data, length, NULL, DISPATCH_DATA_DESTRUCTOR_DEFAULT);
+
+	NSError * error;
+	id<MTLLibrary> library = [(id<MTLDevice>)device newLibraryWithData:dispatchData error:&error];
+
+	// The library retains the data it needs; cgo does not compile with ARC.
+	dispatch_release(dispatchData);
+
+	struct Library l;
+	l.Library = library;
+	if (!library) {
+		l.Error = error.localizedDescription.UTF8String;
+	}
+
+	return l;
+}
+
 void * Library_NewFunctionWithName(void * library, const char * name) {
 	return [(id<MTLLibrary>)library newFunctionWithName:[NSString stringWithUTF8String:name]];
 }
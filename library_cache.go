@@ -0,0 +1,313 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// compiler creates the objects that LibraryCache caches. It is implemented by
+// deviceCompiler and by a fake compiler in tests.
+type compiler interface {
+	NewLibraryWithSource(source string, optFns ...func(*CompileOptions)) (Library, error)
+	NewFunctionWithName(l Library, name string) (Function, error)
+	NewComputePipelineStateWithFunction(f Function) (ComputePipelineState, error)
+	NewRenderPipelineStateWithDescriptor(rpd RenderPipelineDescriptor) (RenderPipelineState, error)
+}
+
+// deviceCompiler is the compiler of a device.
+type deviceCompiler struct {
+	Device
+}
+
+// NewFunctionWithName returns the function with the given name of the library.
+func (deviceCompiler) NewFunctionWithName(l Library, name string) (Function, error) {
+	return l.NewFunctionWithName(name)
+}
+
+// LibraryCacheOptions configures a LibraryCache. A limit of 0 means the cache is unbounded.
+type LibraryCacheOptions struct {
+	// MaxLibraries is the number of libraries that are kept.
+	MaxLibraries int
+
+	// MaxFunctions is the number of functions that are kept.
+	MaxFunctions int
+
+	// MaxPipelineStates is the number of compute and of render pipeline states
+	// that are kept.
+	MaxPipelineStates int
+}
+
+// CacheCounters holds the statistics of a kind of cached object.
+type CacheCounters struct {
+	// Hits counts the requests served from the cache, including the requests that
+	// waited for a concurrent request of the same object.
+	Hits uint64
+
+	// Misses counts the requests that created the object.
+	Misses uint64
+
+	// Evictions counts the objects removed to stay within the limit.
+	Evictions uint64
+
+	// Entries is the number of cached objects.
+	Entries int
+}
+
+// CacheStats holds the statistics of a LibraryCache.
+type CacheStats struct {
+	Libraries             CacheCounters
+	Functions             CacheCounters
+	ComputePipelineStates CacheCounters
+	RenderPipelineStates  CacheCounters
+}
+
+// LibraryCache caches the libraries compiled from source, their functions and the
+// pipeline states created with them. Libraries are addressed by a hash of the
+// source, the compile options and the registry ID of the device, so identical
+// requests compile once. Concurrent requests of the same object wait for a single
+// creation. Failures are not cached. Each kind of object is limited separately, the
+// least recently used objects are evicted first. A LibraryCache is safe for
+// concurrent use.
+type LibraryCache struct {
+	compiler   compiler
+	registryID uint64
+
+	mu                    sync.Mutex
+	libraries             *lru
+	functions             *lru
+	computePipelineStates *lru
+	renderPipelineStates  *lru
+}
+
+// NewLibraryCache returns a cache of the libraries and pipeline states of the device.
+func NewLibraryCache(d Device, optFns ...func(*LibraryCacheOptions)) *LibraryCache {
+	return newLibraryCache(deviceCompiler{d}, d.RegistryID, optFns)
+}
+
+// newLibraryCache returns a cache of the objects created by c.
+func newLibraryCache(c compiler, registryID uint64, optFns []func(*LibraryCacheOptions)) *LibraryCache {
+	opts := LibraryCacheOptions{
+		MaxLibraries:      64,
+		MaxFunctions:      256,
+		MaxPipelineStates: 256,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	return &LibraryCache{
+		compiler:              c,
+		registryID:            registryID,
+		libraries:             newLRU(opts.MaxLibraries),
+		functions:             newLRU(opts.MaxFunctions),
+		computePipelineStates: newLRU(opts.MaxPipelineStates),
+		renderPipelineStates:  newLRU(opts.MaxPipelineStates),
+	}
+}
+
+// NewLibraryWithSource returns the library compiled from source with the compile
+// options, compiling it if it is not cached.
+func (c *LibraryCache) NewLibraryWithSource(source string, optFns ...func(*CompileOptions)) (Library, error) {
+	key, err := c.libraryKey(source, optFns)
+	if err != nil {
+		return Library{}, err
+	}
+
+	v, err := c.get(c.libraries, key, func() (any, error) {
+		return c.compiler.NewLibraryWithSource(source, optFns...)
+	})
+	if err != nil {
+		return Library{}, err
+	}
+
+	return v.(Library), nil
+}
+
+// functionKey is the cache key of a function.
+type functionKey struct {
+	library Library
+	name    string
+}
+
+// NewFunctionWithName returns the function with the given name of the library.
+func (c *LibraryCache) NewFunctionWithName(l Library, name string) (Function, error) {
+	v, err := c.get(c.functions, functionKey{l, name}, func() (any, error) {
+		return c.compiler.NewFunctionWithName(l, name)
+	})
+	if err != nil {
+		return Function{}, err
+	}
+
+	return v.(Function), nil
+}
+
+// NewComputePipelineStateWithFunction returns the compute pipeline state of the function.
+func (c *LibraryCache) NewComputePipelineStateWithFunction(f Function) (ComputePipelineState, error) {
+	v, err := c.get(c.computePipelineStates, f, func() (any, error) {
+		return c.compiler.NewComputePipelineStateWithFunction(f)
+	})
+	if err != nil {
+		return ComputePipelineState{}, err
+	}
+
+	return v.(ComputePipelineState), nil
+}
+
+// NewRenderPipelineStateWithDescriptor returns the render pipeline state of the descriptor.
+func (c *LibraryCache) NewRenderPipelineStateWithDescriptor(rpd RenderPipelineDescriptor) (RenderPipelineState, error) {
+	v, err := c.get(c.renderPipelineStates, rpd, func() (any, error) {
+		return c.compiler.NewRenderPipelineStateWithDescriptor(rpd)
+	})
+	if err != nil {
+		return RenderPipelineState{}, err
+	}
+
+	return v.(RenderPipelineState), nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *LibraryCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Libraries:             c.libraries.counters(),
+		Functions:             c.functions.counters(),
+		ComputePipelineStates: c.computePipelineStates.counters(),
+		RenderPipelineStates:  c.renderPipelineStates.counters(),
+	}
+}
+
+// Purge removes all objects from the cache. The statistics are kept.
+func (c *LibraryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range []*lru{c.libraries, c.functions, c.computePipelineStates, c.renderPipelineStates} {
+		l.entries = map[any]*list.Element{}
+		l.order.Init()
+	}
+}
+
+// libraryKey returns the hash that addresses the library compiled from source.
+func (c *LibraryCache) libraryKey(source string, optFns []func(*CompileOptions)) ([sha256.Size]byte, error) {
+	opts := newCompileOptions(optFns)
+
+	macros, err := opts.macros()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	h := sha256.New()
+
+	_ = binary.Write(h, binary.LittleEndian, c.registryID)
+	_ = binary.Write(h, binary.LittleEndian, uint64(len(source)))
+	_, _ = io.WriteString(h, source)
+
+	fmt.Fprintf(h, "%d %t %d %d %d %d %q %d\n",
+		opts.mathMode(), opts.PreserveInvariance, opts.LanguageVersion, opts.MathFloatingPointFunctions,
+		opts.LibraryType, opts.OptimizationLevel, opts.InstallName, len(macros))
+
+	for _, m := range macros {
+		fmt.Fprintf(h, "%s %d %q\n", m.Name, m.Kind, m.Value)
+	}
+
+	var key [sha256.Size]byte
+
+	copy(key[:], h.Sum(nil))
+
+	return key, nil
+}
+
+// get returns the value of the key in l, calling create once for concurrent misses.
+func (c *LibraryCache) get(l *lru, key any, create func() (any, error)) (any, error) {
+	c.mu.Lock()
+
+	if el, ok := l.entries[key]; ok {
+		l.order.MoveToFront(el)
+		l.hits++
+		c.mu.Unlock()
+
+		e := el.Value.(*lruEntry)
+		<-e.done
+
+		return e.value, e.err
+	}
+
+	l.misses++
+
+	e := &lruEntry{key: key, done: make(chan struct{})}
+	el := l.order.PushFront(e)
+	l.entries[key] = el
+	l.evict()
+
+	c.mu.Unlock()
+
+	e.value, e.err = create()
+
+	if e.err != nil {
+		c.mu.Lock()
+		if l.entries[key] == el {
+			delete(l.entries, key)
+			l.order.Remove(el)
+		}
+		c.mu.Unlock()
+	}
+
+	close(e.done)
+
+	return e.value, e.err
+}
+
+// lruEntry is a cached object, which is being created until done is closed.
+type lruEntry struct {
+	key   any
+	value any
+	err   error
+	done  chan struct{}
+}
+
+// lru is a least recently used list of cached objects. It is guarded by the
+// mutex of its LibraryCache.
+type lru struct {
+	limit   int
+	entries map[any]*list.Element
+	order   *list.List
+
+	hits, misses, evictions uint64
+}
+
+func newLRU(limit int) *lru {
+	return &lru{
+		limit:   limit,
+		entries: map[any]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// evict removes the least recently used objects above the limit.
+func (l *lru) evict() {
+	for l.limit > 0 && l.order.Len() > l.limit {
+		el := l.order.Back()
+		delete(l.entries, el.Value.(*lruEntry).key)
+		l.order.Remove(el)
+		l.evictions++
+	}
+}
+
+func (l *lru) counters() CacheCounters {
+	return CacheCounters{
+		Hits:      l.hits,
+		Misses:    l.misses,
+		Evictions: l.evictions,
+		Entries:   l.order.Len(),
+	}
+}
@@ -0,0 +1,215 @@
+package mtl
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCompiler counts the objects it creates. It fails for the source "error" and
+// blocks creations while gate is not nil.
+type fakeCompiler struct {
+	libraries, functions, pipelineStates int64
+	gate                                 chan struct{}
+}
+
+func (f *fakeCompiler) wait() {
+	if f.gate != nil {
+		<-f.gate
+	}
+}
+
+func (f *fakeCompiler) NewLibraryWithSource(source string, optFns ...func(*CompileOptions)) (Library, error) {
+	f.wait()
+	atomic.AddInt64(&f.libraries, 1)
+
+	if source == "error" {
+		return Library{}, errors.New("compile error")
+	}
+
+	return Library{unsafe.Pointer(new(int))}, nil
+}
+
+func (f *fakeCompiler) NewFunctionWithName(l Library, name string) (Function, error) {
+	f.wait()
+	atomic.AddInt64(&f.functions, 1)
+
+	return Function{unsafe.Pointer(new(int))}, nil
+}
+
+func (f *fakeCompiler) NewComputePipelineStateWithFunction(fn Function) (ComputePipelineState, error) {
+	f.wait()
+	atomic.AddInt64(&f.pipelineStates, 1)
+
+	return ComputePipelineState{computePipelineState: unsafe.Pointer(new(int))}, nil
+}
+
+func (f *fakeCompiler) NewRenderPipelineStateWithDescriptor(rpd RenderPipelineDescriptor) (RenderPipelineState, error) {
+	f.wait()
+	atomic.AddInt64(&f.pipelineStates, 1)
+
+	return RenderPipelineState{unsafe.Pointer(new(int))}, nil
+}
+
+func TestLibraryCache(t *testing.T) {
+	fc := &fakeCompiler{}
+	c := newLibraryCache(fc, 1, nil)
+
+	l1, err := c.NewLibraryWithSource("a")
+	require.NoError(t, err)
+
+	l2, err := c.NewLibraryWithSource("a")
+	require.NoError(t, err)
+	require.Equal(t, l1, l2)
+
+	l3, err := c.NewLibraryWithSource("a", func(o *CompileOptions) {
+		o.PreprocessorMacros = map[string]any{"N": 1}
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, l1, l3)
+
+	_, err = c.NewLibraryWithSource("a", func(o *CompileOptions) {
+		o.PreprocessorMacros = map[string]any{"N": "1"}
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 3, fc.libraries)
+
+	f1, err := c.NewFunctionWithName(l1, "k")
+	require.NoError(t, err)
+
+	f2, err := c.NewFunctionWithName(l1, "k")
+	require.NoError(t, err)
+	require.Equal(t, f1, f2)
+
+	_, err = c.NewFunctionWithName(l3, "k")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, fc.functions)
+
+	cps1, err := c.NewComputePipelineStateWithFunction(f1)
+	require.NoError(t, err)
+
+	cps2, err := c.NewComputePipelineStateWithFunction(f1)
+	require.NoError(t, err)
+	require.Equal(t, cps1, cps2)
+
+	rpd := RenderPipelineDescriptor{VertexFunction: f1, FragmentFunction: f2}
+	rpd.ColorAttachments[0].PixelFormat = PixelFormatBGRA8Unorm
+
+	rps1, err := c.NewRenderPipelineStateWithDescriptor(rpd)
+	require.NoError(t, err)
+
+	rps2, err := c.NewRenderPipelineStateWithDescriptor(rpd)
+	require.NoError(t, err)
+	require.Equal(t, rps1, rps2)
+	require.EqualValues(t, 2, fc.pipelineStates)
+
+	_, err = c.NewLibraryWithSource("error")
+	require.EqualError(t, err, "compile error")
+
+	_, err = c.NewLibraryWithSource("error")
+	require.Error(t, err)
+
+	_, err = c.NewLibraryWithSource("a", func(o *CompileOptions) {
+		o.PreprocessorMacros = map[string]any{"-": 1}
+	})
+	require.Error(t, err)
+
+	require.Equal(t, CacheStats{
+		Libraries:             CacheCounters{Hits: 1, Misses: 5, Entries: 3},
+		Functions:             CacheCounters{Hits: 1, Misses: 2, Entries: 2},
+		ComputePipelineStates: CacheCounters{Hits: 1, Misses: 1, Entries: 1},
+		RenderPipelineStates:  CacheCounters{Hits: 1, Misses: 1, Entries: 1},
+	}, c.Stats())
+
+	c.Purge()
+
+	_, err = c.NewLibraryWithSource("a")
+	require.NoError(t, err)
+	require.EqualValues(t, 6, fc.libraries)
+	require.Equal(t, 1, c.Stats().Libraries.Entries)
+}
+
+func TestLibraryCacheKey(t *testing.T) {
+	c1 := newLibraryCache(&fakeCompiler{}, 1, nil)
+	c2 := newLibraryCache(&fakeCompiler{}, 2, nil)
+
+	k1, err := c1.libraryKey("a", nil)
+	require.NoError(t, err)
+
+	k2, err := c2.libraryKey("a", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+
+	// FastMathEnabled false selects the same math mode as MathModeSafe.
+	k3, err := c1.libraryKey("a", []func(*CompileOptions){func(o *CompileOptions) { o.FastMathEnabled = false }})
+	require.NoError(t, err)
+
+	k4, err := c1.libraryKey("a", []func(*CompileOptions){func(o *CompileOptions) { o.MathMode = MathModeSafe }})
+	require.NoError(t, err)
+	require.Equal(t, k3, k4)
+	require.NotEqual(t, k1, k3)
+}
+
+func TestLibraryCacheEviction(t *testing.T) {
+	fc := &fakeCompiler{}
+	c := newLibraryCache(fc, 1, []func(*LibraryCacheOptions){func(o *LibraryCacheOptions) {
+		o.MaxLibraries = 2
+	}})
+
+	for _, source := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := c.NewLibraryWithSource(source)
+		require.NoError(t, err)
+	}
+
+	// "b" is evicted by "c" and compiled again.
+	require.EqualValues(t, 4, fc.libraries)
+	require.Equal(t, CacheCounters{Hits: 2, Misses: 4, Evictions: 2, Entries: 2}, c.Stats().Libraries)
+}
+
+func TestLibraryCacheConcurrent(t *testing.T) {
+	fc := &fakeCompiler{gate: make(chan struct{})}
+	c := newLibraryCache(fc, 1, nil)
+
+	const n = 8
+
+	var wg sync.WaitGroup
+
+	libraries := make([]Library, n)
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			libraries[i], errs[i] = c.NewLibraryWithSource("a")
+		}(i)
+	}
+
+	// Wait until all requests were counted before the compilation completes.
+	for {
+		s := c.Stats().Libraries
+		if s.Hits+s.Misses == n {
+			break
+		}
+
+		runtime.Gosched()
+	}
+
+	close(fc.gate)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, libraries[0], libraries[i])
+	}
+
+	require.EqualValues(t, 1, fc.libraries)
+	require.Equal(t, CacheCounters{Hits: n - 1, Misses: 1, Entries: 1}, c.Stats().Libraries)
+}
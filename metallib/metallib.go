@@ -0,0 +1,471 @@
+// Package metallib parses Metal library files (.metallib), the containers of
+// precompiled shaders produced by the metal and metallib tools, in pure Go.
+//
+// Apple does not document the format. The parser follows the layout of the files
+// produced by Xcode: a header with the locations of the function list, the public
+// and private metadata and the LLVM bitcode, and for each function a list of tags,
+// such as NAME, TYPE, HASH, VERS, MDSZ and OFFT, terminated by ENDT.
+package metallib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// headerSize is the size of the header at the start of every file.
+const headerSize = 88
+
+// magic is the file identifier at the start of every file.
+var magic = []byte("MTLB")
+
+// endTag terminates a list of tags. It has no size and data.
+const endTag = "ENDT"
+
+// Version is a major and minor version number.
+type Version struct {
+	Major, Minor uint16
+}
+
+// String returns the version as "major.minor".
+func (v Version) String() string {
+	return strconv.Itoa(int(v.Major)) + "." + strconv.Itoa(int(v.Minor))
+}
+
+// FileType is the type of a library file.
+type FileType uint8
+
+const (
+	// FileTypeExecutable is a library of functions that pipelines can use.
+	FileTypeExecutable FileType = 0
+
+	// FileTypeCoreImage is a library of Core Image kernels.
+	FileTypeCoreImage FileType = 1
+
+	// FileTypeDynamic is a dynamic library that other libraries link.
+	FileTypeDynamic FileType = 2
+
+	// FileTypeSymbolCompanion holds the debug symbols of another library.
+	FileTypeSymbolCompanion FileType = 3
+)
+
+// String returns the name of the file type.
+func (t FileType) String() string {
+	switch t {
+	case FileTypeExecutable:
+		return "executable"
+	case FileTypeCoreImage:
+		return "core image"
+	case FileTypeDynamic:
+		return "dynamic"
+	case FileTypeSymbolCompanion:
+		return "symbol companion"
+	}
+
+	return fmt.Sprintf("FileType(%d)", uint8(t))
+}
+
+// OS is the operating system a library file was built for.
+type OS uint8
+
+// Operating systems of library files.
+const (
+	OSUnknown          OS = 0x00
+	OSMacOS            OS = 0x81
+	OSIOS              OS = 0x82
+	OSTVOS             OS = 0x83
+	OSWatchOS          OS = 0x84
+	OSBridgeOS         OS = 0x85
+	OSMacCatalyst      OS = 0x86
+	OSIOSSimulator     OS = 0x87
+	OSTVOSSimulator    OS = 0x88
+	OSWatchOSSimulator OS = 0x89
+)
+
+// osNames maps the operating systems to their names.
+var osNames = map[OS]string{
+	OSUnknown:          "unknown",
+	OSMacOS:            "macOS",
+	OSIOS:              "iOS",
+	OSTVOS:             "tvOS",
+	OSWatchOS:          "watchOS",
+	OSBridgeOS:         "bridgeOS",
+	OSMacCatalyst:      "Mac Catalyst",
+	OSIOSSimulator:     "iOS Simulator",
+	OSTVOSSimulator:    "tvOS Simulator",
+	OSWatchOSSimulator: "watchOS Simulator",
+}
+
+// String returns the name of the operating system.
+func (o OS) String() string {
+	if name, ok := osNames[o]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OS(%#x)", uint8(o))
+}
+
+// FunctionType is the type of a function in a library.
+type FunctionType uint8
+
+// Function types, where vertex, fragment, kernel and intersection functions are
+// entry points and visible functions can be called through function tables.
+const (
+	FunctionTypeVertex       FunctionType = 0
+	FunctionTypeFragment     FunctionType = 1
+	FunctionTypeKernel       FunctionType = 2
+	FunctionTypeUnqualified  FunctionType = 3
+	FunctionTypeVisible      FunctionType = 4
+	FunctionTypeExtern       FunctionType = 5
+	FunctionTypeIntersection FunctionType = 6
+)
+
+// functionTypeNames maps the function types to their names.
+var functionTypeNames = map[FunctionType]string{
+	FunctionTypeVertex:       "vertex",
+	FunctionTypeFragment:     "fragment",
+	FunctionTypeKernel:       "kernel",
+	FunctionTypeUnqualified:  "unqualified",
+	FunctionTypeVisible:      "visible",
+	FunctionTypeExtern:       "extern",
+	FunctionTypeIntersection: "intersection",
+}
+
+// String returns the name of the function type.
+func (t FunctionType) String() string {
+	if name, ok := functionTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("FunctionType(%d)", uint8(t))
+}
+
+// Section is the location of a part of a library file.
+type Section struct {
+	Offset, Size uint64
+}
+
+// Header is the header of a library file.
+type Header struct {
+	// TargetPlatform identifies the GPU family; bit 15 is set for macOS.
+	TargetPlatform uint16
+
+	// FileVersion is the version of the file format.
+	FileVersion Version
+
+	FileType  FileType
+	OS        OS
+	OSVersion Version
+
+	// FileSize is the size of the file in bytes.
+	FileSize uint64
+
+	FunctionList    Section
+	PublicMetadata  Section
+	PrivateMetadata Section
+	Bitcode         Section
+}
+
+// Tag is an entry of the tag list of a function.
+type Tag struct {
+	// Name is the four-character name of the tag, such as NAME or OFFT.
+	Name string
+
+	Data []byte
+}
+
+// Function is a function of a library.
+type Function struct {
+	Name string
+	Type FunctionType
+
+	// Hash is the SHA-256 hash of the bitcode.
+	Hash [32]byte
+
+	// AIRVersion is the version of the Apple intermediate representation and
+	// LanguageVersion the version of the Metal Shading Language.
+	AIRVersion      Version
+	LanguageVersion Version
+
+	// Bitcode is the LLVM bitcode module of the function. It shares the memory of
+	// the data passed to Parse.
+	Bitcode []byte
+
+	// Tags holds the tags of the function list entry in file order, and
+	// PublicMetadata and PrivateMetadata the tags of the metadata sections, such as
+	// the vertex attributes and the debug information.
+	Tags            []Tag
+	PublicMetadata  []Tag
+	PrivateMetadata []Tag
+}
+
+// Library is the content of a library file.
+type Library struct {
+	Header    Header
+	Functions []Function
+}
+
+// Function returns the function with the given name.
+func (l *Library) Function(name string) (*Function, bool) {
+	for i := range l.Functions {
+		if l.Functions[i].Name == name {
+			return &l.Functions[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Parse parses a library file and checks that its sections, tags and bitcode
+// modules lie within the data.
+func Parse(data []byte) (*Library, error) {
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Library{Header: h}
+	if err = l.parseFunctions(data); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// parseFunctions parses the entries of the function list.
+func (l *Library) parseFunctions(data []byte) error {
+	fl := l.Header.FunctionList
+
+	list := data[fl.Offset : fl.Offset+fl.Size]
+	if len(list) < 4 {
+		return errors.New("truncated metallib function list")
+	}
+
+	count := binary.LittleEndian.Uint32(list)
+	pos := 4
+
+	for i := uint32(0); i < count; i++ {
+		// Each entry starts with its size, including the size field, followed
+		// by the tags.
+		if pos+4 > len(list) {
+			return errors.New("truncated metallib function list")
+		}
+
+		size := int(binary.LittleEndian.Uint32(list[pos:]))
+
+		var f Function
+
+		tags, end, err := parseTags(list, pos+4)
+		if err == nil && end-pos != size {
+			err = fmt.Errorf("entry size %d does not match the %d bytes of its tags", size, end-pos)
+		}
+
+		if err == nil {
+			f, err = l.function(data, tags)
+		}
+
+		if err != nil {
+			return fmt.Errorf("metallib function %d: %w", i, err)
+		}
+
+		l.Functions = append(l.Functions, f)
+		pos += size
+	}
+
+	return nil
+}
+
+// parseHeader parses the header and checks the sections against the file size.
+func parseHeader(data []byte) (Header, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:4], magic) {
+		return Header{}, errors.New("invalid metallib file identifier")
+	}
+
+	le := binary.LittleEndian
+	section := func(offset int) Section {
+		return Section{Offset: le.Uint64(data[offset:]), Size: le.Uint64(data[offset+8:])}
+	}
+
+	h := Header{
+		TargetPlatform:  le.Uint16(data[4:]),
+		FileVersion:     Version{le.Uint16(data[6:]), le.Uint16(data[8:])},
+		FileType:        FileType(data[10] & 0x7f), // the high bit marks stub libraries
+		OS:              OS(data[11]),
+		OSVersion:       Version{le.Uint16(data[12:]), le.Uint16(data[14:])},
+		FileSize:        le.Uint64(data[16:]),
+		FunctionList:    section(24),
+		PublicMetadata:  section(40),
+		PrivateMetadata: section(56),
+		Bitcode:         section(72),
+	}
+
+	if h.FileSize != uint64(len(data)) {
+		return Header{}, fmt.Errorf("metallib file size %d does not match the %d bytes of data", h.FileSize, len(data))
+	}
+
+	for _, s := range []struct {
+		name string
+		Section
+	}{
+		{"function list", h.FunctionList},
+		{"public metadata", h.PublicMetadata},
+		{"private metadata", h.PrivateMetadata},
+		{"bitcode", h.Bitcode},
+	} {
+		if !within(s.Offset, s.Size, h.FileSize) {
+			return Header{}, fmt.Errorf("metallib %s at %d with %d bytes exceeds the file size %d", s.name, s.Offset, s.Size, h.FileSize)
+		}
+	}
+
+	return h, nil
+}
+
+// function returns the function described by the tags of a function list entry.
+func (l *Library) function(data []byte, tags []Tag) (Function, error) {
+	f := Function{Tags: tags}
+
+	var (
+		offsets     []uint64
+		bitcodeSize uint64
+	)
+
+	for _, t := range tags {
+		switch t.Name {
+		case "NAME":
+			name, _, ok := bytes.Cut(t.Data, []byte{0})
+			if !ok {
+				return Function{}, errors.New("NAME tag is not NUL-terminated")
+			}
+
+			f.Name = string(name)
+		case "TYPE":
+			if len(t.Data) != 1 {
+				return Function{}, fmt.Errorf("invalid TYPE tag of %d bytes", len(t.Data))
+			}
+
+			f.Type = FunctionType(t.Data[0])
+		case "HASH":
+			if len(t.Data) != len(f.Hash) {
+				return Function{}, fmt.Errorf("invalid HASH tag of %d bytes", len(t.Data))
+			}
+
+			copy(f.Hash[:], t.Data)
+		case "VERS":
+			if len(t.Data) != 8 {
+				return Function{}, fmt.Errorf("invalid VERS tag of %d bytes", len(t.Data))
+			}
+
+			le := binary.LittleEndian
+			f.AIRVersion = Version{le.Uint16(t.Data), le.Uint16(t.Data[2:])}
+			f.LanguageVersion = Version{le.Uint16(t.Data[4:]), le.Uint16(t.Data[6:])}
+		case "MDSZ":
+			if len(t.Data) != 8 {
+				return Function{}, fmt.Errorf("invalid MDSZ tag of %d bytes", len(t.Data))
+			}
+
+			bitcodeSize = binary.LittleEndian.Uint64(t.Data)
+		case "OFFT":
+			if len(t.Data) != 24 {
+				return Function{}, fmt.Errorf("invalid OFFT tag of %d bytes", len(t.Data))
+			}
+
+			for i := 0; i < 3; i++ {
+				offsets = append(offsets, binary.LittleEndian.Uint64(t.Data[8*i:]))
+			}
+		}
+	}
+
+	if f.Name == "" {
+		return Function{}, errors.New("no NAME tag")
+	}
+
+	if offsets == nil {
+		return f, nil
+	}
+
+	var err error
+
+	if f.PublicMetadata, err = parseMetadata(data, l.Header.PublicMetadata, offsets[0]); err != nil {
+		return Function{}, fmt.Errorf("public metadata of %s: %w", f.Name, err)
+	}
+
+	if f.PrivateMetadata, err = parseMetadata(data, l.Header.PrivateMetadata, offsets[1]); err != nil {
+		return Function{}, fmt.Errorf("private metadata of %s: %w", f.Name, err)
+	}
+
+	bitcode := l.Header.Bitcode
+	if !within(offsets[2], bitcodeSize, bitcode.Size) {
+		return Function{}, fmt.Errorf("bitcode of %s at %d with %d bytes exceeds the bitcode section", f.Name, offsets[2], bitcodeSize)
+	}
+
+	start := bitcode.Offset + offsets[2]
+	f.Bitcode = data[start : start+bitcodeSize : start+bitcodeSize]
+
+	if !isBitcode(f.Bitcode) {
+		return Function{}, fmt.Errorf("bitcode of %s is not an LLVM bitcode module", f.Name)
+	}
+
+	return f, nil
+}
+
+// parseMetadata parses the tags at the offset in the metadata section, which start
+// after their size. Sections without data have no tags.
+func parseMetadata(data []byte, s Section, offset uint64) ([]Tag, error) {
+	if s.Size == 0 {
+		return nil, nil
+	}
+
+	if offset+4 > s.Size || offset+4 < offset {
+		return nil, fmt.Errorf("offset %d exceeds the section", offset)
+	}
+
+	tags, _, err := parseTags(data[s.Offset:s.Offset+s.Size], int(offset)+4)
+
+	return tags, err
+}
+
+// parseTags parses the tags starting at pos up to the end tag and returns the
+// position after the end tag.
+func parseTags(data []byte, pos int) ([]Tag, int, error) {
+	var tags []Tag
+
+	for {
+		if pos+4 > len(data) {
+			return nil, 0, errors.New("tag list has no ENDT tag")
+		}
+
+		name := string(data[pos : pos+4])
+		pos += 4
+
+		if name == endTag {
+			return tags, pos, nil
+		}
+
+		if pos+2 > len(data) {
+			return nil, 0, fmt.Errorf("truncated %s tag", name)
+		}
+
+		size := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+
+		if pos+size > len(data) {
+			return nil, 0, fmt.Errorf("truncated %s tag", name)
+		}
+
+		tags = append(tags, Tag{Name: name, Data: data[pos : pos+size : pos+size]})
+		pos += size
+	}
+}
+
+// within reports whether size bytes at offset fit in limit bytes.
+func within(offset, size, limit uint64) bool {
+	return offset <= limit && size <= limit-offset
+}
+
+// isBitcode reports whether data starts with the magic number of LLVM bitcode or
+// of its wrapper header.
+func isBitcode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{'B', 'C', 0xc0, 0xde}) || bytes.HasPrefix(data, []byte{0xde, 0xc0, 0x17, 0x0b})
+}
@@ -0,0 +1,225 @@
+package metallib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testFunction describes a function of a library built by buildLibrary.
+type testFunction struct {
+	name            string
+	typ             FunctionType
+	tags            []Tag
+	public, private []Tag
+	bitcode         []byte
+}
+
+// tagList returns the encoding of the tags followed by the end tag.
+func tagList(tags []Tag) []byte {
+	var b bytes.Buffer
+
+	for _, t := range tags {
+		b.WriteString(t.Name)
+		_ = binary.Write(&b, binary.LittleEndian, uint16(len(t.Data)))
+		b.Write(t.Data)
+	}
+
+	b.WriteString(endTag)
+
+	return b.Bytes()
+}
+
+// sizedTagList returns the encoding of the tags preceded by its size.
+func sizedTagList(tags []Tag) []byte {
+	list := tagList(tags)
+
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(list)+4)), list...)
+}
+
+// buildLibrary returns a macOS library file with the functions in the layout
+// produced by Xcode.
+func buildLibrary(functions []testFunction) []byte {
+	le := binary.LittleEndian
+
+	var list, public, private, bitcode []byte
+
+	list = le.AppendUint32(list, uint32(len(functions)))
+
+	for _, f := range functions {
+		hash := sha256.Sum256(f.bitcode)
+
+		var offsets, vers []byte
+		offsets = le.AppendUint64(offsets, uint64(len(public)))
+		offsets = le.AppendUint64(offsets, uint64(len(private)))
+		offsets = le.AppendUint64(offsets, uint64(len(bitcode)))
+
+		for _, v := range []uint16{2, 6, 3, 1} {
+			vers = le.AppendUint16(vers, v)
+		}
+
+		tags := []Tag{
+			{Name: "NAME", Data: append([]byte(f.name), 0)},
+			{Name: "TYPE", Data: []byte{byte(f.typ)}},
+			{Name: "HASH", Data: hash[:]},
+			{Name: "MDSZ", Data: le.AppendUint64(nil, uint64(len(f.bitcode)))},
+			{Name: "OFFT", Data: offsets},
+			{Name: "VERS", Data: vers},
+		}
+
+		list = append(list, sizedTagList(append(tags, f.tags...))...)
+		public = append(public, sizedTagList(f.public)...)
+		private = append(private, sizedTagList(f.private)...)
+		bitcode = append(bitcode, f.bitcode...)
+	}
+
+	data := make([]byte, headerSize)
+	copy(data, magic)
+	le.PutUint16(data[4:], 0x8001)
+	le.PutUint16(data[6:], 1)
+	le.PutUint16(data[8:], 2)
+	data[10] = byte(FileTypeExecutable)
+	data[11] = byte(OSMacOS)
+	le.PutUint16(data[12:], 14)
+
+	for i, section := range [][]byte{list, public, private, bitcode} {
+		le.PutUint64(data[24+16*i:], uint64(len(data)))
+		le.PutUint64(data[32+16*i:], uint64(len(section)))
+		data = append(data, section...)
+	}
+
+	le.PutUint64(data[16:], uint64(len(data)))
+
+	return data
+}
+
+// testBitcode returns a bitcode module with the wrapper header followed by n bytes.
+func testBitcode(n int) []byte {
+	return append([]byte{0xde, 0xc0, 0x17, 0x0b}, bytes.Repeat([]byte{0x42}, n)...)
+}
+
+func TestParse(t *testing.T) {
+	data := buildLibrary([]testFunction{
+		{
+			name:    "vertex_shader",
+			typ:     FunctionTypeVertex,
+			public:  []Tag{{Name: "VATT", Data: []byte("position\x00")}},
+			private: []Tag{{Name: "DEBI", Data: []byte("shaders.metal\x00")}},
+			bitcode: testBitcode(12),
+		},
+		{
+			name:    "add_arrays",
+			typ:     FunctionTypeKernel,
+			tags:    []Tag{{Name: "UUID", Data: make([]byte, 16)}},
+			bitcode: []byte("BC\xc0\xde"),
+		},
+	})
+
+	l, err := Parse(data)
+	require.NoError(t, err)
+
+	require.Equal(t, Header{
+		TargetPlatform:  0x8001,
+		FileVersion:     Version{1, 2},
+		FileType:        FileTypeExecutable,
+		OS:              OSMacOS,
+		OSVersion:       Version{14, 0},
+		FileSize:        uint64(len(data)),
+		FunctionList:    l.Header.FunctionList,
+		PublicMetadata:  l.Header.PublicMetadata,
+		PrivateMetadata: l.Header.PrivateMetadata,
+		Bitcode:         Section{Offset: uint64(len(data)) - 20, Size: 20},
+	}, l.Header)
+	require.Equal(t, uint64(headerSize), l.Header.FunctionList.Offset)
+
+	require.Len(t, l.Functions, 2)
+
+	f, ok := l.Function("vertex_shader")
+	require.True(t, ok)
+	require.Equal(t, FunctionTypeVertex, f.Type)
+	require.Equal(t, sha256.Sum256(testBitcode(12)), f.Hash)
+	require.Equal(t, Version{2, 6}, f.AIRVersion)
+	require.Equal(t, Version{3, 1}, f.LanguageVersion)
+	require.Equal(t, testBitcode(12), f.Bitcode)
+	require.Equal(t, []Tag{{Name: "VATT", Data: []byte("position\x00")}}, f.PublicMetadata)
+	require.Equal(t, []Tag{{Name: "DEBI", Data: []byte("shaders.metal\x00")}}, f.PrivateMetadata)
+	require.Len(t, f.Tags, 6)
+
+	f, ok = l.Function("add_arrays")
+	require.True(t, ok)
+	require.Equal(t, FunctionTypeKernel, f.Type)
+	require.Equal(t, []byte("BC\xc0\xde"), f.Bitcode)
+	require.Empty(t, f.PublicMetadata)
+	require.Equal(t, "UUID", f.Tags[6].Name)
+
+	_, ok = l.Function("missing")
+	require.False(t, ok)
+
+	require.Equal(t, "3.1", f.LanguageVersion.String())
+	require.Equal(t, "kernel", f.Type.String())
+	require.Equal(t, "FunctionType(9)", FunctionType(9).String())
+	require.Equal(t, "macOS", l.Header.OS.String())
+	require.Equal(t, "OS(0x7)", OS(7).String())
+	require.Equal(t, "executable", l.Header.FileType.String())
+	require.Equal(t, "FileType(5)", FileType(5).String())
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := func() []byte {
+		return buildLibrary([]testFunction{{name: "main0", typ: FunctionTypeFragment, bitcode: testBitcode(4)}})
+	}
+
+	le := binary.LittleEndian
+
+	for _, tt := range []struct {
+		name   string
+		modify func(data []byte) []byte
+		msg    string
+	}{
+		{"magic", func(data []byte) []byte { data[0] = 'X'; return data }, "invalid metallib file identifier"},
+		{"short", func(data []byte) []byte { return data[:40] }, "invalid metallib file identifier"},
+		{"truncated", func(data []byte) []byte { return data[:len(data)-1] }, "metallib file size 239 does not match the 238 bytes of data"},
+		{"section", func(data []byte) []byte {
+			le.PutUint64(data[80:], 100)
+			return data
+		}, "metallib bitcode at 231 with 100 bytes exceeds the file size 239"},
+		{"overflow", func(data []byte) []byte {
+			le.PutUint64(data[72:], 1<<63)
+			le.PutUint64(data[80:], 1<<63)
+			return data
+		}, "metallib bitcode at 9223372036854775808 with 9223372036854775808 bytes exceeds the file size 239"},
+		{"list", func(data []byte) []byte {
+			le.PutUint32(data[headerSize:], 2)
+			return data
+		}, "truncated metallib function list"},
+		{"endt", func(data []byte) []byte {
+			copy(data[bytes.Index(data, []byte(endTag)):], "ENDX")
+			return data
+		}, "metallib function 0: truncated ENDX tag"},
+		{"entry size", func(data []byte) []byte {
+			le.PutUint32(data[headerSize+4:], 12)
+			return data
+		}, "metallib function 0: entry size 12 does not match the 123 bytes of its tags"},
+		{"bitcode", func(data []byte) []byte {
+			data[len(data)-8] = 0
+			return data
+		}, "metallib function 0: bitcode of main0 is not an LLVM bitcode module"},
+		{"bitcode size", func(data []byte) []byte {
+			le.PutUint64(data[bytes.Index(data, []byte("MDSZ"))+6:], 9)
+			return data
+		}, "metallib function 0: bitcode of main0 at 0 with 9 bytes exceeds the bitcode section"},
+		{"type", func([]byte) []byte {
+			return buildLibrary([]testFunction{{name: "main0", tags: []Tag{{Name: "TYPE", Data: []byte{1, 2}}}, bitcode: testBitcode(4)}})
+		}, "metallib function 0: invalid TYPE tag of 2 bytes"},
+		{"name", func(data []byte) []byte {
+			data[bytes.Index(data, []byte("main0"))+5] = '1'
+			return data
+		}, "metallib function 0: NAME tag is not NUL-terminated"},
+	} {
+		_, err := Parse(tt.modify(valid()))
+		require.EqualError(t, err, tt.msg, tt.name)
+	}
+}
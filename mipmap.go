@@ -0,0 +1,376 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"math"
+)
+
+// MipmapFilter selects the kernel used to downsample mipmap levels.
+type MipmapFilter uint8
+
+const (
+	// MipmapFilterBox averages the source pixels covered by a destination pixel.
+	MipmapFilterBox MipmapFilter = 0
+
+	// MipmapFilterTriangle weights source pixels linearly by their distance.
+	MipmapFilterTriangle MipmapFilter = 1
+
+	// MipmapFilterKaiser is a Kaiser-windowed sinc with a radius of 3 pixels. It keeps
+	// levels sharp with little ringing.
+	MipmapFilterKaiser MipmapFilter = 2
+
+	// MipmapFilterLanczos is a Lanczos-windowed sinc with a radius of 3 pixels.
+	MipmapFilterLanczos MipmapFilter = 3
+)
+
+// radius returns the support of the kernel in destination pixels.
+func (f MipmapFilter) radius() float64 {
+	switch f {
+	case MipmapFilterTriangle:
+		return 1
+	case MipmapFilterKaiser, MipmapFilterLanczos:
+		return 3
+	}
+
+	return 0.5
+}
+
+// weight returns the kernel value at distance t in destination pixels.
+func (f MipmapFilter) weight(t float64) float64 {
+	t = math.Abs(t)
+
+	switch f {
+	case MipmapFilterTriangle:
+		return math.Max(0, 1-t)
+	case MipmapFilterKaiser:
+		const alpha = 4
+
+		if t >= 3 {
+			return 0
+		}
+
+		r := t / 3
+
+		return sinc(t) * bessel0(alpha*math.Sqrt(1-r*r)) / bessel0(alpha)
+	case MipmapFilterLanczos:
+		if t >= 3 {
+			return 0
+		}
+
+		return sinc(t) * sinc(t/3)
+	}
+
+	if t <= 0.5 {
+		return 1
+	}
+
+	return 0
+}
+
+// MipmapOptions configures GenerateMipmaps.
+type MipmapOptions struct {
+	// Filter selects the downsampling kernel.
+	Filter MipmapFilter
+
+	// LevelCount is the number of levels to generate, including the base level.
+	// A value of 0 generates the full chain down to 1x1.
+	LevelCount int
+
+	// PremultipliedAlpha reports that the color channels are already multiplied by
+	// alpha. Otherwise colors are weighted by alpha while filtering, so that
+	// transparent pixels do not bleed into their neighbors.
+	PremultipliedAlpha bool
+
+	// AlphaTestReference enables alpha coverage preservation for alpha-tested
+	// textures. If it is greater than 0, the alpha of every level is scaled so that
+	// the fraction of pixels with alpha at or above the reference matches the base level.
+	AlphaTestReference float32
+}
+
+// GenerateMipmaps returns the mipmap chain of width*height pixels of data in the
+// uncompressed pixel format pf, starting with a tightly packed copy of the base
+// level. Level i is uploaded with Texture.ReplaceRegion at level i, or all levels
+// at once with Texture.ReplaceLevels. A bytesPerRow of 0 means the rows are tightly
+// packed.
+//
+// Colors of sRGB pixel formats are filtered in linear space. Dimensions that are
+// not a power of two are rounded down at every level, and the kernels are scaled
+// so that every source pixel contributes to the level below.
+func GenerateMipmaps(data []byte, pf PixelFormat, width, height, bytesPerRow int, optFns ...func(*MipmapOptions)) ([]TextureLevel, error) {
+	opts := MipmapOptions{
+		Filter:             MipmapFilterBox,
+		LevelCount:         0,
+		PremultipliedAlpha: false,
+		AlphaTestReference: 0,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	l, err := filterableLayout(pf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate mipmaps: %w", err)
+	}
+
+	if opts.Filter > MipmapFilterLanczos {
+		return nil, fmt.Errorf("unknown mipmap filter %d", opts.Filter)
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid dimensions %dx%d", width, height)
+	}
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * l.size
+	}
+
+	if err := checkRows(data, "source", width, height, l.size, bytesPerRow); err != nil {
+		return nil, err
+	}
+
+	maxLevels := 1
+	for s := width | height; s > 1; s >>= 1 {
+		maxLevels++
+	}
+
+	levelCount := opts.LevelCount
+	if levelCount <= 0 || levelCount > maxLevels {
+		levelCount = maxLevels
+	}
+
+	premultiply := l.bits[3] > 0 && !opts.PremultipliedAlpha
+
+	// Decode the base level to linear, premultiplied values.
+	img := mipImage{width: width, height: height, pix: make([][4]float32, width*height)}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := l.decode(data[y*bytesPerRow+x*l.size:])
+
+			if l.srgb {
+				for c := 0; c < 3; c++ {
+					v[c] = float32(SRGBToLinear(float64(v[c])))
+				}
+			}
+
+			if premultiply {
+				v[0], v[1], v[2] = v[0]*v[3], v[1]*v[3], v[2]*v[3]
+			}
+
+			img.pix[y*width+x] = v
+		}
+	}
+
+	var coverage float64
+	if opts.AlphaTestReference > 0 {
+		coverage = img.alphaCoverage(opts.AlphaTestReference, 1)
+	}
+
+	levels := make([]TextureLevel, levelCount)
+
+	for i := range levels {
+		if i > 0 {
+			img = img.downsample(opts.Filter, mipmapSize(width, i), mipmapSize(height, i))
+		}
+
+		scale := float32(1)
+		if opts.AlphaTestReference > 0 && i > 0 {
+			scale = img.alphaScale(opts.AlphaTestReference, coverage)
+		}
+
+		levels[i] = newTextureLevel(pf, img.width, img.height, 1, 1)
+		dst := levels[i].Slices[0]
+
+		for j, v := range img.pix {
+			if premultiply && v[3] > 0 {
+				v[0], v[1], v[2] = v[0]/v[3], v[1]/v[3], v[2]/v[3]
+			}
+
+			v[3] *= scale
+
+			if l.srgb {
+				for c := 0; c < 3; c++ {
+					v[c] = float32(LinearToSRGB(clamp(float64(v[c]), 0, 1)))
+				}
+			}
+
+			l.encode(dst[j*l.size:], v)
+		}
+	}
+
+	return levels, nil
+}
+
+// mipImage is an image of linear floating-point RGBA values.
+type mipImage struct {
+	width, height int
+	pix           [][4]float32
+}
+
+// downsample returns the image filtered to the given dimensions. The kernel is
+// applied horizontally, then vertically.
+func (m mipImage) downsample(f MipmapFilter, width, height int) mipImage {
+	tmp := mipImage{width: width, height: m.height, pix: make([][4]float32, width*m.height)}
+
+	taps := mipmapTaps(f, m.width, width)
+	for y := 0; y < m.height; y++ {
+		src, dst := m.pix[y*m.width:], tmp.pix[y*width:]
+
+		for x, t := range taps {
+			var v [4]float32
+
+			for i, w := range t.weights {
+				for c := range v {
+					v[c] += w * src[t.start+i][c]
+				}
+			}
+
+			dst[x] = v
+		}
+	}
+
+	out := mipImage{width: width, height: height, pix: make([][4]float32, width*height)}
+
+	taps = mipmapTaps(f, m.height, height)
+	for y, t := range taps {
+		dst := out.pix[y*width:]
+
+		for i, w := range t.weights {
+			src := tmp.pix[(t.start+i)*width:]
+
+			for x := 0; x < width; x++ {
+				for c := range dst[x] {
+					dst[x][c] += w * src[x][c]
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// alphaCoverage returns the fraction of pixels whose alpha, multiplied by scale,
+// is at or above the reference.
+func (m mipImage) alphaCoverage(reference, scale float32) float64 {
+	n := 0
+
+	for _, v := range m.pix {
+		if v[3]*scale >= reference {
+			n++
+		}
+	}
+
+	return float64(n) / float64(len(m.pix))
+}
+
+// alphaScale returns the factor for the alpha of the image that brings its alpha
+// coverage closest to the given one.
+func (m mipImage) alphaScale(reference float32, coverage float64) float32 {
+	lo, hi := float32(0), float32(4)
+	best, bestErr := float32(1), math.Abs(m.alphaCoverage(reference, 1)-coverage)
+
+	for i := 0; i < 16; i++ {
+		mid := (lo + hi) / 2
+		c := m.alphaCoverage(reference, mid)
+
+		if e := math.Abs(c - coverage); e < bestErr {
+			best, bestErr = mid, e
+		}
+
+		if c < coverage {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return best
+}
+
+// mipmapTap holds the weights of the source pixels that contribute to one
+// destination pixel, starting at source pixel start.
+type mipmapTap struct {
+	start   int
+	weights []float32
+}
+
+// mipmapTaps returns the normalized filter taps that resample src pixels to dst
+// pixels. Source pixels outside the image are clamped to the edge.
+func mipmapTaps(f MipmapFilter, src, dst int) []mipmapTap {
+	scale := float64(src) / float64(dst)
+	radius := f.radius() * scale
+	taps := make([]mipmapTap, dst)
+
+	for x := range taps {
+		center := (float64(x) + 0.5) * scale
+		lo := int(math.Floor(center - radius))
+		hi := int(math.Ceil(center + radius))
+
+		start, end := lo, hi
+		if start < 0 {
+			start = 0
+		}
+
+		if end > src {
+			end = src
+		}
+
+		weights := make([]float64, end-start)
+		sum := 0.0
+
+		for i := lo; i < hi; i++ {
+			var w float64
+
+			if f == MipmapFilterBox {
+				// Use the coverage of the source pixel, which handles odd dimensions.
+				w = math.Max(0, math.Min(float64(i+1), center+radius)-math.Max(float64(i), center-radius))
+			} else {
+				w = f.weight((float64(i) + 0.5 - center) / scale)
+			}
+
+			j := i
+			if j < start {
+				j = start
+			} else if j >= end {
+				j = end - 1
+			}
+
+			weights[j-start] += w
+			sum += w
+		}
+
+		taps[x] = mipmapTap{start: start, weights: make([]float32, len(weights))}
+		for i, w := range weights {
+			taps[x].weights[i] = float32(w / sum)
+		}
+	}
+
+	return taps
+}
+
+// sinc returns the normalized sinc function sin(πx)/(πx).
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	x *= math.Pi
+
+	return math.Sin(x) / x
+}
+
+// bessel0 returns the zeroth order modified Bessel function of the first kind.
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+
+	for k := 1; k < 50 && term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+
+	return sum
+}
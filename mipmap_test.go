@@ -0,0 +1,138 @@
+package mtl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateMipmaps(t *testing.T) {
+	data := make([]byte, 4*4*4)
+	for i := 0; i < 16; i++ {
+		if (i%4+i/4)%2 == 0 {
+			copy(data[4*i:], []byte{255, 255, 255, 255})
+		} else {
+			copy(data[4*i:], []byte{0, 0, 0, 255})
+		}
+	}
+
+	levels, err := GenerateMipmaps(data, PixelFormatRGBA8Unorm, 4, 4, 0)
+	require.NoError(t, err)
+	require.Len(t, levels, 3)
+	require.Equal(t, data, levels[0].Slices[0])
+	require.Equal(t, 2, levels[1].Width)
+	require.Equal(t, 8, levels[1].BytesPerRow)
+	require.Equal(t, []byte{128, 128, 128, 255}, levels[1].Slices[0][:4])
+	require.Equal(t, []byte{128, 128, 128, 255}, levels[2].Slices[0])
+
+	// sRGB colors are averaged in linear space.
+	levels, err = GenerateMipmaps(data, PixelFormatRGBA8UnormSRGB, 4, 4, 0, func(o *MipmapOptions) { o.LevelCount = 2 })
+	require.NoError(t, err)
+	require.Len(t, levels, 2)
+	require.Equal(t, []byte{188, 188, 188, 255}, levels[1].Slices[0][:4])
+}
+
+func TestGenerateMipmapsNonPowerOfTwo(t *testing.T) {
+	// The 3 pixels of the first row contribute equally to the single pixel below.
+	data := []byte{0, 30, 90, 0, 0, 0}
+
+	levels, err := GenerateMipmaps(data, PixelFormatR8Unorm, 3, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, levels, 2)
+	require.Equal(t, 1, levels[1].Width)
+	require.Equal(t, 1, levels[1].Height)
+	require.Equal(t, []byte{20}, levels[1].Slices[0])
+
+	levels, err = GenerateMipmaps(make([]byte, 5*3*2), PixelFormatRG8Unorm, 5, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, [][2]int{{5, 3}, {2, 1}, {1, 1}}, [][2]int{
+		{levels[0].Width, levels[0].Height}, {levels[1].Width, levels[1].Height}, {levels[2].Width, levels[2].Height},
+	})
+}
+
+func TestGenerateMipmapsFilters(t *testing.T) {
+	data := make([]byte, 8*6*4)
+	for i := range data {
+		data[i] = 100
+	}
+
+	for _, f := range []MipmapFilter{MipmapFilterBox, MipmapFilterTriangle, MipmapFilterKaiser, MipmapFilterLanczos} {
+		for _, tap := range mipmapTaps(f, 7, 3) {
+			sum := float32(0)
+			for _, w := range tap.weights {
+				sum += w
+			}
+
+			require.InDelta(t, 1, sum, 1e-6)
+		}
+
+		// Constant images stay constant with every normalized kernel.
+		levels, err := GenerateMipmaps(data, PixelFormatRGBA8Unorm, 8, 6, 0, func(o *MipmapOptions) { o.Filter = f })
+		require.NoError(t, err)
+
+		for _, l := range levels[1:] {
+			for _, b := range l.Slices[0] {
+				require.Equal(t, byte(100), b, f)
+			}
+		}
+	}
+}
+
+func TestGenerateMipmapsAlpha(t *testing.T) {
+	// An opaque red pixel next to a transparent green one.
+	data := []byte{255, 0, 0, 255, 0, 255, 0, 0}
+
+	levels, err := GenerateMipmaps(data, PixelFormatRGBA8Unorm, 2, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte{255, 0, 0, 128}, levels[1].Slices[0])
+
+	levels, err = GenerateMipmaps(data, PixelFormatRGBA8Unorm, 2, 1, 0, func(o *MipmapOptions) { o.PremultipliedAlpha = true })
+	require.NoError(t, err)
+	require.Equal(t, []byte{128, 128, 0, 128}, levels[1].Slices[0])
+}
+
+func TestGenerateMipmapsAlphaCoverage(t *testing.T) {
+	const size, reference = 32, 0.5
+
+	data := make([]byte, size*size)
+	for i := range data {
+		data[i] = byte(i * 7919 % 251)
+	}
+
+	coverage := func(l TextureLevel) float64 {
+		n := 0
+
+		for _, a := range l.Slices[0] {
+			if float32(a)/255 >= reference {
+				n++
+			}
+		}
+
+		return float64(n) / float64(len(l.Slices[0]))
+	}
+
+	plain, err := GenerateMipmaps(data, PixelFormatA8Unorm, size, size, 0)
+	require.NoError(t, err)
+
+	preserved, err := GenerateMipmaps(data, PixelFormatA8Unorm, size, size, 0, func(o *MipmapOptions) { o.AlphaTestReference = reference })
+	require.NoError(t, err)
+
+	base := coverage(plain[0])
+
+	for i := 1; i < 4; i++ {
+		require.Less(t, math.Abs(coverage(preserved[i])-base), math.Abs(coverage(plain[i])-base), i)
+		require.InDelta(t, base, coverage(preserved[i]), 0.1, i)
+	}
+}
+
+func TestGenerateMipmapsErrors(t *testing.T) {
+	_, err := GenerateMipmaps(make([]byte, 16), PixelFormatBC1RGBA, 4, 4, 0)
+	require.ErrorContains(t, err, "cannot generate mipmaps")
+
+	_, err = GenerateMipmaps(make([]byte, 16), PixelFormatR32Uint, 2, 2, 0)
+	require.ErrorContains(t, err, "cannot generate mipmaps")
+
+	_, err = GenerateMipmaps(make([]byte, 3), PixelFormatR8Unorm, 2, 2, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,274 @@
+package msl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity is the severity of a diagnostic.
+type Severity uint8
+
+const (
+	// SeverityError is an error that fails the compilation, including fatal errors.
+	SeverityError Severity = iota
+
+	// SeverityWarning is a warning.
+	SeverityWarning
+
+	// SeverityNote is additional information about the preceding diagnostic.
+	SeverityNote
+
+	// SeverityRemark is an informational remark.
+	SeverityRemark
+)
+
+// severities maps the severity labels of the compiler output to their values.
+var severities = map[string]Severity{
+	"fatal error": SeverityError,
+	"error":       SeverityError,
+	"warning":     SeverityWarning,
+	"note":        SeverityNote,
+	"remark":      SeverityRemark,
+}
+
+// String returns the label of the severity in compiler output.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	case SeverityRemark:
+		return "remark"
+	}
+
+	return "error"
+}
+
+// FixIt is a replacement of the source range from Pos up to End suggested by the
+// compiler. Insertions have an empty range.
+type FixIt struct {
+	Pos, End    Pos
+	Replacement string
+}
+
+// Diagnostic is an error, warning or remark of the Metal compiler.
+type Diagnostic struct {
+	// File is the name of the source file, which is "program_source" for source
+	// compiled with NewLibraryWithSource.
+	File string
+
+	// Pos is the position the diagnostic refers to. The column is 0 if unknown.
+	Pos Pos
+
+	Severity Severity
+	Message  string
+
+	// Option is the compiler option that controls the diagnostic, such as
+	// "-Wunused-variable".
+	Option string
+
+	// Notes holds the notes that follow the diagnostic.
+	Notes []Diagnostic
+
+	// FixIts holds the suggested source changes.
+	FixIts []FixIt
+}
+
+// String returns the diagnostic in compiler output format without its notes.
+func (d Diagnostic) String() string {
+	pos := strconv.Itoa(d.Pos.Line)
+	if d.Pos.Column > 0 {
+		pos = d.Pos.String()
+	}
+
+	s := fmt.Sprintf("%s:%s: %s: %s", d.File, pos, d.Severity, d.Message)
+	if d.Option != "" {
+		s += " [" + d.Option + "]"
+	}
+
+	return s
+}
+
+var (
+	diagnosticPattern = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note|remark): (.*)$`)
+	optionPattern     = regexp.MustCompile(` \[(-W[^\]]*)\]$`)
+	fixItPattern      = regexp.MustCompile(`^fix-it:"((?:[^"\\]|\\.)*)":\{(\d+):(\d+)-(\d+):(\d+)\}:"((?:[^"\\]|\\.)*)"$`)
+	caretPattern      = regexp.MustCompile(`^[ \t~]*\^[ \t~]*$`)
+	insertionPattern  = regexp.MustCompile(`^[ \t]*\S+(?: \S+){0,2}$`)
+	summaryPattern    = regexp.MustCompile(`^\d+ (errors?|warnings?)( and \d+ (errors?|warnings?))? generated\.$`)
+)
+
+// ParseDiagnostics parses the output of the Metal compiler, such as the error of
+// NewLibraryWithSource, into diagnostics. Notes are attached to the diagnostic
+// they follow. Fix-its are read from the line below the caret, or from the
+// machine-readable format of -fdiagnostics-parseable-fixits. Other lines are ignored.
+func ParseDiagnostics(output string) []Diagnostic {
+	var (
+		diags []Diagnostic
+		cur   *Diagnostic
+	)
+
+	// afterCaret counts the lines that followed the caret of the current diagnostic.
+	afterCaret := -1
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if m := diagnosticPattern.FindStringSubmatch(line); m != nil {
+			d := Diagnostic{File: m[1], Severity: severities[m[4]], Message: m[5]}
+			d.Pos.Line, _ = strconv.Atoi(m[2])
+			d.Pos.Column, _ = strconv.Atoi(m[3])
+
+			if o := optionPattern.FindStringSubmatch(d.Message); o != nil {
+				d.Option = o[1]
+				d.Message = strings.TrimSuffix(d.Message, o[0])
+			}
+
+			if d.Severity == SeverityNote && len(diags) > 0 {
+				parent := &diags[len(diags)-1]
+				parent.Notes = append(parent.Notes, d)
+				cur = &parent.Notes[len(parent.Notes)-1]
+			} else {
+				diags = append(diags, d)
+				cur = &diags[len(diags)-1]
+			}
+
+			afterCaret = -1
+
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+
+		if m := fixItPattern.FindStringSubmatch(line); m != nil {
+			cur.FixIts = append(cur.FixIts, FixIt{
+				Pos:         Pos{atoi(m[2]), atoi(m[3])},
+				End:         Pos{atoi(m[4]), atoi(m[5])},
+				Replacement: unquote(m[6]),
+			})
+
+			continue
+		}
+
+		switch {
+		case caretPattern.MatchString(line):
+			afterCaret = 0
+		case afterCaret == 0 && isInsertion(line):
+			// The line below the caret shows the text to insert at its column.
+			col := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+			cur.FixIts = append(cur.FixIts, FixIt{
+				Pos:         Pos{cur.Pos.Line, col},
+				End:         Pos{cur.Pos.Line, col},
+				Replacement: strings.TrimSpace(line),
+			})
+			afterCaret = 1
+		default:
+			if afterCaret >= 0 {
+				afterCaret++
+			}
+		}
+	}
+
+	return diags
+}
+
+// isInsertion reports whether a line below a caret is the text of a fix-it, a
+// short sequence of tokens, rather than other output of the compiler.
+func isInsertion(line string) bool {
+	return insertionPattern.MatchString(line) &&
+		!strings.HasPrefix(strings.TrimSpace(line), "In file included from") &&
+		!summaryPattern.MatchString(line)
+}
+
+// FormatDiagnostics returns the diagnostics with the offending line of the source
+// and a caret below the column, followed by the suggested insertions and the notes.
+// The source is the file of the first diagnostic. Lines of other files, such as
+// included headers, are not shown.
+func FormatDiagnostics(diags []Diagnostic, source string) string {
+	if len(diags) == 0 {
+		return ""
+	}
+
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	file := diags[0].File
+
+	width := 1
+	for _, d := range diags {
+		for _, n := range append([]Diagnostic{d}, d.Notes...) {
+			if w := len(strconv.Itoa(n.Pos.Line)); w > width {
+				width = w
+			}
+		}
+	}
+
+	var sb strings.Builder
+
+	var format func(d Diagnostic, indent string)
+
+	format = func(d Diagnostic, indent string) {
+		sb.WriteString(indent + d.String() + "\n")
+
+		if d.File == file && d.Pos.Line >= 1 && d.Pos.Line <= len(lines) {
+			line := lines[d.Pos.Line-1]
+			gutter := indent + strings.Repeat(" ", width+1) + "| "
+
+			fmt.Fprintf(&sb, "%s%*d | %s\n", indent, width, d.Pos.Line, line)
+
+			if d.Pos.Column > 0 {
+				sb.WriteString(gutter + caretIndent(line, d.Pos.Column) + "^\n")
+			}
+
+			for _, f := range d.FixIts {
+				if f.Pos.Line == d.Pos.Line && f.Pos == f.End && f.Replacement != "" {
+					sb.WriteString(gutter + caretIndent(line, f.Pos.Column) + f.Replacement + "\n")
+				}
+			}
+		}
+
+		for _, n := range d.Notes {
+			format(n, indent+"  ")
+		}
+	}
+
+	for _, d := range diags {
+		format(d, "")
+	}
+
+	return sb.String()
+}
+
+// caretIndent returns the whitespace that aligns a caret below the column of
+// line, keeping its tabs.
+func caretIndent(line string, column int) string {
+	n := column - 1
+	if n > len(line) {
+		n = len(line)
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+
+		return ' '
+	}, line[:n])
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+
+	return n
+}
+
+// unquote returns the text of a quoted C string without its escapes.
+func unquote(s string) string {
+	u, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil {
+		return s
+	}
+
+	return u
+}
@@ -0,0 +1,91 @@
+package msl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testOutput = `Compilation failed:
+
+program_source:4:2: error: use of undeclared identifier 'foo'
+	foo = 1;
+	^
+program_source:5:18: error: expected ';' after expression
+    float x = 1.0
+                 ^
+                 ;
+program_source:2:7: warning: unused variable 'y' [-Wunused-variable]
+float y = 2;
+      ^
+program_source:1:6: note: previous definition is here
+void bar();
+     ^
+fix-it:"program_source":{2:1-2:6}:"const float"
+/usr/include/metal_stdlib:10:3: note: candidate function not viable
+3 errors generated.
+`
+
+func TestParseDiagnostics(t *testing.T) {
+	diags := ParseDiagnostics(testOutput)
+	require.Len(t, diags, 3)
+
+	require.Equal(t, Diagnostic{
+		File:     "program_source",
+		Pos:      Pos{4, 2},
+		Severity: SeverityError,
+		Message:  "use of undeclared identifier 'foo'",
+	}, diags[0])
+
+	require.Equal(t, []FixIt{{Pos: Pos{5, 18}, End: Pos{5, 18}, Replacement: ";"}}, diags[1].FixIts)
+
+	w := diags[2]
+	require.Equal(t, SeverityWarning, w.Severity)
+	require.Equal(t, "unused variable 'y'", w.Message)
+	require.Equal(t, "-Wunused-variable", w.Option)
+	require.Equal(t, "program_source:2:7: warning: unused variable 'y' [-Wunused-variable]", w.String())
+	require.Len(t, w.Notes, 2)
+	require.Equal(t, SeverityNote, w.Notes[0].Severity)
+	require.Equal(t, Pos{1, 6}, w.Notes[0].Pos)
+	require.Equal(t, []FixIt{{Pos: Pos{2, 1}, End: Pos{2, 6}, Replacement: "const float"}}, w.Notes[0].FixIts)
+	require.Equal(t, "/usr/include/metal_stdlib", w.Notes[1].File)
+	require.Empty(t, w.Notes[1].FixIts)
+
+	diags = ParseDiagnostics(`program_source:3:1: error: unknown type name 'flaot'
+flaot x;
+^
+In file included from program_source:1:
+/usr/include/shader.h:2:5: error: redefinition of 'f'
+int f();
+    ^
+Compilation failed because of the errors above.
+`)
+	require.Len(t, diags, 2)
+	require.Empty(t, diags[0].FixIts)
+	require.Empty(t, diags[1].FixIts)
+
+	require.Empty(t, ParseDiagnostics("Compilation failed"))
+	require.Equal(t, Pos{3, 0}, ParseDiagnostics("a.metal:3: fatal error: oops")[0].Pos)
+}
+
+func TestFormatDiagnostics(t *testing.T) {
+	source := "void bar();\nfloat y = 2;\nkernel void k() {\n\tfoo = 1;\n    float x = 1.0\n}\n"
+
+	require.Equal(t, `program_source:4:2: error: use of undeclared identifier 'foo'
+ 4 | 	foo = 1;
+   | 	^
+program_source:5:18: error: expected ';' after expression
+ 5 |     float x = 1.0
+   |                  ^
+   |                  ;
+program_source:2:7: warning: unused variable 'y' [-Wunused-variable]
+ 2 | float y = 2;
+   |       ^
+  program_source:1:6: note: previous definition is here
+   1 | void bar();
+     |      ^
+  /usr/include/metal_stdlib:10:3: note: candidate function not viable
+`, FormatDiagnostics(ParseDiagnostics(testOutput), source))
+
+	require.Empty(t, FormatDiagnostics(nil, source))
+}
@@ -0,0 +1,431 @@
+package msl
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Layout is the memory layout of an MSL struct.
+type Layout struct {
+	Name        string
+	Size, Align int
+	Fields      []FieldLayout
+}
+
+// FieldLayout is the memory layout of a data member of an MSL struct.
+type FieldLayout struct {
+	Name                string
+	Type                Type
+	Offset, Size, Align int
+}
+
+// scalarSizes maps the scalar type names to their sizes, which are also their
+// alignments.
+var scalarSizes = map[string]int{
+	"bool":      1,
+	"char":      1,
+	"uchar":     1,
+	"int8_t":    1,
+	"uint8_t":   1,
+	"short":     2,
+	"ushort":    2,
+	"half":      2,
+	"bfloat":    2,
+	"int16_t":   2,
+	"uint16_t":  2,
+	"int":       4,
+	"uint":      4,
+	"float":     4,
+	"int32_t":   4,
+	"uint32_t":  4,
+	"long":      8,
+	"ulong":     8,
+	"int64_t":   8,
+	"uint64_t":  8,
+	"size_t":    8,
+	"ptrdiff_t": 8,
+}
+
+// Layout returns the memory layout of the struct with the given name according
+// to the layout rules of the Metal Shading Language: 3-component vectors take the
+// space of 4, vectors and matrix columns are aligned to their size, packed vectors
+// to their scalar, and structs to their most aligned member.
+//
+// Reference: https://developer.apple.com/metal/Metal-Shading-Language-Specification.pdf
+func (m *Module) Layout(name string) (*Layout, error) {
+	return m.layout(name, map[string]bool{})
+}
+
+func (m *Module) layout(name string, pending map[string]bool) (*Layout, error) {
+	s, ok := m.Struct(name)
+	if !ok {
+		return nil, fmt.Errorf("struct %s not found", name)
+	}
+
+	if pending[name] {
+		return nil, fmt.Errorf("struct %s contains itself", name)
+	}
+
+	pending[name] = true
+	defer delete(pending, name)
+
+	l := &Layout{Name: name, Align: 1}
+
+	for _, f := range s.Fields {
+		size, align, err := m.typeLayout(f.Type, pending)
+		if err != nil {
+			return nil, fmt.Errorf("%s: field %s of %s: %w", f.Pos, f.Name, name, err)
+		}
+
+		offset := alignUp(l.Size, align)
+		l.Fields = append(l.Fields, FieldLayout{Name: f.Name, Type: f.Type, Offset: offset, Size: size, Align: align})
+		l.Size = offset + size
+
+		if align > l.Align {
+			l.Align = align
+		}
+	}
+
+	l.Size = alignUp(l.Size, l.Align)
+
+	return l, nil
+}
+
+// typeLayout returns the size and alignment of the type t.
+func (m *Module) typeLayout(t Type, pending map[string]bool) (size, align int, err error) {
+	switch {
+	case t.Pointer:
+		size, align = 8, 8
+	case t.Reference:
+		return 0, 0, fmt.Errorf("references have no layout")
+	default:
+		if size, align, err = m.namedLayout(t.Name, t.Args, pending); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for _, n := range t.Array {
+		size *= n
+	}
+
+	return size, align, nil
+}
+
+// namedLayout returns the size and alignment of the type with the name and
+// template arguments.
+func (m *Module) namedLayout(name string, args []string, pending map[string]bool) (size, align int, err error) {
+	if s, ok := scalarSizes[name]; ok {
+		return s, s, nil
+	}
+
+	switch name {
+	case "atomic_int", "atomic_uint", "atomic_float":
+		return 4, 4, nil
+	case "atomic_bool":
+		return 1, 1, nil
+	case "atomic":
+		if len(args) == 1 {
+			return m.namedLayout(typeArg(args[0]), nil, pending)
+		}
+	case "vec", "packed_vec", "array":
+		if len(args) != 2 {
+			break
+		}
+
+		n, convErr := strconv.Atoi(strings.TrimSpace(args[1]))
+		if convErr != nil {
+			return 0, 0, fmt.Errorf("invalid length %q of %s", args[1], name)
+		}
+
+		if name == "array" {
+			size, align, err = m.namedLayout(typeArg(args[0]), nil, pending)
+
+			return n * size, align, err
+		}
+
+		return m.namedLayout(strings.TrimSuffix(name, "vec")+typeArg(args[0])+strconv.Itoa(n), nil, pending)
+	}
+
+	if scalar, n, ok := vectorName(strings.TrimPrefix(name, "packed_")); ok {
+		s := scalarSizes[scalar]
+		if strings.HasPrefix(name, "packed_") {
+			return n * s, s, nil
+		}
+
+		return vectorSize(s, n), vectorSize(s, n), nil
+	}
+
+	if scalar, columns, rows, ok := matrixName(name); ok {
+		column := vectorSize(scalarSizes[scalar], rows)
+
+		return columns * column, column, nil
+	}
+
+	if _, ok := m.Struct(name); ok {
+		l, err := m.layout(name, pending)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return l.Size, l.Align, nil
+	}
+
+	return 0, 0, fmt.Errorf("unsupported type %s", name)
+}
+
+// typeArg returns the type name of a template argument.
+func typeArg(arg string) string {
+	return strings.TrimPrefix(strings.TrimSpace(arg), "metal::")
+}
+
+// vectorName splits a vector type name, such as float3, into its scalar type and
+// number of components.
+func vectorName(name string) (scalar string, n int, ok bool) {
+	if len(name) < 2 {
+		return "", 0, false
+	}
+
+	n = int(name[len(name)-1] - '0')
+	scalar = name[:len(name)-1]
+
+	if _, isScalar := scalarSizes[scalar]; !isScalar || n < 2 || n > 4 {
+		return "", 0, false
+	}
+
+	return scalar, n, true
+}
+
+// matrixName splits a matrix type name, such as float4x3, into its scalar type
+// and number of columns and rows.
+func matrixName(name string) (scalar string, columns, rows int, ok bool) {
+	if len(name) < 4 || name[len(name)-2] != 'x' {
+		return "", 0, 0, false
+	}
+
+	scalar = name[:len(name)-3]
+	columns, rows = int(name[len(name)-3]-'0'), int(name[len(name)-1]-'0')
+
+	if (scalar != "float" && scalar != "half") || columns < 2 || columns > 4 || rows < 2 || rows > 4 {
+		return "", 0, 0, false
+	}
+
+	return scalar, columns, rows, true
+}
+
+// vectorSize returns the size of a vector of n components of the given size, which
+// is also its alignment.
+func vectorSize(size, n int) int {
+	if n == 3 {
+		return 4 * size
+	}
+
+	return n * size
+}
+
+func alignUp(v, align int) int {
+	return (v + align - 1) / align * align
+}
+
+// MismatchKind is the kind of a difference between a Go and an MSL layout.
+type MismatchKind uint8
+
+const (
+	// MismatchSize is a field or struct with different sizes.
+	MismatchSize MismatchKind = iota
+
+	// MismatchOffset is a field at different offsets.
+	MismatchOffset
+
+	// MismatchAlignment is a field at a Go offset that is not a multiple of the
+	// alignment of its MSL type.
+	MismatchAlignment
+
+	// MismatchStride is a struct with a Go size that is not a multiple of the MSL
+	// alignment, so arrays of the struct have different strides.
+	MismatchStride
+
+	// MismatchMissingInMSL is a Go field without an MSL field of its name.
+	MismatchMissingInMSL
+
+	// MismatchMissingInGo is an MSL field without a Go field of its name.
+	MismatchMissingInGo
+)
+
+// LayoutMismatch is a difference between the layout of a Go struct and an MSL struct.
+type LayoutMismatch struct {
+	Kind MismatchKind
+
+	// Field is the path of the MSL field, such as "lights[].color", or "" for the
+	// struct itself.
+	Field string
+
+	// GoField is the path of the Go field, such as "Lights[].Color".
+	GoField string
+
+	// Go and MSL are the compared values. For MismatchAlignment and MismatchStride,
+	// Go is the offset or size and MSL the alignment.
+	Go, MSL int
+}
+
+// String returns a description of the mismatch.
+func (m LayoutMismatch) String() string {
+	what := "size"
+	if m.Field != "" {
+		what = m.Field + ": " + what
+	}
+
+	switch m.Kind {
+	case MismatchOffset:
+		return fmt.Sprintf("%s: offset %d in Go, %d in MSL", m.Field, m.Go, m.MSL)
+	case MismatchAlignment:
+		return fmt.Sprintf("%s: offset %d in Go is not a multiple of the alignment %d in MSL", m.Field, m.Go, m.MSL)
+	case MismatchStride:
+		return fmt.Sprintf("%s %d in Go is not a multiple of the alignment %d in MSL", what, m.Go, m.MSL)
+	case MismatchMissingInMSL:
+		return fmt.Sprintf("%s: missing in MSL", m.GoField)
+	case MismatchMissingInGo:
+		return fmt.Sprintf("%s: missing in Go", m.Field)
+	}
+
+	return fmt.Sprintf("%s %d in Go, %d in MSL", what, m.Go, m.MSL)
+}
+
+// ValidateLayout compares the layout of the Go struct type t with the layout of
+// the MSL struct with the given name and returns the differences, which are empty
+// if values of t can be copied to buffers of the MSL struct. Fields are matched by
+// name using the msl tags of GenerateStructs, and nested structs are compared
+// field by field. Go fields named "_" or tagged `msl:"-"` and MSL fields whose
+// name starts with "_" are padding. A Go array of 3 components followed by at
+// least 4 bytes of padding matches a 3-component vector, such as float3.
+func ValidateLayout(t reflect.Type, m *Module, name string) ([]LayoutMismatch, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct type", t)
+	}
+
+	l, err := m.Layout(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []LayoutMismatch
+
+	m.validate(t, l, "", "", &mismatches)
+
+	return mismatches, nil
+}
+
+// validate appends the differences of the layouts of the Go type t and the MSL
+// struct l, whose fields have the path prefixes.
+func (m *Module) validate(t reflect.Type, l *Layout, prefix, goPrefix string, mismatches *[]LayoutMismatch) {
+	add := func(kind MismatchKind, field, goField string, goValue, mslValue int) {
+		*mismatches = append(*mismatches, LayoutMismatch{Kind: kind, Field: field, GoField: goField, Go: goValue, MSL: mslValue})
+	}
+
+	path, goPath := strings.TrimSuffix(prefix, "."), strings.TrimSuffix(goPrefix, ".")
+
+	if int(t.Size()) != l.Size {
+		add(MismatchSize, path, goPath, int(t.Size()), l.Size)
+	}
+
+	if int(t.Size())%l.Align != 0 {
+		add(MismatchStride, path, goPath, int(t.Size()), l.Align)
+	}
+
+	fields := map[string]FieldLayout{}
+	for _, f := range l.Fields {
+		fields[f.Name] = f
+	}
+
+	matched := map[string]bool{}
+
+	for i := 0; i < t.NumField(); i++ {
+		gf := t.Field(i)
+
+		name, _, _, skip := fieldTag(gf)
+		if skip || gf.Type.Size() == 0 {
+			continue
+		}
+
+		// The end of the field including the padding that follows it.
+		end := int(t.Size())
+
+		for j := i + 1; j < t.NumField(); j++ {
+			if _, _, _, pad := fieldTag(t.Field(j)); !pad && t.Field(j).Type.Size() > 0 {
+				end = int(t.Field(j).Offset)
+
+				break
+			}
+		}
+
+		field, goField := prefix+name, goPrefix+gf.Name
+
+		f, ok := fields[name]
+		if !ok {
+			add(MismatchMissingInMSL, field, goField, 0, 0)
+
+			continue
+		}
+
+		matched[name] = true
+
+		switch {
+		case int(gf.Offset)%f.Align != 0:
+			add(MismatchAlignment, field, goField, int(gf.Offset), f.Align)
+		case int(gf.Offset) != f.Offset:
+			add(MismatchOffset, field, goField, int(gf.Offset), f.Offset)
+		}
+
+		// A Go array of 3 components followed by padding matches a 3-component vector.
+		vector3 := gf.Type.Kind() == reflect.Array && gf.Type.Len() == 3 && isVector3(f.Type) && int(gf.Offset)+f.Size <= end
+
+		if int(gf.Type.Size()) != f.Size && !vector3 {
+			add(MismatchSize, field, goField, int(gf.Type.Size()), f.Size)
+		}
+
+		m.validateNested(gf.Type, f.Type, field, goField, mismatches)
+	}
+
+	for _, f := range l.Fields {
+		if !matched[f.Name] && !strings.HasPrefix(f.Name, "_") {
+			add(MismatchMissingInGo, prefix+f.Name, "", 0, 0)
+		}
+	}
+}
+
+// isVector3 reports whether t is an aligned vector of 3 components.
+func isVector3(t Type) bool {
+	_, n, ok := vectorName(t.Name)
+
+	return ok && n == 3 && !t.Pointer && len(t.Array) == 0
+}
+
+// validateNested compares the fields of the Go struct type and the MSL struct of
+// the fields, or of the elements of arrays of structs.
+func (m *Module) validateNested(goType reflect.Type, t Type, field, goField string, mismatches *[]LayoutMismatch) {
+	dims := len(t.Array)
+	for i := 0; i < dims && goType.Kind() == reflect.Array; i++ {
+		goType = goType.Elem()
+		field, goField = field+"[]", goField+"[]"
+	}
+
+	if goType.Kind() != reflect.Struct || t.Pointer {
+		return
+	}
+
+	if _, ok := m.Struct(t.Name); !ok {
+		return
+	}
+
+	l, err := m.Layout(t.Name)
+	if err != nil {
+		return
+	}
+
+	m.validate(goType, l, field+".", goField+".", mismatches)
+}
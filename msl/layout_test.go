@@ -0,0 +1,163 @@
+package msl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const layoutSource = `#include <metal_stdlib>
+using namespace metal;
+
+struct Light {
+	float3 color;
+	float intensity;
+};
+
+struct Scene {
+	float4x4 transform;
+	half3x3 normal;
+	packed_float3 origin;
+	Light lights[2];
+	char flag;
+	vec<uint, 2> size;
+	array<packed_half2, 3> offsets;
+	atomic_uint counter;
+	device float* data;
+};
+`
+
+func TestLayout(t *testing.T) {
+	m, err := Reflect(layoutSource)
+	require.NoError(t, err)
+
+	l, err := m.Layout("Light")
+	require.NoError(t, err)
+	require.Equal(t, &Layout{Name: "Light", Size: 32, Align: 16, Fields: []FieldLayout{
+		{Name: "color", Type: Type{Name: "float3"}, Offset: 0, Size: 16, Align: 16},
+		{Name: "intensity", Type: Type{Name: "float"}, Offset: 16, Size: 4, Align: 4},
+	}}, l)
+
+	l, err = m.Layout("Scene")
+	require.NoError(t, err)
+
+	type layout struct{ Offset, Size, Align int }
+
+	var fields []layout
+	for _, f := range l.Fields {
+		fields = append(fields, layout{f.Offset, f.Size, f.Align})
+	}
+
+	require.Equal(t, []layout{
+		{0, 64, 16},   // float4x4
+		{64, 24, 8},   // half3x3
+		{88, 12, 4},   // packed_float3
+		{112, 64, 16}, // Light[2]
+		{176, 1, 1},   // char
+		{184, 8, 8},   // uint2
+		{192, 12, 2},  // packed_half2[3]
+		{204, 4, 4},   // atomic_uint
+		{208, 8, 8},   // pointer
+	}, fields)
+	require.Equal(t, 224, l.Size)
+	require.Equal(t, 16, l.Align)
+
+	_, err = m.Layout("Missing")
+	require.EqualError(t, err, "struct Missing not found")
+
+	m, err = Reflect("struct A { texture2d<float> t; };")
+	require.NoError(t, err)
+
+	_, err = m.Layout("A")
+	require.EqualError(t, err, "1:29: field t of A: unsupported type texture2d")
+}
+
+func TestValidateLayout(t *testing.T) {
+	src, err := GenerateStructs([]any{testVertex{}, testUniforms{}}, func(o *StructOptions) {
+		o.TypeNamer = func(t reflect.Type) string { return t.Name()[len("test"):] }
+		o.StaticAssert = true
+	})
+	require.NoError(t, err)
+
+	m, err := Reflect(src)
+	require.NoError(t, err)
+
+	for name, v := range map[string]any{"Vertex": testVertex{}, "Uniforms": &testUniforms{}, "Light": testLight{}} {
+		mismatches, err := ValidateLayout(reflect.TypeOf(v), m, name)
+		require.NoError(t, err)
+		require.Empty(t, mismatches, name)
+	}
+
+	type light struct {
+		Color     [3]float32
+		Intensity float32
+	}
+
+	type scene struct {
+		Origin [3]float32
+		Lights [2]light
+		Extra  uint32
+	}
+
+	m, err = Reflect(`struct Light { float3 color; float intensity; };
+struct Scene { float3 origin; Light lights[2]; ushort flags; };`)
+	require.NoError(t, err)
+
+	mismatches, err := ValidateLayout(reflect.TypeOf(scene{}), m, "Scene")
+	require.NoError(t, err)
+
+	var msgs []string
+	for _, mm := range mismatches {
+		msgs = append(msgs, mm.String())
+	}
+
+	require.Equal(t, []string{
+		"size 48 in Go, 96 in MSL",
+		"origin: size 12 in Go, 16 in MSL",
+		"lights: offset 12 in Go is not a multiple of the alignment 16 in MSL",
+		"lights: size 32 in Go, 64 in MSL",
+		"lights[]: size 16 in Go, 32 in MSL",
+		"lights[].color: size 12 in Go, 16 in MSL",
+		"lights[].intensity: offset 12 in Go, 16 in MSL",
+		"Extra: missing in MSL",
+		"flags: missing in Go",
+	}, msgs)
+
+	require.Equal(t, LayoutMismatch{Kind: MismatchAlignment, Field: "lights", GoField: "Lights", Go: 12, MSL: 16}, mismatches[2])
+
+	type odd struct {
+		Position [4]float32
+		Weight   float32
+	}
+
+	m, err = Reflect("struct Odd { float4 position; float weight; float pad; };")
+	require.NoError(t, err)
+
+	mismatches, err = ValidateLayout(reflect.TypeOf(odd{}), m, "Odd")
+	require.NoError(t, err)
+	require.Equal(t, []LayoutMismatch{
+		{Kind: MismatchSize, Go: 20, MSL: 32},
+		{Kind: MismatchStride, Go: 20, MSL: 16},
+		{Kind: MismatchMissingInGo, Field: "pad"},
+	}, mismatches)
+	require.Equal(t, "size 20 in Go is not a multiple of the alignment 16 in MSL", mismatches[1].String())
+
+	// A Go array of 3 components followed by padding matches a float3.
+	type padded struct {
+		Normal [3]float32
+		_      float32
+		Weight float32
+		_      [3]float32
+	}
+
+	m, err = Reflect("struct Padded { float3 normal; float weight; };")
+	require.NoError(t, err)
+
+	mismatches, err = ValidateLayout(reflect.TypeOf(padded{}), m, "Padded")
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	_, err = ValidateLayout(reflect.TypeOf(1), m, "Odd")
+	require.EqualError(t, err, "int is not a struct type")
+}
@@ -0,0 +1,281 @@
+// Package msl is a front end for the Metal Shading Language written in pure Go.
+// It parses shader source, such as the source passed to Device.NewLibraryWithSource,
+// far enough to reflect the entry points and struct definitions, so that binding
+// indices and data layouts can be validated or generated without a Metal device.
+//
+// Reference: https://developer.apple.com/metal/Metal-Shading-Language-Specification.pdf
+package msl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in the source. Lines and columns start at 1.
+type Pos struct {
+	Line, Column int
+}
+
+// String returns the position as line:column.
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// TokenKind is the kind of a token.
+type TokenKind uint8
+
+const (
+	// TokenEOF marks the end of the source.
+	TokenEOF TokenKind = iota
+
+	// TokenIdent is an identifier or keyword.
+	TokenIdent
+
+	// TokenNumber is an integer or floating-point literal, including its suffix.
+	TokenNumber
+
+	// TokenString is a string literal, including its quotes.
+	TokenString
+
+	// TokenChar is a character literal, including its quotes.
+	TokenChar
+
+	// TokenPunct is an operator or punctuator. Only "::", "->" and "..." are
+	// returned as multi-character tokens, so that nested template argument lists
+	// and attribute brackets always close with single characters.
+	TokenPunct
+)
+
+// Token is a lexical token of the source.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  Pos
+}
+
+// SyntaxError is an error in the source at a position.
+type SyntaxError struct {
+	Pos Pos
+	Msg string
+}
+
+// Error implements the error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Lex splits the source into tokens, ending with a TokenEOF token. Comments and
+// preprocessor directives are skipped.
+func Lex(src string) ([]Token, error) {
+	l := lexer{src: src, line: 1, col: 1}
+
+	var toks []Token
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		toks = append(toks, tok)
+
+		if tok.Kind == TokenEOF {
+			return toks, nil
+		}
+	}
+}
+
+// lexer scans the source byte by byte and tracks the position.
+type lexer struct {
+	src       string
+	off       int
+	line, col int
+
+	// lineStart reports that only whitespace precedes the offset on its line,
+	// where a '#' starts a preprocessor directive.
+	lineStart bool
+}
+
+// next returns the next token.
+func (l *lexer) next() (Token, error) {
+	if l.off == 0 {
+		l.lineStart = true
+	}
+
+	if err := l.skipSpace(); err != nil {
+		return Token{}, err
+	}
+
+	pos := Pos{l.line, l.col}
+	start := l.off
+
+	if l.off >= len(l.src) {
+		return Token{Kind: TokenEOF, Pos: pos}, nil
+	}
+
+	c := l.src[l.off]
+
+	var kind TokenKind
+
+	switch {
+	case isIdentStart(c):
+		kind = TokenIdent
+		for l.off < len(l.src) && isIdentPart(l.src[l.off]) {
+			l.advance()
+		}
+	case isDigit(c) || c == '.' && l.off+1 < len(l.src) && isDigit(l.src[l.off+1]):
+		kind = TokenNumber
+		l.scanNumber()
+	case c == '"' || c == '\'':
+		kind = TokenString
+		if c == '\'' {
+			kind = TokenChar
+		}
+
+		if err := l.scanQuoted(c); err != nil {
+			return Token{}, err
+		}
+	default:
+		kind = TokenPunct
+
+		n := 1
+
+		for _, p := range []string{"::", "->", "..."} {
+			if strings.HasPrefix(l.src[l.off:], p) {
+				n = len(p)
+				break
+			}
+		}
+
+		for i := 0; i < n; i++ {
+			l.advance()
+		}
+	}
+
+	return Token{Kind: kind, Text: l.src[start:l.off], Pos: pos}, nil
+}
+
+// skipSpace skips whitespace, comments and preprocessor directives.
+func (l *lexer) skipSpace() error {
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+
+		switch {
+		case c == '\n':
+			l.advance()
+			l.lineStart = true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.advance()
+		case c == '\\' && strings.HasPrefix(l.src[l.off+1:], "\n"):
+			l.advance()
+			l.advance()
+		case c == '#' && l.lineStart:
+			// Skip the directive up to the next line that is not continued.
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				if l.src[l.off] == '\\' && strings.HasPrefix(l.src[l.off+1:], "\n") {
+					l.advance()
+				}
+
+				l.advance()
+			}
+		case strings.HasPrefix(l.src[l.off:], "//"):
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				l.advance()
+			}
+		case strings.HasPrefix(l.src[l.off:], "/*"):
+			pos := Pos{l.line, l.col}
+
+			end := strings.Index(l.src[l.off+2:], "*/")
+			if end < 0 {
+				return &SyntaxError{Pos: pos, Msg: "unterminated comment"}
+			}
+
+			for n := end + 4; n > 0; n-- {
+				l.advance()
+			}
+		default:
+			l.lineStart = false
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// scanNumber scans a numeric literal with its exponent and suffix.
+func (l *lexer) scanNumber() {
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+
+		switch {
+		case isIdentPart(c) || c == '.':
+			l.advance()
+		case (c == '+' || c == '-') && strings.ContainsRune("eEpP", rune(l.src[l.off-1])) && !isHexPrefix(l.src, l.off):
+			l.advance()
+		default:
+			return
+		}
+	}
+}
+
+// scanQuoted scans a string or character literal delimited by quote.
+func (l *lexer) scanQuoted(quote byte) error {
+	pos := Pos{l.line, l.col}
+
+	l.advance()
+
+	for l.off < len(l.src) {
+		switch l.src[l.off] {
+		case '\\':
+			l.advance()
+		case '\n':
+			return &SyntaxError{Pos: pos, Msg: "unterminated literal"}
+		case quote:
+			l.advance()
+			return nil
+		}
+
+		if l.off < len(l.src) {
+			l.advance()
+		}
+	}
+
+	return &SyntaxError{Pos: pos, Msg: "unterminated literal"}
+}
+
+// advance moves past the current byte.
+func (l *lexer) advance() {
+	if l.src[l.off] == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+
+	l.off++
+}
+
+// isHexPrefix reports whether the number that contains src[off] is a hexadecimal
+// integer, where 'e' is a digit rather than an exponent.
+func isHexPrefix(src string, off int) bool {
+	start := off
+	for start > 0 && (isIdentPart(src[start-1]) || src[start-1] == '.') {
+		start--
+	}
+
+	s := strings.ToLower(src[start:off])
+
+	return strings.HasPrefix(s, "0x") && !strings.ContainsRune(s, 'p')
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
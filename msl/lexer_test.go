@@ -0,0 +1,51 @@
+package msl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLex(t *testing.T) {
+	src := `#include <metal_stdlib>
+#define LONG \
+	continued
+using namespace metal; // comment
+/* block
+   comment */ float x = 1.5e-3f + 0x1e+2 - .5h;
+buf[[buffer(0)]] a::b->c "s\"t" 'c'`
+
+	toks, err := Lex(src)
+	require.NoError(t, err)
+
+	var texts []string
+	for _, tok := range toks {
+		texts = append(texts, tok.Text)
+	}
+
+	require.Equal(t, []string{
+		"using", "namespace", "metal", ";",
+		"float", "x", "=", "1.5e-3f", "+", "0x1e", "+", "2", "-", ".5h", ";",
+		"buf", "[", "[", "buffer", "(", "0", ")", "]", "]", "a", "::", "b", "->", "c", `"s\"t"`, "'c'", "",
+	}, texts)
+
+	require.Equal(t, Pos{4, 1}, toks[0].Pos)
+	require.Equal(t, Pos{6, 15}, toks[4].Pos)
+	require.Equal(t, TokenNumber, toks[7].Kind)
+	require.Equal(t, TokenString, toks[29].Kind)
+	require.Equal(t, TokenChar, toks[30].Kind)
+	require.Equal(t, TokenEOF, toks[31].Kind)
+
+	// A '#' that does not start a line is an ordinary token.
+	toks, err = Lex("a # b")
+	require.NoError(t, err)
+	require.Len(t, toks, 4)
+}
+
+func TestLexErrors(t *testing.T) {
+	_, err := Lex("a /* b")
+	require.EqualError(t, err, "1:3: unterminated comment")
+
+	_, err = Lex("\n  \"abc\n")
+	require.EqualError(t, err, "2:3: unterminated literal")
+}
@@ -0,0 +1,295 @@
+package msl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ProgramSource is the file name of source compiled with NewLibraryWithSource in
+// compiler diagnostics.
+const ProgramSource = "program_source"
+
+// SourceLocation is a line of an original source file.
+type SourceLocation struct {
+	File string
+	Line int
+}
+
+// SourceMap maps the lines of a preprocessed source back to the files and lines
+// they were read from.
+type SourceMap struct {
+	lines []SourceLocation
+}
+
+// Location returns the original location of a line of the preprocessed source.
+// Lines start at 1.
+func (m *SourceMap) Location(line int) (SourceLocation, bool) {
+	if line < 1 || line > len(m.lines) {
+		return SourceLocation{}, false
+	}
+
+	return m.lines[line-1], true
+}
+
+// MapDiagnostics returns the diagnostics of the preprocessed source, such as the
+// diagnostics of a CompileError, with the positions of ProgramSource mapped back
+// to the original files. Diagnostics of other files are returned unchanged.
+func (m *SourceMap) MapDiagnostics(diags []Diagnostic) []Diagnostic {
+	if diags == nil {
+		return nil
+	}
+
+	mapped := make([]Diagnostic, len(diags))
+
+	for i, d := range diags {
+		if d.File == ProgramSource {
+			if loc, ok := m.Location(d.Pos.Line); ok {
+				d.File, d.Pos.Line = loc.File, loc.Line
+			}
+
+			fixIts := append([]FixIt(nil), d.FixIts...)
+			for j, f := range fixIts {
+				if loc, ok := m.Location(f.Pos.Line); ok {
+					f.Pos.Line = loc.Line
+				}
+
+				if loc, ok := m.Location(f.End.Line); ok {
+					f.End.Line = loc.Line
+				}
+
+				fixIts[j] = f
+			}
+
+			d.FixIts = fixIts
+		}
+
+		d.Notes = m.MapDiagnostics(d.Notes)
+		mapped[i] = d
+	}
+
+	return mapped
+}
+
+// PreprocessOptions configures Preprocess.
+type PreprocessOptions struct {
+	// IncludeDirs holds the directories of the file system that are searched for
+	// included files that are not found relative to the including file.
+	IncludeDirs []string
+}
+
+var (
+	includePattern = regexp.MustCompile(`^\s*#\s*include\s*"([^"]+)"`)
+	pragmaOnce     = regexp.MustCompile(`^\s*#\s*pragma\s+once\b`)
+	guardStart     = regexp.MustCompile(`^\s*#\s*(?:ifndef\s+(\w+)|if\s+!\s*defined\s*\(?\s*(\w+)\s*\)?)\s*$`)
+	guardDefine    = regexp.MustCompile(`^\s*#\s*define\s+(\w+)(?:\s.*)?$`)
+	guardEnd       = regexp.MustCompile(`^\s*#\s*endif\b`)
+	conditional    = regexp.MustCompile(`^\s*#\s*if`)
+)
+
+// Preprocess returns the source of the file name in fsys with its quoted #include
+// directives replaced by the included files, and the map from the lines of the
+// result to the original files. The result can be passed to NewLibraryWithSource.
+//
+// Included files are resolved relative to the including file first, then in the
+// include directories. Files with #pragma once and files whose content is wrapped
+// in an include guard are included only once. Angle bracket includes such as
+// <metal_stdlib> and all other directives are left to the compiler, so includes
+// inside conditional directives are expanded unconditionally.
+func Preprocess(fsys fs.FS, name string, optFns ...func(*PreprocessOptions)) (string, *SourceMap, error) {
+	opts := PreprocessOptions{
+		IncludeDirs: nil,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	pp := preprocessor{
+		fsys:    fsys,
+		opts:    opts,
+		once:    map[string]bool{},
+		guards:  map[string]string{},
+		defined: map[string]bool{},
+		sm:      &SourceMap{},
+	}
+
+	if err := pp.include(path.Clean(name)); err != nil {
+		return "", nil, err
+	}
+
+	return pp.out.String(), pp.sm, nil
+}
+
+// preprocessor holds the state of Preprocess.
+type preprocessor struct {
+	fsys fs.FS
+	opts PreprocessOptions
+	out  strings.Builder
+	sm   *SourceMap
+
+	// stack holds the files that are being included, to detect cycles.
+	stack []string
+
+	// once holds the files with #pragma once that were included.
+	once map[string]bool
+
+	// guards maps the files with an include guard to its macro, and defined
+	// holds the macros of the guards that were included.
+	guards  map[string]string
+	defined map[string]bool
+}
+
+// include appends the file to the output, expanding its includes.
+func (pp *preprocessor) include(name string) error {
+	if pp.once[name] || pp.guarded(name) {
+		return nil
+	}
+
+	for i, s := range pp.stack {
+		if s == name {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(pp.stack[i:], name), " -> "))
+		}
+	}
+
+	data, err := fs.ReadFile(pp.fsys, name)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if macro := includeGuard(lines); macro != "" {
+		pp.guards[name] = macro
+		pp.defined[macro] = true
+	}
+
+	pp.stack = append(pp.stack, name)
+	defer func() { pp.stack = pp.stack[:len(pp.stack)-1] }()
+
+	for i, line := range lines {
+		if pragmaOnce.MatchString(line) {
+			pp.once[name] = true
+			continue
+		}
+
+		if m := includePattern.FindStringSubmatch(line); m != nil {
+			target, err := pp.resolve(name, m[1])
+			if err != nil {
+				return fmt.Errorf("%s:%d: cannot include %q: %w", name, i+1, m[1], err)
+			}
+
+			if err := pp.include(target); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		pp.out.WriteString(line + "\n")
+		pp.sm.lines = append(pp.sm.lines, SourceLocation{File: name, Line: i + 1})
+	}
+
+	return nil
+}
+
+// guarded reports whether the file has an include guard whose macro is defined.
+func (pp *preprocessor) guarded(name string) bool {
+	macro, ok := pp.guards[name]
+
+	return ok && pp.defined[macro]
+}
+
+// resolve returns the path of the file included with the given name from the file from.
+func (pp *preprocessor) resolve(from, name string) (string, error) {
+	candidates := []string{path.Join(path.Dir(from), name)}
+	for _, dir := range pp.opts.IncludeDirs {
+		candidates = append(candidates, path.Join(dir, name))
+	}
+
+	for _, c := range candidates {
+		if !fs.ValidPath(c) {
+			continue
+		}
+
+		if _, err := fs.Stat(pp.fsys, c); err == nil {
+			return c, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fs.ErrNotExist
+}
+
+// includeGuard returns the macro of the include guard that wraps the lines, or ""
+// if there is none.
+func includeGuard(lines []string) string {
+	var code []string
+
+	inComment := false
+
+	for _, l := range lines {
+		s := strings.TrimSpace(l)
+
+		if inComment {
+			end := strings.Index(s, "*/")
+			if end < 0 {
+				continue
+			}
+
+			inComment = false
+			s = strings.TrimSpace(s[end+2:])
+		}
+
+		if strings.HasPrefix(s, "/*") && !strings.Contains(s, "*/") {
+			inComment = true
+			continue
+		}
+
+		if s == "" || strings.HasPrefix(s, "//") {
+			continue
+		}
+
+		code = append(code, l)
+	}
+
+	if len(code) < 3 || !guardEnd.MatchString(code[len(code)-1]) {
+		return ""
+	}
+
+	m := guardStart.FindStringSubmatch(code[0])
+	if m == nil {
+		return ""
+	}
+
+	macro := m[1] + m[2]
+
+	if d := guardDefine.FindStringSubmatch(code[1]); d == nil || d[1] != macro {
+		return ""
+	}
+
+	// The #endif must close the #ifndef rather than a nested conditional.
+	depth := 0
+
+	for i, l := range code {
+		switch {
+		case conditional.MatchString(l):
+			depth++
+		case guardEnd.MatchString(l):
+			depth--
+
+			if depth == 0 && i < len(code)-1 {
+				return ""
+			}
+		}
+	}
+
+	return macro
+}
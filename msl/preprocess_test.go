@@ -0,0 +1,126 @@
+package msl
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"shaders/main.metal": {Data: []byte(`#include <metal_stdlib>
+#include "common.h"
+#include "lib/math.h"
+#include "common.h"
+
+kernel void k() {}
+`)},
+	"shaders/common.h": {Data: []byte(`// Shared definitions.
+#ifndef COMMON_H
+#define COMMON_H
+#if defined(FAST)
+#define SCALE 2
+#endif
+constant float scale = 1;
+#endif
+`)},
+	"shaders/lib/math.h": {Data: []byte(`#pragma once
+#include "util.h"
+float square(float x) { return x * x; }
+`)},
+	"include/util.h": {Data: []byte("#pragma once\r\nfloat twice(float x) { return 2 * x; }\r\n")},
+	"cycle/a.h":      {Data: []byte("#include \"b.h\"\n")},
+	"cycle/b.h":      {Data: []byte("// b\n#include \"a.h\"\n")},
+	"missing.metal":  {Data: []byte("\n#include \"nope.h\"\n")},
+}
+
+func TestPreprocess(t *testing.T) {
+	src, sm, err := Preprocess(testFS, "shaders/main.metal", func(o *PreprocessOptions) {
+		o.IncludeDirs = []string{"include"}
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, `#include <metal_stdlib>
+// Shared definitions.
+#ifndef COMMON_H
+#define COMMON_H
+#if defined(FAST)
+#define SCALE 2
+#endif
+constant float scale = 1;
+#endif
+float twice(float x) { return 2 * x; }
+float square(float x) { return x * x; }
+
+kernel void k() {}
+`, src)
+
+	for line, want := range map[int]SourceLocation{
+		1:  {"shaders/main.metal", 1},
+		2:  {"shaders/common.h", 1},
+		8:  {"shaders/common.h", 7},
+		10: {"include/util.h", 2},
+		11: {"shaders/lib/math.h", 3},
+		13: {"shaders/main.metal", 6},
+	} {
+		loc, ok := sm.Location(line)
+		require.True(t, ok)
+		require.Equal(t, want, loc, "line %d", line)
+	}
+
+	_, ok := sm.Location(14)
+	require.False(t, ok)
+
+	_, ok = sm.Location(0)
+	require.False(t, ok)
+}
+
+func TestPreprocessErrors(t *testing.T) {
+	_, _, err := Preprocess(testFS, "cycle/a.h")
+	require.EqualError(t, err, "include cycle: cycle/a.h -> cycle/b.h -> cycle/a.h")
+
+	_, _, err = Preprocess(testFS, "missing.metal")
+	require.EqualError(t, err, `missing.metal:2: cannot include "nope.h": file does not exist`)
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, _, err = Preprocess(testFS, "nope.metal")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestIncludeGuard(t *testing.T) {
+	require.Equal(t, "A", includeGuard([]string{"/* header", " */", "#if !defined(A)", "#define A 1", "#endif", ""}))
+	require.Empty(t, includeGuard([]string{"#ifndef A", "#define A", "#endif", "float x;"}))
+	require.Empty(t, includeGuard([]string{"#ifndef A", "#define B", "#endif"}))
+	require.Empty(t, includeGuard([]string{"#ifndef A", "#define A", "#endif", "#ifdef C", "#endif"}))
+}
+
+func TestMapDiagnostics(t *testing.T) {
+	_, sm, err := Preprocess(testFS, "shaders/main.metal", func(o *PreprocessOptions) {
+		o.IncludeDirs = []string{"include"}
+	})
+	require.NoError(t, err)
+
+	diags := sm.MapDiagnostics([]Diagnostic{{
+		File:   ProgramSource,
+		Pos:    Pos{8, 16},
+		FixIts: []FixIt{{Pos: Pos{8, 16}, End: Pos{8, 21}, Replacement: "s"}},
+		Notes: []Diagnostic{
+			{File: ProgramSource, Pos: Pos{11, 7}, Severity: SeverityNote},
+			{File: "/usr/include/metal_stdlib", Pos: Pos{10, 3}, Severity: SeverityNote},
+		},
+	}, {
+		File: ProgramSource,
+		Pos:  Pos{99, 1},
+	}})
+
+	require.Equal(t, "shaders/common.h", diags[0].File)
+	require.Equal(t, Pos{7, 16}, diags[0].Pos)
+	require.Equal(t, []FixIt{{Pos: Pos{7, 16}, End: Pos{7, 21}, Replacement: "s"}}, diags[0].FixIts)
+	require.Equal(t, "shaders/lib/math.h", diags[0].Notes[0].File)
+	require.Equal(t, Pos{3, 7}, diags[0].Notes[0].Pos)
+	require.Equal(t, "/usr/include/metal_stdlib", diags[0].Notes[1].File)
+	require.Equal(t, Pos{10, 3}, diags[0].Notes[1].Pos)
+	require.Equal(t, Diagnostic{File: ProgramSource, Pos: Pos{99, 1}}, diags[1])
+}
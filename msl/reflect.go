@@ -0,0 +1,1186 @@
+package msl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FunctionKind is the kind of an entry point.
+type FunctionKind uint8
+
+const (
+	// FunctionKindKernel is a compute function declared with kernel or [[kernel]].
+	FunctionKindKernel FunctionKind = iota + 1
+
+	// FunctionKindVertex is a vertex function declared with vertex or [[vertex]].
+	FunctionKindVertex
+
+	// FunctionKindFragment is a fragment function declared with fragment or [[fragment]].
+	FunctionKindFragment
+)
+
+// AddressSpace is the address space of a pointer or reference.
+type AddressSpace uint8
+
+const (
+	// AddressSpaceNone is used for values that are not pointers or references.
+	AddressSpaceNone AddressSpace = iota
+
+	// AddressSpaceDevice is device memory, readable and writable by all threads.
+	AddressSpaceDevice
+
+	// AddressSpaceConstant is read-only memory shared by all threads.
+	AddressSpaceConstant
+
+	// AddressSpaceThreadgroup is memory shared by the threads of a threadgroup.
+	AddressSpaceThreadgroup
+
+	// AddressSpaceThread is memory private to a thread.
+	AddressSpaceThread
+)
+
+// addressSpaces maps the address space keywords to their values.
+var addressSpaces = map[string]AddressSpace{
+	"device":      AddressSpaceDevice,
+	"constant":    AddressSpaceConstant,
+	"threadgroup": AddressSpaceThreadgroup,
+	"thread":      AddressSpaceThread,
+}
+
+// addressSpaceNames holds the keywords of the address spaces.
+var addressSpaceNames = [...]string{"", "device", "constant", "threadgroup", "thread"}
+
+// Access is how a function accesses a buffer or texture argument.
+type Access uint8
+
+const (
+	// AccessNone is used for arguments that are neither buffers nor textures.
+	AccessNone Access = iota
+
+	// AccessSample is the default access of textures, which are sampled or read.
+	AccessSample
+
+	// AccessRead is read-only access, as for access::read textures and const or
+	// constant pointers.
+	AccessRead
+
+	// AccessWrite is write-only access, as for access::write textures.
+	AccessWrite
+
+	// AccessReadWrite is read and write access, as for access::read_write textures
+	// and non-const device pointers.
+	AccessReadWrite
+)
+
+// BindingKind is the kind of resource or value bound to an argument.
+type BindingKind uint8
+
+const (
+	// BindingNone is used for arguments without a binding attribute.
+	BindingNone BindingKind = iota
+
+	// BindingBuffer is a buffer bound with [[buffer(n)]].
+	BindingBuffer
+
+	// BindingTexture is a texture bound with [[texture(n)]].
+	BindingTexture
+
+	// BindingSampler is a sampler bound with [[sampler(n)]].
+	BindingSampler
+
+	// BindingThreadgroup is threadgroup memory bound with [[threadgroup(n)]].
+	BindingThreadgroup
+
+	// BindingStageIn is the per-vertex or per-fragment input marked with [[stage_in]].
+	BindingStageIn
+
+	// BindingBuiltin is a value provided by Metal, such as [[thread_position_in_grid]].
+	BindingBuiltin
+)
+
+// indexedBindings maps the attributes that bind resources by index to their kind.
+var indexedBindings = map[string]BindingKind{
+	"buffer":      BindingBuffer,
+	"texture":     BindingTexture,
+	"sampler":     BindingSampler,
+	"threadgroup": BindingThreadgroup,
+}
+
+// builtins holds the attributes of the built-in input values of entry points.
+var builtins = map[string]bool{
+	"amplification_count":                 true,
+	"amplification_id":                    true,
+	"barycentric_coord":                   true,
+	"base_instance":                       true,
+	"base_vertex":                         true,
+	"dispatch_quadgroups_per_threadgroup": true,
+	"dispatch_simdgroups_per_threadgroup": true,
+	"dispatch_threads_per_threadgroup":    true,
+	"front_facing":                        true,
+	"grid_origin":                         true,
+	"grid_size":                           true,
+	"instance_id":                         true,
+	"patch_id":                            true,
+	"point_coord":                         true,
+	"position":                            true,
+	"position_in_patch":                   true,
+	"primitive_id":                        true,
+	"quadgroup_index_in_threadgroup":      true,
+	"quadgroups_per_threadgroup":          true,
+	"render_target_array_index":           true,
+	"sample_id":                           true,
+	"sample_mask":                         true,
+	"simdgroup_index_in_threadgroup":      true,
+	"simdgroups_per_threadgroup":          true,
+	"thread_execution_width":              true,
+	"thread_index_in_quadgroup":           true,
+	"thread_index_in_simdgroup":           true,
+	"thread_index_in_threadgroup":         true,
+	"thread_position_in_grid":             true,
+	"thread_position_in_threadgroup":      true,
+	"threadgroup_position_in_grid":        true,
+	"threadgroups_per_grid":               true,
+	"threads_per_grid":                    true,
+	"threads_per_simdgroup":               true,
+	"threads_per_threadgroup":             true,
+	"vertex_id":                           true,
+	"viewport_array_index":                true,
+}
+
+// Attribute is an attribute in double brackets, such as [[buffer(0)]].
+type Attribute struct {
+	// Name is the attribute name without namespace, such as "buffer".
+	Name string
+
+	// Args holds the source text of the comma-separated arguments.
+	Args []string
+}
+
+// Binding is the resource or value an argument is bound to.
+type Binding struct {
+	// Kind is the kind of the binding: BindingNone, BindingBuffer, BindingTexture,
+	// BindingSampler, BindingThreadgroup, BindingStageIn or BindingBuiltin.
+	Kind BindingKind
+
+	// Index is the index of buffer, texture, sampler and threadgroup bindings.
+	// It is -1 if the index is neither an integer literal nor a known integer
+	// constant or macro, whose text is kept in the arguments of the attribute.
+	Index int
+
+	// Builtin is the attribute name of built-in values, such as "vertex_id".
+	Builtin string
+}
+
+// Type is a type as written in the source.
+type Type struct {
+	// Name is the type name without the metal namespace, such as "float4",
+	// "texture2d" or the name of a user struct.
+	Name string
+
+	// Args holds the source text of the template arguments, such as "float"
+	// and "access::read" of texture2d<float, access::read>.
+	Args []string
+
+	// AddressSpace is the address space of pointers and references.
+	AddressSpace AddressSpace
+
+	// Const reports whether the pointed-to or referenced data is const.
+	Const bool
+
+	// Pointer and Reference report whether the type is a pointer or a reference.
+	Pointer, Reference bool
+
+	// Array holds the lengths of the array dimensions of the declarator, as in
+	// float values[4].
+	Array []int
+}
+
+// String returns the type in MSL syntax.
+func (t Type) String() string {
+	var sb strings.Builder
+
+	if t.AddressSpace != AddressSpaceNone {
+		sb.WriteString(addressSpaceNames[t.AddressSpace] + " ")
+	}
+
+	if t.Const {
+		sb.WriteString("const ")
+	}
+
+	sb.WriteString(t.Name)
+
+	if len(t.Args) > 0 {
+		sb.WriteString("<" + strings.Join(t.Args, ", ") + ">")
+	}
+
+	if t.Pointer {
+		sb.WriteString("*")
+	} else if t.Reference {
+		sb.WriteString("&")
+	}
+
+	for _, n := range t.Array {
+		sb.WriteString("[" + strconv.Itoa(n) + "]")
+	}
+
+	return sb.String()
+}
+
+// IsTexture reports whether the type is a texture or depth texture.
+func (t Type) IsTexture() bool {
+	return strings.HasPrefix(t.Name, "texture") || strings.HasPrefix(t.Name, "depth")
+}
+
+// Parameter is a parameter of an entry point.
+type Parameter struct {
+	Name       string
+	Type       Type
+	Attributes []Attribute
+	Binding    Binding
+	Access     Access
+	Pos        Pos
+}
+
+// Function is an entry point.
+type Function struct {
+	Kind       FunctionKind
+	Name       string
+	ReturnType Type
+	Parameters []Parameter
+
+	// Attributes holds the attributes of the function, such as
+	// [[max_total_threads_per_threadgroup(64)]], without the one that declares its kind.
+	Attributes []Attribute
+	Pos        Pos
+}
+
+// Bindings returns the parameters with the given binding kind in source order.
+func (f *Function) Bindings(kind BindingKind) []Parameter {
+	var params []Parameter
+
+	for _, p := range f.Parameters {
+		if p.Binding.Kind == kind {
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// Field is a data member of a struct.
+type Field struct {
+	Name       string
+	Type       Type
+	Attributes []Attribute
+	Pos        Pos
+}
+
+// Struct is a user struct definition.
+type Struct struct {
+	Name   string
+	Fields []Field
+	Pos    Pos
+}
+
+// Module is the reflection of a shader source.
+type Module struct {
+	Functions []Function
+	Structs   []Struct
+}
+
+// Function returns the entry point with the given name.
+func (m *Module) Function(name string) (*Function, bool) {
+	for i := range m.Functions {
+		if m.Functions[i].Name == name {
+			return &m.Functions[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Struct returns the struct with the given name.
+func (m *Module) Struct(name string) (*Struct, bool) {
+	for i := range m.Structs {
+		if m.Structs[i].Name == name {
+			return &m.Structs[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// integerMacro matches the definition of an object-like macro with a single token,
+// such as "#define N 4".
+var integerMacro = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*define[ \t]+(\w+)[ \t]+(\w+)[ \t]*$`)
+
+// Reflect parses the source and returns its entry points and struct definitions.
+// Function bodies and other declarations are skipped, so the source is not fully
+// validated. Preprocessor directives are ignored, except for macros defined as
+// integers, which are resolved like integer constants.
+func Reflect(src string) (*Module, error) {
+	toks, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{toks: toks, constants: map[string]int{}}
+
+	for _, m := range integerMacro.FindAllStringSubmatch(src, -1) {
+		if n, err := p.intValue(m[2]); err == nil {
+			p.constants[m[1]] = n
+		}
+	}
+
+	return p.module()
+}
+
+// parser is a recursive descent parser over the tokens of a source.
+type parser struct {
+	toks []Token
+	pos  int
+
+	// constants holds the integer constants declared at namespace scope and the
+	// macros defined as integers, which may be used as array lengths and indices.
+	constants map[string]int
+}
+
+// module parses declarations up to the end of the source.
+func (p *parser) module() (*Module, error) {
+	m := &Module{}
+	depth := 0
+
+	for p.peek().Kind != TokenEOF {
+		t := p.peek()
+
+		switch {
+		case t.Text == ";":
+			p.next()
+		case t.Text == "}" && depth > 0:
+			p.next()
+			depth--
+		case t.Text == "namespace":
+			// Descend into the namespace, whose name does not matter for reflection.
+			for p.peek().Text != "{" && p.peek().Text != ";" && p.peek().Kind != TokenEOF {
+				p.next()
+			}
+
+			if p.accept("{") {
+				depth++
+			}
+		case t.Text == "template":
+			p.next()
+
+			if err := p.skipAngles(); err != nil {
+				return nil, err
+			}
+
+			if err := p.skipDeclaration(); err != nil {
+				return nil, err
+			}
+		case t.Text == "using" || t.Text == "typedef" || t.Text == "static_assert" || t.Text == "enum":
+			if err := p.skipDeclaration(); err != nil {
+				return nil, err
+			}
+		case (t.Text == "struct" || t.Text == "class") && p.peekAt(1).Kind == TokenIdent && p.peekAt(2).Text == "{":
+			s, err := p.structDef()
+			if err != nil {
+				return nil, err
+			}
+
+			m.Structs = append(m.Structs, s)
+		default:
+			f, ok, err := p.declaration()
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				m.Functions = append(m.Functions, f)
+			}
+		}
+	}
+
+	if depth > 0 {
+		return nil, p.errorf(p.peek(), "expected }")
+	}
+
+	return m, nil
+}
+
+// structDef parses a struct definition. Member functions and nested declarations
+// are skipped.
+func (p *parser) structDef() (Struct, error) {
+	p.next()
+
+	name := p.next()
+	s := Struct{Name: name.Text, Pos: name.Pos}
+
+	p.next()
+
+	for !p.accept("}") {
+		if p.peek().Kind == TokenEOF {
+			return Struct{}, p.errorf(p.peek(), "expected }")
+		}
+
+		if p.accept(";") {
+			continue
+		}
+
+		switch p.peek().Text {
+		case "static", "using", "typedef", "template", "struct", "class", "enum", "friend", "public", "private", "protected":
+			if err := p.skipMember(); err != nil {
+				return Struct{}, err
+			}
+
+			continue
+		}
+
+		fields, err := p.fieldDeclaration()
+		if err != nil {
+			return Struct{}, err
+		}
+
+		s.Fields = append(s.Fields, fields...)
+	}
+
+	// Skip declarators that follow the definition.
+	if err := p.skipDeclaration(); err != nil {
+		return Struct{}, err
+	}
+
+	return s, nil
+}
+
+// fieldDeclaration parses a declaration of one or more fields. A member function
+// is skipped and returns no fields.
+func (p *parser) fieldDeclaration() ([]Field, error) {
+	start := p.pos
+
+	base, err := p.typeSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []Field
+
+	for {
+		t := base
+		p.ptrOperators(&t)
+
+		name := p.next()
+		if name.Kind != TokenIdent {
+			// Constructors and operators are not fields.
+			p.pos = start
+			return nil, p.skipMember()
+		}
+
+		if p.peek().Text == "(" || name.Text == "operator" {
+			p.pos = start
+			return nil, p.skipMember()
+		}
+
+		if err := p.arrayDims(&t); err != nil {
+			return nil, err
+		}
+
+		attrs, err := p.attributes()
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip default member initializers.
+		if p.peek().Text == "=" || p.peek().Text == "{" {
+			if err := p.skipUntil(",", ";"); err != nil {
+				return nil, err
+			}
+		}
+
+		fields = append(fields, Field{Name: name.Text, Type: t, Attributes: attrs, Pos: name.Pos})
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// declaration parses a declaration at namespace scope and returns the entry point
+// it declares, if any. Other declarations are skipped.
+func (p *parser) declaration() (Function, bool, error) {
+	start := p.pos
+
+	attrs, err := p.attributes()
+	if err != nil {
+		return Function{}, false, err
+	}
+
+	var kind FunctionKind
+
+	kinds := map[string]FunctionKind{"kernel": FunctionKindKernel, "vertex": FunctionKindVertex, "fragment": FunctionKindFragment}
+
+	for i := 0; i < len(attrs); i++ {
+		if k, ok := kinds[attrs[i].Name]; ok {
+			kind = k
+			attrs = append(attrs[:i], attrs[i+1:]...)
+			i--
+		}
+	}
+
+	for {
+		t := p.peek()
+
+		// A single [ does not start attributes, and attributes() would not consume it.
+		attr := t.Text == "[" && p.peekAt(1).Text == "["
+
+		if k, ok := kinds[t.Text]; ok {
+			kind = k
+		} else if t.Text != "static" && t.Text != "inline" && t.Text != "extern" && !attr {
+			break
+		}
+
+		if attr {
+			more, err := p.attributes()
+			if err != nil {
+				return Function{}, false, err
+			}
+
+			attrs = append(attrs, more...)
+
+			continue
+		}
+
+		p.next()
+	}
+
+	if p.peek().Text == "constant" || p.peek().Text == "constexpr" {
+		p.constant()
+	}
+
+	if kind == 0 {
+		p.pos = start
+		return Function{}, false, p.skipDeclaration()
+	}
+
+	ret, err := p.typeSpec()
+	if err != nil {
+		return Function{}, false, err
+	}
+
+	p.ptrOperators(&ret)
+
+	name := p.next()
+	if name.Kind != TokenIdent {
+		return Function{}, false, p.errorf(name, "expected function name")
+	}
+
+	f := Function{Kind: kind, Name: name.Text, ReturnType: ret, Pos: name.Pos}
+
+	if err := p.expect("("); err != nil {
+		return Function{}, false, err
+	}
+
+	for !p.accept(")") {
+		if len(f.Parameters) > 0 {
+			if err := p.expect(","); err != nil {
+				return Function{}, false, err
+			}
+		}
+
+		param, err := p.parameter()
+		if err != nil {
+			return Function{}, false, err
+		}
+
+		f.Parameters = append(f.Parameters, param)
+	}
+
+	more, err := p.attributes()
+	if err != nil {
+		return Function{}, false, err
+	}
+
+	f.Attributes = append(attrs, more...)
+
+	switch {
+	case p.accept(";"):
+		// A declaration without a definition is not an entry point of this source.
+		return Function{}, false, nil
+	case p.peek().Text == "{":
+		if err := p.skipBalanced(); err != nil {
+			return Function{}, false, err
+		}
+	default:
+		return Function{}, false, p.errorf(p.peek(), "expected function body")
+	}
+
+	return f, true, nil
+}
+
+// parameter parses an entry point parameter.
+func (p *parser) parameter() (Parameter, error) {
+	t, err := p.typeSpec()
+	if err != nil {
+		return Parameter{}, err
+	}
+
+	p.ptrOperators(&t)
+
+	name := p.next()
+	if name.Kind != TokenIdent {
+		return Parameter{}, p.errorf(name, "expected parameter name")
+	}
+
+	if err := p.arrayDims(&t); err != nil {
+		return Parameter{}, err
+	}
+
+	attrs, err := p.attributes()
+	if err != nil {
+		return Parameter{}, err
+	}
+
+	param := Parameter{Name: name.Text, Type: t, Attributes: attrs, Access: access(t), Pos: name.Pos}
+
+	for _, a := range attrs {
+		switch {
+		case a.Name == "stage_in":
+			param.Binding = Binding{Kind: BindingStageIn}
+		case builtins[a.Name]:
+			param.Binding = Binding{Kind: BindingBuiltin, Builtin: a.Name}
+		case indexedBindings[a.Name] != BindingNone:
+			if len(a.Args) != 1 {
+				return Parameter{}, p.errorf(name, "attribute %s of %s needs an index", a.Name, name.Text)
+			}
+
+			// Indices that cannot be resolved are left to the caller.
+			i, err := p.intValue(a.Args[0])
+			if err != nil {
+				i = -1
+			}
+
+			param.Binding = Binding{Kind: indexedBindings[a.Name], Index: i}
+		}
+	}
+
+	return param, nil
+}
+
+// access returns the access of an argument of type t.
+func access(t Type) Access {
+	if t.IsTexture() {
+		for _, a := range t.Args {
+			switch strings.TrimPrefix(strings.TrimPrefix(a, "metal::"), "access::") {
+			case "read":
+				return AccessRead
+			case "write":
+				return AccessWrite
+			case "read_write":
+				return AccessReadWrite
+			}
+		}
+
+		return AccessSample
+	}
+
+	if !t.Pointer && !t.Reference {
+		return AccessNone
+	}
+
+	if t.Const || t.AddressSpace == AddressSpaceConstant {
+		return AccessRead
+	}
+
+	return AccessReadWrite
+}
+
+// typeSpec parses the qualifiers, name and template arguments of a type.
+func (p *parser) typeSpec() (Type, error) {
+	var t Type
+
+	p.qualifiers(&t)
+
+	tok := p.next()
+	if tok.Kind != TokenIdent {
+		return Type{}, p.errorf(tok, "expected type")
+	}
+
+	parts := []string{tok.Text}
+
+	for p.peek().Text == "::" && p.peekAt(1).Kind == TokenIdent {
+		p.next()
+		parts = append(parts, p.next().Text)
+	}
+
+	if parts[0] == "metal" && len(parts) > 1 {
+		parts = parts[1:]
+	}
+
+	t.Name = strings.Join(parts, "::")
+
+	// Multi-word builtin types.
+	for (t.Name == "unsigned" || t.Name == "signed" || t.Name == "long" || strings.HasSuffix(t.Name, " long")) &&
+		(p.peek().Text == "int" || p.peek().Text == "char" || p.peek().Text == "short" || p.peek().Text == "long") {
+		t.Name += " " + p.next().Text
+	}
+
+	if p.peek().Text == "<" {
+		args, err := p.templateArgs()
+		if err != nil {
+			return Type{}, err
+		}
+
+		t.Args = args
+	}
+
+	// Qualifiers may also follow the type name.
+	p.qualifiers(&t)
+
+	return t, nil
+}
+
+// qualifiers parses the const and address space qualifiers of a type.
+func (p *parser) qualifiers(t *Type) {
+	for {
+		switch tok := p.peek(); {
+		case tok.Text == "const":
+			t.Const = true
+		case addressSpaces[tok.Text] != AddressSpaceNone:
+			t.AddressSpace = addressSpaces[tok.Text]
+		case tok.Text == "volatile" || tok.Text == "constexpr" || tok.Text == "static" || tok.Text == "typename":
+		default:
+			return
+		}
+
+		p.next()
+	}
+}
+
+// ptrOperators parses the pointer and reference declarators of a type.
+func (p *parser) ptrOperators(t *Type) {
+	for {
+		switch p.peek().Text {
+		case "*":
+			t.Pointer = true
+		case "&":
+			t.Reference = true
+		case "const", "volatile", "restrict", "__restrict":
+			// Qualifiers of the pointer itself do not change the access.
+		default:
+			return
+		}
+
+		p.next()
+	}
+}
+
+// templateArgs parses a template argument list and returns the text of every argument.
+func (p *parser) templateArgs() ([]string, error) {
+	open := p.next()
+
+	var (
+		args []string
+		cur  []Token
+	)
+
+	depth := 0
+
+	for {
+		tok := p.next()
+
+		switch tok.Text {
+		case "<", "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ">":
+			if depth == 0 {
+				return append(args, joinTokens(cur)), nil
+			}
+
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, joinTokens(cur))
+				cur = nil
+
+				continue
+			}
+		}
+
+		if tok.Kind == TokenEOF || tok.Text == ";" || tok.Text == "{" {
+			return nil, p.errorf(open, "unterminated template argument list")
+		}
+
+		cur = append(cur, tok)
+	}
+}
+
+// arrayDims parses the array dimensions of a declarator.
+func (p *parser) arrayDims(t *Type) error {
+	for p.peek().Text == "[" && p.peekAt(1).Text != "[" {
+		open := p.next()
+
+		var expr []Token
+
+		for p.peek().Text != "]" {
+			if p.peek().Kind == TokenEOF {
+				return p.errorf(open, "expected ]")
+			}
+
+			expr = append(expr, p.next())
+		}
+
+		p.next()
+
+		n, err := p.intValue(joinTokens(expr))
+		if err != nil {
+			return p.errorf(open, "unsupported array length %q", joinTokens(expr))
+		}
+
+		t.Array = append(t.Array, n)
+	}
+
+	return nil
+}
+
+// attributes parses any number of attribute lists in double brackets.
+func (p *parser) attributes() ([]Attribute, error) {
+	var attrs []Attribute
+
+	for p.peek().Text == "[" && p.peekAt(1).Text == "[" {
+		open := p.next()
+		p.next()
+
+		for {
+			name := p.next()
+			if name.Kind != TokenIdent {
+				return nil, p.errorf(name, "expected attribute name")
+			}
+
+			a := Attribute{Name: name.Text}
+
+			// Drop the namespace of attributes such as [[metal::buffer(0)]].
+			for p.accept("::") {
+				a.Name = p.next().Text
+			}
+
+			if p.peek().Text == "(" {
+				args, err := p.parenArgs()
+				if err != nil {
+					return nil, err
+				}
+
+				a.Args = args
+			}
+
+			attrs = append(attrs, a)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+
+		if !p.accept("]") || !p.accept("]") {
+			return nil, p.errorf(open, "expected ]]")
+		}
+	}
+
+	return attrs, nil
+}
+
+// parenArgs parses a parenthesized, comma-separated argument list and returns
+// the text of every argument.
+func (p *parser) parenArgs() ([]string, error) {
+	open := p.next()
+
+	var (
+		args []string
+		cur  []Token
+	)
+
+	depth := 0
+
+	for {
+		tok := p.next()
+
+		switch tok.Text {
+		case "(", "[", "{":
+			depth++
+		case "]", "}":
+			depth--
+		case ")":
+			if depth == 0 {
+				if len(cur) > 0 || len(args) > 0 {
+					args = append(args, joinTokens(cur))
+				}
+
+				return args, nil
+			}
+
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, joinTokens(cur))
+				cur = nil
+
+				continue
+			}
+		}
+
+		if tok.Kind == TokenEOF {
+			return nil, p.errorf(open, "expected )")
+		}
+
+		cur = append(cur, tok)
+	}
+}
+
+// constant records a namespace scope integer constant such as
+// "constant int N = 4;" without consuming any tokens.
+func (p *parser) constant() {
+	i := 0
+	for t := p.peekAt(i).Text; t == "constant" || t == "constexpr" || t == "static" || t == "const"; t = p.peekAt(i).Text {
+		i++
+	}
+
+	if p.peekAt(i).Kind != TokenIdent || p.peekAt(i+1).Kind != TokenIdent || p.peekAt(i+2).Text != "=" || p.peekAt(i+4).Text != ";" {
+		return
+	}
+
+	if n, err := p.intValue(p.peekAt(i + 3).Text); err == nil {
+		p.constants[p.peekAt(i+1).Text] = n
+	}
+}
+
+// intValue returns the value of an integer literal or a known constant.
+func (p *parser) intValue(s string) (int, error) {
+	if n, ok := p.constants[s]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.ParseInt(strings.TrimRight(s, "uUlL"), 0, 64)
+
+	return int(n), err
+}
+
+// skipDeclaration skips tokens up to and including the ';' that ends the
+// declaration at the current nesting level, or up to a function body, which is
+// skipped as well.
+func (p *parser) skipDeclaration() error {
+	for {
+		switch tok := p.peek(); tok.Text {
+		case ";":
+			p.next()
+			return nil
+		case "{":
+			body := p.isBody()
+
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+
+			if body {
+				return nil
+			}
+		case "(", "[":
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+		case "}":
+			return p.errorf(tok, "unexpected }")
+		default:
+			if tok.Kind == TokenEOF {
+				return p.errorf(tok, "unexpected end of source")
+			}
+
+			p.next()
+		}
+	}
+}
+
+// skipMember skips a member declaration of a struct, including the body of a
+// member function.
+func (p *parser) skipMember() error {
+	for {
+		switch tok := p.peek(); tok.Text {
+		case ";":
+			p.next()
+			return nil
+		case "{":
+			body := p.isBody()
+
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+
+			if body {
+				return nil
+			}
+		case "(", "[":
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+		case "}":
+			return nil
+		default:
+			if tok.Kind == TokenEOF {
+				return p.errorf(tok, "unexpected end of source")
+			}
+
+			p.next()
+		}
+	}
+}
+
+// isBody reports whether the brace at the current token opens a function body,
+// which follows the parameter list or attributes, rather than an initializer or
+// a struct body, which are followed by more tokens of the declaration.
+func (p *parser) isBody() bool {
+	if p.pos == 0 {
+		return false
+	}
+
+	prev := p.toks[p.pos-1].Text
+
+	return prev == ")" || prev == "]" || prev == "const"
+}
+
+// skipUntil skips tokens up to one of the given tokens at the current nesting level.
+func (p *parser) skipUntil(stop ...string) error {
+	for {
+		tok := p.peek()
+
+		for _, s := range stop {
+			if tok.Text == s {
+				return nil
+			}
+		}
+
+		switch {
+		case tok.Kind == TokenEOF:
+			return p.errorf(tok, "unexpected end of source")
+		case tok.Text == "(" || tok.Text == "[" || tok.Text == "{":
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+		default:
+			p.next()
+		}
+	}
+}
+
+// skipAngles skips a template parameter list.
+func (p *parser) skipAngles() error {
+	if p.peek().Text != "<" {
+		return nil
+	}
+
+	_, err := p.templateArgs()
+
+	return err
+}
+
+// skipBalanced skips a bracketed token sequence starting at the current token.
+func (p *parser) skipBalanced() error {
+	open := p.next()
+
+	var stack []string
+
+	closing := map[string]string{"(": ")", "[": "]", "{": "}"}
+	stack = append(stack, closing[open.Text])
+
+	for len(stack) > 0 {
+		tok := p.next()
+
+		switch {
+		case tok.Kind == TokenEOF:
+			return p.errorf(open, "expected %s", stack[len(stack)-1])
+		case closing[tok.Text] != "":
+			stack = append(stack, closing[tok.Text])
+		case tok.Text == ")" || tok.Text == "]" || tok.Text == "}":
+			if tok.Text != stack[len(stack)-1] {
+				return p.errorf(tok, "unexpected %s", tok.Text)
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) peek() Token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) peekAt(n int) Token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() Token {
+	tok := p.toks[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek().Text == text {
+		p.next()
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf(p.peek(), "expected %s", text)
+	}
+
+	return nil
+}
+
+// errorf returns a syntax error at the token.
+func (p *parser) errorf(tok Token, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if tok.Kind == TokenEOF && !strings.HasSuffix(msg, "end of source") {
+		msg += " at end of source"
+	}
+
+	return &SyntaxError{Pos: tok.Pos, Msg: msg}
+}
+
+// joinTokens returns the source text of the tokens, with spaces only between
+// words.
+func joinTokens(toks []Token) string {
+	var sb strings.Builder
+
+	for i, t := range toks {
+		if i > 0 && isWord(toks[i-1]) && isWord(t) {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString(t.Text)
+	}
+
+	return sb.String()
+}
+
+func isWord(t Token) bool {
+	return t.Kind == TokenIdent || t.Kind == TokenNumber
+}
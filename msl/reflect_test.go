@@ -0,0 +1,194 @@
+package msl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSource = `#include <metal_stdlib>
+
+using namespace metal;
+
+constant uint kCount = 4;
+
+struct Vertex {
+	float4 position [[position]];
+	float4 color;
+	float weights[kCount], extra;
+
+	Vertex() = default;
+	float4 scaled(float s) const { return color * s; }
+};
+
+struct Uniforms {
+	metal::float4x4 transform;
+	packed_float3 offset;
+};
+
+float helper(float x) {
+	return x * 2;
+}
+
+namespace detail {
+	struct Inner { int a; };
+}
+
+kernel void add_arrays(device const float* inA [[buffer(0)]],
+                       device const float* inB [[buffer(1)]],
+                       device float* result [[ buffer(2) ]],
+                       constant Uniforms& uniforms [[buffer(3)]],
+                       threadgroup float* scratch [[threadgroup(0)]],
+                       uint index [[thread_position_in_grid]])
+{
+	result[index] = inA[index] + inB[index];
+}
+
+[[kernel, max_total_threads_per_threadgroup(64)]]
+void blur(texture2d<float, access::read> src [[texture(0)]],
+          texture2d<float, access::write> dst [[texture(1)]],
+          sampler s [[sampler(0)]],
+          uint2 gid [[thread_position_in_grid]]) {}
+
+vertex Vertex vertex_shader(uint vertexID [[vertex_id]], device Vertex* vertices [[buffer(0)]]) {
+	return vertices[vertexID];
+}
+
+fragment float4 fragment_shader(Vertex in [[stage_in]], texture2d<half> tex [[texture(kCount)]]) {
+	return in.color;
+}
+
+kernel void declared_only(uint i [[thread_position_in_grid]]);
+
+template <typename T>
+kernel void templated(device T* data [[buffer(0)]]) {}
+`
+
+func TestReflect(t *testing.T) {
+	m, err := Reflect(testSource)
+	require.NoError(t, err)
+
+	require.Len(t, m.Structs, 3)
+	require.Equal(t, []string{"Vertex", "Uniforms", "Inner"}, []string{m.Structs[0].Name, m.Structs[1].Name, m.Structs[2].Name})
+
+	v, ok := m.Struct("Vertex")
+	require.True(t, ok)
+	require.Equal(t, Pos{7, 8}, v.Pos)
+	require.Len(t, v.Fields, 4)
+	require.Equal(t, Field{Name: "position", Type: Type{Name: "float4"}, Attributes: []Attribute{{Name: "position"}}, Pos: Pos{8, 9}}, v.Fields[0])
+	require.Equal(t, []int{4}, v.Fields[2].Type.Array)
+	require.Equal(t, "extra", v.Fields[3].Name)
+	require.Nil(t, v.Fields[3].Type.Array)
+
+	u, _ := m.Struct("Uniforms")
+	require.Equal(t, "float4x4", u.Fields[0].Type.Name)
+	require.Equal(t, "packed_float3", u.Fields[1].Type.Name)
+
+	require.Len(t, m.Functions, 4)
+
+	f, ok := m.Function("add_arrays")
+	require.True(t, ok)
+	require.Equal(t, FunctionKindKernel, f.Kind)
+	require.Equal(t, "void", f.ReturnType.Name)
+	require.Len(t, f.Parameters, 6)
+
+	inA := f.Parameters[0]
+	require.Equal(t, "inA", inA.Name)
+	require.Equal(t, Type{Name: "float", AddressSpace: AddressSpaceDevice, Const: true, Pointer: true}, inA.Type)
+	require.Equal(t, "device const float*", inA.Type.String())
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: 0}, inA.Binding)
+	require.Equal(t, AccessRead, inA.Access)
+
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: 2}, f.Parameters[2].Binding)
+	require.Equal(t, AccessReadWrite, f.Parameters[2].Access)
+	require.Equal(t, Type{Name: "Uniforms", AddressSpace: AddressSpaceConstant, Reference: true}, f.Parameters[3].Type)
+	require.Equal(t, AccessRead, f.Parameters[3].Access)
+	require.Equal(t, Binding{Kind: BindingThreadgroup, Index: 0}, f.Parameters[4].Binding)
+	require.Equal(t, Binding{Kind: BindingBuiltin, Builtin: "thread_position_in_grid"}, f.Parameters[5].Binding)
+	require.Equal(t, AccessNone, f.Parameters[5].Access)
+	require.Len(t, f.Bindings(BindingBuffer), 4)
+
+	f, _ = m.Function("blur")
+	require.Equal(t, FunctionKindKernel, f.Kind)
+	require.Equal(t, []Attribute{{Name: "max_total_threads_per_threadgroup", Args: []string{"64"}}}, f.Attributes)
+	require.Equal(t, []string{"float", "access::read"}, f.Parameters[0].Type.Args)
+	require.True(t, f.Parameters[0].Type.IsTexture())
+	require.Equal(t, AccessRead, f.Parameters[0].Access)
+	require.Equal(t, AccessWrite, f.Parameters[1].Access)
+	require.Equal(t, Binding{Kind: BindingTexture, Index: 1}, f.Parameters[1].Binding)
+	require.Equal(t, Binding{Kind: BindingSampler, Index: 0}, f.Parameters[2].Binding)
+
+	f, _ = m.Function("vertex_shader")
+	require.Equal(t, FunctionKindVertex, f.Kind)
+	require.Equal(t, "Vertex", f.ReturnType.Name)
+	require.Equal(t, Binding{Kind: BindingBuiltin, Builtin: "vertex_id"}, f.Parameters[0].Binding)
+
+	f, _ = m.Function("fragment_shader")
+	require.Equal(t, FunctionKindFragment, f.Kind)
+	require.Equal(t, Binding{Kind: BindingStageIn}, f.Parameters[0].Binding)
+	require.Equal(t, Binding{Kind: BindingTexture, Index: 4}, f.Parameters[1].Binding)
+	require.Equal(t, AccessSample, f.Parameters[1].Access)
+	require.Equal(t, "texture2d<half>", f.Parameters[1].Type.String())
+
+	_, ok = m.Function("helper")
+	require.False(t, ok)
+
+	_, ok = m.Function("declared_only")
+	require.False(t, ok)
+}
+
+func TestReflectIndices(t *testing.T) {
+	m, err := Reflect(`#define IN 1
+  #  define OUT IN
+constant int N = 3;
+
+kernel void f(device float* a [[buffer(IN)]], device float* b [[buffer(OUT)]],
+              device float* c [[buffer(N)]], device float* d [[buffer(UNKNOWN)]]) {}
+
+kernel void g(device float* a [[buffer(0)]]) {}
+`)
+	require.NoError(t, err)
+	require.Len(t, m.Functions, 2)
+
+	f, _ := m.Function("f")
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: 1}, f.Parameters[0].Binding)
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: 1}, f.Parameters[1].Binding)
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: 3}, f.Parameters[2].Binding)
+
+	// Unresolved indices are kept as written.
+	require.Equal(t, Binding{Kind: BindingBuffer, Index: -1}, f.Parameters[3].Binding)
+	require.Equal(t, []Attribute{{Name: "buffer", Args: []string{"UNKNOWN"}}}, f.Parameters[3].Attributes)
+}
+
+func TestReflectErrors(t *testing.T) {
+	for src, msg := range map[string]string{
+		"kernel void f(device float* a [[buffer(0)]) {}": "1:31: expected ]]",
+		"kernel void f(int) {}":                          "1:18: expected parameter name",
+		"kernel void f(int a) {":                         "1:22: expected }",
+		"struct S { float a[n]; };":                      `1:19: unsupported array length "n"`,
+		"float f() { ) }":                                "1:13: unexpected )",
+		"{}":                                             "1:3: unexpected end of source",
+		"[":                                              "1:1: expected ]",
+		"kernel void k(device float* a [buffer(0)]) {}": `1:31: unsupported array length "buffer(0)"`,
+	} {
+		_, err := Reflect(src)
+		require.EqualError(t, err, msg, src)
+	}
+}
+
+func FuzzReflect(f *testing.F) {
+	for _, src := range []string{
+		"kernel void f(device float* a [[buffer(0)]], uint i [[thread_position_in_grid]]) {}",
+		"struct S { float4 a; packed_float3 b[2]; };",
+		"[[vertex]] float4 v(uint id [[vertex_id]]) { return 0; }",
+		"[",
+		"{}",
+	} {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		// Reflect must return for any input, with or without an error.
+		_, _ = Reflect(src)
+	})
+}
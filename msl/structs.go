@@ -0,0 +1,533 @@
+package msl
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// StructOptions configures GenerateStructs.
+type StructOptions struct {
+	// TypeNamer returns the MSL name of a Go struct type. The default returns the
+	// name of the Go type, which fails for anonymous structs.
+	TypeNamer func(t reflect.Type) string
+
+	// StaticAssert adds a static_assert of the size of each struct, so the shader
+	// fails to compile if the declaration and the Go type disagree.
+	StaticAssert bool
+}
+
+// GenerateStructs returns the MSL declarations of the Go struct types of the values,
+// which may be pointers, and of the struct types of their fields. Each declaration
+// has the memory layout of the Go type, so Go values can be copied to buffers as
+// they are.
+//
+// Fields are mapped as follows:
+//
+//	bool, int8, uint8, int16, uint16, int32, uint32, int64, uint64, float32:
+//	    bool, char, uchar, short, ushort, int, uint, long, ulong, float
+//	[2]T, [3]T, [4]T of the 8 to 32-bit numbers: T2, T3, T4 or packed_T2, packed_T3, packed_T4
+//	[C][R]float32 with 2 to 4 columns and rows: floatCxR or packed_floatR[C]
+//	other arrays: arrays of the element type
+//	structs: the declaration of the struct type
+//	types of package simd: their MSL types, such as float3 for simd.Float3
+//
+// Packed vectors are used where the aligned vector does not match the Go layout,
+// such as for [3]float32, which is 12 bytes in Go while float3 takes 16. Padding
+// inserted by Go and fields named "_" become explicit char arrays. Other types,
+// including int, uint and float64, are not supported.
+//
+// The tag `msl:"name,attr,..."` sets the MSL name, which defaults to the Go name
+// with a lower case first word, and the attributes of a field, such as
+// `msl:"position,position"` for float4 position [[position]]. The attribute
+// "packed" selects the packed vector type, and the tag `msl:"-"` replaces the field
+// with padding.
+func GenerateStructs(values []any, optFns ...func(*StructOptions)) (string, error) {
+	opts := StructOptions{
+		TypeNamer:    func(t reflect.Type) string { return t.Name() },
+		StaticAssert: false,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	g := structGenerator{opts: opts, structs: map[reflect.Type]*mslStruct{}, names: map[string]reflect.Type{}}
+
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if t == nil || t.Kind() != reflect.Struct {
+			return "", fmt.Errorf("%v is not a struct type", t)
+		}
+
+		if _, err := g.structType(t); err != nil {
+			return "", err
+		}
+	}
+
+	return g.sb.String(), nil
+}
+
+// mslType is the MSL type of a Go type in a struct.
+type mslType struct {
+	Name string
+
+	// Dims holds the array dimensions of the member declarator.
+	Dims []int
+
+	Size, Align int
+
+	// Packable reports whether the type has a packed variant of the Go size.
+	Packable bool
+}
+
+// mslStruct is a generated struct declaration.
+type mslStruct struct {
+	Name        string
+	Size, Align int
+}
+
+// member is a data member of a generated struct declaration.
+type member struct {
+	Name   string
+	Type   mslType
+	Offset int
+	Attrs  []string
+	Packed bool
+
+	// field is the Go field of the member.
+	field reflect.StructField
+}
+
+// structGenerator holds the state of GenerateStructs.
+type structGenerator struct {
+	opts    StructOptions
+	sb      strings.Builder
+	structs map[reflect.Type]*mslStruct
+	names   map[string]reflect.Type
+}
+
+// scalarNames maps the supported kinds of scalar fields to their MSL types.
+var scalarNames = map[reflect.Kind]string{
+	reflect.Bool:    "bool",
+	reflect.Int8:    "char",
+	reflect.Uint8:   "uchar",
+	reflect.Int16:   "short",
+	reflect.Uint16:  "ushort",
+	reflect.Int32:   "int",
+	reflect.Uint32:  "uint",
+	reflect.Int64:   "long",
+	reflect.Uint64:  "ulong",
+	reflect.Float32: "float",
+}
+
+// structType generates the declaration of the struct type t and the struct types
+// it depends on, unless it was generated before.
+func (g *structGenerator) structType(t reflect.Type) (*mslStruct, error) {
+	if s, ok := g.structs[t]; ok {
+		return s, nil
+	}
+
+	name := g.opts.TypeNamer(t)
+	if !isIdentifier(name) {
+		return nil, fmt.Errorf("invalid MSL name %q of struct %v", name, t)
+	}
+
+	if other, ok := g.names[name]; ok {
+		return nil, fmt.Errorf("structs %v and %v have the same MSL name %s", other, t, name)
+	}
+
+	var members []member
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Size() == 0 {
+			continue
+		}
+
+		fieldName, attrs, packed, skip := fieldTag(f)
+		if skip {
+			continue
+		}
+
+		m := member{Name: fieldName, Offset: int(f.Offset), Attrs: attrs, Packed: packed, field: f}
+
+		if !isIdentifier(m.Name) {
+			return nil, fmt.Errorf("invalid MSL name %q of field %s of %v", m.Name, f.Name, t)
+		}
+
+		if err := g.fieldType(t, &m); err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+	}
+
+	if err := g.demote(t, members); err != nil {
+		return nil, err
+	}
+
+	s := &mslStruct{Name: name, Size: int(t.Size()), Align: structAlign(members)}
+
+	g.write(s, members)
+	g.structs[t] = s
+	g.names[name] = t
+
+	return s, nil
+}
+
+// fieldType sets the type of the member of the struct t, using the packed variant
+// if the aligned type does not match the Go layout.
+func (g *structGenerator) fieldType(t reflect.Type, m *member) error {
+	f := m.field
+
+	typ, err := g.mslType(f.Type, m.Packed)
+	if err != nil {
+		return fmt.Errorf("field %s of %v: %w", f.Name, t, err)
+	}
+
+	if (m.Offset%typ.Align != 0 || typ.Size != int(f.Type.Size())) && typ.Packable && !m.Packed {
+		m.Packed = true
+
+		return g.fieldType(t, m)
+	}
+
+	if typ.Size != int(f.Type.Size()) {
+		return fmt.Errorf("field %s of %v: %s has %d bytes, %v has %d", f.Name, t, typ.Name, typ.Size, f.Type, f.Type.Size())
+	}
+
+	if m.Offset%typ.Align != 0 {
+		return fmt.Errorf("field %s of %v: offset %d is not aligned to %d bytes of %s", f.Name, t, m.Offset, typ.Align, typ.Name)
+	}
+
+	m.Type = typ
+
+	return nil
+}
+
+// demote switches the members with the largest alignment to packed types until the
+// Go size of the struct t is a multiple of the alignment of the declaration, so
+// arrays of the struct have the same stride in Go and MSL.
+func (g *structGenerator) demote(t reflect.Type, members []member) error {
+	for {
+		align := structAlign(members)
+		if int(t.Size())%align == 0 {
+			return nil
+		}
+
+		demoted := false
+
+		for i := range members {
+			m := &members[i]
+			if m.Type.Align == align && m.Type.Packable && !m.Packed {
+				m.Packed = true
+				if err := g.fieldType(t, m); err != nil {
+					return err
+				}
+
+				demoted = true
+			}
+		}
+
+		if !demoted {
+			return fmt.Errorf("size %d of %v is not a multiple of the alignment %d of its MSL declaration", t.Size(), t, align)
+		}
+	}
+}
+
+// simdPkgPath is the import path of package simd, whose types have the layout of
+// MSL vectors and matrices. It is not imported, so simd can use msl in its tests.
+const simdPkgPath = "github.com/hupe1980/go-mtl/simd"
+
+// simdType describes the MSL type of a type of package simd: a scalar if n is 1,
+// a vector of n components, or a matrix of the given number of such columns.
+type simdType struct {
+	scalar  string
+	n       int
+	columns int
+}
+
+// simdTypes maps the names of the types of package simd to their MSL types.
+var simdTypes = map[string]simdType{
+	"Half":         {"half", 1, 0},
+	"Float2":       {"float", 2, 0},
+	"Float3":       {"float", 3, 0},
+	"Float4":       {"float", 4, 0},
+	"PackedFloat3": {"packed_float", 3, 0},
+	"Half2":        {"half", 2, 0},
+	"Half3":        {"half", 3, 0},
+	"Half4":        {"half", 4, 0},
+	"Int2":         {"int", 2, 0},
+	"Int3":         {"int", 3, 0},
+	"Int4":         {"int", 4, 0},
+	"UInt2":        {"uint", 2, 0},
+	"UInt3":        {"uint", 3, 0},
+	"UInt4":        {"uint", 4, 0},
+	"Float2x2":     {"float", 2, 2},
+	"Float3x3":     {"float", 3, 3},
+	"Float4x4":     {"float", 4, 4},
+	"Float2x3":     {"float", 3, 2},
+	"Float2x4":     {"float", 4, 2},
+	"Float3x2":     {"float", 2, 3},
+	"Float3x4":     {"float", 4, 3},
+	"Float4x2":     {"float", 2, 4},
+	"Float4x3":     {"float", 3, 4},
+	"Quat":         {"float", 4, 0},
+}
+
+// simdMSLType returns the MSL type of the type t of package simd. Vectors of 3
+// components are padded in Go, so they and their matrices have no packed variant.
+func simdMSLType(t reflect.Type, packed bool) (mslType, bool) {
+	st, ok := simdTypes[t.Name()]
+	if !ok || t.PkgPath() != simdPkgPath {
+		return mslType{}, false
+	}
+
+	size := int(t.Size())
+
+	switch {
+	case st.n == 1:
+		return mslType{Name: st.scalar, Size: size, Align: size}, true
+	case st.scalar == "packed_float":
+		return mslType{Name: "packed_float3", Size: size, Align: 4}, true
+	}
+
+	columns, aligned := 1, st.n
+	if st.columns > 0 {
+		columns = st.columns
+	}
+
+	if st.n == 3 {
+		packed, aligned = false, 4
+	}
+
+	column := vectorType(st.scalar, size/columns/aligned, st.n, packed)
+	column.Packable = st.n != 3
+
+	switch {
+	case st.columns == 0:
+		return column, true
+	case packed:
+		return mslType{Name: column.Name, Dims: []int{columns}, Size: size, Align: column.Align, Packable: true}, true
+	}
+
+	return mslType{
+		Name:     st.scalar + strconv.Itoa(columns) + "x" + strconv.Itoa(st.n),
+		Size:     size,
+		Align:    column.Align,
+		Packable: column.Packable,
+	}, true
+}
+
+// mslType returns the MSL type of the Go type t.
+func (g *structGenerator) mslType(t reflect.Type, packed bool) (mslType, error) {
+	if typ, ok := simdMSLType(t, packed); ok {
+		return typ, nil
+	}
+
+	if name, ok := scalarNames[t.Kind()]; ok {
+		return mslType{Name: name, Size: int(t.Size()), Align: int(t.Size())}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s, err := g.structType(t)
+		if err != nil {
+			return mslType{}, err
+		}
+
+		return mslType{Name: s.Name, Size: s.Size, Align: s.Align}, nil
+	case reflect.Array:
+		return g.arrayType(t, packed)
+	}
+
+	return mslType{}, fmt.Errorf("unsupported type %v", t)
+}
+
+// arrayType returns the MSL vector, matrix or array type of the Go array type t.
+func (g *structGenerator) arrayType(t reflect.Type, packed bool) (mslType, error) {
+	n, elem := t.Len(), t.Elem()
+
+	if n >= 2 && n <= 4 && isVectorScalar(elem.Kind()) {
+		return vectorType(scalarNames[elem.Kind()], int(elem.Size()), n, packed), nil
+	}
+
+	if n >= 2 && n <= 4 && elem.Kind() == reflect.Array && elem.Len() >= 2 && elem.Len() <= 4 && elem.Elem().Kind() == reflect.Float32 {
+		rows := elem.Len()
+		column := vectorType("float", 4, rows, packed)
+
+		if packed {
+			return mslType{Name: column.Name, Dims: []int{n}, Size: n * column.Size, Align: column.Align, Packable: true}, nil
+		}
+
+		return mslType{
+			Name:     "float" + strconv.Itoa(n) + "x" + strconv.Itoa(rows),
+			Size:     n * column.Size,
+			Align:    column.Align,
+			Packable: true,
+		}, nil
+	}
+
+	e, err := g.mslType(elem, packed)
+	if err != nil {
+		return mslType{}, err
+	}
+
+	if e.Size != int(elem.Size()) && e.Packable && !packed {
+		if e, err = g.mslType(elem, true); err != nil {
+			return mslType{}, err
+		}
+	}
+
+	return mslType{
+		Name:     e.Name,
+		Dims:     append([]int{n}, e.Dims...),
+		Size:     n * e.Size,
+		Align:    e.Align,
+		Packable: e.Packable && !packed,
+	}, nil
+}
+
+// vectorType returns the vector type with n components of the scalar type name.
+func vectorType(scalar string, size, n int, packed bool) mslType {
+	name := scalar + strconv.Itoa(n)
+
+	if packed {
+		return mslType{Name: "packed_" + name, Size: n * size, Align: size, Packable: true}
+	}
+
+	// Vectors of 3 components have the size and alignment of 4 components.
+	aligned := n
+	if n == 3 {
+		aligned = 4
+	}
+
+	return mslType{Name: name, Size: aligned * size, Align: aligned * size, Packable: true}
+}
+
+// isVectorScalar reports whether MSL has vectors of the scalar kind.
+func isVectorScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16, reflect.Int32, reflect.Uint32, reflect.Float32:
+		return true
+	}
+
+	return false
+}
+
+// structAlign returns the alignment of a struct declaration with the members.
+func structAlign(members []member) int {
+	align := 1
+
+	for _, m := range members {
+		if m.Type.Align > align {
+			align = m.Type.Align
+		}
+	}
+
+	return align
+}
+
+// write appends the declaration of the struct with the members, inserting padding
+// where the Go offsets of the members leave gaps.
+func (g *structGenerator) write(s *mslStruct, members []member) {
+	fmt.Fprintf(&g.sb, "struct %s {\n", s.Name)
+
+	offset, pads := 0, 0
+
+	pad := func(end int) {
+		if end > offset {
+			fmt.Fprintf(&g.sb, "\tchar _pad%d[%d];\n", pads, end-offset)
+			pads++
+		}
+	}
+
+	for _, m := range members {
+		pad(m.Offset)
+
+		g.sb.WriteString("\t" + m.Type.Name + " " + m.Name)
+
+		for _, d := range m.Type.Dims {
+			g.sb.WriteString("[" + strconv.Itoa(d) + "]")
+		}
+
+		if len(m.Attrs) > 0 {
+			g.sb.WriteString(" [[" + strings.Join(m.Attrs, ", ") + "]]")
+		}
+
+		g.sb.WriteString(";\n")
+
+		offset = m.Offset + m.Type.Size
+	}
+
+	pad(s.Size)
+
+	g.sb.WriteString("};\n")
+
+	if g.opts.StaticAssert {
+		fmt.Fprintf(&g.sb, "static_assert(sizeof(%s) == %d, \"size of %s does not match Go\");\n", s.Name, s.Size, s.Name)
+	}
+
+	g.sb.WriteString("\n")
+}
+
+// fieldTag returns the MSL name, the attributes and the packed option of the
+// field f from its msl tag, and whether the field is padding.
+func fieldTag(f reflect.StructField) (name string, attrs []string, packed, skip bool) {
+	tag, ok := f.Tag.Lookup("msl")
+	if f.Name == "_" || tag == "-" {
+		return "", nil, false, true
+	}
+
+	name = lowerCamel(f.Name)
+
+	if ok {
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+
+		for _, a := range parts[1:] {
+			if a = strings.TrimSpace(a); a == "packed" {
+				packed = true
+			} else if a != "" {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+
+	return name, attrs, packed, false
+}
+
+// lowerCamel returns the name with its first word in lower case, such as
+// "position" for "Position" and "uvCoord" for "UVCoord".
+func lowerCamel(name string) string {
+	r := []rune(name)
+
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+
+		r[i] = unicode.ToLower(r[i])
+	}
+
+	return string(r)
+}
+
+// isIdentifier reports whether s is a valid MSL identifier.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return s != ""
+}
@@ -0,0 +1,203 @@
+package msl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hupe1980/go-mtl/simd"
+)
+
+type testVertex struct {
+	Position [4]float32 `msl:"position,position"`
+	Color    [4]float32
+	UVCoord  [2]float32 `msl:",user(uv)"`
+	_        [2]float32
+}
+
+type testLight struct {
+	Color     [3]float32
+	Intensity float32
+}
+
+type testUniforms struct {
+	Transform [4][4]float32
+	Normal    [3][3]float32
+	Lights    [2]testLight
+	Count     uint16
+	Enabled   bool
+	_         [4]byte
+	Time      float32 `msl:"time"`
+	Frame     uint64
+	Ignored   int32    `msl:"-"`
+	Offsets   [4]int32 `msl:",packed"`
+	Weights   [5]float32
+	Points    [2][3]float32
+}
+
+func TestGenerateStructs(t *testing.T) {
+	src, err := GenerateStructs([]any{testVertex{}, &testUniforms{}, testLight{}}, func(o *StructOptions) {
+		o.TypeNamer = func(t reflect.Type) string { return t.Name()[len("test"):] }
+	})
+	require.NoError(t, err)
+	require.Equal(t, `struct Vertex {
+	float4 position [[position]];
+	float4 color;
+	float2 uvCoord [[user(uv)]];
+	char _pad0[8];
+};
+
+struct Light {
+	packed_float3 color;
+	float intensity;
+};
+
+struct Uniforms {
+	packed_float4 transform[4];
+	packed_float3 normal[3];
+	Light lights[2];
+	ushort count;
+	bool enabled;
+	char _pad0[5];
+	float time;
+	ulong frame;
+	char _pad1[4];
+	packed_int4 offsets;
+	float weights[5];
+	packed_float3 points[2];
+};
+
+`, src)
+
+	// Aligned matrices are kept if the size of the struct is a multiple of 16.
+	type aligned struct {
+		Transform [4][4]float32
+		Scale     [2]float32
+		Weight    float32
+		_         float32
+	}
+
+	src, err = GenerateStructs([]any{aligned{}}, func(o *StructOptions) { o.StaticAssert = true })
+	require.NoError(t, err)
+	require.Equal(t, `struct aligned {
+	float4x4 transform;
+	float2 scale;
+	float weight;
+	char _pad0[4];
+};
+static_assert(sizeof(aligned) == 80, "size of aligned does not match Go");
+
+`, src)
+}
+
+func TestGenerateStructsSIMD(t *testing.T) {
+	type uniforms struct {
+		Transform simd.Float4x4
+		Normal    simd.Float3x3
+		Rotation  simd.Quat
+		Color     simd.Float4
+		Direction simd.Float3
+		Offset    simd.PackedFloat3
+		Weight    simd.Half
+		_         simd.Half
+		Tint      simd.Half3
+		Size      simd.Float2
+		Scale     simd.Float2x2
+		Cell      simd.Int3
+		Mask      simd.UInt4
+		Texel     simd.Half2
+		_         [12]byte
+	}
+
+	src, err := GenerateStructs([]any{uniforms{}}, func(o *StructOptions) { o.StaticAssert = true })
+	require.NoError(t, err)
+	require.Equal(t, `struct uniforms {
+	float4x4 transform;
+	float3x3 normal;
+	float4 rotation;
+	float4 color;
+	float3 direction;
+	packed_float3 offset;
+	half weight;
+	char _pad0[2];
+	half3 tint;
+	float2 size;
+	float2x2 scale;
+	int3 cell;
+	uint4 mask;
+	half2 texel;
+	char _pad1[12];
+};
+static_assert(sizeof(uniforms) == 256, "size of uniforms does not match Go");
+
+`, src)
+
+	m, err := Reflect(src)
+	require.NoError(t, err)
+
+	mismatches, err := ValidateLayout(reflect.TypeOf(uniforms{}), m, "uniforms")
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	// Vectors of 4 components become packed if Go misaligns them, while padded
+	// vectors of 3 components have no packed variant of the same size.
+	type packed struct {
+		Weight float32
+		Color  simd.Float4
+		Normal simd.Float3
+	}
+
+	_, err = GenerateStructs([]any{packed{}})
+	require.EqualError(t, err, "field Normal of msl.packed: offset 20 is not aligned to 16 bytes of float3")
+}
+
+func TestGenerateStructsErrors(t *testing.T) {
+	type double struct {
+		X [2]float64
+	}
+
+	type named struct {
+		X float32 `msl:"1x"`
+	}
+
+	type unsupported struct {
+		X int
+	}
+
+	for _, tt := range []struct {
+		value any
+		msg   string
+	}{
+		{1, "int is not a struct type"},
+		{nil, "<nil> is not a struct type"},
+		{struct{ X float32 }{}, `invalid MSL name "" of struct struct { X float32 }`},
+		{named{}, `invalid MSL name "1x" of field X of msl.named`},
+		{unsupported{}, "field X of msl.unsupported: unsupported type int"},
+		{double{}, "field X of msl.double: unsupported type float64"},
+	} {
+		_, err := GenerateStructs([]any{tt.value})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tt.msg)
+	}
+
+	type a struct{ X float32 }
+
+	_, err := GenerateStructs([]any{a{}, struct{ Y float32 }{}}, func(o *StructOptions) {
+		o.TypeNamer = func(reflect.Type) string { return "A" }
+	})
+	require.EqualError(t, err, "structs msl.a and struct { Y float32 } have the same MSL name A")
+}
+
+func TestLowerCamel(t *testing.T) {
+	for name, want := range map[string]string{
+		"Position": "position",
+		"UVCoord":  "uvCoord",
+		"ID":       "id",
+		"X":        "x",
+		"already":  "already",
+		"HTTPPort": "httpPort",
+	} {
+		require.Equal(t, want, lowerCamel(name))
+	}
+}
@@ -690,6 +690,95 @@ const (
 	StoreActionCustomSampleDepthStore StoreAction = 5
 )
 
+// TextureType represents the dimension of each image, including whether multiple images
+// are arranged into an array or a cube. Unlike MTLTextureType, the zero value is
+// TextureType2D, so texture descriptors without an explicit type describe 2D textures.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtltexturetype
+type TextureType uint8
+
+const (
+	// TextureType2D is a two-dimensional texture image.
+	TextureType2D TextureType = 0
+
+	// TextureType1D is a one-dimensional texture image.
+	TextureType1D TextureType = 1
+
+	// TextureType1DArray is an array of one-dimensional texture images.
+	TextureType1DArray TextureType = 2
+
+	// TextureType2DArray is an array of two-dimensional texture images.
+	TextureType2DArray TextureType = 3
+
+	// TextureType2DMultisample is a two-dimensional texture image that uses more than one sample for each pixel.
+	TextureType2DMultisample TextureType = 4
+
+	// TextureTypeCube is a cube texture with six two-dimensional images.
+	TextureTypeCube TextureType = 5
+
+	// TextureTypeCubeArray is an array of cube textures, each with six two-dimensional images.
+	TextureTypeCubeArray TextureType = 6
+
+	// TextureType3D is a three-dimensional texture image.
+	TextureType3D TextureType = 7
+
+	// TextureType2DMultisampleArray is an array of two-dimensional texture images that use more than one sample for each pixel.
+	TextureType2DMultisampleArray TextureType = 8
+)
+
+// mtlTextureTypes maps TextureType values to MTLTextureType values.
+var mtlTextureTypes = [...]uint8{
+	TextureType2D:                 2,
+	TextureType1D:                 0,
+	TextureType1DArray:            1,
+	TextureType2DArray:            3,
+	TextureType2DMultisample:      4,
+	TextureTypeCube:               5,
+	TextureTypeCubeArray:          6,
+	TextureType3D:                 7,
+	TextureType2DMultisampleArray: 8,
+}
+
+// TextureSwizzle represents the source of a pixel component when a texture is read.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtltextureswizzle
+type TextureSwizzle uint8
+
+const (
+	// TextureSwizzleZero indicates that the component value is 0.
+	TextureSwizzleZero TextureSwizzle = 0
+
+	// TextureSwizzleOne indicates that the component value is 1.
+	TextureSwizzleOne TextureSwizzle = 1
+
+	// TextureSwizzleRed indicates that the component value is taken from the red channel.
+	TextureSwizzleRed TextureSwizzle = 2
+
+	// TextureSwizzleGreen indicates that the component value is taken from the green channel.
+	TextureSwizzleGreen TextureSwizzle = 3
+
+	// TextureSwizzleBlue indicates that the component value is taken from the blue channel.
+	TextureSwizzleBlue TextureSwizzle = 4
+
+	// TextureSwizzleAlpha indicates that the component value is taken from the alpha channel.
+	TextureSwizzleAlpha TextureSwizzle = 5
+)
+
+// TextureSwizzleChannels describes the source of every pixel component when a texture is read.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtltextureswizzlechannels
+type TextureSwizzleChannels struct {
+	Red, Green, Blue, Alpha TextureSwizzle
+}
+
+// TextureSwizzleChannelsDefault is the identity swizzle, which reads every component from its own channel.
+var TextureSwizzleChannelsDefault = TextureSwizzleChannels{
+	Red:   TextureSwizzleRed,
+	Green: TextureSwizzleGreen,
+	Blue:  TextureSwizzleBlue,
+	Alpha: TextureSwizzleAlpha,
+}
+
 // ClearColor is an RGBA value used for a color pixel.
 //
 // Reference: https://developer.apple.com/documentation/metal/mtlclearcolor
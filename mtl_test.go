@@ -2,12 +2,11 @@ package mtl
 
 import (
 	"image"
-	"image/color"
-	"image/png"
 	"os"
 	"testing"
 	"unsafe"
 
+	"github.com/hupe1980/go-mtl/mtltest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -183,7 +182,8 @@ fragment float4 fragment_shader(Vertex in [[stage_in]]) {
 		StorageMode: StorageModeManaged,
 	}
 
-	texture := device.NewTextureWithDescriptor(td)
+	texture, err := device.NewTextureWithDescriptor(td)
+	require.NoError(t, err)
 
 	// Create a command queue for the device.
 	cq := device.NewCommandQueue()
@@ -234,31 +234,28 @@ fragment float4 fragment_shader(Vertex in [[stage_in]]) {
 	region := RegionMake2D(0, 0, texture.Width, texture.Height)
 	texture.GetBytes(&img.Pix[0], uintptr(bytesPerRow), region, 0)
 
-	// Open file to compare
-	want, err := readPNG("testdata/triangle.png")
-	require.NoError(t, err)
-
-	require.Equal(t, img.Bounds(), want.Bounds())
-
-	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
-			c, _ := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
-			d, _ := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
-
-			require.Equal(t, c.R, d.R)
-			require.Equal(t, c.G, d.G)
-			require.Equal(t, c.B, d.B)
-			require.Equal(t, c.A, d.A)
-		}
-	}
+	// Compare against the golden image. Rasterization along the triangle edges
+	// differs slightly between GPUs.
+	mtltest.AssertGolden(t, "testdata/triangle.png", img, func(o *mtltest.GoldenOptions) {
+		o.Tolerance = [4]float64{2.0 / 255, 2.0 / 255, 2.0 / 255, 0}
+		o.MaxMismatchPercent = 2
+	})
 }
 
-func readPNG(name string) (image.Image, error) {
-	f, err := os.Open(name)
-	if err != nil {
-		return nil, err
+func TestNewLibraryWithData(t *testing.T) {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		// GPU functions are not available for macOS runners
+		// https://github.com/actions/runner-images/issues/1779#issuecomment-707071183
+		t.Skip()
 	}
-	defer f.Close()
 
-	return png.Decode(f)
+	device, err := CreateSystemDefaultDevice()
+	require.NoError(t, err)
+
+	// Invalid containers are rejected before they reach Metal.
+	_, err = device.NewLibraryWithData([]byte("not a metallib"))
+	require.EqualError(t, err, "invalid metallib file identifier")
+
+	_, err = device.NewLibraryWithData(nil)
+	require.EqualError(t, err, "invalid metallib file identifier")
 }
@@ -0,0 +1,261 @@
+// Package mtltest provides helpers to test rendering results against golden images
+// and Go structs against the layout of MSL structs.
+//
+// It only depends on the standard library and the pure Go package msl, so that it
+// can be used by the tests of package mtl itself. Golden files are regenerated by
+// running the tests with the -mtltest.update flag:
+//
+//	go test -run TestRender -mtltest.update
+package mtltest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update is namespaced, so test packages that import mtltest can define their own
+// -update flag.
+var update = flag.Bool("mtltest.update", false, "update golden files instead of comparing against them")
+
+// GoldenOptions configures Compare and AssertGolden.
+type GoldenOptions struct {
+	// Tolerance is the largest absolute difference of the red, green, blue and
+	// alpha channels, in [0, 1], at which pixels still match. A tolerance of
+	// 2.0/255 allows two steps of 8-bit channels.
+	Tolerance [4]float64
+
+	// MaxMismatchPercent is the percentage of pixels that may exceed the tolerance.
+	MaxMismatchPercent float64
+
+	// Metric is an optional image difference metric, such as mean FLIP, where
+	// lower values mean more similar images. If it is set, images match if the
+	// metric is at most MaxMetric, regardless of the per-pixel tolerance.
+	Metric func(expected, actual image.Image) (float64, error)
+
+	// MaxMetric is the largest value of Metric at which images still match.
+	MaxMetric float64
+
+	// OutputDir is the directory that AssertGolden writes the actual, expected and
+	// diff images of failed comparisons to. The default is testdata/failures.
+	OutputDir string
+}
+
+// Result is the result of comparing an image against its expected image.
+type Result struct {
+	// Mismatched is the number of pixels that exceed the tolerance.
+	Mismatched int
+
+	// Total is the number of compared pixels.
+	Total int
+
+	// MaxDiff holds the largest absolute difference of the red, green, blue and alpha channels.
+	MaxDiff [4]float64
+
+	// Metric is the value of GoldenOptions.Metric, or 0 if it is not set.
+	Metric float64
+
+	// Diff shows the expected image dimmed to gray, with mismatched pixels in red.
+	Diff *image.NRGBA
+
+	// OK reports whether the images match according to the options.
+	OK bool
+}
+
+// MismatchPercent returns the percentage of pixels that exceed the tolerance.
+func (r Result) MismatchPercent() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+
+	return 100 * float64(r.Mismatched) / float64(r.Total)
+}
+
+// String returns a summary of the comparison.
+func (r Result) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%d of %d pixels (%.3f%%) differ, max diff R=%.4f G=%.4f B=%.4f A=%.4f",
+		r.Mismatched, r.Total, r.MismatchPercent(), r.MaxDiff[0], r.MaxDiff[1], r.MaxDiff[2], r.MaxDiff[3])
+
+	if r.Metric != 0 {
+		fmt.Fprintf(&sb, ", metric %.6f", r.Metric)
+	}
+
+	return sb.String()
+}
+
+// Compare compares actual against expected. Images of different sizes are an error.
+func Compare(expected, actual image.Image, optFns ...func(*GoldenOptions)) (Result, error) {
+	opts := newGoldenOptions(optFns)
+
+	eb, ab := expected.Bounds(), actual.Bounds()
+	if eb.Size() != ab.Size() {
+		return Result{}, fmt.Errorf("image size %v does not match the expected size %v", ab.Size(), eb.Size())
+	}
+
+	res := Result{
+		Total: eb.Dx() * eb.Dy(),
+		Diff:  image.NewNRGBA(image.Rect(0, 0, eb.Dx(), eb.Dy())),
+	}
+
+	for y := 0; y < eb.Dy(); y++ {
+		for x := 0; x < eb.Dx(); x++ {
+			e := nrgba64(expected.At(eb.Min.X+x, eb.Min.Y+y))
+			a := nrgba64(actual.At(ab.Min.X+x, ab.Min.Y+y))
+
+			mismatch := false
+
+			for c, d := range [4]float64{
+				channelDiff(e.R, a.R), channelDiff(e.G, a.G), channelDiff(e.B, a.B), channelDiff(e.A, a.A),
+			} {
+				res.MaxDiff[c] = math.Max(res.MaxDiff[c], d)
+
+				// Allow for the rounding of the tolerance to 16 bits.
+				if d > opts.Tolerance[c]+0.5/0xffff {
+					mismatch = true
+				}
+			}
+
+			if mismatch {
+				res.Mismatched++
+				res.Diff.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+
+				continue
+			}
+
+			// Dim matching pixels so that mismatches stand out.
+			luma := (uint32(e.R)*299 + uint32(e.G)*587 + uint32(e.B)*114) / 1000
+			gray := uint8(64 + luma>>10)
+			res.Diff.SetNRGBA(x, y, color.NRGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+
+	if opts.Metric != nil {
+		m, err := opts.Metric(expected, actual)
+		if err != nil {
+			return Result{}, fmt.Errorf("cannot compute metric: %w", err)
+		}
+
+		res.Metric = m
+		res.OK = m <= opts.MaxMetric
+	} else {
+		res.OK = res.MismatchPercent() <= opts.MaxMismatchPercent
+	}
+
+	return res, nil
+}
+
+// AssertGolden compares actual against the PNG golden file at path and reports an
+// error on t if they do not match. On failure the actual, expected and diff images
+// are written to GoldenOptions.OutputDir. With the -mtltest.update flag, the golden
+// file is written from actual instead.
+func AssertGolden(t testing.TB, path string, actual image.Image, optFns ...func(*GoldenOptions)) {
+	t.Helper()
+
+	if *update {
+		if err := WritePNG(path, actual); err != nil {
+			t.Fatalf("cannot update golden file: %v", err)
+		}
+
+		t.Logf("updated golden file %s", path)
+
+		return
+	}
+
+	expected, err := ReadPNG(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist, run the test with -mtltest.update to create it", path)
+	}
+
+	if err != nil {
+		t.Fatalf("cannot read golden file: %v", err)
+	}
+
+	res, err := Compare(expected, actual, optFns...)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+
+	if res.OK {
+		return
+	}
+
+	opts := newGoldenOptions(optFns)
+	base := filepath.Join(opts.OutputDir, strings.ReplaceAll(t.Name(), "/", "_")+"_"+strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+
+	for suffix, img := range map[string]image.Image{"actual": actual, "expected": expected, "diff": res.Diff} {
+		if err := WritePNG(base+"_"+suffix+".png", img); err != nil {
+			t.Errorf("cannot write %s image: %v", suffix, err)
+		}
+	}
+
+	t.Errorf("image does not match golden file %s: %v; see %s_{actual,expected,diff}.png", path, res, base)
+}
+
+// ReadPNG reads the PNG image at path.
+func ReadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+// WritePNG writes img to path as a PNG image, creating missing directories.
+func WritePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// newGoldenOptions returns the golden options with the functions applied.
+func newGoldenOptions(optFns []func(*GoldenOptions)) GoldenOptions {
+	opts := GoldenOptions{
+		Tolerance:          [4]float64{0, 0, 0, 0},
+		MaxMismatchPercent: 0,
+		Metric:             nil,
+		MaxMetric:          0,
+		OutputDir:          filepath.Join("testdata", "failures"),
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	return opts
+}
+
+// nrgba64 converts c to a non-alpha-premultiplied 16-bit color.
+func nrgba64(c color.Color) color.NRGBA64 {
+	v, _ := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+
+	return v
+}
+
+// channelDiff returns the absolute difference of two 16-bit channels in [0, 1].
+func channelDiff(a, b uint16) float64 {
+	return math.Abs(float64(a)-float64(b)) / 0xffff
+}
@@ -0,0 +1,148 @@
+package mtltest
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImage(c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestCompare(t *testing.T) {
+	expected := newTestImage(color.NRGBA{R: 100, G: 150, B: 200, A: 255})
+	actual := newTestImage(color.NRGBA{R: 100, G: 150, B: 200, A: 255})
+	actual.SetNRGBA(3, 4, color.NRGBA{R: 102, G: 150, B: 200, A: 255})
+
+	res, err := Compare(expected, expected)
+	require.NoError(t, err)
+	require.True(t, res.OK)
+	require.Equal(t, 0, res.Mismatched)
+
+	res, err = Compare(expected, actual)
+	require.NoError(t, err)
+	require.False(t, res.OK)
+	require.Equal(t, 1, res.Mismatched)
+	require.Equal(t, 100, res.Total)
+	require.InDelta(t, 2.0/255, res.MaxDiff[0], 1e-9)
+	require.Equal(t, color.NRGBA{R: 255, A: 255}, res.Diff.NRGBAAt(3, 4))
+	require.NotEqual(t, color.NRGBA{R: 255, A: 255}, res.Diff.NRGBAAt(0, 0))
+
+	res, err = Compare(expected, actual, func(o *GoldenOptions) { o.Tolerance = [4]float64{2.0 / 255, 0, 0, 0} })
+	require.NoError(t, err)
+	require.True(t, res.OK)
+
+	res, err = Compare(expected, actual, func(o *GoldenOptions) { o.MaxMismatchPercent = 1 })
+	require.NoError(t, err)
+	require.True(t, res.OK)
+	require.Equal(t, 1.0, res.MismatchPercent())
+
+	metric := func(threshold float64) func(*GoldenOptions) {
+		return func(o *GoldenOptions) {
+			o.Metric = func(e, a image.Image) (float64, error) { return 0.5, nil }
+			o.MaxMetric = threshold
+		}
+	}
+
+	res, err = Compare(expected, actual, metric(0.6))
+	require.NoError(t, err)
+	require.True(t, res.OK)
+	require.Equal(t, 0.5, res.Metric)
+
+	res, err = Compare(expected, expected, metric(0.4))
+	require.NoError(t, err)
+	require.False(t, res.OK)
+
+	_, err = Compare(expected, image.NewNRGBA(image.Rect(0, 0, 5, 5)))
+	require.ErrorContains(t, err, "does not match the expected size")
+}
+
+// recorder records the failures of a test.
+type recorder struct {
+	testing.TB
+	name   string
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper()      {}
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Logf(format string, args ...any) {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+
+	runtime.Goexit()
+}
+
+// assertGolden runs AssertGolden in its own goroutine, which Fatalf exits.
+func assertGolden(r *recorder, path string, actual image.Image, optFns ...func(*GoldenOptions)) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		AssertGolden(r, path, actual, optFns...)
+	}()
+
+	<-done
+}
+
+func TestUpdateFlag(t *testing.T) {
+	// Test packages that import mtltest may define their own -update flag.
+	require.Nil(t, flag.Lookup("update"))
+	require.NotNil(t, flag.Lookup("mtltest.update"))
+}
+
+func TestAssertGolden(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "golden.png")
+	expected := newTestImage(color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	actual := newTestImage(color.NRGBA{R: 10, G: 20, B: 40, A: 255})
+
+	r := &recorder{name: "TestX/sub"}
+	assertGolden(r, golden, expected)
+	require.True(t, r.fatal)
+	require.Contains(t, r.errors[0], "-mtltest.update")
+
+	*update = true
+	r = &recorder{name: "TestX/sub"}
+	assertGolden(r, golden, expected)
+	*update = false
+
+	require.Empty(t, r.errors)
+
+	r = &recorder{name: "TestX/sub"}
+	assertGolden(r, golden, expected)
+	require.Empty(t, r.errors)
+
+	out := filepath.Join(dir, "failures")
+	assertGolden(r, golden, actual, func(o *GoldenOptions) { o.OutputDir = out })
+	require.Len(t, r.errors, 1)
+	require.Contains(t, r.errors[0], "100 of 100 pixels")
+
+	for _, suffix := range []string{"actual", "expected", "diff"} {
+		img, err := ReadPNG(filepath.Join(out, "TestX_sub_golden_"+suffix+".png"))
+		require.NoError(t, err, suffix)
+		require.Equal(t, expected.Bounds(), img.Bounds())
+	}
+}
@@ -0,0 +1,38 @@
+package mtltest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hupe1980/go-mtl/msl"
+)
+
+// AssertLayout checks that the Go struct of v, which may be a pointer, has the
+// memory layout of the MSL struct with the given name declared in source, and
+// reports each mismatched field, so values of v can be copied to buffers of the
+// struct. See msl.ValidateLayout for how fields are matched.
+func AssertLayout(t testing.TB, v any, source, name string) {
+	t.Helper()
+
+	m, err := msl.Reflect(source)
+	if err != nil {
+		t.Fatalf("cannot parse MSL source: %v", err)
+	}
+
+	mismatches, err := msl.ValidateLayout(reflect.TypeOf(v), m, name)
+	if err != nil {
+		t.Fatalf("cannot compare layouts: %v", err)
+	}
+
+	if len(mismatches) == 0 {
+		return
+	}
+
+	lines := make([]string, len(mismatches))
+	for i, mm := range mismatches {
+		lines[i] = mm.String()
+	}
+
+	t.Errorf("layout of %T does not match MSL struct %s:\n\t%s", v, name, strings.Join(lines, "\n\t"))
+}
@@ -0,0 +1,45 @@
+package mtltest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// assertLayout runs AssertLayout in its own goroutine, which Fatalf exits.
+func assertLayout(r *recorder, v any, source, name string) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		AssertLayout(r, v, source, name)
+	}()
+
+	<-done
+}
+
+func TestAssertLayout(t *testing.T) {
+	type vertex struct {
+		Position [4]float32
+		Normal   [3]float32
+		_        float32
+	}
+
+	r := &recorder{}
+	assertLayout(r, vertex{}, "struct Vertex { float4 position; float3 normal; };", "Vertex")
+	require.Empty(t, r.errors)
+
+	assertLayout(r, &vertex{}, "struct Vertex { float4 position; float normal; };", "Vertex")
+	require.Equal(t, []string{`layout of *mtltest.vertex does not match MSL struct Vertex:
+	normal: size 12 in Go, 4 in MSL`}, r.errors)
+
+	r = &recorder{}
+	assertLayout(r, vertex{}, "struct Vertex {", "Vertex")
+	require.True(t, r.fatal)
+	require.Contains(t, r.errors[0], "cannot parse MSL source")
+
+	r = &recorder{}
+	assertLayout(r, vertex{}, "", "Vertex")
+	require.True(t, r.fatal)
+	require.Equal(t, "cannot compare layouts: struct Vertex not found", r.errors[0])
+}
@@ -0,0 +1,834 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// BytesPerPixel returns the size of one pixel of an uncompressed pixel format,
+// or 0 for compressed, subsampled and unknown pixel formats.
+func (pf PixelFormat) BytesPerPixel() int {
+	if l, ok := pixelLayouts[pf]; ok {
+		return l.size
+	}
+
+	return 0
+}
+
+// IsSRGB reports whether the pixel format converts between sRGB and linear space when it is sampled or written.
+func (pf PixelFormat) IsSRGB() bool {
+	switch pf {
+	case PixelFormatR8UnormSRGB, PixelFormatRG8UnormSRGB, PixelFormatRGBA8UnormSRGB, PixelFormatBGRA8UnormSRGB,
+		PixelFormatPVRTCRGB2BPPSRGB, PixelFormatPVRTCRGB4BPPSRGB, PixelFormatPVRTCRGBA2BPPSRGB, PixelFormatPVRTCRGBA4BPPSRGB,
+		PixelFormatEACRGBA8SRGB, PixelFormatETC2RGB8SRGB, PixelFormatETC2RGB8A1SRGB,
+		PixelFormatASTC4x4SRGB, PixelFormatASTC5x4SRGB, PixelFormatASTC5x5SRGB, PixelFormatASTC6x5SRGB,
+		PixelFormatASTC6x6SRGB, PixelFormatASTC8x5SRGB, PixelFormatASTC8x6SRGB, PixelFormatASTC8x8SRGB,
+		PixelFormatASTC10x5SRGB, PixelFormatASTC10x6SRGB, PixelFormatASTC10x8SRGB, PixelFormatASTC10x10SRGB,
+		PixelFormatASTC12x10SRGB, PixelFormatASTC12x12SRGB,
+		PixelFormatBC1RGBASRGB, PixelFormatBC2RGBASRGB, PixelFormatBC3RGBASRGB, PixelFormatBC7RGBAUnormSRGB,
+		PixelFormatBGRA10XRSRGB, PixelFormatBGR10XRSRGB:
+		return true
+	}
+
+	return false
+}
+
+// astcBlockSizes holds the block dimensions of the ASTC pixel formats, indexed by
+// their offset from the first format of each profile.
+var astcBlockSizes = [...][2]int{
+	{4, 4}, {5, 4}, {5, 5}, {6, 5}, {6, 6}, {}, {8, 5}, {8, 6}, {8, 8},
+	{10, 5}, {10, 6}, {10, 8}, {10, 10}, {12, 10}, {12, 12},
+}
+
+// BlockSize returns the dimensions in pixels and the size in bytes of the smallest
+// addressable unit of a pixel format: one pixel for uncompressed formats, one block
+// for compressed formats and a pair of pixels for subsampled formats. It returns
+// zeros for unknown pixel formats.
+func (pf PixelFormat) BlockSize() (width, height, size int) {
+	if bpp := pf.BytesPerPixel(); bpp != 0 {
+		return 1, 1, bpp
+	}
+
+	var astc [2]int
+
+	switch {
+	case pf >= PixelFormatASTC4x4SRGB && pf <= PixelFormatASTC12x12SRGB:
+		astc = astcBlockSizes[pf-PixelFormatASTC4x4SRGB]
+	case pf >= PixelFormatASTC4x4LDR && pf <= PixelFormatASTC12x12LDR:
+		astc = astcBlockSizes[pf-PixelFormatASTC4x4LDR]
+	case pf >= PixelFormatASTC4x4HDR && pf <= PixelFormatASTC12x12HDR:
+		astc = astcBlockSizes[pf-PixelFormatASTC4x4HDR]
+	}
+
+	// The gaps in the ASTC ranges are not pixel formats.
+	if astc[0] != 0 {
+		return astc[0], astc[1], 16
+	}
+
+	switch pf {
+	case PixelFormatBC1RGBA, PixelFormatBC1RGBASRGB, PixelFormatBC4RUnorm, PixelFormatBC4RSnorm,
+		PixelFormatEACR11Unorm, PixelFormatEACR11Snorm, PixelFormatETC2RGB8, PixelFormatETC2RGB8SRGB,
+		PixelFormatETC2RGB8A1, PixelFormatETC2RGB8A1SRGB:
+		return 4, 4, 8
+	case PixelFormatBC2RGBA, PixelFormatBC2RGBASRGB, PixelFormatBC3RGBA, PixelFormatBC3RGBASRGB,
+		PixelFormatBC5RGUnorm, PixelFormatBC5RGSnorm, PixelFormatBC6HRGBFloat, PixelFormatBC6HRGBUfloat,
+		PixelFormatBC7RGBAUnorm, PixelFormatBC7RGBAUnormSRGB, PixelFormatEACRG11Unorm, PixelFormatEACRG11Snorm,
+		PixelFormatEACRGBA8, PixelFormatEACRGBA8SRGB:
+		return 4, 4, 16
+	case PixelFormatPVRTCRGB4BPP, PixelFormatPVRTCRGB4BPPSRGB, PixelFormatPVRTCRGBA4BPP, PixelFormatPVRTCRGBA4BPPSRGB:
+		return 4, 4, 8
+	case PixelFormatPVRTCRGB2BPP, PixelFormatPVRTCRGB2BPPSRGB, PixelFormatPVRTCRGBA2BPP, PixelFormatPVRTCRGBA2BPPSRGB:
+		return 8, 4, 8
+	case PixelFormatGBGR422, PixelFormatBGRG422:
+		return 2, 1, 4
+	}
+
+	return 0, 0, 0
+}
+
+// IsCompressed reports whether the pixel format stores blocks of pixels in a compressed form.
+func (pf PixelFormat) IsCompressed() bool {
+	w, h, _ := pf.BlockSize()
+	return w*h > 1 && pf != PixelFormatGBGR422 && pf != PixelFormatBGRG422
+}
+
+// isPVRTC reports whether the pixel format is one of the PVRTC formats.
+func (pf PixelFormat) isPVRTC() bool {
+	return pf >= PixelFormatPVRTCRGB2BPP && pf <= PixelFormatPVRTCRGBA4BPPSRGB
+}
+
+// imageSize returns the size in bytes of one row of blocks and the number of rows
+// of blocks of a width by height image. PVRTC images span at least 2x2 blocks.
+func (pf PixelFormat) imageSize(width, height int) (bytesPerRow, rows int) {
+	bw, bh, size := pf.BlockSize()
+	if size == 0 {
+		return 0, 0
+	}
+
+	cols := (width + bw - 1) / bw
+	rows = (height + bh - 1) / bh
+
+	if pf.isPVRTC() {
+		if cols < 2 {
+			cols = 2
+		}
+
+		if rows < 2 {
+			rows = 2
+		}
+	}
+
+	return cols * size, rows
+}
+
+// componentType is the numeric interpretation of the components of a pixel format.
+type componentType uint8
+
+const (
+	componentUnorm componentType = iota
+	componentSnorm
+	componentUint
+	componentSint
+	componentFloat
+)
+
+// pixelLayout describes the memory layout of an uncompressed pixel format.
+//
+// Pixels are decoded to and encoded from the RGBA values a shader would see when
+// reading or writing the texture: normalized formats produce values in [0, 1] or
+// [-1, 1], integer formats produce the integer values and missing channels read
+// as 0 for color and 1 for alpha. sRGB formats are not linearized.
+type pixelLayout struct {
+	// size is the number of bytes per pixel.
+	size int
+
+	// typ is the numeric interpretation of the components.
+	typ componentType
+
+	// bits is the number of bits of the red, green, blue and alpha channels,
+	// or 0 for channels the pixel format does not store.
+	bits [4]int
+
+	// offsets holds the offset in bits of the red, green, blue and alpha channels
+	// within a little-endian pixel.
+	offsets [4]int
+
+	// srgb indicates a pixel format that stores sRGB-encoded colors.
+	srgb bool
+
+	// gray indicates a pixel format with a single red, depth or stencil channel.
+	gray bool
+
+	// fixedScale and fixedBias describe floating-point channels that store the
+	// unsigned fixed-point value v*fixedScale+fixedBias, as the extended range
+	// pixel formats do. fixedScale is 0 for all other pixel formats.
+	fixedScale, fixedBias int
+
+	decode func(src []byte) [4]float32
+	encode func(dst []byte, v [4]float32)
+
+	// truncate rounds v toward zero to values that encode stores exactly. It is
+	// nil for pixel formats whose values are quantized with step or stored as is.
+	truncate func(v [4]float32) [4]float32
+}
+
+// step returns the spacing between two representable values of the channel,
+// or 0 for floating-point channels and channels the pixel format does not store.
+func (l pixelLayout) step(channel int) float32 {
+	n := l.bits[channel]
+	if n == 0 {
+		return 0
+	}
+
+	if l.fixedScale != 0 {
+		return 1 / float32(l.fixedScale)
+	}
+
+	if l.typ == componentFloat {
+		return 0
+	}
+
+	switch l.typ {
+	case componentUnorm:
+		return 1 / float32(uint64(1)<<n-1)
+	case componentSnorm:
+		return 1 / float32(uint64(1)<<(n-1)-1)
+	}
+
+	return 1
+}
+
+// pixelLayouts holds the layouts of all uncompressed pixel formats.
+var pixelLayouts = map[PixelFormat]pixelLayout{
+	// Ordinary 8-bit pixel formats.
+	PixelFormatA8Unorm:     ordinaryLayout(componentUnorm, 8, "a", false),
+	PixelFormatR8Unorm:     ordinaryLayout(componentUnorm, 8, "r", false),
+	PixelFormatR8UnormSRGB: ordinaryLayout(componentUnorm, 8, "r", true),
+	PixelFormatR8Snorm:     ordinaryLayout(componentSnorm, 8, "r", false),
+	PixelFormatR8Uint:      ordinaryLayout(componentUint, 8, "r", false),
+	PixelFormatR8Sint:      ordinaryLayout(componentSint, 8, "r", false),
+
+	// Ordinary and packed 16-bit pixel formats.
+	PixelFormatR16Unorm:     ordinaryLayout(componentUnorm, 16, "r", false),
+	PixelFormatR16Snorm:     ordinaryLayout(componentSnorm, 16, "r", false),
+	PixelFormatR16Uint:      ordinaryLayout(componentUint, 16, "r", false),
+	PixelFormatR16Sint:      ordinaryLayout(componentSint, 16, "r", false),
+	PixelFormatR16Float:     ordinaryLayout(componentFloat, 16, "r", false),
+	PixelFormatRG8Unorm:     ordinaryLayout(componentUnorm, 8, "rg", false),
+	PixelFormatRG8UnormSRGB: ordinaryLayout(componentUnorm, 8, "rg", true),
+	PixelFormatRG8Snorm:     ordinaryLayout(componentSnorm, 8, "rg", false),
+	PixelFormatRG8Uint:      ordinaryLayout(componentUint, 8, "rg", false),
+	PixelFormatRG8Sint:      ordinaryLayout(componentSint, 8, "rg", false),
+	PixelFormatB5G6R5Unorm:  packedLayout(2, componentUnorm, [4]uint{11, 5, 0, 0}, [4]int{5, 6, 5, 0}),
+	PixelFormatA1BGR5Unorm:  packedLayout(2, componentUnorm, [4]uint{11, 6, 1, 0}, [4]int{5, 5, 5, 1}),
+	PixelFormatABGR4Unorm:   packedLayout(2, componentUnorm, [4]uint{12, 8, 4, 0}, [4]int{4, 4, 4, 4}),
+	PixelFormatBGR5A1Unorm:  packedLayout(2, componentUnorm, [4]uint{10, 5, 0, 15}, [4]int{5, 5, 5, 1}),
+
+	// Ordinary and packed 32-bit pixel formats.
+	PixelFormatR32Uint:        ordinaryLayout(componentUint, 32, "r", false),
+	PixelFormatR32Sint:        ordinaryLayout(componentSint, 32, "r", false),
+	PixelFormatR32Float:       ordinaryLayout(componentFloat, 32, "r", false),
+	PixelFormatRG16Unorm:      ordinaryLayout(componentUnorm, 16, "rg", false),
+	PixelFormatRG16Snorm:      ordinaryLayout(componentSnorm, 16, "rg", false),
+	PixelFormatRG16Uint:       ordinaryLayout(componentUint, 16, "rg", false),
+	PixelFormatRG16Sint:       ordinaryLayout(componentSint, 16, "rg", false),
+	PixelFormatRG16Float:      ordinaryLayout(componentFloat, 16, "rg", false),
+	PixelFormatRGBA8Unorm:     ordinaryLayout(componentUnorm, 8, "rgba", false),
+	PixelFormatRGBA8UnormSRGB: ordinaryLayout(componentUnorm, 8, "rgba", true),
+	PixelFormatRGBA8Snorm:     ordinaryLayout(componentSnorm, 8, "rgba", false),
+	PixelFormatRGBA8Uint:      ordinaryLayout(componentUint, 8, "rgba", false),
+	PixelFormatRGBA8Sint:      ordinaryLayout(componentSint, 8, "rgba", false),
+	PixelFormatBGRA8Unorm:     ordinaryLayout(componentUnorm, 8, "bgra", false),
+	PixelFormatBGRA8UnormSRGB: ordinaryLayout(componentUnorm, 8, "bgra", true),
+	PixelFormatBGR10A2Unorm:   packedLayout(4, componentUnorm, [4]uint{20, 10, 0, 30}, [4]int{10, 10, 10, 2}),
+	PixelFormatRGB10A2Unorm:   packedLayout(4, componentUnorm, [4]uint{0, 10, 20, 30}, [4]int{10, 10, 10, 2}),
+	PixelFormatRGB10A2Uint:    packedLayout(4, componentUint, [4]uint{0, 10, 20, 30}, [4]int{10, 10, 10, 2}),
+	PixelFormatRG11B10Float:   rg11b10Layout(),
+	PixelFormatRGB9E5Float:    rgb9e5Layout(),
+
+	// Ordinary 64-bit and 128-bit pixel formats.
+	PixelFormatRG32Uint:    ordinaryLayout(componentUint, 32, "rg", false),
+	PixelFormatRG32Sint:    ordinaryLayout(componentSint, 32, "rg", false),
+	PixelFormatRG32Float:   ordinaryLayout(componentFloat, 32, "rg", false),
+	PixelFormatRGBA16Unorm: ordinaryLayout(componentUnorm, 16, "rgba", false),
+	PixelFormatRGBA16Snorm: ordinaryLayout(componentSnorm, 16, "rgba", false),
+	PixelFormatRGBA16Uint:  ordinaryLayout(componentUint, 16, "rgba", false),
+	PixelFormatRGBA16Sint:  ordinaryLayout(componentSint, 16, "rgba", false),
+	PixelFormatRGBA16Float: ordinaryLayout(componentFloat, 16, "rgba", false),
+	PixelFormatRGBA32Uint:  ordinaryLayout(componentUint, 32, "rgba", false),
+	PixelFormatRGBA32Sint:  ordinaryLayout(componentSint, 32, "rgba", false),
+	PixelFormatRGBA32Float: ordinaryLayout(componentFloat, 32, "rgba", false),
+
+	// Depth and stencil pixel formats.
+	PixelFormatDepth16Unorm:         ordinaryLayout(componentUnorm, 16, "r", false),
+	PixelFormatDepth32Float:         ordinaryLayout(componentFloat, 32, "r", false),
+	PixelFormatStencil8:             ordinaryLayout(componentUint, 8, "r", false),
+	PixelFormatDepth24UnormStencil8: depthStencilLayout(PixelFormatDepth24UnormStencil8),
+	PixelFormatDepth32FloatStencil8: depthStencilLayout(PixelFormatDepth32FloatStencil8),
+	PixelFormatX32Stencil8:          depthStencilLayout(PixelFormatX32Stencil8),
+	PixelFormatX24Stencil8:          depthStencilLayout(PixelFormatX24Stencil8),
+
+	// Extended range pixel formats.
+	PixelFormatBGRA10XR:     extendedRangeLayout(8, false),
+	PixelFormatBGRA10XRSRGB: extendedRangeLayout(8, true),
+	PixelFormatBGR10XR:      extendedRangeLayout(4, false),
+	PixelFormatBGR10XRSRGB:  extendedRangeLayout(4, true),
+}
+
+// ordinaryLayout returns the layout of a pixel format that stores every channel
+// in its own component of bits bits, in the channel order given by order.
+func ordinaryLayout(typ componentType, bits int, order string, srgb bool) pixelLayout {
+	n := bits / 8
+
+	channels := make([]int, len(order))
+	l := pixelLayout{
+		size: n * len(order),
+		typ:  typ,
+		srgb: srgb,
+		gray: order == "r",
+	}
+
+	for i, c := range order {
+		channels[i] = map[rune]int{'r': 0, 'g': 1, 'b': 2, 'a': 3}[c]
+		l.bits[channels[i]] = bits
+		l.offsets[channels[i]] = i * bits
+	}
+
+	l.decode = func(src []byte) [4]float32 {
+		v := [4]float32{0, 0, 0, 1}
+		for i, c := range channels {
+			v[c] = decodeComponent(src[i*n:], typ, bits)
+		}
+
+		return v
+	}
+
+	l.encode = func(dst []byte, v [4]float32) {
+		for i, c := range channels {
+			encodeComponent(dst[i*n:], typ, bits, v[c])
+		}
+	}
+
+	if typ == componentFloat && bits == 16 {
+		l.truncate = func(v [4]float32) [4]float32 {
+			for _, c := range channels {
+				v[c] = truncateSmallFloat(v[c], 10)
+			}
+
+			return v
+		}
+	}
+
+	return l
+}
+
+// decodeComponent reads a little-endian component of the given type and size.
+func decodeComponent(src []byte, typ componentType, bits int) float32 {
+	var u uint32
+
+	switch bits {
+	case 8:
+		u = uint32(src[0])
+	case 16:
+		u = uint32(binary.LittleEndian.Uint16(src))
+	default:
+		u = binary.LittleEndian.Uint32(src)
+	}
+
+	switch typ {
+	case componentUnorm:
+		return float32(float64(u) / float64(uint64(1)<<bits-1))
+	case componentSnorm:
+		s := signExtend(u, bits)
+		return float32(math.Max(-1, float64(s)/float64(int64(1)<<(bits-1)-1)))
+	case componentUint:
+		return float32(u)
+	case componentSint:
+		return float32(signExtend(u, bits))
+	}
+
+	if bits == 16 {
+		return halfToFloat32(uint16(u))
+	}
+
+	return math.Float32frombits(u)
+}
+
+// encodeComponent writes a little-endian component of the given type and size,
+// rounding to the nearest representable value and clamping to its range.
+func encodeComponent(dst []byte, typ componentType, bits int, v float32) {
+	var u uint32
+
+	switch typ {
+	case componentUnorm:
+		u = unormQuantize(v, uint32(uint64(1)<<bits-1))
+	case componentSnorm:
+		m := float64(int64(1)<<(bits-1) - 1)
+		u = uint32(int32(math.RoundToEven(clamp(float64(v), -1, 1) * m)))
+	case componentUint:
+		u = uint32(clamp(math.RoundToEven(float64(v)), 0, float64(uint64(1)<<bits-1)))
+	case componentSint:
+		m := float64(int64(1) << (bits - 1))
+		u = uint32(int32(clamp(math.RoundToEven(float64(v)), -m, m-1)))
+	default:
+		if bits == 16 {
+			u = uint32(float32ToHalf(v))
+		} else {
+			u = math.Float32bits(v)
+		}
+	}
+
+	switch bits {
+	case 8:
+		dst[0] = uint8(u)
+	case 16:
+		binary.LittleEndian.PutUint16(dst, uint16(u))
+	default:
+		binary.LittleEndian.PutUint32(dst, u)
+	}
+}
+
+// packedLayout returns the layout of a packed unsigned pixel format of size bytes,
+// given the bit offset and bit count of every channel.
+func packedLayout(size int, typ componentType, shifts [4]uint, bits [4]int) pixelLayout {
+	l := pixelLayout{
+		size:    size,
+		typ:     typ,
+		bits:    bits,
+		offsets: [4]int{int(shifts[0]), int(shifts[1]), int(shifts[2]), int(shifts[3])},
+	}
+
+	read := func(src []byte) uint32 {
+		if size == 2 {
+			return uint32(binary.LittleEndian.Uint16(src))
+		}
+
+		return binary.LittleEndian.Uint32(src)
+	}
+
+	l.decode = func(src []byte) [4]float32 {
+		p := read(src)
+		v := [4]float32{0, 0, 0, 1}
+
+		for c, n := range bits {
+			if n == 0 {
+				continue
+			}
+
+			m := uint32(1)<<n - 1
+			if typ == componentUint {
+				v[c] = float32(p >> shifts[c] & m)
+			} else {
+				v[c] = float32(p>>shifts[c]&m) / float32(m)
+			}
+		}
+
+		return v
+	}
+
+	l.encode = func(dst []byte, v [4]float32) {
+		var p uint32
+
+		for c, n := range bits {
+			if n == 0 {
+				continue
+			}
+
+			m := uint32(1)<<n - 1
+			if typ == componentUint {
+				p |= uint32(clamp(math.RoundToEven(float64(v[c])), 0, float64(m))) << shifts[c]
+			} else {
+				p |= unormQuantize(v[c], m) << shifts[c]
+			}
+		}
+
+		if size == 2 {
+			binary.LittleEndian.PutUint16(dst, uint16(p))
+		} else {
+			binary.LittleEndian.PutUint32(dst, p)
+		}
+	}
+
+	return l
+}
+
+// rg11b10Layout returns the layout of PixelFormatRG11B10Float.
+func rg11b10Layout() pixelLayout {
+	return pixelLayout{
+		size:    4,
+		typ:     componentFloat,
+		bits:    [4]int{11, 11, 10, 0},
+		offsets: [4]int{0, 11, 22, 0},
+		decode: func(src []byte) [4]float32 {
+			u := binary.LittleEndian.Uint32(src)
+			return [4]float32{
+				smallFloatToFloat32(u&0x7ff, 6),
+				smallFloatToFloat32(u>>11&0x7ff, 6),
+				smallFloatToFloat32(u>>22&0x3ff, 5),
+				1,
+			}
+		},
+		encode: func(dst []byte, v [4]float32) {
+			binary.LittleEndian.PutUint32(dst, float32ToSmallFloat(v[0], 6, false)|
+				float32ToSmallFloat(v[1], 6, false)<<11|
+				float32ToSmallFloat(v[2], 5, false)<<22)
+		},
+		truncate: func(v [4]float32) [4]float32 {
+			return [4]float32{truncateSmallFloat(v[0], 6), truncateSmallFloat(v[1], 6), truncateSmallFloat(v[2], 5), v[3]}
+		},
+	}
+}
+
+// rgb9e5Layout returns the layout of PixelFormatRGB9E5Float.
+func rgb9e5Layout() pixelLayout {
+	return pixelLayout{
+		size:    4,
+		typ:     componentFloat,
+		bits:    [4]int{9, 9, 9, 0},
+		offsets: [4]int{0, 9, 18, 0},
+		decode: func(src []byte) [4]float32 {
+			r, g, b := DecodeRGB9E5(binary.LittleEndian.Uint32(src))
+			return [4]float32{r, g, b, 1}
+		},
+		encode: func(dst []byte, v [4]float32) {
+			binary.LittleEndian.PutUint32(dst, EncodeRGB9E5(v[0], v[1], v[2]))
+		},
+		truncate: truncateRGB9E5,
+	}
+}
+
+// depthStencilLayout returns the layout of a combined depth and stencil pixel format,
+// which decodes depth to the red and stencil to the green channel. Stencil-only
+// views decode stencil to the red channel.
+func depthStencilLayout(pf PixelFormat) pixelLayout {
+	size, _, _ := depthStencilBytesPerPixel(pf)
+
+	l := pixelLayout{
+		size: size,
+		typ:  componentUint,
+		bits: [4]int{8, 0, 0, 0},
+		gray: true,
+	}
+
+	switch pf {
+	case PixelFormatDepth24UnormStencil8:
+		l.typ = componentUnorm
+		l.bits = [4]int{24, 8, 0, 0}
+		l.offsets = [4]int{0, 24, 0, 0}
+	case PixelFormatDepth32FloatStencil8:
+		l.typ = componentFloat
+		l.bits = [4]int{32, 8, 0, 0}
+		l.offsets = [4]int{0, 32, 0, 0}
+	case PixelFormatX24Stencil8:
+		l.offsets = [4]int{24, 0, 0, 0}
+	case PixelFormatX32Stencil8:
+		l.offsets = [4]int{32, 0, 0, 0}
+	}
+
+	l.decode = func(src []byte) [4]float32 {
+		switch pf {
+		case PixelFormatDepth24UnormStencil8:
+			d, s := UnpackDepth24UnormStencil8(src)
+			return [4]float32{d, float32(s), 0, 1}
+		case PixelFormatDepth32FloatStencil8:
+			d, s := UnpackDepth32FloatStencil8(src)
+			return [4]float32{d, float32(s), 0, 1}
+		case PixelFormatX24Stencil8:
+			return [4]float32{float32(UnpackX24Stencil8(src)), 0, 0, 1}
+		}
+
+		return [4]float32{float32(UnpackX32Stencil8(src)), 0, 0, 1}
+	}
+
+	l.encode = func(dst []byte, v [4]float32) {
+		switch pf {
+		case PixelFormatDepth24UnormStencil8:
+			PackDepth24UnormStencil8(dst, v[0], uint8(clamp(math.RoundToEven(float64(v[1])), 0, 255)))
+		case PixelFormatDepth32FloatStencil8:
+			PackDepth32FloatStencil8(dst, v[0], uint8(clamp(math.RoundToEven(float64(v[1])), 0, 255)))
+		case PixelFormatX24Stencil8:
+			PackX24Stencil8(dst, uint8(clamp(math.RoundToEven(float64(v[0])), 0, 255)))
+		default:
+			PackX32Stencil8(dst, uint8(clamp(math.RoundToEven(float64(v[0])), 0, 255)))
+		}
+	}
+
+	return l
+}
+
+// extendedRangeLayout returns the layout of the extended range BGR10 pixel formats.
+// Every channel stores a 10-bit value that maps 384 to 0 and 894 to 1. The 64-bit
+// format stores each channel in the upper bits of a 16-bit word, the 32-bit format
+// packs blue, green and red from the least significant bit.
+func extendedRangeLayout(size int, srgb bool) pixelLayout {
+	const (
+		bias  = 384
+		scale = 510
+	)
+
+	toFloat := func(u uint32) float32 { return float32(int32(u&0x3ff)-bias) / scale }
+	fromFloat := func(v float32) uint32 {
+		return uint32(clamp(math.RoundToEven(float64(v)*scale+bias), 0, 1023))
+	}
+
+	l := pixelLayout{
+		size:       size,
+		typ:        componentFloat,
+		bits:       [4]int{10, 10, 10, 0},
+		offsets:    [4]int{20, 10, 0, 0},
+		srgb:       srgb,
+		fixedScale: scale,
+		fixedBias:  bias,
+	}
+
+	if size == 8 {
+		l.bits[3] = 10
+		l.offsets = [4]int{38, 22, 6, 54}
+		l.decode = func(src []byte) [4]float32 {
+			return [4]float32{
+				toFloat(uint32(binary.LittleEndian.Uint16(src[4:]) >> 6)),
+				toFloat(uint32(binary.LittleEndian.Uint16(src[2:]) >> 6)),
+				toFloat(uint32(binary.LittleEndian.Uint16(src[0:]) >> 6)),
+				toFloat(uint32(binary.LittleEndian.Uint16(src[6:]) >> 6)),
+			}
+		}
+		l.encode = func(dst []byte, v [4]float32) {
+			binary.LittleEndian.PutUint16(dst[0:], uint16(fromFloat(v[2])<<6))
+			binary.LittleEndian.PutUint16(dst[2:], uint16(fromFloat(v[1])<<6))
+			binary.LittleEndian.PutUint16(dst[4:], uint16(fromFloat(v[0])<<6))
+			binary.LittleEndian.PutUint16(dst[6:], uint16(fromFloat(v[3])<<6))
+		}
+
+		return l
+	}
+
+	l.decode = func(src []byte) [4]float32 {
+		u := binary.LittleEndian.Uint32(src)
+		return [4]float32{toFloat(u >> 20), toFloat(u >> 10), toFloat(u), 1}
+	}
+	l.encode = func(dst []byte, v [4]float32) {
+		binary.LittleEndian.PutUint32(dst, fromFloat(v[0])<<20|fromFloat(v[1])<<10|fromFloat(v[2]))
+	}
+
+	return l
+}
+
+// EncodeRGB9E5 packs three non-negative floating-point values into the
+// PixelFormatRGB9E5Float shared exponent layout. Negative values and NaN are
+// stored as 0, values too large to represent are clamped to the largest one.
+func EncodeRGB9E5(r, g, b float32) uint32 {
+	const (
+		mantissaBits = 9
+		expBias      = 15
+		maxExp       = 31
+		maxValue     = float64(1<<mantissaBits-1) / (1 << mantissaBits) * (1 << (maxExp - expBias))
+	)
+
+	rc := clamp(float64(r), 0, maxValue)
+	gc := clamp(float64(g), 0, maxValue)
+	bc := clamp(float64(b), 0, maxValue)
+	maxc := math.Max(rc, math.Max(gc, bc))
+
+	exp := int(math.Max(-expBias-1, math.Floor(math.Log2(maxc)))) + 1 + expBias
+	if maxc == 0 {
+		exp = 0
+	}
+
+	scale := math.Ldexp(1, exp-expBias-mantissaBits)
+	if math.Floor(maxc/scale+0.5) == 1<<mantissaBits {
+		exp++
+		scale *= 2
+	}
+
+	rm := uint32(math.Floor(rc/scale + 0.5))
+	gm := uint32(math.Floor(gc/scale + 0.5))
+	bm := uint32(math.Floor(bc/scale + 0.5))
+
+	return rm | gm<<9 | bm<<18 | uint32(exp)<<27
+}
+
+// DecodeRGB9E5 unpacks a value in the PixelFormatRGB9E5Float shared exponent layout.
+func DecodeRGB9E5(v uint32) (r, g, b float32) {
+	scale := math.Ldexp(1, int(v>>27)-15-9)
+
+	return float32(float64(v&0x1ff) * scale),
+		float32(float64(v>>9&0x1ff) * scale),
+		float32(float64(v>>18&0x1ff) * scale)
+}
+
+// truncateRGB9E5 rounds the red, green and blue values of v toward zero to values
+// that EncodeRGB9E5 stores exactly, using the shared exponent of the largest one.
+func truncateRGB9E5(v [4]float32) [4]float32 {
+	maxValue := math.Ldexp(511, 16-9)
+
+	var maxc float64
+	for c := 0; c < 3; c++ {
+		maxc = math.Max(maxc, clamp(float64(v[c]), 0, maxValue))
+	}
+
+	if maxc == 0 {
+		return [4]float32{0, 0, 0, v[3]}
+	}
+
+	// The shared exponent covers the largest value with 9 mantissa bits and
+	// is at least the smallest exponent of the pixel format.
+	_, exp := math.Frexp(maxc)
+	if exp < -15 {
+		exp = -15
+	}
+
+	scale := math.Ldexp(1, exp-9)
+	for c := 0; c < 3; c++ {
+		v[c] = float32(math.Floor(clamp(float64(v[c]), 0, maxValue)/scale) * scale)
+	}
+
+	return v
+}
+
+// halfToFloat32 converts an IEEE 754 half-precision value to float32.
+func halfToFloat32(h uint16) float32 {
+	f := smallFloatToFloat32(uint32(h&0x7fff), 10)
+	if h&0x8000 != 0 {
+		return -f
+	}
+
+	return f
+}
+
+// float32ToHalf converts a float32 to the nearest IEEE 754 half-precision value.
+func float32ToHalf(f float32) uint16 {
+	return uint16(float32ToSmallFloat(f, 10, true))
+}
+
+// smallFloatToFloat32 converts an unsigned floating-point value with a 5-bit
+// exponent and mantissaBits mantissa bits, as used by half, 11-bit and 10-bit floats.
+func smallFloatToFloat32(v uint32, mantissaBits uint) float32 {
+	e := int(v >> mantissaBits & 0x1f)
+	m := float64(v & (1<<mantissaBits - 1))
+
+	switch e {
+	case 0:
+		return float32(math.Ldexp(m, -14-int(mantissaBits)))
+	case 0x1f:
+		if m != 0 {
+			return float32(math.NaN())
+		}
+
+		return float32(math.Inf(1))
+	}
+
+	return float32(math.Ldexp(1+m/float64(uint32(1)<<mantissaBits), e-15))
+}
+
+// float32ToSmallFloat converts a float32 to the nearest floating-point value with
+// a 5-bit exponent and mantissaBits mantissa bits, rounding to nearest even.
+// With signed set, the sign is stored in the bit above the exponent, otherwise
+// negative values are stored as 0. Values too large to represent become infinity.
+func float32ToSmallFloat(f float32, mantissaBits uint, signed bool) uint32 {
+	bits := math.Float32bits(f)
+	exp := int(bits >> 23 & 0xff)
+	mant := bits & 0x7fffff
+
+	var sign uint32
+	if bits>>31 != 0 {
+		if !signed && (exp != 0xff || mant == 0) {
+			return 0
+		}
+
+		if signed {
+			sign = 1 << (mantissaBits + 5)
+		}
+	}
+
+	inf := uint32(0x1f) << mantissaBits
+
+	if exp == 0xff {
+		if mant != 0 {
+			return sign | inf | 1<<(mantissaBits-1)
+		}
+
+		return sign | inf
+	}
+
+	e := exp - 127 + 15
+	if e <= 0 {
+		// The result is subnormal or rounds to the smallest normal value.
+		return sign | roundShift(mant|0x800000, uint(136-exp)-mantissaBits)
+	}
+
+	r := uint32(e)<<mantissaBits + roundShift(mant, 23-mantissaBits)
+	if r >= inf {
+		return sign | inf
+	}
+
+	return sign | r
+}
+
+// truncateSmallFloat rounds f toward zero to a floating-point value with a 5-bit
+// exponent and mantissaBits mantissa bits. Values too large to represent become
+// the largest finite value, while infinity and NaN are returned as is.
+func truncateSmallFloat(f float32, mantissaBits uint) float32 {
+	a := math.Abs(float64(f))
+	if a == 0 || math.IsInf(a, 0) || math.IsNaN(a) {
+		return f
+	}
+
+	// The largest finite value has the highest exponent below 0x1f and all
+	// mantissa bits set.
+	maxValue := math.Ldexp(2-math.Ldexp(1, -int(mantissaBits)), 15)
+	if a > maxValue {
+		a = maxValue
+	}
+
+	// Subnormal values share the spacing of the smallest normal values.
+	_, exp := math.Frexp(a)
+	if exp < -13 {
+		exp = -13
+	}
+
+	step := math.Ldexp(1, exp-1-int(mantissaBits))
+
+	return float32(math.Copysign(math.Floor(a/step)*step, float64(f)))
+}
+
+// roundShift shifts v right by s bits, rounding to nearest even.
+func roundShift(v uint32, s uint) uint32 {
+	if s == 0 {
+		return v
+	}
+
+	if s > 25 {
+		return 0
+	}
+
+	half := uint32(1) << (s - 1)
+	rem := v & (1<<s - 1)
+	r := v >> s
+
+	if rem > half || (rem == half && r&1 == 1) {
+		r++
+	}
+
+	return r
+}
+
+// signExtend interprets the lowest bits bits of u as a two's complement integer.
+func signExtend(u uint32, bits int) int32 {
+	shift := uint(32 - bits)
+	return int32(u<<shift) >> shift
+}
+
+// clamp limits v to the range [lo, hi]. NaN becomes lo.
+func clamp(v, lo, hi float64) float64 {
+	switch {
+	case !(v >= lo):
+		return lo
+	case v > hi:
+		return hi
+	}
+
+	return v
+}
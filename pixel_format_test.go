@@ -0,0 +1,181 @@
+package mtl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPixelFormatBytesPerPixel(t *testing.T) {
+	require.Equal(t, 1, PixelFormatA8Unorm.BytesPerPixel())
+	require.Equal(t, 2, PixelFormatB5G6R5Unorm.BytesPerPixel())
+	require.Equal(t, 4, PixelFormatBGRA8UnormSRGB.BytesPerPixel())
+	require.Equal(t, 8, PixelFormatDepth32FloatStencil8.BytesPerPixel())
+	require.Equal(t, 16, PixelFormatRGBA32Float.BytesPerPixel())
+	require.Equal(t, 0, PixelFormatBC7RGBAUnorm.BytesPerPixel())
+	require.Equal(t, 0, PixelFormatGBGR422.BytesPerPixel())
+
+	require.True(t, PixelFormatRGBA8UnormSRGB.IsSRGB())
+	require.True(t, PixelFormatASTC4x4SRGB.IsSRGB())
+	require.False(t, PixelFormatRGBA8Unorm.IsSRGB())
+}
+
+func TestPixelLayoutRoundTrip(t *testing.T) {
+	for pf, l := range pixelLayouts {
+		v := [4]float32{0.25, 0.5, 0.75, 1}
+
+		for c := range v {
+			switch l.typ {
+			case componentSnorm:
+				v[c] = v[c]*2 - 1
+			case componentUint, componentSint:
+				v[c] = float32(c)
+			}
+
+			// Combined depth and stencil formats decode the stencil value unnormalized.
+			if c == 1 && l.bits[1] == 8 && l.bits[0] >= 24 {
+				v[c] = 3
+			}
+
+			if l.bits[c] == 0 {
+				v[c] = 0
+				if c == 3 {
+					v[c] = 1
+				}
+			}
+		}
+
+		// Tolerate the precision of the narrowest channel.
+		tolerance := float64(0)
+		for c := range l.bits {
+			if s := float64(l.step(c)); s/2 > tolerance {
+				tolerance = s / 2
+			}
+		}
+
+		if l.typ == componentFloat {
+			tolerance = 1.0 / 64
+		}
+
+		b := make([]byte, l.size)
+		l.encode(b, v)
+		got := l.decode(b)
+
+		if l.gray && l.bits[1] == 0 {
+			require.InDelta(t, v[0], got[0], tolerance+1e-6, "pixel format %d", pf)
+			continue
+		}
+
+		for c := range v {
+			if l.bits[c] != 0 {
+				require.InDelta(t, v[c], got[c], tolerance+1e-6, "pixel format %d channel %d", pf, c)
+			}
+		}
+	}
+}
+
+func TestPixelLayoutChannelOrder(t *testing.T) {
+	b := make([]byte, 4)
+
+	pixelLayouts[PixelFormatBGRA8Unorm].encode(b, [4]float32{1, 0, 0, 1})
+	require.Equal(t, []byte{0, 0, 255, 255}, b)
+
+	pixelLayouts[PixelFormatRGB10A2Unorm].encode(b, [4]float32{1, 0, 0, 0})
+	require.Equal(t, []byte{0xff, 0x03, 0, 0}, b)
+
+	pixelLayouts[PixelFormatBGR10A2Unorm].encode(b, [4]float32{0, 0, 1, 1})
+	require.Equal(t, []byte{0xff, 0x03, 0, 0xc0}, b)
+
+	pixelLayouts[PixelFormatB5G6R5Unorm].encode(b, [4]float32{0, 0, 1, 1})
+	require.Equal(t, []byte{0x1f, 0}, b[:2])
+
+	pixelLayouts[PixelFormatR8Snorm].encode(b, [4]float32{-1, 0, 0, 1})
+	require.Equal(t, byte(0x81), b[0])
+	require.Equal(t, float32(-1), pixelLayouts[PixelFormatR8Snorm].decode([]byte{0x80})[0])
+
+	require.Equal(t, [4]float32{0, 0, 0, 0.6}, pixelLayouts[PixelFormatA8Unorm].decode([]byte{153}))
+}
+
+func TestHalfConversion(t *testing.T) {
+	for _, tt := range []struct {
+		f float32
+		h uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{float32(math.Inf(-1)), 0xfc00},
+		{5.9604645e-08, 0x0001},
+		{6.1035156e-05, 0x0400},
+		{1.0009765625, 0x3c01},
+	} {
+		require.Equal(t, tt.h, float32ToHalf(tt.f), "%v", tt.f)
+		require.Equal(t, tt.f, halfToFloat32(tt.h), "%#04x", tt.h)
+	}
+
+	// Values that round past the largest finite half overflow to infinity.
+	require.Equal(t, uint16(0x7c00), float32ToHalf(65520))
+
+	// Ties round to even.
+	require.Equal(t, uint16(0x3c00), float32ToHalf(1+1.0/2048))
+	require.Equal(t, uint16(0x3c02), float32ToHalf(1+3.0/2048))
+	require.True(t, math.IsNaN(float64(halfToFloat32(float32ToHalf(float32(math.NaN()))))))
+}
+
+func TestSmallFloatConversion(t *testing.T) {
+	require.Equal(t, uint32(0x3c0), float32ToSmallFloat(1, 6, false))
+	require.Equal(t, uint32(0x1e0), float32ToSmallFloat(1, 5, false))
+	require.Equal(t, uint32(0), float32ToSmallFloat(-1, 6, false))
+	require.Equal(t, float32(65024), smallFloatToFloat32(0x7bf, 6))
+	require.Equal(t, float32(64512), smallFloatToFloat32(0x3df, 5))
+}
+
+func TestRGB9E5(t *testing.T) {
+	require.Equal(t, uint32(0), EncodeRGB9E5(0, 0, 0))
+
+	r, g, b := DecodeRGB9E5(EncodeRGB9E5(1, 0.5, 0.25))
+	require.Equal(t, []float32{1, 0.5, 0.25}, []float32{r, g, b})
+
+	r, g, b = DecodeRGB9E5(EncodeRGB9E5(100, -1, float32(math.NaN())))
+	require.Equal(t, []float32{100, 0, 0}, []float32{r, g, b})
+
+	r, _, _ = DecodeRGB9E5(EncodeRGB9E5(1e9, 0, 0))
+	require.Equal(t, float32(65408), r)
+}
+
+func TestPixelFormatBlockSize(t *testing.T) {
+	for _, tt := range []struct {
+		pf                  PixelFormat
+		width, height, size int
+	}{
+		{PixelFormatRGBA8Unorm, 1, 1, 4},
+		{PixelFormatBC1RGBA, 4, 4, 8},
+		{PixelFormatBC7RGBAUnormSRGB, 4, 4, 16},
+		{PixelFormatEACRGBA8, 4, 4, 16},
+		{PixelFormatPVRTCRGBA2BPP, 8, 4, 8},
+		{PixelFormatASTC8x5LDR, 8, 5, 16},
+		{PixelFormatASTC12x12HDR, 12, 12, 16},
+		{PixelFormatASTC6x6SRGB, 6, 6, 16},
+		{PixelFormatGBGR422, 2, 1, 4},
+		{PixelFormat(0), 0, 0, 0},
+		{PixelFormat(191), 0, 0, 0},
+		{PixelFormat(209), 0, 0, 0},
+		{PixelFormat(227), 0, 0, 0},
+	} {
+		w, h, s := tt.pf.BlockSize()
+		require.Equal(t, []int{tt.width, tt.height, tt.size}, []int{w, h, s}, "pixel format %d", tt.pf)
+	}
+
+	require.True(t, PixelFormatBC1RGBA.IsCompressed())
+	require.False(t, PixelFormatGBGR422.IsCompressed())
+	require.False(t, PixelFormatR8Unorm.IsCompressed())
+
+	bytesPerRow, rows := PixelFormatBC1RGBA.imageSize(9, 3)
+	require.Equal(t, []int{24, 1}, []int{bytesPerRow, rows})
+
+	bytesPerRow, rows = PixelFormatPVRTCRGB4BPP.imageSize(1, 1)
+	require.Equal(t, []int{16, 2}, []int{bytesPerRow, rows})
+}
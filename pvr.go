@@ -0,0 +1,479 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Values of the PVR v3 header.
+const (
+	pvrVersion = 0x03525650 // "PVR\x03"
+
+	pvrFlagPremultiplied = 0x2
+
+	pvrColorSpaceLinear = 0
+	pvrColorSpaceSRGB   = 1
+)
+
+// Channel types of the PVR v3 header.
+const (
+	pvrUnsignedByteNorm  = 0
+	pvrSignedByteNorm    = 1
+	pvrUnsignedByte      = 2
+	pvrSignedByte        = 3
+	pvrUnsignedShortNorm = 4
+	pvrSignedShortNorm   = 5
+	pvrUnsignedShort     = 6
+	pvrSignedShort       = 7
+	pvrUnsignedIntNorm   = 8
+	pvrSignedIntNorm     = 9
+	pvrUnsignedInt       = 10
+	pvrSignedInt         = 11
+	pvrSignedFloat       = 12
+	pvrUnsignedFloat     = 13
+)
+
+// pvrFormat describes how a pixel format is stored in a PVR v3 header.
+type pvrFormat struct {
+	pixelFormat PixelFormat
+	format      uint64
+	channelType uint32
+}
+
+// pvrChannels returns the PVR v3 pixel format of an uncompressed format with the
+// given channel names and bits per channel. Channels of formats with bits that are
+// not a multiple of 8 are packed starting at the most significant bit.
+func pvrChannels(names string, bits ...uint8) uint64 {
+	var b [8]byte
+
+	copy(b[:4], names)
+	copy(b[4:], bits)
+
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// pvrFormats maps PVR v3 pixel formats and channel types to pixel formats. The
+// first entry of a pixel format wins when writing.
+var pvrFormats = append([]pvrFormat{
+	{PixelFormatPVRTCRGB2BPP, 0, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGB2BPPSRGB, 0, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGBA2BPP, 1, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGBA2BPPSRGB, 1, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGB4BPP, 2, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGB4BPPSRGB, 2, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGBA4BPP, 3, pvrUnsignedByteNorm},
+	{PixelFormatPVRTCRGBA4BPPSRGB, 3, pvrUnsignedByteNorm},
+	{PixelFormatETC2RGB8, 22, pvrUnsignedByteNorm},
+	{PixelFormatETC2RGB8SRGB, 22, pvrUnsignedByteNorm},
+	{PixelFormatETC2RGB8, 6, pvrUnsignedByteNorm}, // ETC1 is a subset of ETC2.
+	{PixelFormatEACRGBA8, 23, pvrUnsignedByteNorm},
+	{PixelFormatEACRGBA8SRGB, 23, pvrUnsignedByteNorm},
+	{PixelFormatETC2RGB8A1, 24, pvrUnsignedByteNorm},
+	{PixelFormatETC2RGB8A1SRGB, 24, pvrUnsignedByteNorm},
+	{PixelFormatEACR11Unorm, 25, pvrUnsignedByteNorm},
+	{PixelFormatEACR11Snorm, 25, pvrSignedByteNorm},
+	{PixelFormatEACRG11Unorm, 26, pvrUnsignedByteNorm},
+	{PixelFormatEACRG11Snorm, 26, pvrSignedByteNorm},
+	{PixelFormatBC1RGBA, 7, pvrUnsignedByteNorm},
+	{PixelFormatBC1RGBASRGB, 7, pvrUnsignedByteNorm},
+	{PixelFormatBC2RGBA, 9, pvrUnsignedByteNorm},
+	{PixelFormatBC2RGBASRGB, 9, pvrUnsignedByteNorm},
+	{PixelFormatBC2RGBA, 8, pvrUnsignedByteNorm},
+	{PixelFormatBC3RGBA, 11, pvrUnsignedByteNorm},
+	{PixelFormatBC3RGBASRGB, 11, pvrUnsignedByteNorm},
+	{PixelFormatBC3RGBA, 10, pvrUnsignedByteNorm},
+	{PixelFormatBC4RUnorm, 12, pvrUnsignedByteNorm},
+	{PixelFormatBC4RSnorm, 12, pvrSignedByteNorm},
+	{PixelFormatBC5RGUnorm, 13, pvrUnsignedByteNorm},
+	{PixelFormatBC5RGSnorm, 13, pvrSignedByteNorm},
+	{PixelFormatBC6HRGBUfloat, 14, pvrUnsignedFloat},
+	{PixelFormatBC6HRGBFloat, 14, pvrSignedFloat},
+	{PixelFormatBC7RGBAUnorm, 15, pvrUnsignedByteNorm},
+	{PixelFormatBC7RGBAUnormSRGB, 15, pvrUnsignedByteNorm},
+	{PixelFormatRGB9E5Float, 19, pvrUnsignedFloat},
+
+	{PixelFormatR8Unorm, pvrChannels("r", 8), pvrUnsignedByteNorm},
+	{PixelFormatR8UnormSRGB, pvrChannels("r", 8), pvrUnsignedByteNorm},
+	{PixelFormatR8Snorm, pvrChannels("r", 8), pvrSignedByteNorm},
+	{PixelFormatR8Uint, pvrChannels("r", 8), pvrUnsignedByte},
+	{PixelFormatR8Sint, pvrChannels("r", 8), pvrSignedByte},
+	{PixelFormatA8Unorm, pvrChannels("a", 8), pvrUnsignedByteNorm},
+	{PixelFormatRG8Unorm, pvrChannels("rg", 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatRG8UnormSRGB, pvrChannels("rg", 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatRG8Snorm, pvrChannels("rg", 8, 8), pvrSignedByteNorm},
+	{PixelFormatRG8Uint, pvrChannels("rg", 8, 8), pvrUnsignedByte},
+	{PixelFormatRG8Sint, pvrChannels("rg", 8, 8), pvrSignedByte},
+	{PixelFormatRGBA8Unorm, pvrChannels("rgba", 8, 8, 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatRGBA8UnormSRGB, pvrChannels("rgba", 8, 8, 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatRGBA8Snorm, pvrChannels("rgba", 8, 8, 8, 8), pvrSignedByteNorm},
+	{PixelFormatRGBA8Uint, pvrChannels("rgba", 8, 8, 8, 8), pvrUnsignedByte},
+	{PixelFormatRGBA8Sint, pvrChannels("rgba", 8, 8, 8, 8), pvrSignedByte},
+	{PixelFormatBGRA8Unorm, pvrChannels("bgra", 8, 8, 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatBGRA8UnormSRGB, pvrChannels("bgra", 8, 8, 8, 8), pvrUnsignedByteNorm},
+	{PixelFormatR16Unorm, pvrChannels("r", 16), pvrUnsignedShortNorm},
+	{PixelFormatR16Snorm, pvrChannels("r", 16), pvrSignedShortNorm},
+	{PixelFormatR16Uint, pvrChannels("r", 16), pvrUnsignedShort},
+	{PixelFormatR16Sint, pvrChannels("r", 16), pvrSignedShort},
+	{PixelFormatR16Float, pvrChannels("r", 16), pvrSignedFloat},
+	{PixelFormatRG16Unorm, pvrChannels("rg", 16, 16), pvrUnsignedShortNorm},
+	{PixelFormatRG16Snorm, pvrChannels("rg", 16, 16), pvrSignedShortNorm},
+	{PixelFormatRG16Uint, pvrChannels("rg", 16, 16), pvrUnsignedShort},
+	{PixelFormatRG16Sint, pvrChannels("rg", 16, 16), pvrSignedShort},
+	{PixelFormatRG16Float, pvrChannels("rg", 16, 16), pvrSignedFloat},
+	{PixelFormatRGBA16Unorm, pvrChannels("rgba", 16, 16, 16, 16), pvrUnsignedShortNorm},
+	{PixelFormatRGBA16Snorm, pvrChannels("rgba", 16, 16, 16, 16), pvrSignedShortNorm},
+	{PixelFormatRGBA16Uint, pvrChannels("rgba", 16, 16, 16, 16), pvrUnsignedShort},
+	{PixelFormatRGBA16Sint, pvrChannels("rgba", 16, 16, 16, 16), pvrSignedShort},
+	{PixelFormatRGBA16Float, pvrChannels("rgba", 16, 16, 16, 16), pvrSignedFloat},
+	{PixelFormatR32Uint, pvrChannels("r", 32), pvrUnsignedInt},
+	{PixelFormatR32Sint, pvrChannels("r", 32), pvrSignedInt},
+	{PixelFormatR32Float, pvrChannels("r", 32), pvrSignedFloat},
+	{PixelFormatRG32Uint, pvrChannels("rg", 32, 32), pvrUnsignedInt},
+	{PixelFormatRG32Sint, pvrChannels("rg", 32, 32), pvrSignedInt},
+	{PixelFormatRG32Float, pvrChannels("rg", 32, 32), pvrSignedFloat},
+	{PixelFormatRGBA32Uint, pvrChannels("rgba", 32, 32, 32, 32), pvrUnsignedInt},
+	{PixelFormatRGBA32Sint, pvrChannels("rgba", 32, 32, 32, 32), pvrSignedInt},
+	{PixelFormatRGBA32Float, pvrChannels("rgba", 32, 32, 32, 32), pvrSignedFloat},
+	{PixelFormatB5G6R5Unorm, pvrChannels("rgb", 5, 6, 5), pvrUnsignedShortNorm},
+	{PixelFormatA1BGR5Unorm, pvrChannels("rgba", 5, 5, 5, 1), pvrUnsignedShortNorm},
+	{PixelFormatBGR5A1Unorm, pvrChannels("argb", 1, 5, 5, 5), pvrUnsignedShortNorm},
+	{PixelFormatABGR4Unorm, pvrChannels("rgba", 4, 4, 4, 4), pvrUnsignedShortNorm},
+	{PixelFormatRGB10A2Unorm, pvrChannels("abgr", 2, 10, 10, 10), pvrUnsignedIntNorm},
+	{PixelFormatRGB10A2Uint, pvrChannels("abgr", 2, 10, 10, 10), pvrUnsignedInt},
+	{PixelFormatBGR10A2Unorm, pvrChannels("argb", 2, 10, 10, 10), pvrUnsignedIntNorm},
+	{PixelFormatRG11B10Float, pvrChannels("bgr", 10, 11, 11), pvrUnsignedFloat},
+}, pvrASTCFormats()...)
+
+// pvrASTCFormats returns the PVR v3 pixel formats of the 2D ASTC formats. HDR
+// content is marked with a float channel type.
+func pvrASTCFormats() []pvrFormat {
+	var formats []pvrFormat
+
+	code := uint64(27)
+
+	for i, size := range astcBlockSizes {
+		if size[0] == 0 {
+			continue
+		}
+
+		formats = append(formats,
+			pvrFormat{PixelFormatASTC4x4LDR + PixelFormat(i), code, pvrUnsignedByteNorm},
+			pvrFormat{PixelFormatASTC4x4SRGB + PixelFormat(i), code, pvrUnsignedByteNorm},
+			pvrFormat{PixelFormatASTC4x4HDR + PixelFormat(i), code, pvrSignedFloat},
+		)
+		code++
+	}
+
+	return formats
+}
+
+// PVRMetadata is a metadata block of a PVR v3 file.
+type PVRMetadata struct {
+	// FourCC identifies the creator of the metadata. Blocks defined by the format
+	// itself use "PVR\x03".
+	FourCC uint32
+
+	// Key identifies the metadata within the FourCC namespace.
+	Key uint32
+
+	// Data holds the raw metadata.
+	Data []byte
+}
+
+// PVRTexture is a texture stored in the PowerVR v3 file format.
+//
+// Reference: http://powervr-graphics.github.io/WebGL_SDK/WebGL_SDK/Documentation/Specifications/PVR%20File%20Format.Specification.pdf
+type PVRTexture struct {
+	// PixelFormat is the pixel format of the texture data.
+	PixelFormat PixelFormat
+
+	// Width, Height and Depth are the dimensions of the base level in pixels.
+	// Depth is 0 for textures that are not 3D.
+	Width, Height, Depth int
+
+	// ArrayLength is the number of surfaces, or 0 for textures that are not arrays.
+	ArrayLength int
+
+	// FaceCount is 6 for cube textures and 1 otherwise.
+	FaceCount int
+
+	// Premultiplied reports whether the color channels are premultiplied by alpha.
+	Premultiplied bool
+
+	// Metadata holds the metadata blocks in file order.
+	Metadata []PVRMetadata
+
+	// Levels holds the mipmap levels, starting at the base level. Every level has
+	// max(ArrayLength, 1) * FaceCount slices with tightly packed rows.
+	Levels []TextureLevel
+}
+
+// TextureDescriptor returns a descriptor for a texture that holds all levels of the PVR texture.
+func (p *PVRTexture) TextureDescriptor() TextureDescriptor {
+	return levelsTextureDescriptor(p.PixelFormat, p.Width, p.Height, p.Depth, p.ArrayLength, p.FaceCount, len(p.Levels))
+}
+
+// ReadPVR reads a texture in the PVR v3 file format.
+func ReadPVR(r io.Reader) (*PVRTexture, error) {
+	var header [52]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read PVR header: %w", err)
+	}
+
+	le := binary.LittleEndian
+
+	if le.Uint32(header[:]) != pvrVersion {
+		if binary.BigEndian.Uint32(header[:]) == pvrVersion {
+			return nil, errors.New("big-endian PVR files are not supported")
+		}
+
+		return nil, errors.New("invalid PVR file identifier")
+	}
+
+	flags, format := le.Uint32(header[4:]), le.Uint64(header[8:])
+	colorSpace, channelType := le.Uint32(header[16:]), le.Uint32(header[20:])
+	height, width, depth := le.Uint32(header[24:]), le.Uint32(header[28:]), le.Uint32(header[32:])
+	surfaces, faces, levelCount := le.Uint32(header[36:]), le.Uint32(header[40:]), le.Uint32(header[44:])
+	metadataSize := le.Uint32(header[48:])
+
+	pf, ok := pvrPixelFormat(format, channelType, colorSpace)
+	if !ok {
+		if format>>32 == 0 {
+			return nil, fmt.Errorf("unsupported PVR pixel format %d", format)
+		}
+
+		return nil, fmt.Errorf("unsupported PVR pixel format %q with channel type %d", pvrChannelNames(format), channelType)
+	}
+
+	if width == 0 || height == 0 || width > 1<<16 || height > 1<<16 || depth > 1<<16 || surfaces > 1<<16 {
+		return nil, fmt.Errorf("invalid PVR dimensions %dx%dx%d with %d surfaces", width, height, depth, surfaces)
+	}
+
+	if faces != 1 && faces != 6 {
+		return nil, fmt.Errorf("unsupported PVR face count %d", faces)
+	}
+
+	if levelCount > 17 {
+		return nil, fmt.Errorf("invalid PVR mipmap level count %d", levelCount)
+	}
+
+	p := &PVRTexture{
+		PixelFormat:   pf,
+		Width:         int(width),
+		Height:        int(height),
+		FaceCount:     int(faces),
+		Premultiplied: flags&pvrFlagPremultiplied != 0,
+	}
+
+	if depth > 1 {
+		p.Depth = int(depth)
+	}
+
+	if surfaces > 1 {
+		p.ArrayLength = int(surfaces)
+	}
+
+	metadata, err := readFull(r, int(metadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PVR metadata: %w", err)
+	}
+
+	if p.Metadata, err = parsePVRMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	if levelCount == 0 {
+		levelCount = 1
+	}
+
+	slices := p.FaceCount
+	if p.ArrayLength > 0 {
+		slices *= p.ArrayLength
+	}
+
+	// The surfaces and faces of each mipmap level are stored one after another.
+	for i := 0; i < int(levelCount); i++ {
+		l := newTextureLevel(pf, mipmapSize(p.Width, i), mipmapSize(p.Height, i), mipmapSize(p.Depth, i), 0)
+
+		for s := 0; s < slices; s++ {
+			data, err := readFull(r, l.BytesPerImage*l.Depth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read PVR data of level %d, slice %d: %w", i, s, err)
+			}
+
+			l.Slices = append(l.Slices, data)
+		}
+
+		p.Levels = append(p.Levels, l)
+	}
+
+	return p, nil
+}
+
+// WritePVR writes a texture in the PVR v3 file format. The format has no 1D
+// textures, so a texture with a Height of 0 is written with a height of 1 and
+// ReadPVR returns it as a 2D texture.
+func WritePVR(w io.Writer, p *PVRTexture) error {
+	f, ok := pvrFormatOf(p.PixelFormat)
+	if !ok {
+		return fmt.Errorf("pixel format %d is not supported by PVR", p.PixelFormat)
+	}
+
+	if p.FaceCount != 1 && p.FaceCount != 6 {
+		return fmt.Errorf("invalid face count %d", p.FaceCount)
+	}
+
+	if len(p.Levels) == 0 {
+		return errors.New("texture has no mipmap levels")
+	}
+
+	slices := p.FaceCount
+	if p.ArrayLength > 0 {
+		slices *= p.ArrayLength
+	}
+
+	var metadata []byte
+
+	for _, m := range p.Metadata {
+		metadata = binary.LittleEndian.AppendUint32(metadata, m.FourCC)
+		metadata = binary.LittleEndian.AppendUint32(metadata, m.Key)
+		metadata = binary.LittleEndian.AppendUint32(metadata, uint32(len(m.Data)))
+		metadata = append(metadata, m.Data...)
+	}
+
+	var flags uint32
+	if p.Premultiplied {
+		flags |= pvrFlagPremultiplied
+	}
+
+	colorSpace := uint32(pvrColorSpaceLinear)
+	if p.PixelFormat.IsSRGB() {
+		colorSpace = pvrColorSpaceSRGB
+	}
+
+	le := binary.LittleEndian
+	header := make([]byte, 52)
+	le.PutUint32(header, pvrVersion)
+	le.PutUint32(header[4:], flags)
+	le.PutUint64(header[8:], f.format)
+	le.PutUint32(header[16:], colorSpace)
+	le.PutUint32(header[20:], f.channelType)
+	le.PutUint32(header[24:], uint32(oneIfZero(uint(p.Height))))
+	le.PutUint32(header[28:], uint32(p.Width))
+	le.PutUint32(header[32:], uint32(oneIfZero(uint(p.Depth))))
+	le.PutUint32(header[36:], uint32(oneIfZero(uint(p.ArrayLength))))
+	le.PutUint32(header[40:], uint32(p.FaceCount))
+	le.PutUint32(header[44:], uint32(len(p.Levels)))
+	le.PutUint32(header[48:], uint32(len(metadata)))
+
+	buf := bytes.NewBuffer(header)
+	buf.Write(metadata)
+
+	for i, l := range p.Levels {
+		if len(l.Slices) != slices {
+			return fmt.Errorf("level %d has %d slices, want %d", i, len(l.Slices), slices)
+		}
+
+		data, err := packLevel(p.PixelFormat, l)
+		if err != nil {
+			return fmt.Errorf("level %d: %w", i, err)
+		}
+
+		buf.Write(data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// parsePVRMetadata parses the metadata blocks of a PVR v3 file.
+func parsePVRMetadata(data []byte) ([]PVRMetadata, error) {
+	var metadata []PVRMetadata
+
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, errors.New("invalid PVR metadata block")
+		}
+
+		size := binary.LittleEndian.Uint32(data[8:])
+		if uint64(size) > uint64(len(data)-12) {
+			return nil, fmt.Errorf("invalid PVR metadata size %d", size)
+		}
+
+		metadata = append(metadata, PVRMetadata{
+			FourCC: binary.LittleEndian.Uint32(data),
+			Key:    binary.LittleEndian.Uint32(data[4:]),
+			Data:   data[12 : 12+size],
+		})
+		data = data[12+size:]
+	}
+
+	return metadata, nil
+}
+
+// pvrPixelFormat returns the pixel format of a PVR v3 pixel format, channel type
+// and color space. Compressed formats prefer, but do not require, a matching channel
+// type, and formats without an sRGB variant ignore the color space.
+func pvrPixelFormat(format uint64, channelType, colorSpace uint32) (PixelFormat, bool) {
+	var (
+		pf   PixelFormat
+		best int
+	)
+
+	for _, f := range pvrFormats {
+		if f.format != format {
+			continue
+		}
+
+		score := 1
+
+		if f.channelType == channelType {
+			score += 2
+		} else if format>>32 != 0 {
+			continue
+		}
+
+		if f.pixelFormat.IsSRGB() == (colorSpace == pvrColorSpaceSRGB) {
+			score++
+		}
+
+		if score > best {
+			pf, best = f.pixelFormat, score
+		}
+	}
+
+	return pf, best > 0
+}
+
+// pvrFormatOf returns the PVR v3 pixel format of a pixel format.
+func pvrFormatOf(pf PixelFormat) (pvrFormat, bool) {
+	for _, f := range pvrFormats {
+		if f.pixelFormat == pf {
+			return f, true
+		}
+	}
+
+	return pvrFormat{}, false
+}
+
+// pvrChannelNames returns a readable description of an uncompressed PVR v3 pixel
+// format, such as "rgba8888".
+func pvrChannelNames(format uint64) string {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], format)
+
+	names := string(bytes.TrimRight(b[:4], "\x00"))
+	for _, bits := range b[4 : 4+len(names)] {
+		names += fmt.Sprint(bits)
+	}
+
+	return names
+}
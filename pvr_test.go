@@ -0,0 +1,117 @@
+package mtl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPVRRoundTrip(t *testing.T) {
+	p := newTestTexture[PVRTexture](PixelFormatPVRTCRGBA4BPPSRGB, 16, 16, 0, 5, 1)
+	p.Premultiplied = true
+	p.Metadata = []PVRMetadata{{FourCC: pvrVersion, Key: 3, Data: []byte{0, 1, 0}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePVR(&buf, p))
+
+	data := buf.Bytes()
+	require.Equal(t, uint64(3), binary.LittleEndian.Uint64(data[8:]))
+	require.Equal(t, uint32(pvrColorSpaceSRGB), binary.LittleEndian.Uint32(data[16:]))
+	require.Equal(t, uint32(15), binary.LittleEndian.Uint32(data[48:]))
+
+	// PVRTC levels are at least 2x2 blocks of 8 bytes.
+	require.Len(t, data, 52+15+128+4*32)
+
+	got, err := ReadPVR(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+}
+
+func TestPVRCubeArray(t *testing.T) {
+	p := newTestTexture[PVRTexture](PixelFormatRGBA8Unorm, 2, 2, 0, 2, 12)
+	p.ArrayLength = 2
+	p.FaceCount = 6
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePVR(&buf, p))
+
+	// All surfaces and faces of the base level precede the next level.
+	data := buf.Bytes()
+	require.Equal(t, p.Levels[0].Slices[11], data[52+11*16:52+12*16])
+	require.Equal(t, p.Levels[1].Slices[0], data[52+12*16:52+12*16+4])
+
+	got, err := ReadPVR(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+	require.Equal(t, TextureTypeCubeArray, got.TextureDescriptor().TextureType)
+}
+
+func TestPVR1D(t *testing.T) {
+	p := newTestTexture[PVRTexture](PixelFormatRGBA8Unorm, 8, 0, 0, 4, 1)
+	require.Equal(t, TextureType1D, p.TextureDescriptor().TextureType)
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePVR(&buf, p))
+
+	// The 1D texture is read back as a 2D texture with a height of 1.
+	got, err := ReadPVR(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, TextureType2D, got.TextureDescriptor().TextureType)
+
+	p.Height = 1
+	require.Equal(t, p, got)
+}
+
+func TestPVRPixelFormats(t *testing.T) {
+	for _, pf := range []PixelFormat{
+		PixelFormatETC2RGB8SRGB, PixelFormatEACR11Snorm, PixelFormatEACRG11Unorm, PixelFormatBC6HRGBFloat,
+		PixelFormatASTC8x5LDR, PixelFormatASTC8x5SRGB, PixelFormatASTC12x12HDR,
+		PixelFormatRGBA16Float, PixelFormatB5G6R5Unorm, PixelFormatRG11B10Float, PixelFormatRGB10A2Uint,
+	} {
+		f, ok := pvrFormatOf(pf)
+		require.True(t, ok, pf)
+
+		colorSpace := uint32(pvrColorSpaceLinear)
+		if pf.IsSRGB() {
+			colorSpace = pvrColorSpaceSRGB
+		}
+
+		got, ok := pvrPixelFormat(f.format, f.channelType, colorSpace)
+		require.True(t, ok, pf)
+		require.Equal(t, pf, got)
+	}
+
+	f, _ := pvrFormatOf(PixelFormatASTC8x5LDR)
+	require.Equal(t, uint64(32), f.format)
+	require.Equal(t, "rgba8888", pvrChannelNames(pvrChannels("rgba", 8, 8, 8, 8)))
+
+	// ETC1 is read as ETC2 and compressed formats tolerate other channel types.
+	pf, ok := pvrPixelFormat(6, pvrUnsignedByteNorm, pvrColorSpaceLinear)
+	require.True(t, ok)
+	require.Equal(t, PixelFormatETC2RGB8, pf)
+
+	pf, ok = pvrPixelFormat(15, pvrUnsignedShortNorm, pvrColorSpaceSRGB)
+	require.True(t, ok)
+	require.Equal(t, PixelFormatBC7RGBAUnormSRGB, pf)
+}
+
+func TestPVRErrors(t *testing.T) {
+	_, err := ReadPVR(bytes.NewReader(make([]byte, 52)))
+	require.ErrorContains(t, err, "invalid PVR file identifier")
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePVR(&buf, newTestTexture[PVRTexture](PixelFormatRGBA8Unorm, 2, 2, 0, 1, 1)))
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[20:], pvrSignedFloat)
+	_, err = ReadPVR(bytes.NewReader(data))
+	require.ErrorContains(t, err, `unsupported PVR pixel format "rgba8888" with channel type 12`)
+
+	binary.LittleEndian.PutUint64(data[8:], 4)
+	_, err = ReadPVR(bytes.NewReader(data))
+	require.ErrorContains(t, err, "unsupported PVR pixel format 4")
+
+	require.ErrorContains(t, WritePVR(&buf, newTestTexture[PVRTexture](PixelFormatDepth32Float, 2, 2, 0, 1, 1)), "not supported by PVR")
+}
@@ -0,0 +1,622 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// QualityResult is the result of comparing a test image to a reference image.
+//
+// Raw texture data is compared by wrapping it with NewTextureImageFromBytes, which
+// exposes the pixel values as they are stored.
+type QualityResult struct {
+	// Channels holds the metric of the red, green, blue and alpha channels.
+	Channels [4]float64
+
+	// Value is the metric of the color channels combined. Alpha is only reported
+	// in Channels.
+	Value float64
+
+	// ErrorMap holds the error of every pixel in [0, 1] as a gray level, where 0
+	// means equal and 1 the largest difference.
+	ErrorMap *FloatImage
+}
+
+// Heatmap returns the error map in the Turbo color map, which shows low errors
+// in blue and high errors in red.
+//
+// Reference: https://research.google/blog/turbo-an-improved-rainbow-colormap-for-visualization/
+func (r QualityResult) Heatmap() *image.RGBA {
+	m := r.ErrorMap
+	img := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+
+	for i, p := range m.Pix {
+		img.SetRGBA(i%m.Width, i/m.Width, turbo(float64(p.R)))
+	}
+
+	return img
+}
+
+// PSNR returns the peak signal-to-noise ratio in decibels of test compared to
+// reference, with a peak value of 1. Equal channels have an infinite ratio. The
+// error map holds the root mean square error of the color channels.
+func PSNR(reference, test image.Image) (QualityResult, error) {
+	ref, tst, err := qualityPlanes(reference, test)
+	if err != nil {
+		return QualityResult{}, err
+	}
+
+	var (
+		res QualityResult
+		mse [4]float64
+	)
+
+	w, h := reference.Bounds().Dx(), reference.Bounds().Dy()
+	res.ErrorMap = NewFloatImage(w, h)
+
+	for i := range res.ErrorMap.Pix {
+		sum := 0.0
+
+		for c := range mse {
+			d := ref[c][i] - tst[c][i]
+			mse[c] += d * d
+
+			if c < 3 {
+				sum += d * d
+			}
+		}
+
+		res.ErrorMap.Pix[i] = grayError(math.Sqrt(sum / 3))
+	}
+
+	for c := range mse {
+		mse[c] /= float64(w * h)
+		res.Channels[c] = psnr(mse[c])
+	}
+
+	res.Value = psnr((mse[0] + mse[1] + mse[2]) / 3)
+
+	return res, nil
+}
+
+// SSIM returns the structural similarity index of test compared to reference,
+// computed with an 11x11 Gaussian window with a standard deviation of 1.5 pixels.
+// Equal images have an index of 1. The error map holds 1 minus the mean index of
+// the color channels.
+//
+// Reference: https://ece.uwaterloo.ca/~z70wang/publications/ssim.pdf
+func SSIM(reference, test image.Image) (QualityResult, error) {
+	ref, tst, err := qualityPlanes(reference, test)
+	if err != nil {
+		return QualityResult{}, err
+	}
+
+	w, h := reference.Bounds().Dx(), reference.Bounds().Dy()
+
+	var maps [4][]float64
+
+	for c := range maps {
+		l, cs := ssimMaps(ref[c], tst[c], w, h)
+
+		maps[c] = l
+		for i := range l {
+			maps[c][i] *= cs[i]
+		}
+	}
+
+	return ssimResult(maps, w, h, func(c int) float64 { return mean(maps[c]) }), nil
+}
+
+// msssimWeights holds the exponents of the scales of MS-SSIM.
+var msssimWeights = [5]float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// MSSSIM returns the multi-scale structural similarity index of test compared to
+// reference over 5 scales. Images too small for 5 scales use fewer scales whose
+// exponents are renormalized. The error map is the one of SSIM.
+//
+// Reference: https://www.cns.nyu.edu/pub/eero/wang03b.pdf
+func MSSSIM(reference, test image.Image) (QualityResult, error) {
+	ref, tst, err := qualityPlanes(reference, test)
+	if err != nil {
+		return QualityResult{}, err
+	}
+
+	w, h := reference.Bounds().Dx(), reference.Bounds().Dy()
+
+	scales := 1
+	for scales < len(msssimWeights) && (w>>scales) >= 8 && (h>>scales) >= 8 {
+		scales++
+	}
+
+	weightSum := 0.0
+	for _, wt := range msssimWeights[:scales] {
+		weightSum += wt
+	}
+
+	var (
+		maps  [4][]float64
+		index [4]float64
+	)
+
+	for c := range index {
+		x, y, sw, sh := ref[c], tst[c], w, h
+		index[c] = 1
+
+		for s := 0; s < scales; s++ {
+			l, cs := ssimMaps(x, y, sw, sh)
+
+			if s == 0 || s == scales-1 {
+				for i := range l {
+					l[i] *= cs[i]
+				}
+			}
+
+			if s == 0 {
+				maps[c] = l
+			}
+
+			v := mean(cs)
+			if s == scales-1 {
+				v = mean(l)
+			}
+
+			index[c] *= math.Pow(math.Max(v, 0), msssimWeights[s]/weightSum)
+
+			if s < scales-1 {
+				x, _, _ = downsample2x(x, sw, sh)
+				y, sw, sh = downsample2x(y, sw, sh)
+			}
+		}
+	}
+
+	return ssimResult(maps, w, h, func(c int) float64 { return index[c] }), nil
+}
+
+// FLIPOptions configures FLIP.
+type FLIPOptions struct {
+	// PixelsPerDegree is the number of pixels per degree of visual angle. The
+	// default of 67 corresponds to a 0.7 m wide 4K monitor viewed from 0.7 m.
+	PixelsPerDegree float64
+
+	// Linear reports that the colors are in linear space. Otherwise they are
+	// interpreted as sRGB encoded, as stored by 8-bit images and sRGB pixel formats.
+	Linear bool
+}
+
+// FLIP parameters from the paper.
+const (
+	flipQc = 0.7
+	flipPc = 0.4
+	flipPt = 0.95
+	flipQf = 0.5
+	flipW  = 0.082
+)
+
+// FLIP returns the mean of the LDR-FLIP perceptual difference between test and
+// reference, which approximates the error an observer perceives when flipping
+// between the images. Differences are in [0, 1], where 0 means indistinguishable.
+// FLIP compares colors, so Channels is not set. Alpha is ignored.
+//
+// Reference: https://research.nvidia.com/publication/2020-07_flip-difference-evaluator-alternating-images
+func FLIP(reference, test image.Image, optFns ...func(*FLIPOptions)) (QualityResult, error) {
+	opts := FLIPOptions{
+		PixelsPerDegree: 67,
+		Linear:          false,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	if opts.PixelsPerDegree <= 0 {
+		return QualityResult{}, fmt.Errorf("invalid pixels per degree %g", opts.PixelsPerDegree)
+	}
+
+	ref, tst, err := qualityPlanes(reference, test)
+	if err != nil {
+		return QualityResult{}, err
+	}
+
+	w, h := reference.Bounds().Dx(), reference.Bounds().Dy()
+	ppd := opts.PixelsPerDegree
+
+	refLab, refFeatures := flipPrepare(ref, w, h, ppd, opts.Linear)
+	tstLab, tstFeatures := flipPrepare(tst, w, h, ppd, opts.Linear)
+
+	cmax := math.Pow(hyab(huntLab(linearToLab([3]float64{0, 1, 0})), huntLab(linearToLab([3]float64{0, 0, 1}))), flipQc)
+
+	res := QualityResult{ErrorMap: NewFloatImage(w, h)}
+	sum := 0.0
+
+	for i := range res.ErrorMap.Pix {
+		// Color difference, compressed so that large differences saturate toward 1.
+		dc := math.Pow(hyab(refLab[i], tstLab[i]), flipQc)
+		if dc < flipPc*cmax {
+			dc *= flipPt / (flipPc * cmax)
+		} else {
+			dc = flipPt + (dc-flipPc*cmax)/(cmax-flipPc*cmax)*(1-flipPt)
+		}
+
+		// Feature difference of edges and points.
+		df := math.Max(
+			math.Abs(refFeatures[0][i]-tstFeatures[0][i]),
+			math.Abs(refFeatures[1][i]-tstFeatures[1][i]),
+		)
+		df = math.Pow(df/math.Sqrt2, flipQf)
+
+		e := clamp(math.Pow(dc, 1-df), 0, 1)
+		res.ErrorMap.Pix[i] = grayError(e)
+		sum += e
+	}
+
+	res.Value = sum / float64(w*h)
+
+	return res, nil
+}
+
+// flipPrepare returns the Hunt-adjusted CIELAB colors of the image filtered with
+// the contrast sensitivity of the human eye, and the magnitudes of its edges and points.
+func flipPrepare(p [4][]float64, w, h int, ppd float64, linear bool) ([][3]float64, [2][]float64) {
+	n := w * h
+
+	var ycc, filtered [3][]float64
+
+	for c := range ycc {
+		ycc[c] = make([]float64, n)
+	}
+
+	gray := make([]float64, n)
+
+	for i := 0; i < n; i++ {
+		rgb := [3]float64{p[0][i], p[1][i], p[2][i]}
+		for c := range rgb {
+			rgb[c] = clamp(rgb[c], 0, 1)
+			if !linear {
+				rgb[c] = SRGBToLinear(rgb[c])
+			}
+		}
+
+		v := xyzToYCxCz(linearToXYZ(rgb))
+		ycc[0][i], ycc[1][i], ycc[2][i] = v[0], v[1], v[2]
+		gray[i] = (v[0] + 16) / 116
+	}
+
+	// Contrast sensitivity functions of the opponent channels, each a sum of up
+	// to 2 Gaussians with amplitude a and width b.
+	csf := [3][4]float64{
+		{1, 0.0047, 0, 1e-5},
+		{1, 0.0053, 0, 1e-5},
+		{34.1, 0.04, 13.5, 0.025},
+	}
+	radius := int(math.Ceil(3 * math.Sqrt(0.04/(2*math.Pi*math.Pi)) * ppd))
+
+	for c, params := range csf {
+		filtered[c] = make([]float64, n)
+		total := 0.0
+
+		for k := 0; k < 4; k += 2 {
+			a, b := params[k], params[k+1]
+			if a == 0 {
+				continue
+			}
+
+			g := make([]float64, 2*radius+1)
+			s := 0.0
+
+			for i := range g {
+				x := float64(i-radius) / ppd
+				g[i] = math.Sqrt(a) * math.Pow(math.Pi/b, 0.25) * math.Exp(-math.Pi*math.Pi*x*x/b)
+				s += g[i]
+			}
+
+			total += s * s
+
+			for i, v := range convolve(ycc[c], w, h, g, g) {
+				filtered[c][i] += v
+			}
+		}
+
+		for i := range filtered[c] {
+			filtered[c][i] /= total
+		}
+	}
+
+	lab := make([][3]float64, n)
+	for i := range lab {
+		rgb := xyzToLinear(yCxCzToXYZ([3]float64{filtered[0][i], filtered[1][i], filtered[2][i]}))
+		for c := range rgb {
+			rgb[c] = clamp(rgb[c], 0, 1)
+		}
+
+		lab[i] = huntLab(linearToLab(rgb))
+	}
+
+	// Derivatives of a Gaussian, normalized so that their positive and negative
+	// weights each sum to 1 in magnitude.
+	sigma := 0.5 * flipW * ppd
+	r := int(math.Ceil(3 * sigma))
+	g, d1, d2 := make([]float64, 2*r+1), make([]float64, 2*r+1), make([]float64, 2*r+1)
+
+	for i := range g {
+		x := float64(i - r)
+		g[i] = math.Exp(-x * x / (2 * sigma * sigma))
+		d1[i] = -x * g[i]
+		d2[i] = (x*x/(sigma*sigma) - 1) * g[i]
+	}
+
+	normalizeKernel(g, false)
+	normalizeKernel(d1, true)
+	normalizeKernel(d2, true)
+
+	var features [2][]float64
+
+	for f, d := range [][]float64{d1, d2} {
+		dx, dy := convolve(gray, w, h, d, g), convolve(gray, w, h, g, d)
+		features[f] = make([]float64, n)
+
+		for i := range features[f] {
+			features[f][i] = math.Hypot(dx[i], dy[i])
+		}
+	}
+
+	return lab, features
+}
+
+// normalizeKernel scales the kernel so that its weights sum to 1, or its positive
+// and negative weights separately to 1 and -1 if signed is set.
+func normalizeKernel(k []float64, signed bool) {
+	pos, neg := 0.0, 0.0
+
+	for _, v := range k {
+		if v > 0 {
+			pos += v
+		} else {
+			neg -= v
+		}
+	}
+
+	for i, v := range k {
+		switch {
+		case !signed:
+			k[i] = v / (pos + neg)
+		case v > 0:
+			k[i] = v / pos
+		case v < 0:
+			k[i] = v / neg
+		}
+	}
+}
+
+// D65 white point of linear sRGB in CIE XYZ.
+var (
+	whiteX = 0.4124564 + 0.3575761 + 0.1804375
+	whiteZ = 0.0193339 + 0.1191920 + 0.9503041
+)
+
+// linearToXYZ converts a linear sRGB color to CIE XYZ.
+func linearToXYZ(c [3]float64) [3]float64 {
+	return [3]float64{
+		0.4124564*c[0] + 0.3575761*c[1] + 0.1804375*c[2],
+		0.2126729*c[0] + 0.7151522*c[1] + 0.0721750*c[2],
+		0.0193339*c[0] + 0.1191920*c[1] + 0.9503041*c[2],
+	}
+}
+
+// xyzToLinear converts a CIE XYZ color to linear sRGB.
+func xyzToLinear(c [3]float64) [3]float64 {
+	return [3]float64{
+		3.2404542*c[0] - 1.5371385*c[1] - 0.4985314*c[2],
+		-0.9692660*c[0] + 1.8760108*c[1] + 0.0415560*c[2],
+		0.0556434*c[0] - 0.2040259*c[1] + 1.0572252*c[2],
+	}
+}
+
+// xyzToYCxCz converts a CIE XYZ color to the linearized opponent space YCxCz.
+func xyzToYCxCz(c [3]float64) [3]float64 {
+	x, y, z := c[0]/whiteX, c[1], c[2]/whiteZ
+
+	return [3]float64{116*y - 16, 500 * (x - y), 200 * (y - z)}
+}
+
+// yCxCzToXYZ is the inverse of xyzToYCxCz.
+func yCxCzToXYZ(c [3]float64) [3]float64 {
+	y := (c[0] + 16) / 116
+
+	return [3]float64{(c[1]/500 + y) * whiteX, y, (y - c[2]/200) * whiteZ}
+}
+
+// linearToLab converts a linear sRGB color to CIELAB.
+func linearToLab(c [3]float64) [3]float64 {
+	xyz := linearToXYZ(c)
+
+	f := func(t float64) float64 {
+		const delta = 6.0 / 29
+
+		if t > delta*delta*delta {
+			return math.Cbrt(t)
+		}
+
+		return t/(3*delta*delta) + 4.0/29
+	}
+
+	fx, fy, fz := f(xyz[0]/whiteX), f(xyz[1]), f(xyz[2]/whiteZ)
+
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// huntLab scales the chroma of a CIELAB color by its lightness, following the
+// Hunt effect where colorfulness decreases with luminance.
+func huntLab(c [3]float64) [3]float64 {
+	return [3]float64{c[0], 0.01 * c[0] * c[1], 0.01 * c[0] * c[2]}
+}
+
+// hyab returns the HyAB distance between two CIELAB colors, which suits large
+// color differences better than the Euclidean distance.
+func hyab(a, b [3]float64) float64 {
+	return math.Abs(a[0]-b[0]) + math.Hypot(a[1]-b[1], a[2]-b[2])
+}
+
+// ssimResult returns the result of SSIM and MS-SSIM from the index maps at full
+// resolution and the index of every channel.
+func ssimResult(maps [4][]float64, w, h int, index func(c int) float64) QualityResult {
+	res := QualityResult{ErrorMap: NewFloatImage(w, h)}
+
+	for c := range res.Channels {
+		res.Channels[c] = index(c)
+	}
+
+	res.Value = (res.Channels[0] + res.Channels[1] + res.Channels[2]) / 3
+
+	for i := range res.ErrorMap.Pix {
+		res.ErrorMap.Pix[i] = grayError(1 - (maps[0][i]+maps[1][i]+maps[2][i])/3)
+	}
+
+	return res
+}
+
+// ssimMaps returns the luminance and the contrast-structure terms of the SSIM
+// index of every pixel of two planes.
+func ssimMaps(x, y []float64, w, h int) ([]float64, []float64) {
+	const (
+		c1 = 0.01 * 0.01
+		c2 = 0.03 * 0.03
+	)
+
+	g := make([]float64, 11)
+	for i := range g {
+		d := float64(i - 5)
+		g[i] = math.Exp(-d * d / (2 * 1.5 * 1.5))
+	}
+
+	normalizeKernel(g, false)
+
+	xx, yy, xy := make([]float64, len(x)), make([]float64, len(x)), make([]float64, len(x))
+	for i := range x {
+		xx[i], yy[i], xy[i] = x[i]*x[i], y[i]*y[i], x[i]*y[i]
+	}
+
+	mx, my := convolve(x, w, h, g, g), convolve(y, w, h, g, g)
+	sxx, syy, sxy := convolve(xx, w, h, g, g), convolve(yy, w, h, g, g), convolve(xy, w, h, g, g)
+
+	l, cs := make([]float64, len(x)), make([]float64, len(x))
+
+	for i := range l {
+		vx, vy, cov := sxx[i]-mx[i]*mx[i], syy[i]-my[i]*my[i], sxy[i]-mx[i]*my[i]
+		l[i] = (2*mx[i]*my[i] + c1) / (mx[i]*mx[i] + my[i]*my[i] + c1)
+		cs[i] = (2*cov + c2) / (vx + vy + c2)
+	}
+
+	return l, cs
+}
+
+// qualityPlanes returns the RGBA channels of two images of equal size as planes
+// of w*h values.
+func qualityPlanes(reference, test image.Image) ([4][]float64, [4][]float64, error) {
+	rb, tb := reference.Bounds(), test.Bounds()
+	if rb.Size() != tb.Size() {
+		return [4][]float64{}, [4][]float64{}, fmt.Errorf("images have different sizes %v and %v", rb.Size(), tb.Size())
+	}
+
+	if rb.Empty() {
+		return [4][]float64{}, [4][]float64{}, errors.New("images are empty")
+	}
+
+	planes := func(img image.Image) (p [4][]float64) {
+		b := img.Bounds()
+
+		for c := range p {
+			p[c] = make([]float64, b.Dx()*b.Dy())
+		}
+
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				v := toFloatColor(img.At(b.Min.X+x, b.Min.Y+y))
+				i := y*b.Dx() + x
+				p[0][i], p[1][i], p[2][i], p[3][i] = float64(v.R), float64(v.G), float64(v.B), float64(v.A)
+			}
+		}
+
+		return p
+	}
+
+	return planes(reference), planes(test), nil
+}
+
+// convolve returns the plane convolved with kx horizontally and ky vertically.
+// Both kernels have odd lengths and are centered. Pixels outside the plane are
+// clamped to the edge.
+func convolve(p []float64, w, h int, kx, ky []float64) []float64 {
+	tmp, out := make([]float64, len(p)), make([]float64, len(p))
+	rx, ry := len(kx)/2, len(ky)/2
+
+	for y := 0; y < h; y++ {
+		row := p[y*w : (y+1)*w]
+
+		for x := 0; x < w; x++ {
+			s := 0.0
+			for i, k := range kx {
+				s += k * row[clampInt(x+i-rx, 0, w-1)]
+			}
+
+			tmp[y*w+x] = s
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for i, k := range ky {
+			src := tmp[clampInt(y+i-ry, 0, h-1)*w:]
+
+			for x := 0; x < w; x++ {
+				out[y*w+x] += k * src[x]
+			}
+		}
+	}
+
+	return out
+}
+
+// downsample2x returns the plane averaged over 2x2 blocks and its new size.
+func downsample2x(p []float64, w, h int) ([]float64, int, int) {
+	dw, dh := w/2, h/2
+	out := make([]float64, dw*dh)
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			i := 2*y*w + 2*x
+			out[y*dw+x] = (p[i] + p[i+1] + p[i+w] + p[i+w+1]) / 4
+		}
+	}
+
+	return out, dw, dh
+}
+
+// mean returns the arithmetic mean of the values.
+func mean(v []float64) float64 {
+	s := 0.0
+	for _, x := range v {
+		s += x
+	}
+
+	return s / float64(len(v))
+}
+
+// psnr returns the peak signal-to-noise ratio of a mean squared error for a peak of 1.
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+
+	return -10 * math.Log10(mse)
+}
+
+// grayError returns an opaque gray color of the error clamped to [0, 1].
+func grayError(e float64) FloatColor {
+	v := float32(clamp(e, 0, 1))
+
+	return FloatColor{v, v, v, 1}
+}
@@ -0,0 +1,126 @@
+package mtl
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPattern(w, h int, noise float64, seed int64) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 0.5 + 0.4*math.Sin(float64(x)/3)*math.Cos(float64(y)/5)
+			c := func(o float64) uint8 {
+				return uint8(math.Round(clamp(v+o+noise*rnd.NormFloat64(), 0, 1) * 255))
+			}
+
+			img.SetNRGBA(x, y, color.NRGBA{R: c(0), G: c(0.05), B: c(-0.05), A: 255})
+		}
+	}
+
+	return img
+}
+
+func TestPSNR(t *testing.T) {
+	ref := newTestPattern(16, 16, 0, 1)
+
+	res, err := PSNR(ref, ref)
+	require.NoError(t, err)
+	require.True(t, math.IsInf(res.Value, 1))
+	require.Equal(t, FloatColor{0, 0, 0, 1}, res.ErrorMap.Pix[0])
+
+	// An error of 0.2 in one of 3 channels is a mean squared error of 0.04/3.
+	ti, err := NewTextureImageFromBytes([]byte{0, 0, 0, 255, 0, 0, 0, 255}, PixelFormatRGBA8Unorm, 2, 1, 0)
+	require.NoError(t, err)
+
+	test, err := NewTextureImageFromBytes([]byte{51, 0, 0, 255, 51, 0, 0, 255}, PixelFormatRGBA8Unorm, 2, 1, 0)
+	require.NoError(t, err)
+
+	res, err = PSNR(ti, test)
+	require.NoError(t, err)
+	require.InDelta(t, 20*math.Log10(5), res.Channels[0], 1e-5)
+	require.True(t, math.IsInf(res.Channels[1], 1))
+	require.True(t, math.IsInf(res.Channels[3], 1))
+	require.InDelta(t, -10*math.Log10(0.04/3), res.Value, 1e-5)
+	require.InDelta(t, 0.2/math.Sqrt(3), res.ErrorMap.Pix[1].R, 1e-6)
+
+	_, err = PSNR(ref, newTestPattern(8, 16, 0, 1))
+	require.ErrorContains(t, err, "different sizes")
+}
+
+func TestSSIM(t *testing.T) {
+	ref := newTestPattern(64, 48, 0, 1)
+
+	for _, metric := range []func(a, b image.Image) (QualityResult, error){SSIM, MSSSIM} {
+		res, err := metric(ref, ref)
+		require.NoError(t, err)
+		require.InDelta(t, 1, res.Value, 1e-9)
+		require.InDelta(t, 1, res.Channels[3], 1e-9)
+		require.InDelta(t, 0, res.ErrorMap.Pix[100].R, 1e-6)
+
+		// More noise lowers the index.
+		prev := 1.0
+
+		for _, noise := range []float64{0.01, 0.05, 0.2} {
+			res, err = metric(ref, newTestPattern(64, 48, noise, 2))
+			require.NoError(t, err)
+			require.Less(t, res.Value, prev, noise)
+			require.Greater(t, res.Value, 0.0, noise)
+
+			prev = res.Value
+		}
+	}
+
+	// A uniform brightness shift barely changes the structure.
+	shifted := image.NewNRGBA(ref.Bounds())
+	for i, v := range ref.Pix {
+		shifted.Pix[i] = v
+		if i%4 != 3 {
+			shifted.Pix[i] = v + 5
+		}
+	}
+
+	res, err := SSIM(ref, shifted)
+	require.NoError(t, err)
+	require.Greater(t, res.Value, 0.95)
+}
+
+func TestFLIP(t *testing.T) {
+	ref := newTestPattern(32, 32, 0, 1)
+
+	res, err := FLIP(ref, ref)
+	require.NoError(t, err)
+	require.Equal(t, 0.0, res.Value)
+
+	// Black and white are far apart.
+	res, err = FLIP(newTestSprite(8, 8, 0), newTestSprite(8, 8, 255))
+	require.NoError(t, err)
+	require.Greater(t, res.Value, 0.9)
+	require.LessOrEqual(t, res.Value, 1.0)
+
+	// Small differences are harder to see than large ones, and from further away.
+	small, err := FLIP(ref, newTestPattern(32, 32, 0.02, 2))
+	require.NoError(t, err)
+
+	large, err := FLIP(ref, newTestPattern(32, 32, 0.2, 2))
+	require.NoError(t, err)
+	require.Less(t, small.Value, large.Value)
+
+	far, err := FLIP(ref, newTestPattern(32, 32, 0.2, 2), func(o *FLIPOptions) { o.PixelsPerDegree = 200 })
+	require.NoError(t, err)
+	require.Less(t, far.Value, large.Value)
+
+	heatmap := large.Heatmap()
+	require.Equal(t, image.Rect(0, 0, 32, 32), heatmap.Bounds())
+	require.Equal(t, turbo(float64(large.ErrorMap.Pix[33].R)), heatmap.RGBAAt(1, 1))
+
+	_, err = FLIP(ref, ref, func(o *FLIPOptions) { o.PixelsPerDegree = 0 })
+	require.Error(t, err)
+}
@@ -7,7 +7,10 @@ package mtl
 #include "resource.h"
 */
 import "C"
-import "unsafe"
+import (
+	"fmt"
+	"unsafe"
+)
 
 // Buffer is a memory allocation for storing unformatted data
 // that is accessible to the GPU.
@@ -45,10 +48,20 @@ func (d Device) NewBufferWithBytes(bytes unsafe.Pointer, length uintptr, opt Res
 //
 // Reference: https://developer.apple.com/documentation/metal/mtltexturedescriptor
 type TextureDescriptor struct {
+	TextureType TextureType
 	PixelFormat PixelFormat
 	Width       uint
 	Height      uint
 	StorageMode StorageMode
+
+	// Depth is the depth of a 3D texture in pixels. A value of 0 is treated as 1.
+	Depth uint
+
+	// MipmapLevelCount is the number of mipmap levels. A value of 0 is treated as 1.
+	MipmapLevelCount uint
+
+	// ArrayLength is the number of array elements of an array texture. A value of 0 is treated as 1.
+	ArrayLength uint
 }
 
 // Texture is a memory allocation for storing formatted
@@ -63,22 +76,35 @@ type Texture struct {
 
 	// Height is the height of the texture image for the base level mipmap, in pixels.
 	Height uint
+
+	// PixelFormat is the format describing how every pixel on the texture image is stored.
+	PixelFormat PixelFormat
 }
 
 // NewTextureWithDescriptor creates a new texture with the provided descriptor using the device.
-func (d Device) NewTextureWithDescriptor(td TextureDescriptor) Texture {
+// It returns an error if the texture type of the descriptor is unknown.
+func (d Device) NewTextureWithDescriptor(td TextureDescriptor) (Texture, error) {
+	if int(td.TextureType) >= len(mtlTextureTypes) {
+		return Texture{}, fmt.Errorf("invalid texture type %d", td.TextureType)
+	}
+
 	descriptor := C.struct_TextureDescriptor{
-		PixelFormat: C.uint16_t(td.PixelFormat),
-		Width:       C.uint_t(td.Width),
-		Height:      C.uint_t(td.Height),
-		StorageMode: C.uint8_t(td.StorageMode),
+		TextureType:      C.uint8_t(mtlTextureTypes[td.TextureType]),
+		PixelFormat:      C.uint16_t(td.PixelFormat),
+		Width:            C.uint_t(td.Width),
+		Height:           C.uint_t(td.Height),
+		Depth:            C.uint_t(oneIfZero(td.Depth)),
+		MipmapLevelCount: C.uint_t(oneIfZero(td.MipmapLevelCount)),
+		ArrayLength:      C.uint_t(oneIfZero(td.ArrayLength)),
+		StorageMode:      C.uint8_t(td.StorageMode),
 	}
 
 	return Texture{
-		texture: C.Device_NewTextureWithDescriptor(d.device, descriptor),
-		Width:   td.Width,
-		Height:  td.Height,
-	}
+		texture:     C.Device_NewTextureWithDescriptor(d.device, descriptor),
+		Width:       td.Width,
+		Height:      td.Height,
+		PixelFormat: td.PixelFormat,
+	}, nil
 }
 
 // resource implements the Resource interface.
@@ -103,6 +129,57 @@ func (t Texture) ReplaceRegion(region Region, level int, pixelBytes *byte, bytes
 	C.Texture_ReplaceRegion(t.texture, r, C.uint_t(level), unsafe.Pointer(pixelBytes), C.size_t(bytesPerRow))
 }
 
+// ReplaceRegionSlice copies a block of pixels into a section of a texture slice.
+// Slices are the elements of array textures and the faces of cube textures, where
+// the faces of the cube at array index i are the slices 6*i to 6*i+5. For 3D
+// textures, bytesPerImage is the distance in bytes between two consecutive images.
+//
+// Reference: https://developer.apple.com/documentation/metal/mtltexture/1515679-replaceregion
+func (t Texture) ReplaceRegionSlice(region Region, level, slice int, pixelBytes *byte, bytesPerRow, bytesPerImage uintptr) {
+	r := C.struct_Region{
+		Origin: C.struct_Origin{
+			X: C.uint_t(region.Origin.X),
+			Y: C.uint_t(region.Origin.Y),
+			Z: C.uint_t(region.Origin.Z),
+		},
+		Size: C.struct_Size{
+			Width:  C.uint_t(region.Size.Width),
+			Height: C.uint_t(region.Size.Height),
+			Depth:  C.uint_t(region.Size.Depth),
+		},
+	}
+	C.Texture_ReplaceRegionSlice(t.texture, r, C.uint_t(level), C.uint_t(slice), unsafe.Pointer(pixelBytes), C.size_t(bytesPerRow), C.size_t(bytesPerImage))
+}
+
+// ReplaceLevels uploads the mipmap levels, starting at level 0, into the texture.
+// Every slice of a level is copied into the texture slice with the same index.
+func (t Texture) ReplaceLevels(levels []TextureLevel) {
+	pf := t.PixelFormat
+
+	for i, l := range levels {
+		region := RegionMake3D(0, 0, 0, uint(l.Width), uint(l.Height), uint(l.Depth))
+
+		// Metal expects no row and image strides for PVRTC data and no image stride
+		// for textures that are not 3D.
+		bytesPerRow, bytesPerImage := uintptr(l.BytesPerRow), uintptr(l.BytesPerImage)
+		if pf.isPVRTC() {
+			bytesPerRow = 0
+		}
+
+		if l.Depth <= 1 || pf.isPVRTC() {
+			bytesPerImage = 0
+		}
+
+		for slice, data := range l.Slices {
+			if len(data) == 0 {
+				continue
+			}
+
+			t.ReplaceRegionSlice(region, i, slice, &data[0], bytesPerRow, bytesPerImage)
+		}
+	}
+}
+
 // GetBytes copies a block of pixels from the storage allocation of texture
 // slice zero into system memory at a specified address.
 //
@@ -122,3 +199,12 @@ func (t Texture) GetBytes(pixelBytes *byte, bytesPerRow uintptr, region Region,
 	}
 	C.Texture_GetBytes(t.texture, unsafe.Pointer(pixelBytes), C.size_t(bytesPerRow), r, C.uint_t(level))
 }
+
+// oneIfZero returns 1 for a zero value and the value otherwise.
+func oneIfZero(v uint) uint {
+	if v == 0 {
+		return 1
+	}
+
+	return v
+}
@@ -3,9 +3,13 @@
 #include "mtl.h"
 
 struct TextureDescriptor {
+	uint8_t  TextureType;
 	uint16_t PixelFormat;
 	uint_t   Width;
 	uint_t   Height;
+	uint_t   Depth;
+	uint_t   MipmapLevelCount;
+	uint_t   ArrayLength;
 	uint8_t  StorageMode;
 };
 
@@ -17,4 +21,5 @@ void * Buffer_Contents(void * buffer);
 void * Device_NewTextureWithDescriptor(void * device, struct TextureDescriptor descriptor);
 
 void Texture_ReplaceRegion(void * texture, struct Region region, uint_t level, void * pixelBytes, size_t bytesPerRow);
+void Texture_ReplaceRegionSlice(void * texture, struct Region region, uint_t level, uint_t slice, void * pixelBytes, size_t bytesPerRow, size_t bytesPerImage);
 void Texture_GetBytes(void * texture, void * pixelBytes, size_t bytesPerRow, struct Region region, uint_t level);
\ No newline at end of file
@@ -20,9 +20,13 @@ void * Buffer_Contents(void * buffer) {
 
 void * Device_NewTextureWithDescriptor(void * device, struct TextureDescriptor descriptor) {
 	MTLTextureDescriptor * textureDescriptor = [[MTLTextureDescriptor alloc] init];
+	textureDescriptor.textureType = descriptor.TextureType;
 	textureDescriptor.pixelFormat = descriptor.PixelFormat;
 	textureDescriptor.width = descriptor.Width;
 	textureDescriptor.height = descriptor.Height;
+	textureDescriptor.depth = descriptor.Depth;
+	textureDescriptor.mipmapLevelCount = descriptor.MipmapLevelCount;
+	textureDescriptor.arrayLength = descriptor.ArrayLength;
 	textureDescriptor.storageMode = descriptor.StorageMode;
     
 	return [(id<MTLDevice>)device newTextureWithDescriptor:textureDescriptor];
@@ -35,6 +39,15 @@ void Texture_ReplaceRegion(void * texture, struct Region region, uint_t level, v
 	                           bytesPerRow:(NSUInteger)bytesPerRow];
 }
 
+void Texture_ReplaceRegionSlice(void * texture, struct Region region, uint_t level, uint_t slice, void * pixelBytes, size_t bytesPerRow, size_t bytesPerImage) {
+	[(id<MTLTexture>)texture replaceRegion:(MTLRegion){{region.Origin.X, region.Origin.Y, region.Origin.Z}, {region.Size.Width, region.Size.Height, region.Size.Depth}}
+	                           mipmapLevel:(NSUInteger)level
+	                                 slice:(NSUInteger)slice
+	                             withBytes:(void *)pixelBytes
+	                           bytesPerRow:(NSUInteger)bytesPerRow
+	                         bytesPerImage:(NSUInteger)bytesPerImage];
+}
+
 void Texture_GetBytes(void * texture, void * pixelBytes, size_t bytesPerRow, struct Region region, uint_t level) {
 	[(id<MTLTexture>)texture getBytes:(void *)pixelBytes
 	                      bytesPerRow:(NSUInteger)bytesPerRow
@@ -0,0 +1,100 @@
+package simd
+
+import "math"
+
+// Half is an IEEE 754 half-precision floating-point number, the half type of MSL.
+type Half uint16
+
+// NewHalf returns the half-precision value nearest to f, rounding ties to even.
+// Values too large to represent become infinity.
+func NewHalf(f float32) Half {
+	bits := math.Float32bits(f)
+	sign := uint32(bits>>16) & 0x8000
+	exp := int(bits >> 23 & 0xff)
+	mant := bits & 0x7fffff
+
+	if exp == 0xff {
+		if mant != 0 {
+			return Half(sign | 0x7e00)
+		}
+
+		return Half(sign | 0x7c00)
+	}
+
+	e := exp - 127 + 15
+
+	switch {
+	case e < -10:
+		// The value is below half of the smallest subnormal value.
+		return Half(sign)
+	case e <= 0:
+		// The result is subnormal or rounds to the smallest normal value.
+		return Half(sign | roundShift(mant|0x800000, uint(14-e)))
+	}
+
+	// A carry of the rounded mantissa correctly increments the exponent.
+	r := uint32(e)<<10 + roundShift(mant, 13)
+	if r >= 0x7c00 {
+		return Half(sign | 0x7c00)
+	}
+
+	return Half(sign | r)
+}
+
+// Float32 returns h as a float32.
+func (h Half) Float32() float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h >> 10 & 0x1f)
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		f := float32(math.Ldexp(float64(mant), -24))
+
+		return math.Float32frombits(math.Float32bits(f) | sign)
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+
+	return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+}
+
+// roundShift returns v shifted right by s bits, rounding to nearest even.
+func roundShift(v uint32, s uint) uint32 {
+	q, r := v>>s, v&(1<<s-1)
+	half := uint32(1) << (s - 1)
+
+	if r > half || (r == half && q&1 == 1) {
+		q++
+	}
+
+	return q
+}
+
+// Half2 is a vector of 2 half-precision values, the half2 type of MSL.
+type Half2 struct {
+	X, Y Half
+}
+
+// Float2 converts v to single precision.
+func (v Half2) Float2() Float2 { return Float2{v.X.Float32(), v.Y.Float32()} }
+
+// Half3 is a vector of 3 half-precision values, the half3 type of MSL. Like half3,
+// it takes 8 bytes.
+type Half3 struct {
+	X, Y, Z Half
+	_       Half
+}
+
+// Float3 converts v to single precision.
+func (v Half3) Float3() Float3 { return Float3{X: v.X.Float32(), Y: v.Y.Float32(), Z: v.Z.Float32()} }
+
+// Half4 is a vector of 4 half-precision values, the half4 type of MSL.
+type Half4 struct {
+	X, Y, Z, W Half
+}
+
+// Float4 converts v to single precision.
+func (v Half4) Float4() Float4 {
+	return Float4{v.X.Float32(), v.Y.Float32(), v.Z.Float32(), v.W.Float32()}
+}
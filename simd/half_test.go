@@ -0,0 +1,41 @@
+package simd
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHalf(t *testing.T) {
+	for f, h := range map[float32]Half{
+		0:                     0x0000,
+		1:                     0x3c00,
+		-2:                    0xc000,
+		0.5:                   0x3800,
+		65504:                 0x7bff,
+		65520:                 0x7c00, // rounds to infinity
+		1e6:                   0x7c00,
+		0.000060975552:        0x03ff, // largest subnormal
+		0.000000059604645:     0x0001, // smallest subnormal
+		0.00000002:            0x0000, // rounds to zero
+		1.0009765625:          0x3c01,
+		1.00048828125:         0x3c00, // ties to even
+		1.00146484375:         0x3c02, // ties to even
+		float32(math.Inf(-1)): 0xfc00,
+	} {
+		require.Equal(t, h, NewHalf(f), "%v", f)
+	}
+
+	require.Equal(t, Half(0x8000), NewHalf(float32(math.Copysign(0, -1))))
+	require.True(t, math.IsNaN(float64(NewHalf(float32(math.NaN())).Float32())))
+
+	for _, h := range []Half{0x0000, 0x8000, 0x0001, 0x03ff, 0x0400, 0x3c00, 0xc000, 0x7bff, 0x7c00, 0xfc00} {
+		require.Equal(t, h, NewHalf(h.Float32()), "%#04x", uint16(h))
+	}
+
+	require.Equal(t, float32(1), Half(0x3c00).Float32())
+	require.Equal(t, float32(-65504), Half(0xfbff).Float32())
+	require.Equal(t, float32(math.Ldexp(1, -24)), Half(0x0001).Float32())
+	require.True(t, math.IsInf(float64(Half(0x7c00).Float32()), 1))
+}
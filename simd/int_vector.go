@@ -0,0 +1,89 @@
+package simd
+
+// Int2 is a vector of 2 int32 values, the int2 type of MSL.
+type Int2 struct {
+	X, Y int32
+}
+
+// Add returns v+w.
+func (v Int2) Add(w Int2) Int2 { return Int2{v.X + w.X, v.Y + w.Y} }
+
+// Sub returns v-w.
+func (v Int2) Sub(w Int2) Int2 { return Int2{v.X - w.X, v.Y - w.Y} }
+
+// Mul returns the component-wise product of v and w.
+func (v Int2) Mul(w Int2) Int2 { return Int2{v.X * w.X, v.Y * w.Y} }
+
+// Int3 is a vector of 3 int32 values, the int3 type of MSL. Like int3, it takes
+// 16 bytes.
+type Int3 struct {
+	X, Y, Z int32
+	_       int32
+}
+
+// Add returns v+w.
+func (v Int3) Add(w Int3) Int3 { return Int3{X: v.X + w.X, Y: v.Y + w.Y, Z: v.Z + w.Z} }
+
+// Sub returns v-w.
+func (v Int3) Sub(w Int3) Int3 { return Int3{X: v.X - w.X, Y: v.Y - w.Y, Z: v.Z - w.Z} }
+
+// Mul returns the component-wise product of v and w.
+func (v Int3) Mul(w Int3) Int3 { return Int3{X: v.X * w.X, Y: v.Y * w.Y, Z: v.Z * w.Z} }
+
+// Int4 is a vector of 4 int32 values, the int4 type of MSL.
+type Int4 struct {
+	X, Y, Z, W int32
+}
+
+// Add returns v+w.
+func (v Int4) Add(w Int4) Int4 { return Int4{v.X + w.X, v.Y + w.Y, v.Z + w.Z, v.W + w.W} }
+
+// Sub returns v-w.
+func (v Int4) Sub(w Int4) Int4 { return Int4{v.X - w.X, v.Y - w.Y, v.Z - w.Z, v.W - w.W} }
+
+// Mul returns the component-wise product of v and w.
+func (v Int4) Mul(w Int4) Int4 { return Int4{v.X * w.X, v.Y * w.Y, v.Z * w.Z, v.W * w.W} }
+
+// UInt2 is a vector of 2 uint32 values, the uint2 type of MSL.
+type UInt2 struct {
+	X, Y uint32
+}
+
+// Add returns v+w.
+func (v UInt2) Add(w UInt2) UInt2 { return UInt2{v.X + w.X, v.Y + w.Y} }
+
+// Sub returns v-w.
+func (v UInt2) Sub(w UInt2) UInt2 { return UInt2{v.X - w.X, v.Y - w.Y} }
+
+// Mul returns the component-wise product of v and w.
+func (v UInt2) Mul(w UInt2) UInt2 { return UInt2{v.X * w.X, v.Y * w.Y} }
+
+// UInt3 is a vector of 3 uint32 values, the uint3 type of MSL. Like uint3, it
+// takes 16 bytes.
+type UInt3 struct {
+	X, Y, Z uint32
+	_       uint32
+}
+
+// Add returns v+w.
+func (v UInt3) Add(w UInt3) UInt3 { return UInt3{X: v.X + w.X, Y: v.Y + w.Y, Z: v.Z + w.Z} }
+
+// Sub returns v-w.
+func (v UInt3) Sub(w UInt3) UInt3 { return UInt3{X: v.X - w.X, Y: v.Y - w.Y, Z: v.Z - w.Z} }
+
+// Mul returns the component-wise product of v and w.
+func (v UInt3) Mul(w UInt3) UInt3 { return UInt3{X: v.X * w.X, Y: v.Y * w.Y, Z: v.Z * w.Z} }
+
+// UInt4 is a vector of 4 uint32 values, the uint4 type of MSL.
+type UInt4 struct {
+	X, Y, Z, W uint32
+}
+
+// Add returns v+w.
+func (v UInt4) Add(w UInt4) UInt4 { return UInt4{v.X + w.X, v.Y + w.Y, v.Z + w.Z, v.W + w.W} }
+
+// Sub returns v-w.
+func (v UInt4) Sub(w UInt4) UInt4 { return UInt4{v.X - w.X, v.Y - w.Y, v.Z - w.Z, v.W - w.W} }
+
+// Mul returns the component-wise product of v and w.
+func (v UInt4) Mul(w UInt4) UInt4 { return UInt4{v.X * w.X, v.Y * w.Y, v.Z * w.Z, v.W * w.W} }
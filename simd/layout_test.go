@@ -0,0 +1,94 @@
+package simd_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hupe1980/go-mtl/msl"
+	"github.com/hupe1980/go-mtl/simd"
+)
+
+func TestLayout(t *testing.T) {
+	for _, tt := range []struct {
+		value any
+		msl   string
+	}{
+		{simd.Half(0), "half"},
+		{simd.Float2{}, "float2"},
+		{simd.Float3{}, "float3"},
+		{simd.Float4{}, "float4"},
+		{simd.PackedFloat3{}, "packed_float3"},
+		{simd.Half2{}, "half2"},
+		{simd.Half3{}, "half3"},
+		{simd.Half4{}, "half4"},
+		{simd.Int2{}, "int2"},
+		{simd.Int3{}, "int3"},
+		{simd.Int4{}, "int4"},
+		{simd.UInt2{}, "uint2"},
+		{simd.UInt3{}, "uint3"},
+		{simd.UInt4{}, "uint4"},
+		{simd.Float2x2{}, "float2x2"},
+		{simd.Float3x3{}, "float3x3"},
+		{simd.Float4x4{}, "float4x4"},
+		{simd.Float2x3{}, "float2x3"},
+		{simd.Float2x4{}, "float2x4"},
+		{simd.Float3x2{}, "float3x2"},
+		{simd.Float3x4{}, "float3x4"},
+		{simd.Float4x2{}, "float4x2"},
+		{simd.Float4x3{}, "float4x3"},
+		{simd.Quat{}, "float4"},
+	} {
+		m, err := msl.Reflect("struct S { " + tt.msl + " v; };")
+		require.NoError(t, err)
+
+		l, err := m.Layout("S")
+		require.NoError(t, err)
+
+		typ := reflect.TypeOf(tt.value)
+		f := l.Fields[0]
+
+		// Go aligns to at most the size of the scalars, so the MSL alignment must be
+		// a multiple of the Go alignment, and arrays must have the MSL stride.
+		require.Equal(t, f.Size, int(typ.Size()), "size of %v", typ)
+		require.Zero(t, f.Align%typ.Align(), "alignment of %v", typ)
+		require.Zero(t, int(typ.Size())%f.Align, "stride of %v", typ)
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	type light struct {
+		Position  simd.Float3
+		Color     simd.Half4
+		Intensity float32
+		_         float32
+	}
+
+	type uniforms struct {
+		Transform simd.Float4x4
+		Normal    simd.Float3x3
+		Rotation  simd.Quat
+		Lights    [2]light
+		Cells     [3]simd.Int3
+	}
+
+	m, err := msl.Reflect(`struct Light {
+	float3 position;
+	half4 color;
+	float intensity;
+};
+
+struct Uniforms {
+	float4x4 transform;
+	float3x3 normal;
+	float4 rotation;
+	Light lights[2];
+	int3 cells[3];
+};`)
+	require.NoError(t, err)
+
+	mismatches, err := msl.ValidateLayout(reflect.TypeOf(uniforms{}), m, "Uniforms")
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+}
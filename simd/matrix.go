@@ -0,0 +1,366 @@
+package simd
+
+import "math"
+
+// Float2x2 is a matrix of 2 columns and 2 rows of float32 values, the float2x2
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float2x2 [2]Float2
+
+// Identity2x2 returns the 2x2 identity matrix.
+func Identity2x2() Float2x2 {
+	return Float2x2{{1, 0}, {0, 1}}
+}
+
+// Mul returns the matrix product m*n.
+func (m Float2x2) Mul(n Float2x2) Float2x2 { return m.matrix().mul(n.matrix()).float2x2() }
+
+// MulVector returns the product of m and the column vector v.
+func (m Float2x2) MulVector(v Float2) Float2 { return m[0].Scale(v.X).Add(m[1].Scale(v.Y)) }
+
+// Transpose returns the transpose of m.
+func (m Float2x2) Transpose() Float2x2 { return m.matrix().transpose().float2x2() }
+
+// Determinant returns the determinant of m.
+func (m Float2x2) Determinant() float32 { return float32(m.matrix().determinant()) }
+
+// Inverse returns the inverse of m and reports false if m is singular.
+func (m Float2x2) Inverse() (Float2x2, bool) {
+	inv, ok := m.matrix().inverse()
+
+	return inv.float2x2(), ok
+}
+
+// Float3x3 is a matrix of 3 columns and 3 rows of float32 values, the float3x3
+// type of MSL. The elements are stored in column-major order, so m[c] is column c,
+// and like in MSL each column takes 16 bytes.
+type Float3x3 [3]Float3
+
+// Identity3x3 returns the 3x3 identity matrix.
+func Identity3x3() Float3x3 {
+	return Float3x3{{X: 1}, {Y: 1}, {Z: 1}}
+}
+
+// Mul returns the matrix product m*n.
+func (m Float3x3) Mul(n Float3x3) Float3x3 { return m.matrix().mul(n.matrix()).float3x3() }
+
+// MulVector returns the product of m and the column vector v.
+func (m Float3x3) MulVector(v Float3) Float3 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z))
+}
+
+// Transpose returns the transpose of m.
+func (m Float3x3) Transpose() Float3x3 { return m.matrix().transpose().float3x3() }
+
+// Determinant returns the determinant of m.
+func (m Float3x3) Determinant() float32 { return float32(m.matrix().determinant()) }
+
+// Inverse returns the inverse of m and reports false if m is singular.
+func (m Float3x3) Inverse() (Float3x3, bool) {
+	inv, ok := m.matrix().inverse()
+
+	return inv.float3x3(), ok
+}
+
+// Float4x4 is a matrix of 4 columns and 4 rows of float32 values, the float4x4
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float4x4 [4]Float4
+
+// Identity4x4 returns the 4x4 identity matrix.
+func Identity4x4() Float4x4 {
+	return Float4x4{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+}
+
+// Mul returns the matrix product m*n.
+func (m Float4x4) Mul(n Float4x4) Float4x4 { return m.matrix().mul(n.matrix()).float4x4() }
+
+// MulVector returns the product of m and the column vector v.
+func (m Float4x4) MulVector(v Float4) Float4 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z)).Add(m[3].Scale(v.W))
+}
+
+// Transpose returns the transpose of m.
+func (m Float4x4) Transpose() Float4x4 { return m.matrix().transpose().float4x4() }
+
+// Determinant returns the determinant of m.
+func (m Float4x4) Determinant() float32 { return float32(m.matrix().determinant()) }
+
+// Inverse returns the inverse of m and reports false if m is singular.
+func (m Float4x4) Inverse() (Float4x4, bool) {
+	inv, ok := m.matrix().inverse()
+
+	return inv.float4x4(), ok
+}
+
+// Float2x3 is a matrix of 2 columns and 3 rows of float32 values, the float2x3
+// type of MSL. The elements are stored in column-major order, so m[c] is column c,
+// and like in MSL each column takes 16 bytes.
+type Float2x3 [2]Float3
+
+// MulVector returns the product of m and the column vector v.
+func (m Float2x3) MulVector(v Float2) Float3 { return m[0].Scale(v.X).Add(m[1].Scale(v.Y)) }
+
+// Transpose returns the transpose of m.
+func (m Float2x3) Transpose() Float3x2 {
+	return Float3x2{{m[0].X, m[1].X}, {m[0].Y, m[1].Y}, {m[0].Z, m[1].Z}}
+}
+
+// Float2x4 is a matrix of 2 columns and 4 rows of float32 values, the float2x4
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float2x4 [2]Float4
+
+// MulVector returns the product of m and the column vector v.
+func (m Float2x4) MulVector(v Float2) Float4 { return m[0].Scale(v.X).Add(m[1].Scale(v.Y)) }
+
+// Transpose returns the transpose of m.
+func (m Float2x4) Transpose() Float4x2 {
+	return Float4x2{{m[0].X, m[1].X}, {m[0].Y, m[1].Y}, {m[0].Z, m[1].Z}, {m[0].W, m[1].W}}
+}
+
+// Float3x2 is a matrix of 3 columns and 2 rows of float32 values, the float3x2
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float3x2 [3]Float2
+
+// MulVector returns the product of m and the column vector v.
+func (m Float3x2) MulVector(v Float3) Float2 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z))
+}
+
+// Transpose returns the transpose of m.
+func (m Float3x2) Transpose() Float2x3 {
+	return Float2x3{{X: m[0].X, Y: m[1].X, Z: m[2].X}, {X: m[0].Y, Y: m[1].Y, Z: m[2].Y}}
+}
+
+// Float3x4 is a matrix of 3 columns and 4 rows of float32 values, the float3x4
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float3x4 [3]Float4
+
+// MulVector returns the product of m and the column vector v.
+func (m Float3x4) MulVector(v Float3) Float4 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z))
+}
+
+// Transpose returns the transpose of m.
+func (m Float3x4) Transpose() Float4x3 {
+	return Float4x3{
+		{X: m[0].X, Y: m[1].X, Z: m[2].X},
+		{X: m[0].Y, Y: m[1].Y, Z: m[2].Y},
+		{X: m[0].Z, Y: m[1].Z, Z: m[2].Z},
+		{X: m[0].W, Y: m[1].W, Z: m[2].W},
+	}
+}
+
+// Float4x2 is a matrix of 4 columns and 2 rows of float32 values, the float4x2
+// type of MSL. The elements are stored in column-major order, so m[c] is column c.
+type Float4x2 [4]Float2
+
+// MulVector returns the product of m and the column vector v.
+func (m Float4x2) MulVector(v Float4) Float2 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z)).Add(m[3].Scale(v.W))
+}
+
+// Transpose returns the transpose of m.
+func (m Float4x2) Transpose() Float2x4 {
+	return Float2x4{{m[0].X, m[1].X, m[2].X, m[3].X}, {m[0].Y, m[1].Y, m[2].Y, m[3].Y}}
+}
+
+// Float4x3 is a matrix of 4 columns and 3 rows of float32 values, the float4x3
+// type of MSL. The elements are stored in column-major order, so m[c] is column c,
+// and like in MSL each column takes 16 bytes.
+type Float4x3 [4]Float3
+
+// MulVector returns the product of m and the column vector v.
+func (m Float4x3) MulVector(v Float4) Float3 {
+	return m[0].Scale(v.X).Add(m[1].Scale(v.Y)).Add(m[2].Scale(v.Z)).Add(m[3].Scale(v.W))
+}
+
+// Transpose returns the transpose of m.
+func (m Float4x3) Transpose() Float3x4 {
+	return Float3x4{
+		{m[0].X, m[1].X, m[2].X, m[3].X},
+		{m[0].Y, m[1].Y, m[2].Y, m[3].Y},
+		{m[0].Z, m[1].Z, m[2].Z, m[3].Z},
+	}
+}
+
+// matrix is a square matrix of n rows and columns in double precision, used to
+// implement the operations of all matrix types. e[r][c] is the element in row r
+// and column c.
+type matrix struct {
+	n int
+	e [4][4]float64
+}
+
+// matrix returns m in double precision.
+func (m Float2x2) matrix() matrix {
+	a := matrix{n: 2}
+	for c, col := range m {
+		a.e[0][c], a.e[1][c] = float64(col.X), float64(col.Y)
+	}
+
+	return a
+}
+
+// matrix returns m in double precision.
+func (m Float3x3) matrix() matrix {
+	a := matrix{n: 3}
+	for c, col := range m {
+		a.e[0][c], a.e[1][c], a.e[2][c] = float64(col.X), float64(col.Y), float64(col.Z)
+	}
+
+	return a
+}
+
+// matrix returns m in double precision.
+func (m Float4x4) matrix() matrix {
+	a := matrix{n: 4}
+	for c, col := range m {
+		a.e[0][c], a.e[1][c], a.e[2][c], a.e[3][c] = float64(col.X), float64(col.Y), float64(col.Z), float64(col.W)
+	}
+
+	return a
+}
+
+// float2x2 returns a, which has 2 rows and columns, in single precision.
+func (a matrix) float2x2() (m Float2x2) {
+	for c := range m {
+		m[c] = Float2{float32(a.e[0][c]), float32(a.e[1][c])}
+	}
+
+	return m
+}
+
+// float3x3 returns a, which has 3 rows and columns, in single precision.
+func (a matrix) float3x3() (m Float3x3) {
+	for c := range m {
+		m[c] = Float3{X: float32(a.e[0][c]), Y: float32(a.e[1][c]), Z: float32(a.e[2][c])}
+	}
+
+	return m
+}
+
+// float4x4 returns a, which has 4 rows and columns, in single precision.
+func (a matrix) float4x4() (m Float4x4) {
+	for c := range m {
+		m[c] = Float4{float32(a.e[0][c]), float32(a.e[1][c]), float32(a.e[2][c]), float32(a.e[3][c])}
+	}
+
+	return m
+}
+
+// mul returns the matrix product a*b.
+func (a matrix) mul(b matrix) matrix {
+	p := matrix{n: a.n}
+
+	for r := 0; r < a.n; r++ {
+		for c := 0; c < a.n; c++ {
+			for k := 0; k < a.n; k++ {
+				p.e[r][c] += a.e[r][k] * b.e[k][c]
+			}
+		}
+	}
+
+	return p
+}
+
+// transpose returns the transpose of a.
+func (a matrix) transpose() matrix {
+	t := matrix{n: a.n}
+
+	for r := 0; r < a.n; r++ {
+		for c := 0; c < a.n; c++ {
+			t.e[c][r] = a.e[r][c]
+		}
+	}
+
+	return t
+}
+
+// pivot swaps the row with the largest absolute value in column c at or below the
+// diagonal into row c of a and of b, and reports whether the rows were swapped and
+// whether the pivot is not 0.
+func (a *matrix) pivot(b *matrix, c int) (swapped, ok bool) {
+	p := c
+
+	for r := c + 1; r < a.n; r++ {
+		if math.Abs(a.e[r][c]) > math.Abs(a.e[p][c]) {
+			p = r
+		}
+	}
+
+	if a.e[p][c] == 0 {
+		return false, false
+	}
+
+	if p == c {
+		return false, true
+	}
+
+	a.e[p], a.e[c] = a.e[c], a.e[p]
+	b.e[p], b.e[c] = b.e[c], b.e[p]
+
+	return true, true
+}
+
+// determinant returns the determinant of a using Gaussian elimination.
+func (a matrix) determinant() float64 {
+	var unused matrix
+
+	det := 1.0
+
+	for c := 0; c < a.n; c++ {
+		swapped, ok := a.pivot(&unused, c)
+		if !ok {
+			return 0
+		}
+
+		if swapped {
+			det = -det
+		}
+
+		det *= a.e[c][c]
+
+		for r := c + 1; r < a.n; r++ {
+			f := a.e[r][c] / a.e[c][c]
+			for k := c; k < a.n; k++ {
+				a.e[r][k] -= f * a.e[c][k]
+			}
+		}
+	}
+
+	return det
+}
+
+// inverse returns the inverse of a using Gauss-Jordan elimination and reports
+// false if a is singular.
+func (a matrix) inverse() (matrix, bool) {
+	inv := matrix{n: a.n}
+	for i := 0; i < a.n; i++ {
+		inv.e[i][i] = 1
+	}
+
+	for c := 0; c < a.n; c++ {
+		if _, ok := a.pivot(&inv, c); !ok {
+			return matrix{n: a.n}, false
+		}
+
+		scale := 1 / a.e[c][c]
+		for k := 0; k < a.n; k++ {
+			a.e[c][k] *= scale
+			inv.e[c][k] *= scale
+		}
+
+		for r := 0; r < a.n; r++ {
+			if r == c || a.e[r][c] == 0 {
+				continue
+			}
+
+			f := a.e[r][c]
+			for k := 0; k < a.n; k++ {
+				a.e[r][k] -= f * a.e[c][k]
+				inv.e[r][k] -= f * inv.e[c][k]
+			}
+		}
+	}
+
+	return inv, true
+}
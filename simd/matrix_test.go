@@ -0,0 +1,85 @@
+package simd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloat2x2(t *testing.T) {
+	m := Float2x2{{1, 2}, {3, 4}}
+
+	require.Equal(t, m, m.Mul(Identity2x2()))
+	require.Equal(t, Float2x2{{1, 3}, {2, 4}}, m.Transpose())
+	require.Equal(t, Float2{7, 10}, m.MulVector(Float2{1, 2}))
+	require.Equal(t, float32(-2), m.Determinant())
+
+	inv, ok := m.Inverse()
+	require.True(t, ok)
+	require.Equal(t, Float2x2{{-2, 1}, {1.5, -0.5}}, inv)
+	require.Equal(t, Identity2x2(), m.Mul(inv))
+
+	_, ok = Float2x2{{1, 2}, {2, 4}}.Inverse()
+	require.False(t, ok)
+}
+
+func TestFloat3x3(t *testing.T) {
+	m := Float3x3{{X: 2}, {Y: 3}, {X: 1, Z: 4}}
+
+	require.Equal(t, m, Identity3x3().Mul(m))
+	require.Equal(t, Float3x3{{X: 2, Z: 1}, {Y: 3}, {Z: 4}}, m.Transpose())
+
+	// Columns are the images of the unit vectors.
+	require.Equal(t, Float3{X: 3, Y: 3, Z: 4}, m.MulVector(Float3{X: 1, Y: 1, Z: 1}))
+	require.Equal(t, float32(24), m.Determinant())
+
+	inv, ok := m.Inverse()
+	require.True(t, ok)
+	require.Equal(t, Identity3x3(), m.Mul(inv))
+
+	_, ok = Float3x3{{X: 1}, {Y: 1}, {}}.Inverse()
+	require.False(t, ok)
+}
+
+func TestFloat4x4(t *testing.T) {
+	// A translation by (1, 2, 3) followed by a scale by 2.
+	translate := Identity4x4()
+	translate[3] = Float4{1, 2, 3, 1}
+	scale := Float4x4{{2, 0, 0, 0}, {0, 2, 0, 0}, {0, 0, 2, 0}, {0, 0, 0, 1}}
+	m := scale.Mul(translate)
+
+	require.Equal(t, Float4{4, 6, 8, 1}, m.MulVector(Float4{1, 1, 1, 1}))
+	require.Equal(t, Float4{2, 4, 6, 1}, m[3])
+	require.Equal(t, Float4{1, 0, 0, 1}, translate.Transpose()[0])
+	require.Equal(t, float32(8), m.Determinant())
+	require.Equal(t, float32(-1), Float4x4{{0, 1, 0, 0}, {1, 0, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}.Determinant())
+
+	inv, ok := m.Inverse()
+	require.True(t, ok)
+	require.Equal(t, Float4{1, 1, 1, 1}, inv.MulVector(Float4{4, 6, 8, 1}))
+	require.Equal(t, Identity4x4(), inv.Mul(m))
+
+	_, ok = Float4x4{}.Inverse()
+	require.False(t, ok)
+	require.Equal(t, float32(0), Float4x4{}.Determinant())
+}
+
+func TestNonSquareMatrices(t *testing.T) {
+	m23 := Float2x3{{X: 1, Y: 2, Z: 3}, {X: 4, Y: 5, Z: 6}}
+	require.Equal(t, Float3{X: 9, Y: 12, Z: 15}, m23.MulVector(Float2{1, 2}))
+	require.Equal(t, Float3x2{{1, 4}, {2, 5}, {3, 6}}, m23.Transpose())
+	require.Equal(t, m23, m23.Transpose().Transpose())
+	require.Equal(t, Float2{14, 32}, m23.Transpose().MulVector(Float3{X: 1, Y: 2, Z: 3}))
+
+	m24 := Float2x4{{1, 2, 3, 4}, {5, 6, 7, 8}}
+	require.Equal(t, Float4{11, 14, 17, 20}, m24.MulVector(Float2{1, 2}))
+	require.Equal(t, Float4x2{{1, 5}, {2, 6}, {3, 7}, {4, 8}}, m24.Transpose())
+	require.Equal(t, m24, m24.Transpose().Transpose())
+	require.Equal(t, Float2{10, 26}, m24.Transpose().MulVector(Float4{1, 1, 1, 1}))
+
+	m34 := Float3x4{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+	require.Equal(t, Float4{15, 18, 21, 24}, m34.MulVector(Float3{X: 1, Y: 1, Z: 1}))
+	require.Equal(t, Float4x3{{X: 1, Y: 5, Z: 9}, {X: 2, Y: 6, Z: 10}, {X: 3, Y: 7, Z: 11}, {X: 4, Y: 8, Z: 12}}, m34.Transpose())
+	require.Equal(t, m34, m34.Transpose().Transpose())
+	require.Equal(t, Float3{X: 10, Y: 26, Z: 42}, m34.Transpose().MulVector(Float4{1, 1, 1, 1}))
+}
@@ -0,0 +1,117 @@
+package simd
+
+import "math"
+
+// Quat is a quaternion of float32 values with the imaginary part X, Y, Z and the
+// real part W, the layout of simd_quatf. MSL has no quaternion type, so shaders
+// declare it as float4.
+type Quat struct {
+	X, Y, Z, W float32
+}
+
+// IdentityQuat returns the quaternion of no rotation.
+func IdentityQuat() Quat {
+	return Quat{W: 1}
+}
+
+// QuatAxisAngle returns the unit quaternion of the rotation by angle radians
+// around axis, following the right-hand rule. axis does not need to be normalized.
+func QuatAxisAngle(axis Float3, angle float32) Quat {
+	sin, cos := math.Sincos(float64(angle) / 2)
+	v := axis.Normalize().Scale(float32(sin))
+
+	return Quat{v.X, v.Y, v.Z, float32(cos)}
+}
+
+// Mul returns the Hamilton product q*r, the rotation r followed by q.
+func (q Quat) Mul(r Quat) Quat {
+	return Quat{
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+	}
+}
+
+// Dot returns the dot product of q and r.
+func (q Quat) Dot(r Quat) float32 { return q.X*r.X + q.Y*r.Y + q.Z*r.Z + q.W*r.W }
+
+// Length returns the norm of q.
+func (q Quat) Length() float32 { return sqrt(q.Dot(q)) }
+
+// Normalize returns q scaled to length 1, or q if its length is 0.
+func (q Quat) Normalize() Quat {
+	s := inverseLength(q.Dot(q))
+
+	return Quat{q.X * s, q.Y * s, q.Z * s, q.W * s}
+}
+
+// Conjugate returns the conjugate of q, which is its inverse if q is a unit
+// quaternion.
+func (q Quat) Conjugate() Quat { return Quat{-q.X, -q.Y, -q.Z, q.W} }
+
+// Inverse returns the inverse of q, or q if its length is 0.
+func (q Quat) Inverse() Quat {
+	n := q.Dot(q)
+	if n == 0 {
+		return q
+	}
+
+	c := q.Conjugate()
+
+	return Quat{c.X / n, c.Y / n, c.Z / n, c.W / n}
+}
+
+// Slerp returns the spherical linear interpolation of the unit quaternions q and
+// r at t between 0 and 1 along the shorter arc.
+func (q Quat) Slerp(r Quat, t float32) Quat {
+	d := float64(q.Dot(r))
+	if d < 0 {
+		r, d = Quat{-r.X, -r.Y, -r.Z, -r.W}, -d
+	}
+
+	a, b := 1-float64(t), float64(t)
+
+	// Interpolate linearly where the angle is too small for the sine.
+	if d < 0.9995 {
+		theta := math.Acos(d)
+		sin := math.Sin(theta)
+		a, b = math.Sin(a*theta)/sin, math.Sin(b*theta)/sin
+	}
+
+	s := Quat{
+		float32(a*float64(q.X) + b*float64(r.X)),
+		float32(a*float64(q.Y) + b*float64(r.Y)),
+		float32(a*float64(q.Z) + b*float64(r.Z)),
+		float32(a*float64(q.W) + b*float64(r.W)),
+	}
+
+	return s.Normalize()
+}
+
+// Rotate returns v rotated by the unit quaternion q.
+func (q Quat) Rotate(v Float3) Float3 {
+	u := Float3{X: q.X, Y: q.Y, Z: q.Z}
+	t := u.Cross(v).Scale(2)
+
+	return v.Add(t.Scale(q.W)).Add(u.Cross(t))
+}
+
+// Float3x3 returns the rotation matrix of the unit quaternion q.
+func (q Quat) Float3x3() Float3x3 {
+	x, y, z, w := q.X, q.Y, q.Z, q.W
+
+	return Float3x3{
+		{X: 1 - 2*(y*y+z*z), Y: 2 * (x*y + w*z), Z: 2 * (x*z - w*y)},
+		{X: 2 * (x*y - w*z), Y: 1 - 2*(x*x+z*z), Z: 2 * (y*z + w*x)},
+		{X: 2 * (x*z + w*y), Y: 2 * (y*z - w*x), Z: 1 - 2*(x*x+y*y)},
+	}
+}
+
+// Float4x4 returns the rotation matrix of the unit quaternion q in homogeneous
+// coordinates.
+func (q Quat) Float4x4() Float4x4 {
+	m := q.Float3x3()
+
+	return Float4x4{m[0].Float4(0), m[1].Float4(0), m[2].Float4(0), {0, 0, 0, 1}}
+}
@@ -0,0 +1,53 @@
+package simd
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireFloat3 checks that the components of v are within 1e-6 of want.
+func requireFloat3(t *testing.T, want, v Float3) {
+	t.Helper()
+
+	require.InDelta(t, want.X, v.X, 1e-6)
+	require.InDelta(t, want.Y, v.Y, 1e-6)
+	require.InDelta(t, want.Z, v.Z, 1e-6)
+}
+
+func TestQuat(t *testing.T) {
+	x, y, z := Float3{X: 1}, Float3{Y: 1}, Float3{Z: 1}
+
+	q := QuatAxisAngle(Float3{Z: 2}, math.Pi/2)
+	require.InDelta(t, 1, q.Length(), 1e-6)
+
+	// A quarter turn around z rotates x to y and y to -x.
+	requireFloat3(t, y, q.Rotate(x))
+	requireFloat3(t, x.Neg(), q.Rotate(y))
+	requireFloat3(t, z, q.Rotate(z))
+	requireFloat3(t, x, q.Conjugate().Rotate(y))
+	requireFloat3(t, x, q.Inverse().Rotate(y))
+
+	// The product applies the right operand first.
+	r := QuatAxisAngle(x, math.Pi/2)
+	requireFloat3(t, z, q.Mul(r).Rotate(y))
+	requireFloat3(t, z, r.Mul(q).Rotate(x))
+
+	for _, v := range []Float3{x, y, z, {X: 1, Y: 2, Z: 3}} {
+		requireFloat3(t, q.Rotate(v), q.Float3x3().MulVector(v))
+		requireFloat3(t, q.Rotate(v), q.Float4x4().MulVector(v.Float4(1)).XYZ())
+	}
+
+	require.Equal(t, Float4{0, 0, 0, 1}, q.Float4x4()[3])
+	require.Equal(t, Identity4x4(), IdentityQuat().Float4x4())
+	require.Equal(t, Quat{W: 0.5}, Quat{W: 2}.Inverse())
+	require.Equal(t, Quat{W: 1}, Quat{W: 3}.Normalize())
+	require.Equal(t, Quat{}, Quat{}.Inverse())
+
+	// Halfway between no rotation and a quarter turn is an eighth turn.
+	s := IdentityQuat().Slerp(q, 0.5)
+	requireFloat3(t, Float3{X: math.Sqrt2 / 2, Y: math.Sqrt2 / 2}, s.Rotate(x))
+	require.Equal(t, IdentityQuat(), IdentityQuat().Slerp(q, 0))
+	require.InDelta(t, 1, q.Slerp(q, 0.5).Dot(q), 1e-6)
+}
@@ -0,0 +1,160 @@
+// Package simd provides vector, matrix and quaternion types with the memory layout
+// of the corresponding Metal Shading Language types, so Go values can be copied to
+// buffers byte for byte.
+//
+// Each type has the size of its MSL type, including the padding of vectors of 3
+// components: Float3 takes 16 bytes like float3, and the columns of Float3x3 are
+// 16 bytes apart. Matrices are stored in column-major order. Go aligns the types to
+// at most 4 bytes, while MSL aligns float4 to 16, so fields of these types must be
+// placed at offsets that are multiples of the MSL alignment. msl.ValidateLayout and
+// mtltest.AssertLayout check this, and msl.GenerateStructs maps the types to their
+// MSL names.
+//
+//	type Uniforms struct {
+//		Transform simd.Float4x4
+//		Color     simd.Float4
+//		Normal    simd.Float3
+//	}
+package simd
+
+import "math"
+
+// Float2 is a vector of 2 float32 values, the float2 type of MSL.
+type Float2 struct {
+	X, Y float32
+}
+
+// Add returns v+w.
+func (v Float2) Add(w Float2) Float2 { return Float2{v.X + w.X, v.Y + w.Y} }
+
+// Sub returns v-w.
+func (v Float2) Sub(w Float2) Float2 { return Float2{v.X - w.X, v.Y - w.Y} }
+
+// Mul returns the component-wise product of v and w.
+func (v Float2) Mul(w Float2) Float2 { return Float2{v.X * w.X, v.Y * w.Y} }
+
+// Scale returns v multiplied by s.
+func (v Float2) Scale(s float32) Float2 { return Float2{v.X * s, v.Y * s} }
+
+// Neg returns -v.
+func (v Float2) Neg() Float2 { return Float2{-v.X, -v.Y} }
+
+// Dot returns the dot product of v and w.
+func (v Float2) Dot(w Float2) float32 { return v.X*w.X + v.Y*w.Y }
+
+// Length returns the Euclidean length of v.
+func (v Float2) Length() float32 { return sqrt(v.Dot(v)) }
+
+// Normalize returns v scaled to length 1, or v if its length is 0.
+func (v Float2) Normalize() Float2 { return v.Scale(inverseLength(v.Dot(v))) }
+
+// Half2 converts v to half precision.
+func (v Float2) Half2() Half2 { return Half2{NewHalf(v.X), NewHalf(v.Y)} }
+
+// Float3 is a vector of 3 float32 values, the float3 type of MSL. Like float3, it
+// takes 16 bytes.
+type Float3 struct {
+	X, Y, Z float32
+	_       float32
+}
+
+// Add returns v+w.
+func (v Float3) Add(w Float3) Float3 { return Float3{X: v.X + w.X, Y: v.Y + w.Y, Z: v.Z + w.Z} }
+
+// Sub returns v-w.
+func (v Float3) Sub(w Float3) Float3 { return Float3{X: v.X - w.X, Y: v.Y - w.Y, Z: v.Z - w.Z} }
+
+// Mul returns the component-wise product of v and w.
+func (v Float3) Mul(w Float3) Float3 { return Float3{X: v.X * w.X, Y: v.Y * w.Y, Z: v.Z * w.Z} }
+
+// Scale returns v multiplied by s.
+func (v Float3) Scale(s float32) Float3 { return Float3{X: v.X * s, Y: v.Y * s, Z: v.Z * s} }
+
+// Neg returns -v.
+func (v Float3) Neg() Float3 { return Float3{X: -v.X, Y: -v.Y, Z: -v.Z} }
+
+// Dot returns the dot product of v and w.
+func (v Float3) Dot(w Float3) float32 { return v.X*w.X + v.Y*w.Y + v.Z*w.Z }
+
+// Cross returns the cross product of v and w.
+func (v Float3) Cross(w Float3) Float3 {
+	return Float3{
+		X: v.Y*w.Z - v.Z*w.Y,
+		Y: v.Z*w.X - v.X*w.Z,
+		Z: v.X*w.Y - v.Y*w.X,
+	}
+}
+
+// Length returns the Euclidean length of v.
+func (v Float3) Length() float32 { return sqrt(v.Dot(v)) }
+
+// Normalize returns v scaled to length 1, or v if its length is 0.
+func (v Float3) Normalize() Float3 { return v.Scale(inverseLength(v.Dot(v))) }
+
+// Float4 returns v extended by the component w.
+func (v Float3) Float4(w float32) Float4 { return Float4{v.X, v.Y, v.Z, w} }
+
+// Packed returns v without padding.
+func (v Float3) Packed() PackedFloat3 { return PackedFloat3{v.X, v.Y, v.Z} }
+
+// Half3 converts v to half precision.
+func (v Float3) Half3() Half3 { return Half3{X: NewHalf(v.X), Y: NewHalf(v.Y), Z: NewHalf(v.Z)} }
+
+// PackedFloat3 is a vector of 3 float32 values without padding, the packed_float3
+// type of MSL.
+type PackedFloat3 struct {
+	X, Y, Z float32
+}
+
+// Float3 returns v as an aligned vector.
+func (v PackedFloat3) Float3() Float3 { return Float3{X: v.X, Y: v.Y, Z: v.Z} }
+
+// Float4 is a vector of 4 float32 values, the float4 type of MSL.
+type Float4 struct {
+	X, Y, Z, W float32
+}
+
+// Add returns v+w.
+func (v Float4) Add(w Float4) Float4 { return Float4{v.X + w.X, v.Y + w.Y, v.Z + w.Z, v.W + w.W} }
+
+// Sub returns v-w.
+func (v Float4) Sub(w Float4) Float4 { return Float4{v.X - w.X, v.Y - w.Y, v.Z - w.Z, v.W - w.W} }
+
+// Mul returns the component-wise product of v and w.
+func (v Float4) Mul(w Float4) Float4 { return Float4{v.X * w.X, v.Y * w.Y, v.Z * w.Z, v.W * w.W} }
+
+// Scale returns v multiplied by s.
+func (v Float4) Scale(s float32) Float4 { return Float4{v.X * s, v.Y * s, v.Z * s, v.W * s} }
+
+// Neg returns -v.
+func (v Float4) Neg() Float4 { return Float4{-v.X, -v.Y, -v.Z, -v.W} }
+
+// Dot returns the dot product of v and w.
+func (v Float4) Dot(w Float4) float32 { return v.X*w.X + v.Y*w.Y + v.Z*w.Z + v.W*w.W }
+
+// Length returns the Euclidean length of v.
+func (v Float4) Length() float32 { return sqrt(v.Dot(v)) }
+
+// Normalize returns v scaled to length 1, or v if its length is 0.
+func (v Float4) Normalize() Float4 { return v.Scale(inverseLength(v.Dot(v))) }
+
+// XYZ returns the first 3 components of v.
+func (v Float4) XYZ() Float3 { return Float3{X: v.X, Y: v.Y, Z: v.Z} }
+
+// Half4 converts v to half precision.
+func (v Float4) Half4() Half4 { return Half4{NewHalf(v.X), NewHalf(v.Y), NewHalf(v.Z), NewHalf(v.W)} }
+
+// sqrt returns the square root of x.
+func sqrt(x float32) float32 {
+	return float32(math.Sqrt(float64(x)))
+}
+
+// inverseLength returns the factor that scales a vector with the squared length
+// to length 1, or 1 for the zero vector.
+func inverseLength(squared float32) float32 {
+	if squared == 0 {
+		return 1
+	}
+
+	return float32(1 / math.Sqrt(float64(squared)))
+}
@@ -0,0 +1,78 @@
+package simd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloat2(t *testing.T) {
+	v, w := Float2{1, 2}, Float2{3, 4}
+
+	require.Equal(t, Float2{4, 6}, v.Add(w))
+	require.Equal(t, Float2{-2, -2}, v.Sub(w))
+	require.Equal(t, Float2{3, 8}, v.Mul(w))
+	require.Equal(t, Float2{2, 4}, v.Scale(2))
+	require.Equal(t, Float2{-1, -2}, v.Neg())
+	require.Equal(t, float32(11), v.Dot(w))
+	require.Equal(t, float32(5), w.Length())
+	require.Equal(t, Float2{0.6, 0.8}, w.Normalize())
+	require.Equal(t, Float2{}, Float2{}.Normalize())
+	require.Equal(t, v, v.Half2().Float2())
+}
+
+func TestFloat3(t *testing.T) {
+	v, w := Float3{X: 1, Y: 2, Z: 3}, Float3{X: 4, Y: 5, Z: 6}
+
+	require.Equal(t, Float3{X: 5, Y: 7, Z: 9}, v.Add(w))
+	require.Equal(t, Float3{X: -3, Y: -3, Z: -3}, v.Sub(w))
+	require.Equal(t, Float3{X: 4, Y: 10, Z: 18}, v.Mul(w))
+	require.Equal(t, Float3{X: 2, Y: 4, Z: 6}, v.Scale(2))
+	require.Equal(t, Float3{X: -1, Y: -2, Z: -3}, v.Neg())
+	require.Equal(t, float32(32), v.Dot(w))
+	require.Equal(t, Float3{X: -3, Y: 6, Z: -3}, v.Cross(w))
+	require.Equal(t, Float3{Z: 1}, Float3{X: 1}.Cross(Float3{Y: 1}))
+	require.Equal(t, float32(3), Float3{X: 1, Y: 2, Z: 2}.Length())
+	require.InDelta(t, 1, v.Normalize().Length(), 1e-6)
+	require.Equal(t, Float4{1, 2, 3, 1}, v.Float4(1))
+	require.Equal(t, PackedFloat3{1, 2, 3}, v.Packed())
+	require.Equal(t, v, v.Packed().Float3())
+	require.Equal(t, v, v.Half3().Float3())
+}
+
+func TestFloat4(t *testing.T) {
+	v, w := Float4{1, 2, 3, 4}, Float4{5, 6, 7, 8}
+
+	require.Equal(t, Float4{6, 8, 10, 12}, v.Add(w))
+	require.Equal(t, Float4{-4, -4, -4, -4}, v.Sub(w))
+	require.Equal(t, Float4{5, 12, 21, 32}, v.Mul(w))
+	require.Equal(t, Float4{0.5, 1, 1.5, 2}, v.Scale(0.5))
+	require.Equal(t, Float4{-1, -2, -3, -4}, v.Neg())
+	require.Equal(t, float32(70), v.Dot(w))
+	require.Equal(t, float32(2), Float4{1, 1, 1, 1}.Length())
+	require.Equal(t, Float4{0.5, 0.5, 0.5, 0.5}, Float4{2, 2, 2, 2}.Normalize())
+	require.Equal(t, Float3{X: 1, Y: 2, Z: 3}, v.XYZ())
+	require.Equal(t, v, v.Half4().Float4())
+}
+
+func TestIntVectors(t *testing.T) {
+	require.Equal(t, Int2{4, -2}, Int2{1, 2}.Add(Int2{3, -4}))
+	require.Equal(t, Int2{-2, 6}, Int2{1, 2}.Sub(Int2{3, -4}))
+	require.Equal(t, Int2{3, -8}, Int2{1, 2}.Mul(Int2{3, -4}))
+	require.Equal(t, Int3{X: 5, Y: 7, Z: 9}, Int3{X: 1, Y: 2, Z: 3}.Add(Int3{X: 4, Y: 5, Z: 6}))
+	require.Equal(t, Int3{X: -3, Y: -3, Z: -3}, Int3{X: 1, Y: 2, Z: 3}.Sub(Int3{X: 4, Y: 5, Z: 6}))
+	require.Equal(t, Int3{X: 4, Y: 10, Z: 18}, Int3{X: 1, Y: 2, Z: 3}.Mul(Int3{X: 4, Y: 5, Z: 6}))
+	require.Equal(t, Int4{2, 2, 2, 2}, Int4{1, 2, 3, 4}.Add(Int4{1, 0, -1, -2}))
+	require.Equal(t, Int4{0, 2, 4, 6}, Int4{1, 2, 3, 4}.Sub(Int4{1, 0, -1, -2}))
+	require.Equal(t, Int4{1, 0, -3, -8}, Int4{1, 2, 3, 4}.Mul(Int4{1, 0, -1, -2}))
+
+	require.Equal(t, UInt2{4, 6}, UInt2{1, 2}.Add(UInt2{3, 4}))
+	require.Equal(t, UInt2{2, 2}, UInt2{3, 4}.Sub(UInt2{1, 2}))
+	require.Equal(t, UInt2{3, 8}, UInt2{1, 2}.Mul(UInt2{3, 4}))
+	require.Equal(t, UInt3{X: 5, Y: 7, Z: 9}, UInt3{X: 1, Y: 2, Z: 3}.Add(UInt3{X: 4, Y: 5, Z: 6}))
+	require.Equal(t, UInt3{X: 3, Y: 3, Z: 3}, UInt3{X: 4, Y: 5, Z: 6}.Sub(UInt3{X: 1, Y: 2, Z: 3}))
+	require.Equal(t, UInt3{X: 4, Y: 10, Z: 18}, UInt3{X: 1, Y: 2, Z: 3}.Mul(UInt3{X: 4, Y: 5, Z: 6}))
+	require.Equal(t, UInt4{6, 8, 10, 12}, UInt4{1, 2, 3, 4}.Add(UInt4{5, 6, 7, 8}))
+	require.Equal(t, UInt4{4, 4, 4, 4}, UInt4{5, 6, 7, 8}.Sub(UInt4{1, 2, 3, 4}))
+	require.Equal(t, UInt4{5, 12, 21, 32}, UInt4{1, 2, 3, 4}.Mul(UInt4{5, 6, 7, 8}))
+}
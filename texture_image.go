@@ -0,0 +1,290 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// FloatColor represents a non-alpha-premultiplied color with 32-bit floating-point
+// components. Components are not limited to [0, 1], so it can hold high dynamic range values.
+type FloatColor struct {
+	R, G, B, A float32
+}
+
+// RGBA implements the color.Color interface. Components are clamped to [0, 1].
+func (c FloatColor) RGBA() (r, g, b, a uint32) {
+	a = unormQuantize(c.A, 0xffff)
+	r = unormQuantize(c.R, 0xffff) * a / 0xffff
+	g = unormQuantize(c.G, 0xffff) * a / 0xffff
+	b = unormQuantize(c.B, 0xffff) * a / 0xffff
+
+	return r, g, b, a
+}
+
+// FloatColorModel is the color model for FloatColor.
+var FloatColorModel = color.ModelFunc(floatColorModel)
+
+func floatColorModel(c color.Color) color.Color {
+	if _, ok := c.(FloatColor); ok {
+		return c
+	}
+
+	return toFloatColor(c)
+}
+
+// toFloatColor converts any color to a FloatColor, undoing the alpha premultiplication.
+func toFloatColor(c color.Color) FloatColor {
+	switch c := c.(type) {
+	case FloatColor:
+		return c
+	case color.NRGBA:
+		return FloatColor{float32(c.R) / 0xff, float32(c.G) / 0xff, float32(c.B) / 0xff, float32(c.A) / 0xff}
+	case color.NRGBA64:
+		return FloatColor{float32(c.R) / 0xffff, float32(c.G) / 0xffff, float32(c.B) / 0xffff, float32(c.A) / 0xffff}
+	}
+
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return FloatColor{}
+	}
+
+	fa := float32(a)
+
+	return FloatColor{float32(r) / fa, float32(g) / fa, float32(b) / fa, fa / 0xffff}
+}
+
+// TextureImage is an in-memory image whose pixels are stored in the layout
+// of an uncompressed PixelFormat, such as the bytes read with Texture.GetBytes
+// or uploaded with Texture.ReplaceRegion. It implements the image.Image and
+// draw.Image interfaces.
+//
+// Pixel values are exposed as they are stored, without conversion between sRGB
+// and linear space. Single-channel formats are exposed as gray levels, signed
+// normalized and integer formats are mapped linearly from their full range
+// to [0, 1] and floating-point formats use FloatColor. An image whose
+// PixelFormat is compressed or unknown, which only a literal can hold, reads as
+// transparent and ignores Set.
+type TextureImage struct {
+	// Pix holds the image's pixels in the layout of PixelFormat.
+	// The pixel at (x, y) starts at Pix[y*BytesPerRow + x*PixelFormat.BytesPerPixel()].
+	Pix []byte
+
+	// PixelFormat is the pixel format of the image's pixels.
+	PixelFormat PixelFormat
+
+	// Width is the width of the image in pixels.
+	Width int
+
+	// Height is the height of the image in pixels.
+	Height int
+
+	// BytesPerRow is the distance in bytes between the start of two consecutive rows.
+	BytesPerRow int
+
+	layout pixelLayout
+}
+
+// NewTextureImage returns a new TextureImage with tightly packed rows for the given pixel format and size.
+func NewTextureImage(pf PixelFormat, width, height int) (*TextureImage, error) {
+	bpp := pf.BytesPerPixel()
+	if bpp == 0 {
+		return nil, fmt.Errorf("pixel format %d is not an uncompressed pixel format", pf)
+	}
+
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+
+	return NewTextureImageFromBytes(make([]byte, width*height*bpp), pf, width, height, width*bpp)
+}
+
+// NewTextureImageFromBytes returns a TextureImage that wraps pix without copying it.
+// A bytesPerRow of 0 means the rows are tightly packed.
+func NewTextureImageFromBytes(pix []byte, pf PixelFormat, width, height, bytesPerRow int) (*TextureImage, error) {
+	l, ok := pixelLayouts[pf]
+	if !ok {
+		return nil, fmt.Errorf("pixel format %d is not an uncompressed pixel format", pf)
+	}
+
+	if bytesPerRow == 0 {
+		bytesPerRow = width * l.size
+	}
+
+	if width < 0 || height < 0 || bytesPerRow < width*l.size {
+		return nil, fmt.Errorf("invalid image size %dx%d with %d bytes per row", width, height, bytesPerRow)
+	}
+
+	if height > 0 && len(pix) < (height-1)*bytesPerRow+width*l.size {
+		return nil, fmt.Errorf("pixel data too short: got %d bytes", len(pix))
+	}
+
+	return &TextureImage{
+		Pix:         pix,
+		PixelFormat: pf,
+		Width:       width,
+		Height:      height,
+		BytesPerRow: bytesPerRow,
+		layout:      l,
+	}, nil
+}
+
+// ColorModel implements the image.Image interface.
+func (ti *TextureImage) ColorModel() color.Model {
+	l := ti.pixelLayout()
+
+	switch {
+	case l.typ == componentFloat:
+		return FloatColorModel
+	case l.bits == [4]int{0, 0, 0, 8}:
+		return color.AlphaModel
+	case l.gray && l.bits[0] <= 8:
+		return color.GrayModel
+	case l.gray:
+		return color.Gray16Model
+	case l.bits[0] <= 8 && l.bits[1] <= 8 && l.bits[2] <= 8 && l.bits[3] <= 8:
+		return color.NRGBAModel
+	}
+
+	return color.NRGBA64Model
+}
+
+// Bounds implements the image.Image interface.
+func (ti *TextureImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, ti.Width, ti.Height)
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to the pixel at (x, y).
+func (ti *TextureImage) PixOffset(x, y int) int {
+	return y*ti.BytesPerRow + x*ti.pixelLayout().size
+}
+
+// Region returns the region covering the whole image, for use with
+// Texture.ReplaceRegion and Texture.GetBytes.
+func (ti *TextureImage) Region() Region {
+	return RegionMake2D(0, 0, uint(ti.Width), uint(ti.Height))
+}
+
+// At implements the image.Image interface.
+func (ti *TextureImage) At(x, y int) color.Color {
+	l := ti.pixelLayout()
+	if l.decode == nil || !(image.Point{x, y}.In(ti.Bounds())) {
+		return ti.ColorModel().Convert(color.Transparent)
+	}
+
+	v := ti.normalize(l.decode(ti.Pix[ti.PixOffset(x, y):]))
+
+	switch ti.ColorModel() {
+	case FloatColorModel:
+		if l.gray {
+			return FloatColor{v[0], v[0], v[0], 1}
+		}
+
+		return FloatColor{v[0], v[1], v[2], v[3]}
+	case color.AlphaModel:
+		return color.Alpha{A: uint8(unormQuantize(v[3], 0xff))}
+	case color.GrayModel:
+		return color.Gray{Y: uint8(unormQuantize(v[0], 0xff))}
+	case color.Gray16Model:
+		return color.Gray16{Y: uint16(unormQuantize(v[0], 0xffff))}
+	case color.NRGBAModel:
+		return color.NRGBA{
+			R: uint8(unormQuantize(v[0], 0xff)),
+			G: uint8(unormQuantize(v[1], 0xff)),
+			B: uint8(unormQuantize(v[2], 0xff)),
+			A: uint8(unormQuantize(v[3], 0xff)),
+		}
+	}
+
+	return color.NRGBA64{
+		R: uint16(unormQuantize(v[0], 0xffff)),
+		G: uint16(unormQuantize(v[1], 0xffff)),
+		B: uint16(unormQuantize(v[2], 0xffff)),
+		A: uint16(unormQuantize(v[3], 0xffff)),
+	}
+}
+
+// Set implements the draw.Image interface. The color is converted with the
+// image's color model before it is encoded in the image's pixel format.
+func (ti *TextureImage) Set(x, y int, c color.Color) {
+	l := ti.pixelLayout()
+	if l.encode == nil || !(image.Point{x, y}.In(ti.Bounds())) {
+		return
+	}
+
+	var v [4]float32
+
+	switch c := ti.ColorModel().Convert(c).(type) {
+	case color.Alpha:
+		v = [4]float32{0, 0, 0, float32(c.A) / 0xff}
+	case color.Gray:
+		y := float32(c.Y) / 0xff
+		v = [4]float32{y, y, y, 1}
+	case color.Gray16:
+		y := float32(c.Y) / 0xffff
+		v = [4]float32{y, y, y, 1}
+	default:
+		f := toFloatColor(c)
+		v = [4]float32{f.R, f.G, f.B, f.A}
+	}
+
+	l.encode(ti.Pix[ti.PixOffset(x, y):], ti.denormalize(v))
+}
+
+// pixelLayout returns the layout of the image's pixel format. It also supports
+// TextureImage values that were not created with one of the constructors, whose
+// layout is looked up on every call so that concurrent readers never write to ti.
+func (ti *TextureImage) pixelLayout() pixelLayout {
+	if ti.layout.decode == nil {
+		return pixelLayouts[ti.PixelFormat]
+	}
+
+	return ti.layout
+}
+
+// normalize maps decoded shader values to the [0, 1] range of the image's color model.
+func (ti *TextureImage) normalize(v [4]float32) [4]float32 {
+	l := ti.pixelLayout()
+
+	for c, n := range l.bits {
+		if n == 0 {
+			continue
+		}
+
+		switch l.typ {
+		case componentSnorm:
+			v[c] = (v[c] + 1) / 2
+		case componentUint:
+			v[c] /= float32(uint64(1)<<n - 1)
+		case componentSint:
+			v[c] = (v[c] + float32(uint64(1)<<(n-1))) / float32(uint64(1)<<n-1)
+		}
+	}
+
+	return v
+}
+
+// denormalize is the inverse of normalize.
+func (ti *TextureImage) denormalize(v [4]float32) [4]float32 {
+	l := ti.pixelLayout()
+
+	for c, n := range l.bits {
+		if n == 0 {
+			continue
+		}
+
+		switch l.typ {
+		case componentSnorm:
+			v[c] = v[c]*2 - 1
+		case componentUint:
+			v[c] *= float32(uint64(1)<<n - 1)
+		case componentSint:
+			v[c] = v[c]*float32(uint64(1)<<n-1) - float32(uint64(1)<<(n-1))
+		}
+	}
+
+	return v
+}
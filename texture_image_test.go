@@ -0,0 +1,117 @@
+package mtl
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextureImage(t *testing.T) {
+	ti, err := NewTextureImage(PixelFormatBGRA8Unorm, 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, 8, ti.BytesPerRow)
+	require.Equal(t, color.NRGBAModel, ti.ColorModel())
+	require.Equal(t, RegionMake2D(0, 0, 2, 2), ti.Region())
+
+	ti.Set(1, 1, color.NRGBA{R: 1, G: 2, B: 3, A: 4})
+	require.Equal(t, []byte{3, 2, 1, 4}, ti.Pix[ti.PixOffset(1, 1):][:4])
+	require.Equal(t, color.NRGBA{R: 1, G: 2, B: 3, A: 4}, ti.At(1, 1))
+	require.Equal(t, color.NRGBA{}, ti.At(2, 2))
+
+	_, err = NewTextureImage(PixelFormatBC1RGBA, 4, 4)
+	require.Error(t, err)
+
+	_, err = NewTextureImageFromBytes(make([]byte, 15), PixelFormatRGBA8Unorm, 2, 2, 0)
+	require.Error(t, err)
+}
+
+func TestTextureImagePaddedRows(t *testing.T) {
+	pix := make([]byte, 2*8)
+	ti, err := NewTextureImageFromBytes(pix, PixelFormatR16Unorm, 3, 2, 8)
+	require.NoError(t, err)
+	require.Equal(t, color.Gray16Model, ti.ColorModel())
+
+	ti.Set(2, 1, color.Gray16{Y: 0x1234})
+	require.Equal(t, []byte{0x34, 0x12}, pix[12:14])
+	require.Equal(t, color.Gray16{Y: 0x1234}, ti.At(2, 1))
+}
+
+func TestTextureImageLiteral(t *testing.T) {
+	// A TextureImage that was not created by a constructor can be read concurrently.
+	ti := &TextureImage{Pix: []byte{1, 2, 3, 4}, PixelFormat: PixelFormatRGBA8Unorm, Width: 1, Height: 1, BytesPerRow: 4}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_ = ti.At(0, 0)
+		}()
+	}
+
+	wg.Wait()
+
+	require.Equal(t, color.NRGBA{1, 2, 3, 4}, ti.At(0, 0))
+
+	// Compressed pixel formats have no per-pixel layout.
+	ti = &TextureImage{Pix: make([]byte, 8), PixelFormat: PixelFormatBC1RGBA, Width: 4, Height: 4, BytesPerRow: 8}
+	ti.Set(0, 0, color.White)
+	require.Equal(t, make([]byte, 8), ti.Pix)
+	require.Equal(t, color.NRGBA{}, ti.At(0, 0))
+}
+
+func TestTextureImageDraw(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{R: 255, G: 128, B: 0, A: 255}}, image.Point{}, draw.Src)
+
+	for _, pf := range []PixelFormat{
+		PixelFormatRGBA8Unorm, PixelFormatRGBA16Float, PixelFormatRGB10A2Unorm, PixelFormatRGBA32Float,
+		PixelFormatRGBA16Unorm, PixelFormatRGBA8Snorm, PixelFormatRG11B10Float,
+	} {
+		ti, err := NewTextureImage(pf, 4, 4)
+		require.NoError(t, err)
+
+		draw.Draw(ti, ti.Bounds(), src, image.Point{}, draw.Src)
+
+		r, g, b, a := ti.At(3, 3).RGBA()
+		require.InDelta(t, 0xffff, r, 0x200, "pixel format %d", pf)
+		require.InDelta(t, 0x8080, g, 0x200, "pixel format %d", pf)
+		require.InDelta(t, 0, b, 0x200, "pixel format %d", pf)
+		require.InDelta(t, 0xffff, a, 0x200, "pixel format %d", pf)
+	}
+}
+
+func TestTextureImagePNG(t *testing.T) {
+	ti, err := NewTextureImage(PixelFormatRGBA16Float, 3, 1)
+	require.NoError(t, err)
+
+	ti.Set(0, 0, FloatColor{R: 2, G: 0.5, B: 0, A: 1})
+	ti.Set(1, 0, FloatColor{R: 0, G: 0, B: 1, A: 0.5})
+	require.Equal(t, FloatColor{R: 2, G: 0.5, B: 0, A: 1}, ti.At(0, 0))
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, ti))
+
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, color.NRGBA64{R: 0xffff, G: 0x8000, B: 0, A: 0xffff}, img.At(0, 0))
+	require.Equal(t, color.NRGBA64{R: 0, G: 0, B: 0xffff, A: 0x8000}, img.At(1, 0))
+}
+
+func TestFloatColorModel(t *testing.T) {
+	c := FloatColorModel.Convert(color.NRGBA{R: 255, A: 128})
+	require.Equal(t, FloatColor{R: 1, A: 128.0 / 255}, c)
+
+	r, _, _, a := FloatColor{R: 1, A: 0.5}.RGBA()
+	require.Equal(t, uint32(0x8000), r)
+	require.Equal(t, uint32(0x8000), a)
+}
@@ -0,0 +1,92 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+// TextureLevel holds the pixel data of one mipmap level of a texture, as stored
+// by the texture container formats and uploaded with Texture.ReplaceLevels.
+type TextureLevel struct {
+	// Width, Height and Depth are the dimensions of the level in pixels.
+	Width, Height, Depth int
+
+	// BytesPerRow is the distance in bytes between the start of two consecutive
+	// rows of pixels, or rows of blocks for compressed pixel formats.
+	BytesPerRow int
+
+	// BytesPerImage is the distance in bytes between the start of two consecutive
+	// images of a 3D texture.
+	BytesPerImage int
+
+	// Slices holds the pixel data of every slice of the level. Array elements come
+	// first, so the faces of the cube at array index i are the slices 6*i to 6*i+5.
+	// Each slice holds Depth images.
+	Slices [][]byte
+}
+
+// newTextureLevel returns a level of zeroed, tightly packed pixel data in the pixel
+// format pf for the given number of slices.
+func newTextureLevel(pf PixelFormat, width, height, depth, slices int) TextureLevel {
+	bytesPerRow, rows := pf.imageSize(width, height)
+
+	l := TextureLevel{
+		Width:         width,
+		Height:        height,
+		Depth:         depth,
+		BytesPerRow:   bytesPerRow,
+		BytesPerImage: bytesPerRow * rows,
+		Slices:        make([][]byte, slices),
+	}
+
+	for i := range l.Slices {
+		l.Slices[i] = make([]byte, l.BytesPerImage*depth)
+	}
+
+	return l
+}
+
+// levelsTextureDescriptor returns a descriptor for a texture as described by the
+// header of a texture container. A height of 0 denotes a 1D texture, a depth of 0
+// a texture that is not 3D and an array length of 0 a texture that is not an array.
+func levelsTextureDescriptor(pf PixelFormat, width, height, depth, arrayLength, faceCount, levelCount int) TextureDescriptor {
+	td := TextureDescriptor{
+		TextureType:      TextureType2D,
+		PixelFormat:      pf,
+		Width:            uint(width),
+		Height:           uint(height),
+		Depth:            uint(depth),
+		MipmapLevelCount: uint(levelCount),
+		ArrayLength:      uint(arrayLength),
+		StorageMode:      StorageModeShared,
+	}
+
+	switch {
+	case faceCount == 6 && arrayLength > 0:
+		td.TextureType = TextureTypeCubeArray
+	case faceCount == 6:
+		td.TextureType = TextureTypeCube
+	case depth > 0:
+		td.TextureType = TextureType3D
+	case height == 0 && arrayLength > 0:
+		td.TextureType = TextureType1DArray
+	case height == 0:
+		td.TextureType = TextureType1D
+	case arrayLength > 0:
+		td.TextureType = TextureType2DArray
+	}
+
+	// Metal requires a height of 1 for 1D textures.
+	if height == 0 {
+		td.Height = 1
+	}
+
+	return td
+}
+
+// mipmapSize returns the size of a dimension at the given mipmap level.
+func mipmapSize(size, level int) int {
+	if size >>= level; size < 1 {
+		return 1
+	}
+
+	return size
+}
@@ -0,0 +1,34 @@
+package mtl
+
+import "reflect"
+
+// newTestTexture returns a texture container, such as a KTXTexture, with a single
+// face and the given number of mipmap levels and slices. The levels are filled
+// with a pattern that differs between levels and slices.
+func newTestTexture[T any](pf PixelFormat, width, height, depth, levels, slices int) *T {
+	t := new(T)
+
+	v := reflect.ValueOf(t).Elem()
+	v.FieldByName("PixelFormat").Set(reflect.ValueOf(pf))
+	v.FieldByName("Width").SetInt(int64(width))
+	v.FieldByName("Height").SetInt(int64(height))
+	v.FieldByName("Depth").SetInt(int64(depth))
+	v.FieldByName("FaceCount").SetInt(1)
+
+	var ls []TextureLevel
+
+	for i := 0; i < levels; i++ {
+		l := newTextureLevel(pf, mipmapSize(width, i), mipmapSize(height, i), mipmapSize(depth, i), slices)
+		for s := range l.Slices {
+			for j := range l.Slices[s] {
+				l.Slices[s][j] = byte(i*50 + s*7 + j)
+			}
+		}
+
+		ls = append(ls, l)
+	}
+
+	v.FieldByName("Levels").Set(reflect.ValueOf(ls))
+
+	return t
+}
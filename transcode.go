@@ -0,0 +1,336 @@
+//go:build darwin
+// +build darwin
+
+package mtl
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Rounding selects how values are rounded to the precision of the destination pixel format.
+type Rounding uint8
+
+const (
+	// RoundingNearest rounds to the nearest representable value.
+	RoundingNearest Rounding = 0
+
+	// RoundingTruncate rounds toward zero.
+	RoundingTruncate Rounding = 1
+)
+
+// Dither selects the dithering applied when values are quantized to the destination pixel format.
+type Dither uint8
+
+const (
+	// DitherNone disables dithering. Values are rounded according to TranscodeOptions.Rounding.
+	DitherNone Dither = 0
+
+	// DitherOrdered adds a position-dependent threshold from an 8x8 Bayer matrix before quantizing.
+	DitherOrdered Dither = 1
+
+	// DitherFloydSteinberg diffuses the quantization error to neighboring pixels.
+	// Error diffusion depends on the previous rows, so the rows are processed serially.
+	DitherFloydSteinberg Dither = 2
+)
+
+// TranscodeOptions configures Transcode.
+type TranscodeOptions struct {
+	// Rounding selects how values are rounded when no dithering is applied.
+	Rounding Rounding
+
+	// Dither selects the dithering applied when quantizing to normalized, integer and
+	// extended range pixel formats.
+	Dither Dither
+
+	// Swizzle selects the source channel, or a constant, for every destination channel.
+	Swizzle TextureSwizzleChannels
+
+	// Parallelism is the maximum number of goroutines that convert rows concurrently.
+	// A value of 0 uses runtime.GOMAXPROCS.
+	Parallelism int
+}
+
+// bayer8x8 holds the threshold indices of an 8x8 ordered dithering matrix.
+var bayer8x8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Transcode converts width*height pixels from src in srcFormat to dst in dstFormat.
+// Both pixel formats must be uncompressed. A bytesPerRow of 0 means the rows are
+// tightly packed.
+//
+// Colors are converted to linear space when they are read from an sRGB pixel
+// format and encoded again when they are written to one; alpha is never converted.
+// Normalized values are clamped to the range of the destination pixel format, while
+// integer values are transferred unnormalized. Missing source channels read as 0,
+// and alpha as 1, unless the swizzle fills them otherwise.
+func Transcode(dst []byte, dstFormat PixelFormat, dstBytesPerRow int, src []byte, srcFormat PixelFormat, srcBytesPerRow int, width, height int, optFns ...func(*TranscodeOptions)) error {
+	opts := TranscodeOptions{
+		Rounding:    RoundingNearest,
+		Dither:      DitherNone,
+		Swizzle:     TextureSwizzleChannelsDefault,
+		Parallelism: 0,
+	}
+
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	sl, ok := pixelLayouts[srcFormat]
+	if !ok {
+		return fmt.Errorf("source pixel format %d is not an uncompressed pixel format", srcFormat)
+	}
+
+	dl, ok := pixelLayouts[dstFormat]
+	if !ok {
+		return fmt.Errorf("destination pixel format %d is not an uncompressed pixel format", dstFormat)
+	}
+
+	if width < 0 || height < 0 {
+		return fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+
+	if srcBytesPerRow == 0 {
+		srcBytesPerRow = width * sl.size
+	}
+
+	if dstBytesPerRow == 0 {
+		dstBytesPerRow = width * dl.size
+	}
+
+	if err := checkRows(src, "source", width, height, sl.size, srcBytesPerRow); err != nil {
+		return err
+	}
+
+	if err := checkRows(dst, "destination", width, height, dl.size, dstBytesPerRow); err != nil {
+		return err
+	}
+
+	swizzle := [4]TextureSwizzle{opts.Swizzle.Red, opts.Swizzle.Green, opts.Swizzle.Blue, opts.Swizzle.Alpha}
+	for _, s := range swizzle {
+		if s > TextureSwizzleAlpha {
+			return fmt.Errorf("invalid texture swizzle %d", s)
+		}
+	}
+
+	if width == 0 || height == 0 {
+		return nil
+	}
+
+	// Identical formats without a swizzle only need their rows copied.
+	if srcFormat == dstFormat && opts.Swizzle == TextureSwizzleChannelsDefault {
+		for y := 0; y < height; y++ {
+			copy(dst[y*dstBytesPerRow:][:width*dl.size], src[y*srcBytesPerRow:])
+		}
+
+		return nil
+	}
+
+	t := transcoder{
+		src:      sl,
+		dst:      dl,
+		swizzle:  swizzle,
+		rounding: opts.Rounding,
+		dither:   opts.Dither,
+	}
+
+	// Floating-point and depth/stencil channels are encoded without quantization,
+	// unless they store fixed-point values.
+	_, hasDepth, hasStencil := depthStencilBytesPerPixel(dstFormat)
+	if (dl.typ != componentFloat || dl.fixedScale != 0) && !hasDepth && !hasStencil {
+		for c := range t.scale {
+			if step := dl.step(c); step != 0 {
+				t.scale[c] = math.Round(1 / float64(step))
+			}
+		}
+	}
+
+	convert := func(y0, y1 int) {
+		var errs [2][][4]float32
+		if t.dither == DitherFloydSteinberg {
+			errs = [2][][4]float32{make([][4]float32, width+2), make([][4]float32, width+2)}
+		}
+
+		for y := y0; y < y1; y++ {
+			s := src[y*srcBytesPerRow:]
+			d := dst[y*dstBytesPerRow:]
+
+			for x := 0; x < width; x++ {
+				v := t.quantize(t.convert(sl.decode(s[x*sl.size:])), x, y, errs)
+				dl.encode(d[x*dl.size:], v)
+			}
+
+			if errs[0] != nil {
+				errs[0], errs[1] = errs[1], errs[0]
+				for i := range errs[1] {
+					errs[1][i] = [4]float32{}
+				}
+			}
+		}
+	}
+
+	workers := opts.Parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if workers > height {
+		workers = height
+	}
+
+	if workers <= 1 || t.dither == DitherFloydSteinberg {
+		convert(0, height)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+
+	rows := (height + workers - 1) / workers
+	for y := 0; y < height; y += rows {
+		y1 := y + rows
+		if y1 > height {
+			y1 = height
+		}
+
+		wg.Add(1)
+
+		go func(y0, y1 int) {
+			defer wg.Done()
+			convert(y0, y1)
+		}(y, y1)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// checkRows verifies that data holds height rows of width pixels of size bytes.
+func checkRows(data []byte, name string, width, height, size, bytesPerRow int) error {
+	if bytesPerRow < width*size {
+		return fmt.Errorf("%s bytes per row %d too small for %d pixels", name, bytesPerRow, width)
+	}
+
+	if height > 0 && len(data) < (height-1)*bytesPerRow+width*size {
+		return fmt.Errorf("%s pixel data too short: got %d bytes", name, len(data))
+	}
+
+	return nil
+}
+
+// transcoder holds the per-pixel state of a Transcode call.
+type transcoder struct {
+	src, dst pixelLayout
+	swizzle  [4]TextureSwizzle
+	rounding Rounding
+	dither   Dither
+
+	// scale is the number of quantization steps per unit of every destination
+	// channel, or 0 for channels that are encoded as is.
+	scale [4]float64
+}
+
+// convert linearizes, swizzles and re-encodes a decoded source pixel in the color space of the destination.
+func (t *transcoder) convert(v [4]float32) [4]float32 {
+	if t.src.srgb {
+		for c := 0; c < 3; c++ {
+			v[c] = float32(SRGBToLinear(float64(v[c])))
+		}
+	}
+
+	var w [4]float32
+
+	for c, s := range t.swizzle {
+		switch s {
+		case TextureSwizzleZero:
+			w[c] = 0
+		case TextureSwizzleOne:
+			w[c] = 1
+		default:
+			w[c] = v[s-TextureSwizzleRed]
+		}
+	}
+
+	if t.dst.srgb {
+		for c := 0; c < 3; c++ {
+			w[c] = float32(LinearToSRGB(clamp(float64(w[c]), 0, 1)))
+		}
+	}
+
+	return w
+}
+
+// quantize rounds v to the destination precision at pixel (x, y). For error
+// diffusion, errs holds the accumulated errors of the current and the next row,
+// offset by one pixel.
+func (t *transcoder) quantize(v [4]float32, x, y int, errs [2][][4]float32) [4]float32 {
+	for c, scale := range t.scale {
+		if scale == 0 {
+			continue
+		}
+
+		lo, hi := t.rangeOf(c)
+		f := clamp(float64(v[c])*scale, lo, hi)
+
+		var q float64
+
+		switch t.dither {
+		case DitherOrdered:
+			q = math.Floor(f + (float64(bayer8x8[y&7][x&7])+0.5)/64)
+		case DitherFloydSteinberg:
+			f += float64(errs[0][x+1][c])
+			q = clamp(math.Round(f), lo, hi)
+
+			e := float32(f - q)
+			errs[0][x+2][c] += e * 7 / 16
+			errs[1][x][c] += e * 3 / 16
+			errs[1][x+1][c] += e * 5 / 16
+			errs[1][x+2][c] += e * 1 / 16
+		default:
+			if t.rounding == RoundingTruncate {
+				q = math.Trunc(f)
+			} else {
+				q = math.RoundToEven(f)
+			}
+		}
+
+		v[c] = float32(clamp(q, lo, hi) / scale)
+	}
+
+	// Floating-point channels are not dithered, so they are truncated regardless.
+	if t.rounding == RoundingTruncate && t.dst.truncate != nil {
+		v = t.dst.truncate(v)
+	}
+
+	return v
+}
+
+// rangeOf returns the range of channel c of the destination in quantization steps.
+func (t *transcoder) rangeOf(c int) (lo, hi float64) {
+	n := t.dst.bits[c]
+
+	if t.dst.fixedScale != 0 {
+		return float64(-t.dst.fixedBias), float64(uint64(1)<<n - 1 - uint64(t.dst.fixedBias))
+	}
+
+	switch t.dst.typ {
+	case componentSnorm:
+		m := float64(int64(1)<<(n-1) - 1)
+		return -m, m
+	case componentSint:
+		m := float64(int64(1) << (n - 1))
+		return -m, m - 1
+	}
+
+	return 0, float64(uint64(1)<<n - 1)
+}
@@ -0,0 +1,220 @@
+package mtl
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscode(t *testing.T) {
+	src := []byte{10, 20, 30, 40, 50, 60, 70, 80}
+	dst := make([]byte, 8)
+
+	require.NoError(t, Transcode(dst, PixelFormatRGBA8Unorm, 0, src, PixelFormatBGRA8Unorm, 0, 2, 1))
+	require.Equal(t, []byte{30, 20, 10, 40, 70, 60, 50, 80}, dst)
+
+	// Identical formats are copied row by row.
+	padded := make([]byte, 2*12)
+	require.NoError(t, Transcode(padded, PixelFormatRGBA8Unorm, 12, append(src, src...), PixelFormatRGBA8Unorm, 8, 2, 2))
+	require.Equal(t, src, padded[12:20])
+	require.Equal(t, []byte{0, 0, 0, 0}, padded[8:12])
+
+	err := Transcode(dst, PixelFormatBC1RGBA, 0, src, PixelFormatRGBA8Unorm, 0, 2, 1)
+	require.Error(t, err)
+
+	err = Transcode(dst[:7], PixelFormatRGBA8Unorm, 0, src, PixelFormatRGBA8Unorm, 0, 2, 1)
+	require.Error(t, err)
+}
+
+func TestTranscodeSRGB(t *testing.T) {
+	src := make([]byte, 256*8)
+	for i := 0; i < 256; i++ {
+		// Linear values of every 8-bit sRGB code, with alpha 0.5.
+		l := float32ToHalf(SRGB8ToLinear(uint8(i)))
+		src[i*8], src[i*8+1] = byte(l), byte(l>>8)
+		src[i*8+6], src[i*8+7] = 0x00, 0x38
+	}
+
+	dst := make([]byte, 256*4)
+	require.NoError(t, Transcode(dst, PixelFormatRGBA8UnormSRGB, 0, src, PixelFormatRGBA16Float, 0, 256, 1))
+
+	for i := 0; i < 256; i++ {
+		require.Equal(t, uint8(i), dst[i*4], "code %d", i)
+		require.Equal(t, uint8(128), dst[i*4+3])
+	}
+
+	// Converting back and forth between sRGB formats is lossless.
+	back := make([]byte, 256*4)
+	require.NoError(t, Transcode(back, PixelFormatBGRA8UnormSRGB, 0, dst, PixelFormatRGBA8UnormSRGB, 0, 256, 1))
+
+	for i := 0; i < 256; i++ {
+		require.Equal(t, uint8(i), back[i*4+2], "code %d", i)
+	}
+}
+
+func TestTranscodeSwizzle(t *testing.T) {
+	dst := make([]byte, 4)
+
+	require.NoError(t, Transcode(dst, PixelFormatRGBA8Unorm, 0, []byte{200}, PixelFormatR8Unorm, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Swizzle = TextureSwizzleChannels{
+			Red:   TextureSwizzleRed,
+			Green: TextureSwizzleRed,
+			Blue:  TextureSwizzleRed,
+			Alpha: TextureSwizzleOne,
+		}
+	}))
+	require.Equal(t, []byte{200, 200, 200, 255}, dst)
+
+	// Missing channels read as 0 and alpha as 1.
+	require.NoError(t, Transcode(dst, PixelFormatRGBA8Unorm, 0, []byte{200}, PixelFormatR8Unorm, 0, 1, 1))
+	require.Equal(t, []byte{200, 0, 0, 255}, dst)
+
+	err := Transcode(dst, PixelFormatRGBA8Unorm, 0, []byte{200}, PixelFormatR8Unorm, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Swizzle.Red = 6
+	})
+	require.Error(t, err)
+}
+
+func TestTranscodeRounding(t *testing.T) {
+	// 0.7 of a 2-bit alpha step, so nearest rounds up and truncation down.
+	src := make([]byte, 16)
+	encodeComponent(src[12:], componentFloat, 32, 0.7/3)
+
+	dst := make([]byte, 4)
+	require.NoError(t, Transcode(dst, PixelFormatRGB10A2Unorm, 0, src, PixelFormatRGBA32Float, 0, 1, 1))
+	require.Equal(t, byte(1), dst[3]>>6)
+
+	require.NoError(t, Transcode(dst, PixelFormatRGB10A2Unorm, 0, src, PixelFormatRGBA32Float, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Rounding = RoundingTruncate
+	}))
+	require.Equal(t, byte(0), dst[3]>>6)
+
+	// 0.7 of the spacing of the floating-point values above 1, whose mantissa has
+	// 10 bits for half floats, 6 and 5 bits for RG11B10 and 8 bits below the
+	// shared exponent of RGB9E5.
+	for _, tc := range []struct {
+		pf  PixelFormat
+		ulp [3]float64
+	}{
+		{PixelFormatRGBA16Float, [3]float64{1.0 / 1024, 1.0 / 1024, 1.0 / 1024}},
+		{PixelFormatRG11B10Float, [3]float64{1.0 / 64, 1.0 / 64, 1.0 / 32}},
+		{PixelFormatRGB9E5Float, [3]float64{1.0 / 256, 1.0 / 256, 1.0 / 256}},
+	} {
+		for c, ulp := range tc.ulp {
+			encodeComponent(src[c*4:], componentFloat, 32, float32(1+0.7*ulp))
+		}
+
+		l := pixelLayouts[tc.pf]
+		dst := make([]byte, l.size)
+
+		require.NoError(t, Transcode(dst, tc.pf, 0, src, PixelFormatRGBA32Float, 0, 1, 1))
+		for c, ulp := range tc.ulp {
+			require.Equal(t, float32(1+ulp), l.decode(dst)[c], "pixel format %d", tc.pf)
+		}
+
+		require.NoError(t, Transcode(dst, tc.pf, 0, src, PixelFormatRGBA32Float, 0, 1, 1, func(o *TranscodeOptions) {
+			o.Rounding = RoundingTruncate
+		}))
+		for c := range tc.ulp {
+			require.Equal(t, float32(1), l.decode(dst)[c], "pixel format %d", tc.pf)
+		}
+	}
+
+	// Negative half floats are truncated toward zero, and values too large for
+	// them become the largest finite value.
+	encodeComponent(src, componentFloat, 32, float32(-1-0.7/1024))
+	encodeComponent(src[4:], componentFloat, 32, 1e6)
+
+	half := make([]byte, 8)
+	require.NoError(t, Transcode(half, PixelFormatRGBA16Float, 0, src, PixelFormatRGBA32Float, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Rounding = RoundingTruncate
+	}))
+	require.Equal(t, float32(-1), halfToFloat32(binary.LittleEndian.Uint16(half)))
+	require.Equal(t, float32(65504), halfToFloat32(binary.LittleEndian.Uint16(half[2:])))
+
+	// The extended range formats are quantized in steps of 1/510.
+	encodeComponent(src, componentFloat, 32, 0.7/510)
+	encodeComponent(src[4:], componentFloat, 32, -0.7/510)
+	encodeComponent(src[8:], componentFloat, 32, 0)
+
+	xr := pixelLayouts[PixelFormatBGR10XR]
+	require.NoError(t, Transcode(dst, PixelFormatBGR10XR, 0, src, PixelFormatRGBA32Float, 0, 1, 1))
+	require.Equal(t, [4]float32{1.0 / 510, -1.0 / 510, 0, 1}, xr.decode(dst))
+
+	require.NoError(t, Transcode(dst, PixelFormatBGR10XR, 0, src, PixelFormatRGBA32Float, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Rounding = RoundingTruncate
+	}))
+	require.Equal(t, [4]float32{0, 0, 0, 1}, xr.decode(dst))
+
+	require.NoError(t, Transcode(src, PixelFormatRGBA32Float, 0, dst, PixelFormatRGB10A2Unorm, 0, 1, 1, func(o *TranscodeOptions) {
+		o.Rounding = RoundingTruncate
+	}))
+}
+
+func TestTranscodeDither(t *testing.T) {
+	const size = 64
+
+	// A constant value halfway between two 8-bit codes.
+	src := make([]byte, size*size*4)
+	for i := 0; i < size*size; i++ {
+		encodeComponent(src[i*4:], componentFloat, 32, 100.5/255)
+	}
+
+	for _, dither := range []Dither{DitherOrdered, DitherFloydSteinberg} {
+		dst := make([]byte, size*size)
+		require.NoError(t, Transcode(dst, PixelFormatR8Unorm, 0, src, PixelFormatR32Float, 0, size, size, func(o *TranscodeOptions) {
+			o.Dither = dither
+			o.Parallelism = 4
+		}))
+
+		sum := 0
+		for _, v := range dst {
+			require.Contains(t, []byte{100, 101}, v)
+			sum += int(v)
+		}
+
+		require.InDelta(t, 100.5, float64(sum)/(size*size), 0.01, "dither %d", dither)
+	}
+
+	// The extended range formats are dithered in steps of 1/510.
+	for i := 0; i < size*size; i++ {
+		encodeComponent(src[i*4:], componentFloat, 32, 100.5/510)
+	}
+
+	dst := make([]byte, size*size*4)
+	require.NoError(t, Transcode(dst, PixelFormatBGR10XR, 0, src, PixelFormatR32Float, 0, size, size, func(o *TranscodeOptions) {
+		o.Dither = DitherOrdered
+	}))
+
+	xr := pixelLayouts[PixelFormatBGR10XR]
+	sum := float64(0)
+
+	for i := 0; i < size*size; i++ {
+		sum += float64(xr.decode(dst[i*4:])[0]) * 510
+	}
+
+	require.InDelta(t, 100.5, sum/(size*size), 0.01)
+}
+
+func TestTranscodeParallel(t *testing.T) {
+	const width, height = 33, 17
+
+	src := make([]byte, width*height*8)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+
+	serial := make([]byte, width*height*4)
+	require.NoError(t, Transcode(serial, PixelFormatRGBA8Unorm, 0, src, PixelFormatRGBA16Unorm, 0, width, height, func(o *TranscodeOptions) {
+		o.Parallelism = 1
+		o.Dither = DitherOrdered
+	}))
+
+	parallel := make([]byte, width*height*4)
+	require.NoError(t, Transcode(parallel, PixelFormatRGBA8Unorm, 0, src, PixelFormatRGBA16Unorm, 0, width, height, func(o *TranscodeOptions) {
+		o.Parallelism = 5
+		o.Dither = DitherOrdered
+	}))
+	require.Equal(t, serial, parallel)
+}